@@ -2,70 +2,260 @@ package main
 
 import (
 	"context"
-	"log"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"net/http"
-	"path/filepath"
+	"os"
+	"os/signal"
+	"syscall"
 	"text/template"
+	"time"
 
-	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
-	"github.com/go-chi/render"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"mikrotik_provisioning/internal/app"
 	"mikrotik_provisioning/internal/config"
-	mux "mikrotik_provisioning/internal/pkg/http"
-	mw "mikrotik_provisioning/internal/pkg/http/middleware"
+	"mikrotik_provisioning/internal/pkg/apikey"
+	"mikrotik_provisioning/internal/pkg/audit"
+	"mikrotik_provisioning/internal/pkg/clientcert"
+	"mikrotik_provisioning/internal/pkg/health"
+	"mikrotik_provisioning/internal/pkg/http/router"
+	"mikrotik_provisioning/internal/pkg/logging"
+	"mikrotik_provisioning/internal/pkg/metrics"
+	"mikrotik_provisioning/internal/pkg/oidc"
 	"mikrotik_provisioning/internal/pkg/repository/mongo"
+	"mikrotik_provisioning/internal/pkg/signing"
+	tmpl "mikrotik_provisioning/internal/pkg/templates"
+	"mikrotik_provisioning/internal/pkg/watch"
+	"mikrotik_provisioning/internal/pkg/webhook"
+)
+
+const (
+	defaultListen          = ":3333"
+	defaultShutdownTimeout = 30 * time.Second
+	expiryInterval         = time.Minute
 )
 
 func main() {
 	config, err := config.ParseConfig()
 	if err != nil {
-		log.Fatalf("failed to parse config file with error: %q\n", err)
+		logging.Default().Fatal("failed to parse config file", "error", err)
 	}
 
-	templateFiles, err := filepath.Glob("templates/*")
+	logger, err := newLogger(config.Log)
 	if err != nil {
-		log.Fatalf("failed to get template filenames with glob with error: %q\n", err)
+		logging.Default().Fatal("failed to initialize logger", "error", err)
 	}
+	logging.SetDefault(logger)
 
-	templates := new(template.Template)
-	templates, err = templates.Delims("#(", ")#").ParseFiles(templateFiles...)
+	baseTemplate := new(template.Template)
+	templates, err := tmpl.ParseDir(baseTemplate.Delims("#(", ")#"), "templates")
 	if err != nil {
-		log.Fatalf("failed to parse template files with error: %q\n", err)
+		logger.Fatal("failed to parse template files", "error", err)
 	}
 
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	mongoStore, err := mongo.NewMongoStorage(ctx, config.DB)
 	if err != nil {
-		log.Fatalf("failed to initialize MongoStore with error: %q\n", err)
-	}
-
-	service := app.NewMikrotikProvisioningService(mongoStore)
-	mw := mw.NewMiddleware(service, config.Access)
-	handler := mux.NewAddressListHandler(service, templates)
-
-	r := chi.NewRouter()
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.AllowContentType("application/json"))
-	r.Use(mw.CheckAcceptHeader("*/*", "application/json", "text/plain"))
-	r.Use(render.SetContentType(render.ContentTypeJSON))
-
-	r.Route("/address-list", func(r chi.Router) {
-		r.Get("/", handler.GetAddressLists)                                                            // GET /address-list
-		r.With(mw.EnsureAuth).With(mw.EnsureAddressListNotExists).Post("/", handler.CreateAddressList) // POST /address-list
-
-		r.Route("/{addressListName:[A-Za-z0-9-]+}", func(r chi.Router) {
-			r.With(mw.EnsureAddressListExists).Get("/", handler.GetAddressList)                           // GET /address-list/whats-up
-			r.With(mw.EnsureAuth).With(mw.EnsureAddressListExists).Put("/", handler.UpdateAddressList)    // PUT /address-list/whats-up
-			r.With(mw.EnsureAuth).With(mw.EnsureAddressListExists).Patch("/", handler.PatchAddressList)   // PATCH /address-list/whats-up
-			r.With(mw.EnsureAuth).With(mw.EnsureAddressListExists).Delete("/", handler.DeleteAddressList) // DELETE /address-list/whats-up
-		})
+		logger.Fatal("failed to initialize MongoStore", "error", err)
+	}
+	var backend app.Storage = mongoStore
+	if config.Access.KeyEncryptionKeyFile != "" {
+		sealer, err := apikey.NewSealerFromFile(config.Access.KeyEncryptionKeyFile)
+		if err != nil {
+			logger.Fatal("failed to read key encryption key", "error", err)
+		}
+		backend = app.NewSealingStorage(mongoStore, sealer)
+	}
+	storage := app.NewInstrumentedStorage(backend)
+	prometheus.MustRegister(metrics.NewAddressListCollector(storage))
+
+	var signer signing.Signer
+	if config.Signing != nil {
+		signer, err = signing.NewSigner(config.Signing)
+		if err != nil {
+			logger.Fatal("failed to initialize script signer", "error", err)
+		}
+	}
+
+	var verifier *oidc.Verifier
+	if config.Access.OIDC != nil {
+		verifier, err = oidc.NewVerifier(config.Access.OIDC)
+		if err != nil {
+			logger.Fatal("failed to initialize bearer token verifier", "error", err)
+		}
+	}
+
+	var certs *clientcert.Verifier
+	if tls := config.Application.TLS; tls != nil && tls.ClientCAFile != "" {
+		certs, err = clientcert.NewVerifier(tls.ClientCAFile, tls.CRLFile)
+		if err != nil {
+			logger.Fatal("failed to initialize client certificate verifier", "error", err)
+		}
+	}
+
+	auditSinks := make([]audit.Sink, 0)
+	var auditFile *audit.FileSink
+	if config.Audit != nil {
+		if config.Audit.Stdout {
+			auditSinks = append(auditSinks, audit.NewStdoutSink())
+		}
+		if config.Audit.File != nil {
+			auditFile, err = audit.NewFileSink(config.Audit.File.Path, config.Audit.File.MaxSize, config.Audit.File.MaxBackups)
+			if err != nil {
+				logger.Fatal("failed to initialize audit log file", "error", err)
+			}
+			auditSinks = append(auditSinks, auditFile)
+		}
+		if config.Audit.Storage {
+			auditSinks = append(auditSinks, audit.NewStorageSink(storage))
+		}
+	}
+
+	dispatcher := newWebhookDispatcher(storage, config.Webhooks)
+	dispatcher.Start()
+
+	broker := watch.NewBroker()
+	if config.Watch != nil && config.Watch.ChangeStreams {
+		go broker.Follow(ctx, mongoStore.WatchAddressLists)
+	}
+
+	service := app.NewMikrotikProvisioningService(storage, app.WithAuditSinks(auditSinks...), app.WithSubscribers(dispatcher, broker))
+	go service.ExpireEntries(ctx, expiryInterval)
+
+	readiness := health.New(health.DefaultTimeout)
+	readiness.Add("storage", storage)
+	readiness.Add("templates", health.CheckerFunc(func(ctx context.Context) error {
+		return templates.Require("GetAddressList", "GetAddressLists", "GetAddressListLoader", "GetDeviceBootstrap", "GetDeviceFetchScript", "ImportSigned")
+	}))
+	readiness.Add("webhooks", dispatcher)
+	if config.Watch != nil && config.Watch.ChangeStreams {
+		readiness.Add("change-streams", broker)
+	}
+
+	handler, err := router.New(&router.Options{
+		Config:     config,
+		Service:    service,
+		Templates:  templates,
+		Signer:     signer,
+		Verifier:   verifier,
+		Certs:      certs,
+		Dispatcher: dispatcher,
+		Broker:     broker,
+		Health:     readiness,
+		Logger:     logger,
 	})
+	if err != nil {
+		logger.Fatal("failed to initialize router", "error", err)
+	}
 
-	err = http.ListenAndServe(":3333", r)
+	server, err := newServer(config.Application, handler)
 	if err != nil {
-		log.Fatalf("failed to initialize http server with error: %q\n", err)
+		logger.Fatal("failed to initialize http server", "error", err)
 	}
+	server.RegisterOnShutdown(broker.Close)
+
+	go func() {
+		logger.Info("starting http server", "addr", server.Addr, "tls", config.Application.TLS != nil)
+
+		var err error
+		if config.Application.TLS != nil {
+			err = server.ListenAndServeTLS(config.Application.TLS.CertFile, config.Application.TLS.KeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logger.Fatal("failed to initialize http server", "error", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	// In-flight requests are drained first, as they may still use the workers and the storage.
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout(config.Application))
+	defer shutdownCancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to shut down http server", "error", err)
+	}
+
+	cancel()
+	dispatcher.Stop()
+
+	if auditFile != nil {
+		if err := auditFile.Close(); err != nil {
+			logger.Error("failed to close audit log file", "error", err)
+		}
+	}
+
+	if err := mongoStore.Close(shutdownCtx); err != nil {
+		logger.Error("failed to disconnect from MongoDB", "error", err)
+	}
+}
+
+func newServer(application *config.Application, handler http.Handler) (*http.Server, error) {
+	server := &http.Server{
+		Addr:         defaultListen,
+		Handler:      handler,
+		ReadTimeout:  application.ReadTimeout,
+		WriteTimeout: application.WriteTimeout,
+		IdleTimeout:  application.IdleTimeout,
+	}
+	if application.Listen != "" {
+		server.Addr = application.Listen
+	}
+
+	if application.TLS != nil && application.TLS.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(application.TLS.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", application.TLS.ClientCAFile)
+		}
+
+		server.TLSConfig = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.VerifyClientCertIfGiven}
+		if application.TLS.RequireClientCert {
+			server.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return server, nil
+}
+
+func shutdownTimeout(application *config.Application) time.Duration {
+	if application.ShutdownTimeout > 0 {
+		return application.ShutdownTimeout
+	}
+
+	return defaultShutdownTimeout
+}
+
+func newLogger(log *config.Log) (*logging.Logger, error) {
+	if log == nil {
+		log = new(config.Log)
+	}
+
+	level, err := logging.ParseLevel(log.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	return logging.New(os.Stderr, level, logging.Format(log.Format)), nil
+}
+
+func newWebhookDispatcher(store webhook.Store, webhooks *config.Webhooks) *webhook.Dispatcher {
+	if webhooks == nil {
+		webhooks = new(config.Webhooks)
+	}
+
+	return webhook.NewDispatcher(store, webhooks.MaxAttempts, webhooks.BaseDelay, webhooks.MaxDelay, webhooks.Workers)
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mikrotik_provisioning/internal/config"
+)
+
+func TestNewServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, newCertificate(t), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	if err := ioutil.WriteFile(invalidFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		application    *config.Application
+		wantAddr       string
+		wantClientAuth tls.ClientAuthType
+		wantTLS        bool
+		wantErr        bool
+	}{
+		{name: "defaults", application: &config.Application{}, wantAddr: defaultListen},
+		{name: "listen", application: &config.Application{Listen: "127.0.0.1:8443"}, wantAddr: "127.0.0.1:8443"},
+		{name: "tls without client ca", application: &config.Application{TLS: &config.TLS{}}, wantAddr: defaultListen},
+		{
+			name:           "client ca",
+			application:    &config.Application{TLS: &config.TLS{ClientCAFile: caFile}},
+			wantAddr:       defaultListen,
+			wantClientAuth: tls.VerifyClientCertIfGiven,
+			wantTLS:        true,
+		},
+		{
+			name:           "require client cert",
+			application:    &config.Application{TLS: &config.TLS{ClientCAFile: caFile, RequireClientCert: true}},
+			wantAddr:       defaultListen,
+			wantClientAuth: tls.RequireAndVerifyClientCert,
+			wantTLS:        true,
+		},
+		{name: "missing client ca", application: &config.Application{TLS: &config.TLS{ClientCAFile: filepath.Join(dir, "missing.pem")}}, wantErr: true},
+		{name: "invalid client ca", application: &config.Application{TLS: &config.TLS{ClientCAFile: invalidFile}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.application.ReadTimeout = 2 * time.Second
+			tt.application.WriteTimeout = 3 * time.Second
+			tt.application.IdleTimeout = 4 * time.Second
+
+			server, err := newServer(tt.application, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if server.Addr != tt.wantAddr {
+				t.Errorf("Addr = %s, want %s", server.Addr, tt.wantAddr)
+			}
+			if server.ReadTimeout != 2*time.Second || server.WriteTimeout != 3*time.Second || server.IdleTimeout != 4*time.Second {
+				t.Errorf("timeouts = %v, %v, %v, want 2s, 3s, 4s", server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+			}
+			if (server.TLSConfig != nil) != tt.wantTLS {
+				t.Fatalf("TLSConfig = %v, want TLS %v", server.TLSConfig, tt.wantTLS)
+			}
+			if tt.wantTLS && server.TLSConfig.ClientAuth != tt.wantClientAuth {
+				t.Errorf("ClientAuth = %v, want %v", server.TLSConfig.ClientAuth, tt.wantClientAuth)
+			}
+		})
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	if got := shutdownTimeout(&config.Application{}); got != defaultShutdownTimeout {
+		t.Errorf("shutdownTimeout() = %v, want %v", got, defaultShutdownTimeout)
+	}
+	if got := shutdownTimeout(&config.Application{ShutdownTimeout: time.Second}); got != time.Second {
+		t.Errorf("shutdownTimeout() = %v, want %v", got, time.Second)
+	}
+}
+
+// newCertificate returns a PEM encoded self-signed CA certificate.
+func newCertificate(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "mikrotik_provisioning test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
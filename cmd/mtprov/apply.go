@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"mikrotik_provisioning/pkg/client"
+)
+
+const defaultManagedBy = "mtprov"
+
+// runApply plans the changes which bring the service in line with a directory of list definitions, prints
+// the plan and applies it once confirmed. The reviewed plan is applied only if nothing changed meanwhile.
+func runApply(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e)
+	managedBy := flags.String("managed-by", defaultManagedBy, "owner of the lists, stored in their "+client.ManagedByLabel+" label")
+	prune := flags.Bool("prune", false, "delete lists of the owner which are not defined in the directory")
+	dryRun := flags.Bool("dry-run", false, "only print the plan, and exit with code 6 if it changes anything")
+	yes := flags.Bool("yes", false, "apply without asking for confirmation")
+	format := formatFlag(flags)
+	positional, err := parseFlags(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	f, err := format()
+	if err != nil {
+		return err
+	}
+
+	addressLists, err := readListDir(positional[0])
+	if err != nil {
+		return err
+	}
+
+	request := &client.ApplyRequest{ManagedBy: *managedBy, Prune: *prune, Lists: addressLists}
+	plan, err := e.client.Apply(ctx, request, true)
+	if err != nil {
+		return err
+	}
+
+	if f == jsonFormat {
+		if err := writeJSON(e.stdout, plan); err != nil {
+			return err
+		}
+	} else if err := writePlan(e, plan); err != nil {
+		return err
+	}
+
+	if !plan.Changes() {
+		return nil
+	}
+	if *dryRun {
+		return errDiffers
+	}
+
+	if !*yes {
+		confirmed, err := confirm(e, "Apply these changes?")
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			return fmt.Errorf("not applied")
+		}
+	}
+
+	request.Plan = plan.ID
+	applied, err := e.client.Apply(ctx, request, false)
+	if err != nil {
+		if client.IsConflict(err) {
+			return fmt.Errorf("%s; run apply again to review the new plan", err)
+		}
+		return err
+	}
+
+	if f == jsonFormat {
+		return writeJSON(e.stdout, applied)
+	}
+
+	fmt.Fprintf(e.stdout, "Applied plan %s.\n", applied.ID)
+	return nil
+}
+
+func writePlan(e *env, plan *client.Plan) error {
+	t := newTable(e.stdout)
+	for _, step := range plan.Steps {
+		switch step.Action {
+		case client.CreatePlanAction:
+			t.row("+", "create", step.List, fmt.Sprintf("%d entries", len(step.Added)))
+		case client.UpdatePlanAction:
+			details := fmt.Sprintf("+%d -%d ~%d entries", len(step.Added), len(step.Removed), len(step.Changed))
+			if step.Labels != nil {
+				details += ", labels " + formatLabels(step.Labels)
+			}
+			t.row("~", "update", step.List, details)
+		case client.DeletePlanAction:
+			t.row("-", "delete", step.List, fmt.Sprintf("%d entries", len(step.Removed)))
+		case client.SkipPlanAction:
+			t.row("!", "skip", step.List, step.Reason)
+		}
+	}
+	if err := t.flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stdout, "Plan %s: %d to change, %d unchanged.\n", plan.ID, countChanges(plan), plan.Unchanged)
+	return nil
+}
+
+func countChanges(plan *client.Plan) int {
+	n := 0
+	for _, step := range plan.Steps {
+		if step.Action != client.SkipPlanAction {
+			n++
+		}
+	}
+
+	return n
+}
+
+// confirm asks a yes or no question on the terminal. Without a terminal, it fails rather than guessing.
+func confirm(e *env, question string) (bool, error) {
+	if file, ok := e.stdin.(*os.File); ok {
+		if info, err := file.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return false, usagef("standard input is not a terminal; pass -yes to apply without confirmation")
+		}
+	}
+
+	fmt.Fprintf(e.stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(e.stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"mikrotik_provisioning/pkg/client"
+)
+
+// runBackup writes an archive of the service to standard output or, with -o, to a file which is replaced
+// only once the archive is complete.
+func runBackup(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e)
+	output := flags.String("o", "", "file to write the archive to (default standard output)")
+	secrets := flags.Bool("secrets", false, "include device tokens and API signing keys, which grant access to the service")
+	if _, err := parseFlags(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	if *output == "" || *output == "-" {
+		return e.client.Export(ctx, e.stdout, *secrets)
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(*output), "."+filepath.Base(*output)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := e.client.Export(ctx, file, *secrets); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), *output)
+}
+
+// runRestore imports an archive written by backup. Replacing deletes what the archive does not hold, so it
+// asks for confirmation first.
+func runRestore(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e)
+	mode := flags.String("mode", string(client.MergeImport), "merge, or replace to also delete the lists, devices and API keys missing from the archive")
+	yes := flags.Bool("yes", false, "replace without asking for confirmation")
+	format := formatFlag(flags)
+	positional, err := parseFlags(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	f, err := format()
+	if err != nil {
+		return err
+	}
+
+	importMode := client.ImportMode(*mode)
+	if importMode != client.MergeImport && importMode != client.ReplaceImport {
+		return usagef("unknown mode %q, expected one of: %s, %s", *mode, client.MergeImport, client.ReplaceImport)
+	}
+
+	var archive []byte
+	if positional[0] == "-" {
+		archive, err = ioutil.ReadAll(e.stdin)
+	} else {
+		archive, err = ioutil.ReadFile(positional[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	if importMode == client.ReplaceImport && !*yes {
+		confirmed, err := confirm(e, "Delete the address lists, devices and API keys which are not in the archive?")
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			return fmt.Errorf("not restored")
+		}
+	}
+
+	result, err := e.client.Import(ctx, archive, importMode)
+	if err != nil {
+		return err
+	}
+
+	if f == jsonFormat {
+		return writeJSON(e.stdout, result)
+	}
+
+	return writeImportResult(e.stdout, result)
+}
+
+func writeImportResult(w io.Writer, result *client.ImportResult) error {
+	t := newTable(w, "KIND", "CREATED", "UPDATED", "DELETED", "SKIPPED")
+	for _, kind := range []struct {
+		name   string
+		counts client.ImportCounts
+	}{
+		{"address lists", result.AddressLists},
+		{"devices", result.Devices},
+		{"api keys", result.APIKeys},
+		{"audit events", result.AuditEvents},
+	} {
+		t.row(kind.name, fmt.Sprint(kind.counts.Created), fmt.Sprint(kind.counts.Updated), fmt.Sprint(kind.counts.Deleted), fmt.Sprint(kind.counts.Skipped))
+	}
+
+	return t.flush()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"mikrotik_provisioning/pkg/client"
+)
+
+func runList(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e)
+	prefix := flags.String("prefix", "", "only lists whose name starts with prefix")
+	labels := make(labelFlag)
+	flags.Var(labels, "label", "only lists with the label key=value, or with the label key at all (repeatable)")
+	format := formatFlag(flags)
+	if _, err := parseFlags(flags, args, 0, 0); err != nil {
+		return err
+	}
+	f, err := format()
+	if err != nil {
+		return err
+	}
+
+	addressLists, err := e.client.GetAllAddressLists(ctx, &client.ListOptions{Prefix: *prefix, Labels: labels})
+	if err != nil {
+		return err
+	}
+
+	if f == jsonFormat {
+		return writeJSON(e.stdout, addressLists)
+	}
+
+	return writeAddressLists(e.stdout, addressLists)
+}
+
+func runGet(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e)
+	version := flags.String("version", "", "RouterOS version to render the script for (rsc only)")
+	model := flags.String("model", "", "router model to render the script for (rsc only)")
+	format := formatFlag(flags, rscFormat)
+	positional, err := parseFlags(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	f, err := format()
+	if err != nil {
+		return err
+	}
+
+	if f == rscFormat {
+		script, err := e.client.GetAddressListScript(ctx, positional[0], &client.ScriptOptions{Version: *version, Model: *model})
+		if err != nil {
+			return err
+		}
+
+		_, err = e.stdout.Write(script)
+		return err
+	}
+
+	addressList, err := e.client.GetAddressList(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+
+	if f == jsonFormat {
+		return writeJSON(e.stdout, addressList)
+	}
+
+	return writeEntries(e.stdout, addressList.Addresses)
+}
+
+// runAdd puts every entry on its own, so that existing entries are replaced along with their expiry.
+func runAdd(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e)
+	comment := flags.String("comment", "", "comment of the entries")
+	disabled := flags.Bool("disabled", false, "add the entries disabled")
+	ttl := flags.Duration("ttl", 0, "remove the entries from the list after this duration, e.g. 4h")
+	format := formatFlag(flags)
+	positional, err := parseFlags(flags, args, 2, -1)
+	if err != nil {
+		return err
+	}
+	f, err := format()
+	if err != nil {
+		return err
+	}
+	if *ttl < 0 {
+		return usagef("invalid ttl: %s", *ttl)
+	}
+
+	var expiresAt *time.Time
+	if *ttl > 0 {
+		t := time.Now().Add(*ttl).UTC()
+		expiresAt = &t
+	}
+
+	stored := make([]*client.Address, 0, len(positional)-1)
+	for _, address := range positional[1:] {
+		entry, _, err := e.client.PutEntry(ctx, positional[0], &client.Address{Address: address, Comment: *comment, Disabled: *disabled, ExpiresAt: expiresAt})
+		if err != nil {
+			return err
+		}
+		stored = append(stored, entry)
+	}
+
+	if f == jsonFormat {
+		return writeJSON(e.stdout, stored)
+	}
+
+	return writeEntries(e.stdout, stored)
+}
+
+func runRemove(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e)
+	positional, err := parseFlags(flags, args, 2, -1)
+	if err != nil {
+		return err
+	}
+
+	addresses := make([]*client.Address, 0, len(positional)-1)
+	for _, address := range positional[1:] {
+		addresses = append(addresses, &client.Address{Address: address})
+	}
+
+	_, err = e.client.RemoveEntries(ctx, positional[0], addresses...)
+	return err
+}
+
+// labelFlag collects repeated -label key=value flags.
+type labelFlag map[string]string
+
+func (l labelFlag) String() string {
+	return formatLabels(l)
+}
+
+func (l labelFlag) Set(value string) error {
+	key, v := value, ""
+	if i := strings.Index(value, "="); i >= 0 {
+		key, v = value[:i], value[i+1:]
+	}
+	if key == "" {
+		return usagef("invalid label: %s", value)
+	}
+	l[key] = v
+
+	return nil
+}
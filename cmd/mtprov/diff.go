@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"mikrotik_provisioning/pkg/client"
+)
+
+type (
+	entryChange struct {
+		Before *client.Address `json:"before"`
+		After  *client.Address `json:"after"`
+	}
+
+	// listDiff is what changes when the service is brought in line with the local definition.
+	listDiff struct {
+		List    string            `json:"list"`
+		Exists  bool              `json:"exists"`
+		Added   []*client.Address `json:"added"`
+		Removed []*client.Address `json:"removed"`
+		Changed []*entryChange    `json:"changed"`
+		Labels  *labelChange      `json:"labels,omitempty"`
+	}
+
+	labelChange struct {
+		Before map[string]string `json:"before"`
+		After  map[string]string `json:"after"`
+	}
+)
+
+// runDiff compares a local list definition with the address list of the same name, and exits with
+// exitDiffers if they differ.
+func runDiff(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e)
+	format := formatFlag(flags)
+	positional, err := parseFlags(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	f, err := format()
+	if err != nil {
+		return err
+	}
+
+	local, err := readListFile(positional[0])
+	if err != nil {
+		return err
+	}
+
+	remote, err := e.client.GetAddressList(ctx, local.Name)
+	if err != nil && !client.IsNotFound(err) {
+		return err
+	}
+
+	d := diffList(local, remote)
+	if f == jsonFormat {
+		err = writeJSON(e.stdout, d)
+	} else {
+		err = d.write(e)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !d.Exists || d.Labels != nil || len(d.Added)+len(d.Removed)+len(d.Changed) != 0 {
+		return errDiffers
+	}
+
+	return nil
+}
+
+// diffList compares the local list with the remote one, which is nil if it does not exist.
+func diffList(local, remote *client.AddressList) *listDiff {
+	d := &listDiff{List: local.Name, Added: []*client.Address{}, Removed: []*client.Address{}, Changed: []*entryChange{}}
+	if remote == nil {
+		remote = new(client.AddressList)
+	} else {
+		d.Exists = true
+	}
+
+	existing := make(map[string]*client.Address)
+	for _, a := range remote.Addresses {
+		existing[a.Address] = a
+	}
+
+	wanted := make(map[string]bool)
+	for _, a := range local.Addresses {
+		wanted[a.Address] = true
+		b, ok := existing[a.Address]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, a)
+		case b.Comment != a.Comment || b.Disabled != a.Disabled || b.ExpiresAt != nil:
+			d.Changed = append(d.Changed, &entryChange{Before: b, After: a})
+		}
+	}
+
+	for _, b := range remote.Addresses {
+		if !wanted[b.Address] {
+			d.Removed = append(d.Removed, b)
+		}
+	}
+	sort.Slice(d.Removed, func(i, j int) bool { return d.Removed[i].Address < d.Removed[j].Address })
+
+	// The owner label is set by apply, not by the definition.
+	labels := make(map[string]string)
+	for key, value := range remote.Labels {
+		if key != client.ManagedByLabel {
+			labels[key] = value
+		}
+	}
+	if formatLabels(local.Labels) != formatLabels(labels) {
+		d.Labels = &labelChange{Before: remote.Labels, After: local.Labels}
+	}
+
+	return d
+}
+
+// write prints the differences like a unified diff: + for entries only in the local definition, - for
+// entries only in the service and ~ for entries which differ.
+func (d *listDiff) write(e *env) error {
+	if !d.Exists {
+		fmt.Fprintf(e.stdout, "+ list %s\n", d.List)
+	}
+	if d.Labels != nil {
+		fmt.Fprintf(e.stdout, "~ labels %s -> %s\n", formatLabels(d.Labels.Before), formatLabels(d.Labels.After))
+	}
+
+	t := newTable(e.stdout)
+	for _, a := range d.Added {
+		t.row("+", a.Address, describeEntry(a))
+	}
+	for _, c := range d.Changed {
+		t.row("~", c.After.Address, describeEntry(c.Before)+" -> "+describeEntry(c.After))
+	}
+	for _, b := range d.Removed {
+		t.row("-", b.Address, describeEntry(b))
+	}
+
+	return t.flush()
+}
+
+func describeEntry(a *client.Address) string {
+	s := fmt.Sprintf("comment=%q disabled=%s", a.Comment, formatBool(a.Disabled))
+	if a.ExpiresAt != nil {
+		s += " expires=" + formatTime(a.ExpiresAt)
+	}
+
+	return s
+}
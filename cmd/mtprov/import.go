@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"mikrotik_provisioning/pkg/client"
+)
+
+const addressListMenu = "/ip firewall address-list"
+
+type importResult struct {
+	List      string `json:"list"`
+	Created   bool   `json:"created"`
+	Added     int    `json:"added"`
+	Changed   int    `json:"changed"`
+	Unchanged int    `json:"unchanged"`
+}
+
+// runImport adds the entries of an export of /ip firewall address-list to the lists of the same name. Entries
+// of existing lists are applied as one batch, so that either all or none of them are added; missing lists
+// are created afterwards.
+func runImport(ctx context.Context, e *env, args []string) error {
+	flags := newFlagSet(e)
+	only := flags.String("list", "", "only import the entries of this list")
+	dryRun := flags.Bool("dry-run", false, "report what would change without changing anything")
+	format := formatFlag(flags)
+	positional, err := parseFlags(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	f, err := format()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(positional[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	names, entries, err := parseExport(file)
+	if err != nil {
+		return fmt.Errorf("%s: %s", positional[0], err)
+	}
+	if *only != "" {
+		if _, ok := entries[*only]; !ok {
+			return fmt.Errorf("%s: no entries of list %s", positional[0], *only)
+		}
+		names = []string{*only}
+	}
+
+	results := make([]*importResult, 0, len(names))
+	operations := make([]*client.Operation, 0, len(names))
+	missing := make([]string, 0)
+	for _, name := range names {
+		if _, err := e.client.GetAddressList(ctx, name); err != nil {
+			if !client.IsNotFound(err) {
+				return err
+			}
+			missing = append(missing, name)
+			continue
+		}
+		operations = append(operations, &client.Operation{List: name, Action: client.AddAction, Addresses: entries[name]})
+	}
+
+	if len(operations) != 0 {
+		response, err := e.client.ApplyChanges(ctx, operations, *dryRun)
+		if response != nil {
+			for _, r := range response.Results {
+				if r.Error != "" {
+					fmt.Fprintf(e.stderr, "mtprov import: %s: %s\n", r.List, r.Error)
+				}
+				results = append(results, &importResult{List: r.List, Added: len(r.Added), Changed: len(r.Changed), Unchanged: r.Unchanged})
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range missing {
+		if !*dryRun {
+			if _, err := e.client.CreateAddressList(ctx, &client.AddressList{Name: name, Addresses: entries[name]}); err != nil {
+				return err
+			}
+		}
+		results = append(results, &importResult{List: name, Created: true, Added: len(entries[name])})
+	}
+
+	if f == jsonFormat {
+		return writeJSON(e.stdout, results)
+	}
+
+	t := newTable(e.stdout, "LIST", "CREATED", "ADDED", "CHANGED", "UNCHANGED")
+	for _, r := range results {
+		t.row(r.List, formatBool(r.Created), fmt.Sprint(r.Added), fmt.Sprint(r.Changed), fmt.Sprint(r.Unchanged))
+	}
+
+	return t.flush()
+}
+
+// parseExport reads the add commands of /ip firewall address-list from a RouterOS export and returns the
+// entries by list, along with the list names in order of appearance. Other menus and commands are skipped.
+func parseExport(r io.Reader) ([]string, map[string][]*client.Address, error) {
+	names := make([]string, 0)
+	entries := make(map[string][]*client.Address)
+	seen := make(map[string]map[string]bool)
+
+	menu := ""
+	scanner := bufio.NewScanner(r)
+	number, line := 0, ""
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSpace(scanner.Text())
+
+		// A trailing backslash continues the command on the next line.
+		if strings.HasSuffix(text, "\\") && !strings.HasSuffix(text, "\\\\") {
+			line += strings.TrimSuffix(text, "\\")
+			continue
+		}
+		line += text
+		if line == "" || strings.HasPrefix(line, "#") {
+			line = ""
+			continue
+		}
+
+		words, err := splitWords(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s", number, err)
+		}
+		line = ""
+
+		if strings.HasPrefix(words[0], "/") {
+			path := make([]string, 0)
+			for len(words) != 0 && !strings.Contains(words[0], "=") && (len(path) == 0 || !isCommand(words[0])) {
+				path = append(path, words[0])
+				words = words[1:]
+			}
+			menu = strings.Join(path, " ")
+		}
+
+		if menu != addressListMenu || len(words) == 0 || words[0] != "add" {
+			continue
+		}
+
+		entry, list, err := parseAdd(words[1:])
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s", number, err)
+		}
+
+		if _, ok := entries[list]; !ok {
+			names = append(names, list)
+			seen[list] = make(map[string]bool)
+		}
+		if !seen[list][entry.Address] {
+			seen[list][entry.Address] = true
+			entries[list] = append(entries[list], entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("no address-list entries found")
+	}
+
+	return names, entries, nil
+}
+
+func isCommand(word string) bool {
+	switch word {
+	case "add", "set", "remove", "disable", "enable", "print", "export":
+		return true
+	}
+
+	return false
+}
+
+// parseAdd parses the arguments of an add command. Arguments other than list, address, comment and
+// disabled, such as timeout, are ignored.
+func parseAdd(arguments []string) (*client.Address, string, error) {
+	entry, list := new(client.Address), ""
+	for _, argument := range arguments {
+		i := strings.Index(argument, "=")
+		if i < 0 {
+			return nil, "", fmt.Errorf("unexpected argument: %s", argument)
+		}
+
+		key, value := argument[:i], argument[i+1:]
+		switch key {
+		case "list":
+			list = value
+		case "address":
+			entry.Address = value
+		case "comment":
+			entry.Comment = value
+		case "disabled":
+			switch value {
+			case "yes", "true":
+				entry.Disabled = true
+			case "no", "false":
+			default:
+				return nil, "", fmt.Errorf("invalid disabled value: %s", value)
+			}
+		}
+	}
+
+	if list == "" || entry.Address == "" {
+		return nil, "", fmt.Errorf("add without list or address")
+	}
+
+	return entry, list, nil
+}
+
+// splitWords splits a command line at spaces outside of double quotes and removes the quotes and escapes.
+func splitWords(line string) ([]string, error) {
+	words := make([]string, 0)
+	var word strings.Builder
+	inWord, quoted := false, false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			n, s := unescape(line[i+1:])
+			word.WriteString(s)
+			i += n
+			inWord = true
+		case c == '"':
+			quoted = !quoted
+			inWord = true
+		case (c == ' ' || c == '\t') && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+// unescape decodes the RouterOS escape sequence at the start of s, which follows a backslash, and returns
+// how many bytes it took. Exports write other bytes as two upper case hex digits, e.g. \C3\A9.
+func unescape(s string) (int, string) {
+	if len(s) >= 2 && isHex(s[0]) && isHex(s[1]) {
+		b, _ := strconv.ParseUint(s[:2], 16, 8)
+		return 2, string([]byte{byte(b)})
+	}
+
+	switch s[0] {
+	case 'n':
+		return 1, "\n"
+	case 'r':
+		return 1, "\r"
+	case 't':
+		return 1, "\t"
+	case '_':
+		return 1, " "
+	case 'a':
+		return 1, "\a"
+	case 'b':
+		return 1, "\b"
+	case 'f':
+		return 1, "\f"
+	case 'v':
+		return 1, "\v"
+	}
+
+	return 1, s[:1]
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,220 @@
+// Command mtprov is a command-line client of the MikroTik provisioning API for operators and scripts.
+//
+// Credentials are read from a profile in ~/.config/mtprov/config.yaml and may be overridden by the
+// environment (MTPROV_URL, MTPROV_ACCESS_KEY, MTPROV_SECRET_KEY, MTPROV_TOKEN). Results are printed
+// as tables or, with -format json, as JSON. The exit code tells scripts what went wrong.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"mikrotik_provisioning/pkg/client"
+)
+
+const (
+	exitOK        = 0
+	exitError     = 1
+	exitUsage     = 2
+	exitNotFound  = 3
+	exitForbidden = 4
+	exitConflict  = 5
+	exitDiffers   = 6
+)
+
+type (
+	// env is what every command runs with.
+	env struct {
+		command *command
+		client  *client.Client
+		stdin   io.Reader
+		stdout  io.Writer
+		stderr  io.Writer
+	}
+
+	command struct {
+		name    string
+		args    string
+		summary string
+		run     func(ctx context.Context, e *env, args []string) error
+	}
+
+	usageError struct {
+		message string
+	}
+)
+
+// errDiffers is returned by commands which found differences, such as diff.
+var errDiffers = errors.New("differences found")
+
+var commands = []*command{
+	{name: "list", args: "[-prefix name] [-label key=value]...", summary: "list address lists", run: runList},
+	{name: "get", args: "<list> [-format table|json|rsc]", summary: "show the entries or the RouterOS script of an address list", run: runGet},
+	{name: "add", args: "<list> <address>... [-comment text] [-disabled] [-ttl duration]", summary: "add or replace entries", run: runAdd},
+	{name: "rm", args: "<list> <address>...", summary: "remove entries", run: runRemove},
+	{name: "import", args: "<file.rsc> [-list name] [-dry-run]", summary: "import the entries of a RouterOS address-list export", run: runImport},
+	{name: "diff", args: "<list.yaml>", summary: "compare a local list definition with the service", run: runDiff},
+	{name: "apply", args: "<dir> [-managed-by name] [-prune] [-dry-run] [-yes]", summary: "bring the service in line with a directory of list definitions", run: runApply},
+	{name: "backup", args: "[-o file] [-secrets]", summary: "write an archive of all lists, devices, API keys and audit events", run: runBackup},
+	{name: "restore", args: "<file> [-mode merge|replace] [-yes]", summary: "restore an archive written by backup", run: runRestore},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("mtprov", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { usage(stderr) }
+	configFile := flags.String("config", "", "profile file (default $MTPROV_CONFIG or ~/.config/mtprov/config.yaml)")
+	profileName := flags.String("profile", "", "profile to use (default $MTPROV_PROFILE or the default of the profile file)")
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+
+	cmd := findCommand(flags.Arg(0))
+	if cmd == nil {
+		fmt.Fprintf(stderr, "mtprov: unknown command %q\n", flags.Arg(0))
+		usage(stderr)
+		return exitUsage
+	}
+
+	profile, err := loadProfile(*configFile, *profileName)
+	if err != nil {
+		fmt.Fprintf(stderr, "mtprov: %s\n", err)
+		return exitUsage
+	}
+
+	c, err := profile.newClient()
+	if err != nil {
+		fmt.Fprintf(stderr, "mtprov: %s\n", err)
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err = cmd.run(ctx, &env{command: cmd, client: c, stdin: stdin, stdout: stdout, stderr: stderr}, flags.Args()[1:])
+	if err != nil && err != errDiffers && err != flag.ErrHelp && err.Error() != "" {
+		fmt.Fprintf(stderr, "mtprov %s: %s\n", cmd.name, err)
+	}
+
+	return exitCode(err)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: mtprov [-config file] [-profile name] <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-7s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "exit codes: 0 success, 1 error, 2 usage, 3 not found, 4 unauthorized or forbidden,")
+	fmt.Fprintln(w, "5 conflict, 6 differences found (diff, apply -dry-run)")
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+
+	return nil
+}
+
+func exitCode(err error) int {
+	var usage *usageError
+	switch {
+	case err == nil, err == flag.ErrHelp:
+		return exitOK
+	case err == errDiffers:
+		return exitDiffers
+	case errors.As(err, &usage):
+		return exitUsage
+	case client.IsNotFound(err):
+		return exitNotFound
+	case client.IsForbidden(err):
+		return exitForbidden
+	case client.IsConflict(err):
+		return exitConflict
+	}
+
+	return exitError
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{message: fmt.Sprintf(format, args...)}
+}
+
+// newFlagSet returns the flag set of the command, which prints its usage on -h.
+func newFlagSet(e *env) *flag.FlagSet {
+	flags := flag.NewFlagSet(e.command.name, flag.ContinueOnError)
+	flags.SetOutput(e.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(e.stderr, "usage: mtprov %s %s\n", e.command.name, e.command.args)
+		flags.PrintDefaults()
+	}
+
+	return flags
+}
+
+// parseFlags parses flags mixed with positional arguments, as in "get blocklist -format rsc", and returns
+// the positional arguments. It fails unless there are between min and max of them; max < 0 means any number.
+func parseFlags(flags *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	positional := make([]string, 0)
+	for {
+		if err := flags.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return nil, err
+			}
+			// The flag package has already reported the error with the usage.
+			return nil, &usageError{}
+		}
+
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) < min || (max >= 0 && len(positional) > max) {
+		flags.Usage()
+		return nil, usagef("wrong number of arguments")
+	}
+
+	return positional, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+
+	"mikrotik_provisioning/pkg/client"
+)
+
+// listFile is the local definition of an address list, one list per file:
+//
+//	name: blocklist
+//	labels:
+//	  env: prod
+//	addresses:
+//	  - address: 192.0.2.1
+//	    comment: scanner
+type listFile struct {
+	Name      string            `yaml:"name"`
+	Labels    map[string]string `yaml:"labels"`
+	Addresses []*struct {
+		Address  string `yaml:"address"`
+		Comment  string `yaml:"comment"`
+		Disabled bool   `yaml:"disabled"`
+	} `yaml:"addresses"`
+}
+
+func readListFile(path string) (*client.AddressList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := new(listFile)
+	if err := yaml.UnmarshalStrict(data, file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+	if file.Name == "" {
+		return nil, fmt.Errorf("%s: missing name", path)
+	}
+
+	addressList := &client.AddressList{Name: file.Name, Labels: file.Labels, Addresses: make([]*client.Address, 0, len(file.Addresses))}
+	for _, a := range file.Addresses {
+		if a == nil || a.Address == "" {
+			return nil, fmt.Errorf("%s: entry without address", path)
+		}
+		addressList.Addresses = append(addressList.Addresses, &client.Address{Address: a.Address, Comment: a.Comment, Disabled: a.Disabled})
+	}
+
+	return addressList, nil
+}
+
+// readListDir reads every .yaml and .yml file of dir, sorted by file name. Subdirectories are not read.
+func readListDir(dir string) ([]*client.AddressList, error) {
+	paths := make([]string, 0)
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	if len(paths) == 0 {
+		if _, err := ioutil.ReadDir(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	addressLists := make([]*client.AddressList, 0, len(paths))
+	files := make(map[string]string)
+	for _, path := range paths {
+		addressList, err := readListFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := files[addressList.Name]; ok {
+			return nil, fmt.Errorf("address list %s is defined in %s and %s", addressList.Name, other, path)
+		}
+		files[addressList.Name] = path
+		addressLists = append(addressLists, addressList)
+	}
+
+	return addressLists, nil
+}
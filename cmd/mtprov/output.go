@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"mikrotik_provisioning/pkg/client"
+)
+
+const (
+	tableFormat = "table"
+	jsonFormat  = "json"
+	rscFormat   = "rsc"
+)
+
+// formatFlag adds the -format flag, which accepts table, json and the extra formats given.
+func formatFlag(flags *flag.FlagSet, extra ...string) func() (string, error) {
+	formats := append([]string{tableFormat, jsonFormat}, extra...)
+	format := flags.String("format", tableFormat, "output format: "+strings.Join(formats, ", "))
+
+	return func() (string, error) {
+		for _, f := range formats {
+			if *format == f {
+				return f, nil
+			}
+		}
+
+		return "", usagef("unknown format %q, expected one of: %s", *format, strings.Join(formats, ", "))
+	}
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
+
+// table writes tab separated rows as aligned columns.
+type table struct {
+	w *tabwriter.Writer
+}
+
+func newTable(w io.Writer, header ...string) *table {
+	t := &table{w: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)}
+	if len(header) != 0 {
+		t.row(header...)
+	}
+
+	return t
+}
+
+func (t *table) row(columns ...string) {
+	fmt.Fprintln(t.w, strings.Join(columns, "\t"))
+}
+
+func (t *table) flush() error {
+	return t.w.Flush()
+}
+
+func writeAddressLists(w io.Writer, addressLists []*client.AddressList) error {
+	t := newTable(w, "NAME", "ENTRIES", "REVISION", "LABELS")
+	for _, addressList := range addressLists {
+		t.row(addressList.Name, fmt.Sprint(len(addressList.Addresses)), fmt.Sprint(addressList.Revision), formatLabels(addressList.Labels))
+	}
+
+	return t.flush()
+}
+
+func writeEntries(w io.Writer, entries []*client.Address) error {
+	t := newTable(w, "ADDRESS", "DISABLED", "EXPIRES", "COMMENT")
+	for _, entry := range entries {
+		t.row(entry.Address, formatBool(entry.Disabled), formatTime(entry.ExpiresAt), entry.Comment)
+	}
+
+	return t.flush()
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + labels[key]
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func formatBool(v bool) string {
+	if v {
+		return "yes"
+	}
+
+	return "no"
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+
+	return t.Local().Format(time.RFC3339)
+}
@@ -7,6 +7,7 @@ require (
 	github.com/go-chi/render v1.0.1
 	github.com/go-playground/universal-translator v0.17.0 // indirect
 	github.com/leodido/go-urn v1.2.0 // indirect
+	github.com/prometheus/client_golang v1.7.1
 	go.mongodb.org/mongo-driver v1.4.0
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
 	gopkg.in/go-playground/validator.v9 v9.31.0
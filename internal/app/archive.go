@@ -0,0 +1,429 @@
+package app
+
+import (
+	"context"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/apikey"
+	"mikrotik_provisioning/internal/pkg/archive"
+	"mikrotik_provisioning/internal/pkg/audit"
+	"mikrotik_provisioning/internal/pkg/device"
+	"mikrotik_provisioning/pkg/hmacauth"
+)
+
+// exportPageSize is the number of address lists read from storage at once while exporting.
+const exportPageSize = 100
+
+// Export writes a complete archive of every address list, device, API key and audit event. Expired entries
+// are left out. Device tokens and API signing keys are written only with secrets.
+func (s *Service) Export(ctx context.Context, w *archive.Writer, secrets bool) error {
+	now := time.Now().UTC()
+	if err := w.Write(archive.HeaderKind, &archive.Header{Version: archive.Version, CreatedAt: now, Secrets: secrets}); err != nil {
+		return err
+	}
+
+	filter := &address_list.Filter{Limit: exportPageSize}
+	for {
+		addressLists, cursor, err := s.storage.GetAddressLists(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, addressList := range addressLists {
+			addressList.Addresses = address_list.Unexpired(addressList.Addresses, now)
+			if err := w.Write(archive.AddressListKind, addressList); err != nil {
+				return err
+			}
+		}
+		if cursor == "" {
+			break
+		}
+		filter.Cursor = cursor
+	}
+
+	devices, err := s.storage.GetDevices(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range devices {
+		if !secrets {
+			d.Token = ""
+		}
+		if err := w.Write(archive.DeviceKind, d); err != nil {
+			return err
+		}
+	}
+
+	keys, err := s.storage.GetAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := w.Write(archive.APIKeyKind, archive.NewAPIKey(key, secrets)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.eachAuditEvent(ctx, func(event *audit.Event) error {
+		// IDs are assigned by the backend; restored events get new ones.
+		event.ID = ""
+		return w.Write(archive.AuditEventKind, event)
+	}); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// Import restores the contents of an archive. Audit events are added unless an equal event is stored, so
+// that the history stays in place when the same archive is imported twice, and name the importing actor, as
+// whoever imports an archive can write any history into it. Address lists, devices and API
+// keys are created or updated and, in archive.ReplaceMode, deleted if they are not in the archive, except
+// for the API key of the importing principal. Devices without a token keep theirs or get a new one; API
+// keys without a signing key keep theirs or, if they are new, cannot be used until they are rotated.
+//
+// A failure leaves the earlier changes in place; importing the archive again completes the restore.
+func (s *Service) Import(ctx context.Context, contents *archive.Contents, mode archive.Mode) (*archive.Result, error) {
+	result := &archive.Result{Mode: mode, Version: contents.Header.Version}
+
+	if err := s.importAuditEvents(ctx, contents.AuditEvents, &result.AuditEvents); err != nil {
+		return result, err
+	}
+	if err := s.importAddressLists(ctx, contents.AddressLists, mode, result); err != nil {
+		return result, err
+	}
+	if err := s.importDevices(ctx, contents.Devices, mode, result); err != nil {
+		return result, err
+	}
+	if err := s.importAPIKeys(ctx, contents.APIKeys, mode, &result.APIKeys); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (s *Service) importAuditEvents(ctx context.Context, events []*audit.Event, counts *archive.Counts) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	stored := make(map[string]bool)
+	if err := s.eachAuditEvent(ctx, func(event *audit.Event) error {
+		stored[auditEventKey(event)] = true
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	importer := audit.ActorFromContext(ctx).Name
+	for _, event := range events {
+		key := auditEventKey(event)
+		if stored[key] {
+			counts.Skipped++
+			continue
+		}
+
+		imported := *event
+		imported.ImportedBy = importer
+		if err := s.storage.CreateAuditEvent(ctx, &imported); err != nil {
+			return err
+		}
+		stored[key] = true
+		counts.Created++
+	}
+
+	return nil
+}
+
+func (s *Service) importAddressLists(ctx context.Context, addressLists []*address_list.AddressList, mode archive.Mode, result *archive.Result) error {
+	stored, _, err := s.storage.GetAddressLists(ctx, &address_list.Filter{})
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]*address_list.AddressList)
+	for _, addressList := range stored {
+		existing[addressList.Name] = addressList
+	}
+
+	now := time.Now().UTC()
+	archived := make(map[string]bool)
+	before := make(map[string]*address_list.AddressList)
+	updates := make([]*address_list.AddressList, 0)
+	creates := make([]*address_list.AddressList, 0)
+	for _, addressList := range addressLists {
+		archived[addressList.Name] = true
+		after := *addressList
+		after.Addresses = address_list.Unexpired(addressList.Addresses, now)
+		restoreEntries(after.Addresses, now)
+
+		b, ok := existing[after.Name]
+		switch {
+		case !ok:
+			creates = append(creates, &after)
+		case b.SameAs(&after, now):
+			result.AddressLists.Skipped++
+		default:
+			after.ID, after.Revision = b.ID, b.Revision
+			before[after.Name] = b
+			updates = append(updates, &after)
+		}
+	}
+
+	if len(updates) != 0 {
+		updated, err := s.storage.UpdateAddressLists(ctx, updates)
+		if err != nil {
+			return err
+		}
+		for _, addressList := range updated {
+			s.record(ctx, audit.NewEvent(ctx, audit.UpdateAction, audit.AddressListResource, addressList.Name).WithDiff(before[addressList.Name], addressList))
+			result.AddressLists.Updated++
+		}
+	}
+
+	for _, addressList := range creates {
+		created, err := s.storage.CreateAddressList(ctx, addressList)
+		if err != nil {
+			return err
+		}
+		s.record(ctx, audit.NewEvent(ctx, audit.CreateAction, audit.AddressListResource, created.Name).WithDiff(nil, created))
+		result.AddressLists.Created++
+	}
+
+	if mode != archive.ReplaceMode {
+		return nil
+	}
+
+	for _, addressList := range stored {
+		if archived[addressList.Name] {
+			continue
+		}
+		if err := s.storage.DeleteAddressList(ctx, addressList.ID); err != nil {
+			return err
+		}
+		s.record(ctx, audit.NewEvent(ctx, audit.DeleteAction, audit.AddressListResource, addressList.Name).WithDiff(addressList, nil))
+		result.AddressLists.Deleted++
+		result.DeletedAddressLists = append(result.DeletedAddressLists, addressList.Name)
+	}
+
+	return nil
+}
+
+func (s *Service) importDevices(ctx context.Context, devices []*device.Device, mode archive.Mode, result *archive.Result) error {
+	stored, err := s.storage.GetDevices(ctx)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]*device.Device)
+	for _, d := range stored {
+		existing[d.Name] = d
+	}
+
+	archived := make(map[string]bool)
+	for _, d := range devices {
+		archived[d.Name] = true
+		after := *d
+
+		b, ok := existing[after.Name]
+		if after.Token == "" && ok {
+			after.Token = b.Token
+		}
+
+		switch {
+		case !ok:
+			if after.Token == "" {
+				token, err := generateDeviceToken()
+				if err != nil {
+					return err
+				}
+				after.Token = token
+			}
+			created, err := s.storage.CreateDevice(ctx, &after)
+			if err != nil {
+				return err
+			}
+			s.record(ctx, audit.NewEvent(ctx, audit.CreateAction, audit.DeviceResource, created.Name))
+			result.Devices.Created++
+		case sameDevice(b, &after):
+			result.Devices.Skipped++
+		default:
+			updated, err := s.storage.UpdateDevice(ctx, b.ID, &after)
+			if err != nil {
+				return err
+			}
+			s.record(ctx, audit.NewEvent(ctx, audit.UpdateAction, audit.DeviceResource, updated.Name))
+			result.Devices.Updated++
+		}
+	}
+
+	if mode != archive.ReplaceMode {
+		return nil
+	}
+
+	for _, d := range stored {
+		if archived[d.Name] {
+			continue
+		}
+		if err := s.storage.DeleteDevice(ctx, d.ID); err != nil {
+			return err
+		}
+		s.record(ctx, audit.NewEvent(ctx, audit.DeleteAction, audit.DeviceResource, d.Name))
+		result.Devices.Deleted++
+		result.DeletedDevices = append(result.DeletedDevices, d.Name)
+	}
+
+	return nil
+}
+
+func (s *Service) importAPIKeys(ctx context.Context, keys []*archive.APIKey, mode archive.Mode, counts *archive.Counts) error {
+	stored, err := s.storage.GetAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]*apikey.APIKey)
+	for _, key := range stored {
+		existing[key.AccessKey] = key
+	}
+
+	archived := make(map[string]bool)
+	for _, k := range keys {
+		archived[k.AccessKey] = true
+		after := k.ToAPIKey()
+
+		b, ok := existing[after.AccessKey]
+		if after.SigningKey == "" {
+			if ok {
+				after.SigningKey, after.PreviousSigningKey, after.PreviousExpiresAt = b.SigningKey, b.PreviousSigningKey, b.PreviousExpiresAt
+			} else {
+				// nobody knows the secret of this signing key, so the key is unusable until it is rotated
+				secretKey, err := generateSecretKey()
+				if err != nil {
+					return err
+				}
+				after.SigningKey = hex.EncodeToString(hmacauth.DeriveKey(secretKey))
+				after.PreviousSigningKey, after.PreviousExpiresAt = "", nil
+			}
+		}
+		if after.PreviousSigningKey == "" {
+			after.PreviousExpiresAt = nil
+		}
+
+		switch {
+		case !ok:
+			created, err := s.storage.CreateAPIKey(ctx, after)
+			if err != nil {
+				return err
+			}
+			s.record(ctx, audit.NewEvent(ctx, audit.CreateAction, audit.APIKeyResource, created.AccessKey))
+			counts.Created++
+		case sameAPIKey(b, after):
+			counts.Skipped++
+		default:
+			updated, err := s.storage.UpdateAPIKey(ctx, b.ID, after)
+			if err != nil {
+				return err
+			}
+			s.record(ctx, audit.NewEvent(ctx, audit.UpdateAction, audit.APIKeyResource, updated.AccessKey))
+			counts.Updated++
+		}
+	}
+
+	if mode != archive.ReplaceMode {
+		return nil
+	}
+
+	importer := audit.ActorFromContext(ctx).Name
+	for _, key := range stored {
+		if archived[key.AccessKey] {
+			continue
+		}
+		if key.AccessKey == importer {
+			counts.Skipped++
+			continue
+		}
+		if err := s.storage.DeleteAPIKey(ctx, key.ID); err != nil {
+			return err
+		}
+		s.record(ctx, audit.NewEvent(ctx, audit.DeleteAction, audit.APIKeyResource, key.AccessKey))
+		counts.Deleted++
+	}
+
+	return nil
+}
+
+// eachAuditEvent calls fn for every stored audit event, newest first. Storage returns a bounded page of the
+// newest events, so the pages are walked back in time, each continuing after the last event of the previous.
+func (s *Service) eachAuditEvent(ctx context.Context, fn func(event *audit.Event) error) error {
+	filter := &audit.Filter{}
+	for {
+		events, err := s.storage.GetAuditEvents(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		// fn may modify the events, the ID included
+		last := events[len(events)-1]
+		filter.To, filter.BeforeID = last.Time, last.ID
+
+		for _, event := range events {
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// auditEventKey identifies an event across backends, which assign their own IDs and may store times at a
+// coarser precision.
+func auditEventKey(event *audit.Event) string {
+	return strings.Join([]string{
+		event.Time.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano),
+		event.Actor,
+		event.RequestID,
+		event.Action,
+		event.Resource,
+		event.Name,
+	}, "\x00")
+}
+
+// restoreEntries keeps the timestamps of archived entries, setting only those which are missing.
+func restoreEntries(entries []*address_list.Address, now time.Time) {
+	for _, entry := range entries {
+		entry.ExpiresAt = truncateExpiry(entry.ExpiresAt)
+		if entry.CreatedAt == nil {
+			entry.CreatedAt = &now
+		}
+		if entry.UpdatedAt == nil {
+			entry.UpdatedAt = &now
+		}
+	}
+}
+
+func sameDevice(a, b *device.Device) bool {
+	return a.Model == b.Model && a.RouterOSVersion == b.RouterOSVersion && a.FetchInterval == b.FetchInterval &&
+		a.Token == b.Token && (len(a.AddressLists) == 0 && len(b.AddressLists) == 0 || reflect.DeepEqual(a.AddressLists, b.AddressLists))
+}
+
+// sameAPIKey compares everything but the time a key was last used, which changes with every request.
+func sameAPIKey(a, b *apikey.APIKey) bool {
+	return a.Description == b.Description && a.Role == b.Role &&
+		(len(a.Grants) == 0 && len(b.Grants) == 0 || reflect.DeepEqual(a.Grants, b.Grants)) &&
+		a.CreatedAt.Equal(b.CreatedAt) && sameTime(a.ExpiresAt, b.ExpiresAt) && a.SigningKey == b.SigningKey &&
+		a.PreviousSigningKey == b.PreviousSigningKey && sameTime(a.PreviousExpiresAt, b.PreviousExpiresAt)
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
@@ -0,0 +1,332 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/apikey"
+	"mikrotik_provisioning/internal/pkg/audit"
+	"mikrotik_provisioning/internal/pkg/device"
+	"mikrotik_provisioning/internal/pkg/metrics"
+	"mikrotik_provisioning/internal/pkg/webhook"
+)
+
+// InstrumentedStorage decorates a Storage with call latency and error metrics, labelled with the method name.
+type InstrumentedStorage struct {
+	storage Storage
+}
+
+func NewInstrumentedStorage(storage Storage) *InstrumentedStorage {
+	return &InstrumentedStorage{storage: storage}
+}
+
+// CheckHealth forwards to the decorated storage if it implements HealthChecker.
+func (s *InstrumentedStorage) CheckHealth(ctx context.Context) error {
+	checker, ok := s.storage.(HealthChecker)
+	if !ok {
+		return nil
+	}
+
+	start := time.Now()
+	err := checker.CheckHealth(ctx)
+	metrics.ObserveStorageCall("CheckHealth", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) GetAddressLists(ctx context.Context, filter *address_list.Filter) ([]*address_list.AddressList, string, error) {
+	start := time.Now()
+	result, cursor, err := s.storage.GetAddressLists(ctx, filter)
+	metrics.ObserveStorageCall("GetAddressLists", start, err)
+
+	return result, cursor, err
+}
+
+func (s *InstrumentedStorage) CreateAddressList(ctx context.Context, addressList *address_list.AddressList) (*address_list.AddressList, error) {
+	start := time.Now()
+	result, err := s.storage.CreateAddressList(ctx, addressList)
+	metrics.ObserveStorageCall("CreateAddressList", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) GetAddressList(ctx context.Context, name string) (*address_list.AddressList, error) {
+	start := time.Now()
+	result, err := s.storage.GetAddressList(ctx, name)
+	metrics.ObserveStorageCall("GetAddressList", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) GetAddressListByID(ctx context.Context, id string) (*address_list.AddressList, error) {
+	start := time.Now()
+	result, err := s.storage.GetAddressListByID(ctx, id)
+	metrics.ObserveStorageCall("GetAddressListByID", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) UpdateAddressList(ctx context.Context, id string, addressList *address_list.AddressList) (*address_list.AddressList, error) {
+	start := time.Now()
+	result, err := s.storage.UpdateAddressList(ctx, id, addressList)
+	metrics.ObserveStorageCall("UpdateAddressList", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) DeleteAddressList(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.storage.DeleteAddressList(ctx, id)
+	metrics.ObserveStorageCall("DeleteAddressList", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) UpdateEntriesInAddressList(ctx context.Context, action address_list.Action, id string, addresses []*address_list.Address) (*address_list.AddressList, error) {
+	start := time.Now()
+	result, err := s.storage.UpdateEntriesInAddressList(ctx, action, id, addresses)
+	metrics.ObserveStorageCall("UpdateEntriesInAddressList", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) GetEntries(ctx context.Context, id string, filter *address_list.EntryFilter) ([]*address_list.Address, string, error) {
+	start := time.Now()
+	result, cursor, err := s.storage.GetEntries(ctx, id, filter)
+	metrics.ObserveStorageCall("GetEntries", start, err)
+
+	return result, cursor, err
+}
+
+func (s *InstrumentedStorage) GetEntry(ctx context.Context, id string, address string) (*address_list.Address, error) {
+	start := time.Now()
+	result, err := s.storage.GetEntry(ctx, id, address)
+	metrics.ObserveStorageCall("GetEntry", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) PutEntry(ctx context.Context, id string, entry *address_list.Address) (*address_list.Address, bool, error) {
+	start := time.Now()
+	result, created, err := s.storage.PutEntry(ctx, id, entry)
+	metrics.ObserveStorageCall("PutEntry", start, err)
+
+	return result, created, err
+}
+
+func (s *InstrumentedStorage) DeleteEntry(ctx context.Context, id string, address string) error {
+	start := time.Now()
+	err := s.storage.DeleteEntry(ctx, id, address)
+	metrics.ObserveStorageCall("DeleteEntry", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) UpdateAddressLists(ctx context.Context, addressLists []*address_list.AddressList) ([]*address_list.AddressList, error) {
+	start := time.Now()
+	result, err := s.storage.UpdateAddressLists(ctx, addressLists)
+	metrics.ObserveStorageCall("UpdateAddressLists", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) UpdateAddressListRevision(ctx context.Context, addressList *address_list.AddressList) (*address_list.AddressList, error) {
+	start := time.Now()
+	result, err := s.storage.UpdateAddressListRevision(ctx, addressList)
+	metrics.ObserveStorageCall("UpdateAddressListRevision", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) DeleteAddressListRevision(ctx context.Context, id string, revision int64) error {
+	start := time.Now()
+	err := s.storage.DeleteAddressListRevision(ctx, id, revision)
+	metrics.ObserveStorageCall("DeleteAddressListRevision", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) GetDevices(ctx context.Context) ([]*device.Device, error) {
+	start := time.Now()
+	result, err := s.storage.GetDevices(ctx)
+	metrics.ObserveStorageCall("GetDevices", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) CreateDevice(ctx context.Context, device *device.Device) (*device.Device, error) {
+	start := time.Now()
+	result, err := s.storage.CreateDevice(ctx, device)
+	metrics.ObserveStorageCall("CreateDevice", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) GetDevice(ctx context.Context, name string) (*device.Device, error) {
+	start := time.Now()
+	result, err := s.storage.GetDevice(ctx, name)
+	metrics.ObserveStorageCall("GetDevice", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) GetDeviceByID(ctx context.Context, id string) (*device.Device, error) {
+	start := time.Now()
+	result, err := s.storage.GetDeviceByID(ctx, id)
+	metrics.ObserveStorageCall("GetDeviceByID", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) UpdateDevice(ctx context.Context, id string, device *device.Device) (*device.Device, error) {
+	start := time.Now()
+	result, err := s.storage.UpdateDevice(ctx, id, device)
+	metrics.ObserveStorageCall("UpdateDevice", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) DeleteDevice(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.storage.DeleteDevice(ctx, id)
+	metrics.ObserveStorageCall("DeleteDevice", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) GetAPIKeys(ctx context.Context) ([]*apikey.APIKey, error) {
+	start := time.Now()
+	result, err := s.storage.GetAPIKeys(ctx)
+	metrics.ObserveStorageCall("GetAPIKeys", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) CreateAPIKey(ctx context.Context, key *apikey.APIKey) (*apikey.APIKey, error) {
+	start := time.Now()
+	result, err := s.storage.CreateAPIKey(ctx, key)
+	metrics.ObserveStorageCall("CreateAPIKey", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) GetAPIKey(ctx context.Context, accessKey string) (*apikey.APIKey, error) {
+	start := time.Now()
+	result, err := s.storage.GetAPIKey(ctx, accessKey)
+	metrics.ObserveStorageCall("GetAPIKey", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) GetAPIKeyByID(ctx context.Context, id string) (*apikey.APIKey, error) {
+	start := time.Now()
+	result, err := s.storage.GetAPIKeyByID(ctx, id)
+	metrics.ObserveStorageCall("GetAPIKeyByID", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) UpdateAPIKey(ctx context.Context, id string, key *apikey.APIKey) (*apikey.APIKey, error) {
+	start := time.Now()
+	result, err := s.storage.UpdateAPIKey(ctx, id, key)
+	metrics.ObserveStorageCall("UpdateAPIKey", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) TouchAPIKey(ctx context.Context, id string, lastUsedAt time.Time) error {
+	start := time.Now()
+	err := s.storage.TouchAPIKey(ctx, id, lastUsedAt)
+	metrics.ObserveStorageCall("TouchAPIKey", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) DeleteAPIKey(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.storage.DeleteAPIKey(ctx, id)
+	metrics.ObserveStorageCall("DeleteAPIKey", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) CreateAuditEvent(ctx context.Context, event *audit.Event) error {
+	start := time.Now()
+	err := s.storage.CreateAuditEvent(ctx, event)
+	metrics.ObserveStorageCall("CreateAuditEvent", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) GetAuditEvents(ctx context.Context, filter *audit.Filter) ([]*audit.Event, error) {
+	start := time.Now()
+	result, err := s.storage.GetAuditEvents(ctx, filter)
+	metrics.ObserveStorageCall("GetAuditEvents", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) GetWebhooks(ctx context.Context) ([]*webhook.Webhook, error) {
+	start := time.Now()
+	result, err := s.storage.GetWebhooks(ctx)
+	metrics.ObserveStorageCall("GetWebhooks", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) CreateWebhook(ctx context.Context, webhook *webhook.Webhook) (*webhook.Webhook, error) {
+	start := time.Now()
+	result, err := s.storage.CreateWebhook(ctx, webhook)
+	metrics.ObserveStorageCall("CreateWebhook", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) GetWebhook(ctx context.Context, id string) (*webhook.Webhook, error) {
+	start := time.Now()
+	result, err := s.storage.GetWebhook(ctx, id)
+	metrics.ObserveStorageCall("GetWebhook", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) DeleteWebhook(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.storage.DeleteWebhook(ctx, id)
+	metrics.ObserveStorageCall("DeleteWebhook", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) CreateDeadLetter(ctx context.Context, delivery *webhook.Delivery) error {
+	start := time.Now()
+	err := s.storage.CreateDeadLetter(ctx, delivery)
+	metrics.ObserveStorageCall("CreateDeadLetter", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) GetDeadLetters(ctx context.Context) ([]*webhook.Delivery, error) {
+	start := time.Now()
+	result, err := s.storage.GetDeadLetters(ctx)
+	metrics.ObserveStorageCall("GetDeadLetters", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) GetDeadLetter(ctx context.Context, id string) (*webhook.Delivery, error) {
+	start := time.Now()
+	result, err := s.storage.GetDeadLetter(ctx, id)
+	metrics.ObserveStorageCall("GetDeadLetter", start, err)
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) DeleteDeadLetter(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.storage.DeleteDeadLetter(ctx, id)
+	metrics.ObserveStorageCall("DeleteDeadLetter", start, err)
+
+	return err
+}
@@ -2,51 +2,794 @@ package app
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
 
 	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/apikey"
+	"mikrotik_provisioning/internal/pkg/archive"
+	"mikrotik_provisioning/internal/pkg/audit"
+	"mikrotik_provisioning/internal/pkg/device"
+	"mikrotik_provisioning/internal/pkg/logging"
+	"mikrotik_provisioning/internal/pkg/webhook"
+	"mikrotik_provisioning/pkg/hmacauth"
+)
+
+const (
+	deviceTokenLength = 32
+	accessKeyLength   = 24
+	secretKeyLength   = 32
+	accessKeyAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 )
 
 type UseCases interface {
 	Storage
+	RotateAPIKey(ctx context.Context, key *apikey.APIKey, overlap time.Duration) (*apikey.APIKey, error)
+	ApplyChanges(ctx context.Context, operations []*address_list.Operation, dryRun bool) ([]*address_list.OperationResult, error)
+	PlanManifests(ctx context.Context, request *address_list.ApplyRequest) (*address_list.Plan, error)
+	ApplyPlan(ctx context.Context, plan *address_list.Plan) error
+	Export(ctx context.Context, w *archive.Writer, secrets bool) error
+	Import(ctx context.Context, contents *archive.Contents, mode archive.Mode) (*archive.Result, error)
 }
 
 type Storage interface {
-	GetAddressLists(ctx context.Context) ([]*address_list.AddressList, error)
+	GetAddressLists(ctx context.Context, filter *address_list.Filter) ([]*address_list.AddressList, string, error)
 	CreateAddressList(ctx context.Context, addressList *address_list.AddressList) (*address_list.AddressList, error)
 	GetAddressList(ctx context.Context, name string) (*address_list.AddressList, error)
+	GetAddressListByID(ctx context.Context, id string) (*address_list.AddressList, error)
 	UpdateAddressList(ctx context.Context, id string, addressList *address_list.AddressList) (*address_list.AddressList, error)
 	DeleteAddressList(ctx context.Context, id string) error
 	UpdateEntriesInAddressList(ctx context.Context, action address_list.Action, id string, addresses []*address_list.Address) (*address_list.AddressList, error)
+	GetEntries(ctx context.Context, id string, filter *address_list.EntryFilter) ([]*address_list.Address, string, error)
+	GetEntry(ctx context.Context, id string, address string) (*address_list.Address, error)
+	PutEntry(ctx context.Context, id string, entry *address_list.Address) (*address_list.Address, bool, error)
+	DeleteEntry(ctx context.Context, id string, address string) error
+	UpdateAddressLists(ctx context.Context, addressLists []*address_list.AddressList) ([]*address_list.AddressList, error)
+	UpdateAddressListRevision(ctx context.Context, addressList *address_list.AddressList) (*address_list.AddressList, error)
+	DeleteAddressListRevision(ctx context.Context, id string, revision int64) error
+	GetDevices(ctx context.Context) ([]*device.Device, error)
+	CreateDevice(ctx context.Context, device *device.Device) (*device.Device, error)
+	GetDevice(ctx context.Context, name string) (*device.Device, error)
+	GetDeviceByID(ctx context.Context, id string) (*device.Device, error)
+	UpdateDevice(ctx context.Context, id string, device *device.Device) (*device.Device, error)
+	DeleteDevice(ctx context.Context, id string) error
+	GetAPIKeys(ctx context.Context) ([]*apikey.APIKey, error)
+	CreateAPIKey(ctx context.Context, key *apikey.APIKey) (*apikey.APIKey, error)
+	GetAPIKey(ctx context.Context, accessKey string) (*apikey.APIKey, error)
+	GetAPIKeyByID(ctx context.Context, id string) (*apikey.APIKey, error)
+	UpdateAPIKey(ctx context.Context, id string, key *apikey.APIKey) (*apikey.APIKey, error)
+	TouchAPIKey(ctx context.Context, id string, lastUsedAt time.Time) error
+	DeleteAPIKey(ctx context.Context, id string) error
+	CreateAuditEvent(ctx context.Context, event *audit.Event) error
+	GetAuditEvents(ctx context.Context, filter *audit.Filter) ([]*audit.Event, error)
+	GetWebhooks(ctx context.Context) ([]*webhook.Webhook, error)
+	CreateWebhook(ctx context.Context, webhook *webhook.Webhook) (*webhook.Webhook, error)
+	GetWebhook(ctx context.Context, id string) (*webhook.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	CreateDeadLetter(ctx context.Context, delivery *webhook.Delivery) error
+	GetDeadLetters(ctx context.Context) ([]*webhook.Delivery, error)
+	GetDeadLetter(ctx context.Context, id string) (*webhook.Delivery, error)
+	DeleteDeadLetter(ctx context.Context, id string) error
+}
+
+// HealthChecker is implemented by storage backends which can tell whether they are reachable.
+// Backends without it are considered healthy.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
 }
 
 type Service struct {
-	storage Storage
+	storage     Storage
+	auditSinks  []audit.Sink
+	subscribers []audit.Sink
+}
+
+type Option func(*Service)
+
+// WithAuditSinks records an audit event in every sink for each change made through the service.
+func WithAuditSinks(sinks ...audit.Sink) Option {
+	return func(s *Service) {
+		s.auditSinks = append(s.auditSinks, sinks...)
+	}
+}
+
+// WithSubscribers notifies every subscriber of each change made through the service, after the audit sinks.
+// Subscribers must not block, as they are called on the request path.
+func WithSubscribers(subscribers ...audit.Sink) Option {
+	return func(s *Service) {
+		s.subscribers = append(s.subscribers, subscribers...)
+	}
+}
+
+func NewMikrotikProvisioningService(storage Storage, options ...Option) *Service {
+	s := &Service{storage: storage}
+	for _, option := range options {
+		option(s)
+	}
+
+	return s
 }
 
-func NewMikrotikProvisioningService(storage Storage) *Service {
-	return &Service{storage: storage}
+// record writes the event to all audit sinks and subscribers. A failing sink does not undo the change,
+// so errors are only logged.
+func (s *Service) record(ctx context.Context, event *audit.Event) {
+	for _, sink := range s.auditSinks {
+		if err := sink.Write(ctx, event); err != nil {
+			logging.FromContext(ctx).Error("failed to write audit event", "error", err)
+		}
+	}
+
+	for _, subscriber := range s.subscribers {
+		if err := subscriber.Write(ctx, event); err != nil {
+			logging.FromContext(ctx).Error("failed to notify subscriber", "error", err)
+		}
+	}
 }
 
-func (s *Service) GetAddressLists(ctx context.Context) ([]*address_list.AddressList, error) {
-	return s.storage.GetAddressLists(ctx)
+// GetAddressLists returns a page of address lists. Expired entries are left out, as they are of all reads.
+func (s *Service) GetAddressLists(ctx context.Context, filter *address_list.Filter) ([]*address_list.AddressList, string, error) {
+	addressLists, cursor, err := s.storage.GetAddressLists(ctx, filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	for _, addressList := range addressLists {
+		addressList.Addresses = address_list.Unexpired(addressList.Addresses, now)
+	}
+
+	return addressLists, cursor, nil
+}
+
+// GetEntries returns a page of entries. Pages may be shorter than the limit, as expired entries are left out.
+func (s *Service) GetEntries(ctx context.Context, id string, filter *address_list.EntryFilter) ([]*address_list.Address, string, error) {
+	entries, cursor, err := s.storage.GetEntries(ctx, id, filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return address_list.Unexpired(entries, time.Now()), cursor, nil
 }
 
 func (s *Service) CreateAddressList(ctx context.Context, addressList *address_list.AddressList) (*address_list.AddressList, error) {
-	return s.storage.CreateAddressList(ctx, addressList)
+	stampEntries(nil, addressList.Addresses, time.Now().UTC())
+
+	created, err := s.storage.CreateAddressList(ctx, addressList)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, audit.NewEvent(ctx, audit.CreateAction, audit.AddressListResource, created.Name).WithDiff(nil, created))
+
+	return created, nil
 }
 
 func (s *Service) GetAddressList(ctx context.Context, name string) (*address_list.AddressList, error) {
-	return s.storage.GetAddressList(ctx, name)
+	addressList, err := s.storage.GetAddressList(ctx, name)
+	if err != nil || addressList == nil {
+		return addressList, err
+	}
+	addressList.Addresses = address_list.Unexpired(addressList.Addresses, time.Now())
+
+	return addressList, nil
+}
+
+func (s *Service) GetAddressListByID(ctx context.Context, id string) (*address_list.AddressList, error) {
+	return s.storage.GetAddressListByID(ctx, id)
 }
 
 func (s *Service) UpdateAddressList(ctx context.Context, id string, addressList *address_list.AddressList) (*address_list.AddressList, error) {
-	return s.storage.UpdateAddressList(ctx, id, addressList)
+	before, err := s.storage.GetAddressListByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	stampEntries(before, addressList.Addresses, time.Now().UTC())
+
+	updated, err := s.storage.UpdateAddressList(ctx, id, addressList)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, audit.NewEvent(ctx, audit.UpdateAction, audit.AddressListResource, updated.Name).WithDiff(before, updated))
+
+	return updated, nil
 }
 
 func (s *Service) DeleteAddressList(ctx context.Context, id string) error {
-	return s.storage.DeleteAddressList(ctx, id)
+	before, err := s.storage.GetAddressListByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.storage.DeleteAddressList(ctx, id); err != nil {
+		return err
+	}
+	if before != nil {
+		s.record(ctx, audit.NewEvent(ctx, audit.DeleteAction, audit.AddressListResource, before.Name).WithDiff(before, nil))
+	}
+
+	return nil
 }
 
 func (s *Service) UpdateEntriesInAddressList(ctx context.Context, action address_list.Action, id string, addresses []*address_list.Address) (*address_list.AddressList, error) {
-	return s.storage.UpdateEntriesInAddressList(ctx, action, id, addresses)
+	before, err := s.storage.GetAddressListByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if action == address_list.AddAction {
+		stampEntries(before, addresses, time.Now().UTC())
+	}
+
+	updated, err := s.storage.UpdateEntriesInAddressList(ctx, action, id, addresses)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, audit.NewEvent(ctx, audit.PatchAction, audit.AddressListResource, updated.Name).WithDiff(before, updated))
+
+	return updated, nil
+}
+
+func (s *Service) GetEntry(ctx context.Context, id string, address string) (*address_list.Address, error) {
+	entry, err := s.storage.GetEntry(ctx, id, address)
+	if err != nil || entry == nil || entry.Expired(time.Now()) {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// PutEntry creates or updates a single entry. Repeating the same request changes nothing and records no event.
+func (s *Service) PutEntry(ctx context.Context, id string, entry *address_list.Address) (*address_list.Address, bool, error) {
+	before, err := s.storage.GetAddressListByID(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now().UTC()
+	entry.CreatedAt = nil
+	entry.UpdatedAt = &now
+	entry.ExpiresAt = truncateExpiry(entry.ExpiresAt)
+
+	stored, created, err := s.storage.PutEntry(ctx, id, entry)
+	if err != nil {
+		return nil, false, err
+	}
+
+	after, err := s.storage.GetAddressListByID(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+	if after != nil {
+		if event := audit.NewEvent(ctx, audit.PatchAction, audit.AddressListResource, after.Name).WithDiff(before, after); len(event.Added) != 0 || len(event.Changed) != 0 {
+			s.record(ctx, event)
+		}
+	}
+
+	return stored, created, nil
+}
+
+func (s *Service) DeleteEntry(ctx context.Context, id string, address string) error {
+	before, err := s.storage.GetAddressListByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.storage.DeleteEntry(ctx, id, address); err != nil {
+		return err
+	}
+
+	after, err := s.storage.GetAddressListByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if after != nil {
+		s.record(ctx, audit.NewEvent(ctx, audit.PatchAction, audit.AddressListResource, after.Name).WithDiff(before, after))
+	}
+
+	return nil
+}
+
+// ExpireEntries removes expired entries every interval until the context is done. Reads leave expired entries
+// out right away, but only removing them changes the revision, which watchers and webhooks are notified of.
+func (s *Service) ExpireEntries(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := s.RemoveExpiredEntries(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			logging.FromContext(ctx).Error("failed to remove expired entries", "error", err)
+		}
+	}
+}
+
+// RemoveExpiredEntries removes the entries of every address list which expired at now. Lists are only written if
+// they still have the revision they were read with; a list changed meanwhile is left to the next run, so that an
+// entry renewed in between is kept. Each list is written on its own, so no transaction is needed.
+func (s *Service) RemoveExpiredEntries(ctx context.Context, now time.Time) error {
+	filter := &address_list.Filter{}
+	for {
+		addressLists, cursor, err := s.storage.GetAddressLists(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		for _, before := range addressLists {
+			after := *before
+			after.Addresses = address_list.Unexpired(before.Addresses, now)
+			if len(after.Addresses) == len(before.Addresses) {
+				continue
+			}
+
+			updated, err := s.storage.UpdateAddressListRevision(ctx, &after)
+			if errors.Is(err, address_list.ErrConflict) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			s.record(ctx, audit.NewEvent(ctx, audit.ExpireAction, audit.AddressListResource, before.Name).WithDiff(before, updated))
+		}
+
+		if cursor == "" {
+			return nil
+		}
+		filter.Cursor = cursor
+	}
+}
+
+func (s *Service) UpdateAddressLists(ctx context.Context, addressLists []*address_list.AddressList) ([]*address_list.AddressList, error) {
+	return s.storage.UpdateAddressLists(ctx, addressLists)
+}
+
+func (s *Service) UpdateAddressListRevision(ctx context.Context, addressList *address_list.AddressList) (*address_list.AddressList, error) {
+	return s.storage.UpdateAddressListRevision(ctx, addressList)
+}
+
+func (s *Service) DeleteAddressListRevision(ctx context.Context, id string, revision int64) error {
+	return s.storage.DeleteAddressListRevision(ctx, id, revision)
+}
+
+// ApplyChanges validates all operations, then applies them in order and writes all changed lists at once.
+// Operations on the same list see the effect of the preceding ones. If any operation is invalid, nothing is
+// written and address_list.ErrInvalidChanges is returned with the error in each result. In a dry run,
+// the results are computed without writing.
+func (s *Service) ApplyChanges(ctx context.Context, operations []*address_list.Operation, dryRun bool) ([]*address_list.OperationResult, error) {
+	results := make([]*address_list.OperationResult, len(operations))
+	before := make(map[string]*address_list.AddressList)
+	invalid := false
+
+	for i, operation := range operations {
+		results[i] = &address_list.OperationResult{List: operation.List, Action: operation.Action}
+
+		if err := operation.Validate(); err != nil {
+			results[i].Error = err.Error()
+			invalid = true
+			continue
+		}
+
+		if _, ok := before[operation.List]; !ok {
+			addressList, err := s.storage.GetAddressList(ctx, operation.List)
+			if err != nil {
+				return nil, err
+			}
+			before[operation.List] = addressList
+		}
+
+		if before[operation.List] == nil {
+			results[i].Error = fmt.Sprintf("address list not found: %s", operation.List)
+			invalid = true
+		}
+	}
+
+	if invalid {
+		return results, address_list.ErrInvalidChanges
+	}
+
+	entries := make(map[string][]*address_list.Address)
+	changed := make([]string, 0)
+	for i, operation := range operations {
+		current, ok := entries[operation.List]
+		if !ok {
+			current = before[operation.List].Addresses
+		}
+		for _, a := range operation.Addresses {
+			a.ExpiresAt = truncateExpiry(a.ExpiresAt)
+		}
+
+		entries[operation.List], results[i] = operation.Apply(current)
+		if len(results[i].Added) != 0 || len(results[i].Removed) != 0 || len(results[i].Changed) != 0 {
+			if !contains(changed, operation.List) {
+				changed = append(changed, operation.List)
+			}
+		}
+	}
+
+	if dryRun || len(changed) == 0 {
+		return results, nil
+	}
+
+	now := time.Now().UTC()
+	addressLists := make([]*address_list.AddressList, len(changed))
+	for i, name := range changed {
+		addressList := *before[name]
+		addressList.Addresses = entries[name]
+		stampEntries(before[name], addressList.Addresses, now)
+		addressLists[i] = &addressList
+	}
+
+	updated, err := s.storage.UpdateAddressLists(ctx, addressLists)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addressList := range updated {
+		s.record(ctx, audit.NewEvent(ctx, audit.PatchAction, audit.AddressListResource, addressList.Name).WithDiff(before[addressList.Name], addressList))
+	}
+
+	return results, nil
+}
+
+// PlanManifests compares the lists declared by the request with all stored lists. If the request names a
+// reviewed plan which differs from the computed one, address_list.ErrPlanChanged is returned.
+func (s *Service) PlanManifests(ctx context.Context, request *address_list.ApplyRequest) (*address_list.Plan, error) {
+	stored, _, err := s.storage.GetAddressLists(ctx, &address_list.Filter{})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := address_list.NewPlan(request, stored, time.Now())
+	if request.Plan != "" && request.Plan != plan.ID {
+		return plan, address_list.ErrPlanChanged
+	}
+
+	return plan, nil
+}
+
+// ApplyPlan writes the updates of the plan at once, failing with address_list.ErrConflict if any of the lists
+// changed since it was planned, and then creates and deletes lists one by one. Lists are only deleted at the
+// revision they were planned at. A failure in the second part leaves the earlier steps applied; planning again
+// picks up from there.
+func (s *Service) ApplyPlan(ctx context.Context, plan *address_list.Plan) error {
+	now := time.Now().UTC()
+	before := make(map[string]*address_list.AddressList)
+	updates := make([]*address_list.AddressList, 0)
+	for _, step := range plan.Steps {
+		if step.Action == address_list.UpdatePlanAction {
+			after := *step.After
+			stampEntries(step.Before, after.Addresses, now)
+			before[after.Name] = step.Before
+			updates = append(updates, &after)
+		}
+	}
+
+	if len(updates) != 0 {
+		updated, err := s.storage.UpdateAddressLists(ctx, updates)
+		if err != nil {
+			return err
+		}
+		for _, addressList := range updated {
+			s.record(ctx, audit.NewEvent(ctx, audit.UpdateAction, audit.AddressListResource, addressList.Name).WithDiff(before[addressList.Name], addressList))
+		}
+	}
+
+	for _, step := range plan.Steps {
+		switch step.Action {
+		case address_list.CreatePlanAction:
+			after := *step.After
+			if _, err := s.CreateAddressList(ctx, &after); err != nil {
+				return err
+			}
+		case address_list.DeletePlanAction:
+			if err := s.storage.DeleteAddressListRevision(ctx, step.Before.ID, step.Revision); err != nil {
+				return err
+			}
+			s.record(ctx, audit.NewEvent(ctx, audit.DeleteAction, audit.AddressListResource, step.List).WithDiff(step.Before, nil))
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) GetDevices(ctx context.Context) ([]*device.Device, error) {
+	return s.storage.GetDevices(ctx)
+}
+
+// CreateDevice stores the device with a newly generated token, which the device presents when fetching its script.
+func (s *Service) CreateDevice(ctx context.Context, device *device.Device) (*device.Device, error) {
+	token, err := generateDeviceToken()
+	if err != nil {
+		return nil, err
+	}
+	device.Token = token
+
+	created, err := s.storage.CreateDevice(ctx, device)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, audit.NewEvent(ctx, audit.CreateAction, audit.DeviceResource, created.Name))
+
+	return created, nil
+}
+
+func (s *Service) GetDevice(ctx context.Context, name string) (*device.Device, error) {
+	return s.storage.GetDevice(ctx, name)
+}
+
+func (s *Service) UpdateDevice(ctx context.Context, id string, device *device.Device) (*device.Device, error) {
+	updated, err := s.storage.UpdateDevice(ctx, id, device)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, audit.NewEvent(ctx, audit.UpdateAction, audit.DeviceResource, updated.Name))
+
+	return updated, nil
+}
+
+func (s *Service) GetDeviceByID(ctx context.Context, id string) (*device.Device, error) {
+	return s.storage.GetDeviceByID(ctx, id)
+}
+
+func (s *Service) DeleteDevice(ctx context.Context, id string) error {
+	before, err := s.storage.GetDeviceByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.storage.DeleteDevice(ctx, id); err != nil {
+		return err
+	}
+	if before != nil {
+		s.record(ctx, audit.NewEvent(ctx, audit.DeleteAction, audit.DeviceResource, before.Name))
+	}
+
+	return nil
+}
+
+func (s *Service) GetAPIKeys(ctx context.Context) ([]*apikey.APIKey, error) {
+	return s.storage.GetAPIKeys(ctx)
+}
+
+// CreateAPIKey generates an access and secret key pair. The returned key carries the secret,
+// the stored key only the signing key derived from it.
+func (s *Service) CreateAPIKey(ctx context.Context, key *apikey.APIKey) (*apikey.APIKey, error) {
+	accessKey, err := generateAccessKey()
+	if err != nil {
+		return nil, err
+	}
+
+	secretKey, err := generateSecretKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key.AccessKey = accessKey
+	key.SigningKey = hex.EncodeToString(hmacauth.DeriveKey(secretKey))
+	key.CreatedAt = time.Now().UTC()
+	key.LastUsedAt = nil
+	key.PreviousSigningKey = ""
+	key.PreviousExpiresAt = nil
+	key.SecretKey = ""
+
+	created, err := s.storage.CreateAPIKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, audit.NewEvent(ctx, audit.CreateAction, audit.APIKeyResource, created.AccessKey))
+	created.SecretKey = secretKey
+
+	return created, nil
+}
+
+func (s *Service) GetAPIKey(ctx context.Context, accessKey string) (*apikey.APIKey, error) {
+	return s.storage.GetAPIKey(ctx, accessKey)
+}
+
+func (s *Service) GetAPIKeyByID(ctx context.Context, id string) (*apikey.APIKey, error) {
+	return s.storage.GetAPIKeyByID(ctx, id)
+}
+
+func (s *Service) UpdateAPIKey(ctx context.Context, id string, key *apikey.APIKey) (*apikey.APIKey, error) {
+	updated, err := s.storage.UpdateAPIKey(ctx, id, key)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, audit.NewEvent(ctx, audit.UpdateAction, audit.APIKeyResource, updated.AccessKey))
+
+	return updated, nil
+}
+
+func (s *Service) TouchAPIKey(ctx context.Context, id string, lastUsedAt time.Time) error {
+	return s.storage.TouchAPIKey(ctx, id, lastUsedAt)
+}
+
+func (s *Service) DeleteAPIKey(ctx context.Context, id string) error {
+	before, err := s.storage.GetAPIKeyByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.storage.DeleteAPIKey(ctx, id); err != nil {
+		return err
+	}
+	if before != nil {
+		s.record(ctx, audit.NewEvent(ctx, audit.DeleteAction, audit.APIKeyResource, before.AccessKey))
+	}
+
+	return nil
+}
+
+func (s *Service) CreateAuditEvent(ctx context.Context, event *audit.Event) error {
+	return s.storage.CreateAuditEvent(ctx, event)
+}
+
+func (s *Service) GetAuditEvents(ctx context.Context, filter *audit.Filter) ([]*audit.Event, error) {
+	return s.storage.GetAuditEvents(ctx, filter)
+}
+
+// RotateAPIKey replaces the secret of a key. Requests signed with the old secret are accepted for the overlap period.
+func (s *Service) RotateAPIKey(ctx context.Context, key *apikey.APIKey, overlap time.Duration) (*apikey.APIKey, error) {
+	secretKey, err := generateSecretKey()
+	if err != nil {
+		return nil, err
+	}
+
+	previousExpiresAt := time.Now().UTC().Add(overlap)
+	key.PreviousSigningKey = key.SigningKey
+	key.PreviousExpiresAt = &previousExpiresAt
+	key.SigningKey = hex.EncodeToString(hmacauth.DeriveKey(secretKey))
+	key.SecretKey = ""
+
+	rotated, err := s.storage.UpdateAPIKey(ctx, key.ID, key)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, audit.NewEvent(ctx, audit.UpdateAction, audit.APIKeyResource, rotated.AccessKey))
+	rotated.SecretKey = secretKey
+
+	return rotated, nil
+}
+
+func generateAccessKey() (string, error) {
+	accessKey := make([]byte, 0, accessKeyLength)
+	buf := make([]byte, 1)
+	for len(accessKey) < accessKeyLength {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		// reject bytes that would bias the modulo towards the first characters
+		if int(buf[0]) >= 256-256%len(accessKeyAlphabet) {
+			continue
+		}
+		accessKey = append(accessKey, accessKeyAlphabet[int(buf[0])%len(accessKeyAlphabet)])
+	}
+
+	return string(accessKey), nil
+}
+
+func generateDeviceToken() (string, error) {
+	token := make([]byte, deviceTokenLength)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
+
+func generateSecretKey() (string, error) {
+	secretKey := make([]byte, secretKeyLength)
+	if _, err := rand.Read(secretKey); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secretKey), nil
+}
+
+func (s *Service) GetWebhooks(ctx context.Context) ([]*webhook.Webhook, error) {
+	return s.storage.GetWebhooks(ctx)
+}
+
+// CreateWebhook stores the webhook, generating a signing secret unless one is given.
+func (s *Service) CreateWebhook(ctx context.Context, wh *webhook.Webhook) (*webhook.Webhook, error) {
+	if wh.Secret == "" {
+		secret, err := generateSecretKey()
+		if err != nil {
+			return nil, err
+		}
+		wh.Secret = secret
+	}
+	wh.CreatedAt = time.Now().UTC()
+
+	created, err := s.storage.CreateWebhook(ctx, wh)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, audit.NewEvent(ctx, audit.CreateAction, audit.WebhookResource, created.ID))
+
+	return created, nil
+}
+
+func (s *Service) GetWebhook(ctx context.Context, id string) (*webhook.Webhook, error) {
+	return s.storage.GetWebhook(ctx, id)
+}
+
+func (s *Service) DeleteWebhook(ctx context.Context, id string) error {
+	if err := s.storage.DeleteWebhook(ctx, id); err != nil {
+		return err
+	}
+	s.record(ctx, audit.NewEvent(ctx, audit.DeleteAction, audit.WebhookResource, id))
+
+	return nil
+}
+
+func (s *Service) CreateDeadLetter(ctx context.Context, delivery *webhook.Delivery) error {
+	return s.storage.CreateDeadLetter(ctx, delivery)
+}
+
+func (s *Service) GetDeadLetters(ctx context.Context) ([]*webhook.Delivery, error) {
+	return s.storage.GetDeadLetters(ctx)
+}
+
+func (s *Service) GetDeadLetter(ctx context.Context, id string) (*webhook.Delivery, error) {
+	return s.storage.GetDeadLetter(ctx, id)
+}
+
+func (s *Service) DeleteDeadLetter(ctx context.Context, id string) error {
+	return s.storage.DeleteDeadLetter(ctx, id)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stampEntries sets the timestamps of entries about to be stored. Entries already in the list keep their creation
+// time, and their modification time unless the comment, disabled flag or expiry changed.
+func stampEntries(before *address_list.AddressList, entries []*address_list.Address, now time.Time) {
+	existing := make(map[string]*address_list.Address)
+	if before != nil {
+		for _, a := range before.Addresses {
+			existing[a.Address] = a
+		}
+	}
+
+	for _, entry := range entries {
+		createdAt, updatedAt := &now, &now
+		entry.ExpiresAt = truncateExpiry(entry.ExpiresAt)
+
+		if b, ok := existing[entry.Address]; ok {
+			if b.CreatedAt != nil {
+				createdAt = b.CreatedAt
+			}
+			if b.UpdatedAt != nil && b.SameAs(entry) {
+				updatedAt = b.UpdatedAt
+			}
+		}
+
+		entry.CreatedAt, entry.UpdatedAt = createdAt, updatedAt
+	}
+}
+
+// truncateExpiry stores expiry times in UTC at whole seconds, so that they compare equal after a round trip
+// through storage.
+func truncateExpiry(expiresAt *time.Time) *time.Time {
+	if expiresAt == nil {
+		return nil
+	}
+
+	t := expiresAt.UTC().Truncate(time.Second)
+	return &t
 }
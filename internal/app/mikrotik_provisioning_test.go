@@ -0,0 +1,42 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+)
+
+func TestStampEntries(t *testing.T) {
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	created, updated := now.Add(-2*time.Hour), now.Add(-time.Hour)
+	before := &address_list.AddressList{Name: "office", Addresses: []*address_list.Address{
+		{Address: "10.0.0.1", Comment: "gateway", CreatedAt: &created, UpdatedAt: &updated},
+		{Address: "10.0.0.2", CreatedAt: &created, UpdatedAt: &updated},
+		{Address: "10.0.0.3"},
+	}}
+
+	tests := []struct {
+		name          string
+		before        *address_list.AddressList
+		entry         *address_list.Address
+		wantCreatedAt time.Time
+		wantUpdatedAt time.Time
+	}{
+		{name: "new list", entry: &address_list.Address{Address: "10.0.0.1"}, wantCreatedAt: now, wantUpdatedAt: now},
+		{name: "new entry", before: before, entry: &address_list.Address{Address: "10.0.0.4"}, wantCreatedAt: now, wantUpdatedAt: now},
+		{name: "unchanged entry", before: before, entry: &address_list.Address{Address: "10.0.0.1", Comment: "gateway"}, wantCreatedAt: created, wantUpdatedAt: updated},
+		{name: "changed entry", before: before, entry: &address_list.Address{Address: "10.0.0.2", Disabled: true}, wantCreatedAt: created, wantUpdatedAt: now},
+		{name: "entry without timestamps", before: before, entry: &address_list.Address{Address: "10.0.0.3"}, wantCreatedAt: now, wantUpdatedAt: now},
+		{name: "timestamps from the request", before: before, entry: &address_list.Address{Address: "10.0.0.4", CreatedAt: &updated, UpdatedAt: &updated}, wantCreatedAt: now, wantUpdatedAt: now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stampEntries(tt.before, []*address_list.Address{tt.entry}, now)
+			if tt.entry.CreatedAt == nil || !tt.entry.CreatedAt.Equal(tt.wantCreatedAt) || tt.entry.UpdatedAt == nil || !tt.entry.UpdatedAt.Equal(tt.wantUpdatedAt) {
+				t.Errorf("stampEntries() = created %v, updated %v, want %v, %v", tt.entry.CreatedAt, tt.entry.UpdatedAt, tt.wantCreatedAt, tt.wantUpdatedAt)
+			}
+		})
+	}
+}
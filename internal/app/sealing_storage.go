@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+
+	"mikrotik_provisioning/internal/pkg/apikey"
+)
+
+// SealingStorage decorates a Storage so that the signing keys of API keys are stored sealed by an
+// apikey.Sealer and handed out in clear. Everything else is passed through.
+type SealingStorage struct {
+	Storage
+	sealer *apikey.Sealer
+}
+
+func NewSealingStorage(storage Storage, sealer *apikey.Sealer) *SealingStorage {
+	return &SealingStorage{Storage: storage, sealer: sealer}
+}
+
+// CheckHealth forwards to the decorated storage if it implements HealthChecker.
+func (s *SealingStorage) CheckHealth(ctx context.Context) error {
+	checker, ok := s.Storage.(HealthChecker)
+	if !ok {
+		return nil
+	}
+
+	return checker.CheckHealth(ctx)
+}
+
+func (s *SealingStorage) GetAPIKeys(ctx context.Context) ([]*apikey.APIKey, error) {
+	keys, err := s.Storage.GetAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if err := s.sealer.OpenKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *SealingStorage) CreateAPIKey(ctx context.Context, key *apikey.APIKey) (*apikey.APIKey, error) {
+	sealed, err := s.sealer.SealKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.open(s.Storage.CreateAPIKey(ctx, sealed))
+}
+
+func (s *SealingStorage) GetAPIKey(ctx context.Context, accessKey string) (*apikey.APIKey, error) {
+	return s.open(s.Storage.GetAPIKey(ctx, accessKey))
+}
+
+func (s *SealingStorage) GetAPIKeyByID(ctx context.Context, id string) (*apikey.APIKey, error) {
+	return s.open(s.Storage.GetAPIKeyByID(ctx, id))
+}
+
+func (s *SealingStorage) UpdateAPIKey(ctx context.Context, id string, key *apikey.APIKey) (*apikey.APIKey, error) {
+	sealed, err := s.sealer.SealKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.open(s.Storage.UpdateAPIKey(ctx, id, sealed))
+}
+
+func (s *SealingStorage) open(key *apikey.APIKey, err error) (*apikey.APIKey, error) {
+	if err != nil || key == nil {
+		return key, err
+	}
+
+	if err := s.sealer.OpenKey(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
@@ -18,18 +18,59 @@ type (
 	Config struct {
 		Access      *Access      `yaml:"access" validator:"required"`
 		DB          *Database    `yaml:"database" validator:"required"`
-		Application *Application `yaml:"application" validator:"required"`
+		Application *Application `yaml:"application" validator:"omitempty"`
+		Signing     *Signing     `yaml:"signing" validator:"omitempty"`
+		Audit       *Audit       `yaml:"audit" validator:"omitempty"`
+		Webhooks    *Webhooks    `yaml:"webhooks" validator:"omitempty"`
+		Watch       *Watch       `yaml:"watch" validator:"omitempty"`
+		Log         *Log         `yaml:"log" validator:"omitempty"`
 	}
 
 	Access struct {
-		Users []*User `yaml:"users" validator:"required"`
+		Users        []*User       `yaml:"users" validator:"required"`
+		ReplayWindow time.Duration `yaml:"replay_window" validator:"omitempty,min=1"`
+		OIDC         *OIDC         `yaml:"oidc" validator:"omitempty"`
+		// AnonymousRead serves address lists, their entries, loaders and watches to unauthenticated
+		// clients, such as routers fetching scripts without a client certificate. Authenticated
+		// requests are still limited to the lists granted to the principal.
+		AnonymousRead bool `yaml:"anonymous_read" validator:"omitempty"`
+		// KeyEncryptionKeyFile holds the secret the signing keys of API keys are encrypted with in the
+		// storage. Without it, signing keys are stored in clear and reading the storage is enough to sign
+		// requests as any API key.
+		KeyEncryptionKeyFile string `yaml:"key_encryption_key_file" validator:"omitempty,file"`
+	}
+
+	OIDC struct {
+		Issuer      string          `yaml:"issuer" validator:"required,url"`
+		Audience    string          `yaml:"audience" validator:"required"`
+		JWKSURL     string          `yaml:"jwks_url" validator:"required_without=JWKSFile,omitempty,url"`
+		JWKSFile    string          `yaml:"jwks_file" validator:"required_without=JWKSURL,omitempty,file"`
+		CacheTTL    time.Duration   `yaml:"cache_ttl" validator:"omitempty,min=1"`
+		GroupsClaim string          `yaml:"groups_claim" validator:"omitempty"`
+		Groups      []*GroupMapping `yaml:"groups" validator:"required,dive"`
+	}
+
+	// GroupMapping gives the members of an IdP group a role and optional per-list grants.
+	GroupMapping struct {
+		Group  string   `yaml:"group" validator:"required"`
+		Role   string   `yaml:"role" validator:"required,oneof=admin editor viewer device"`
+		Grants []*Grant `yaml:"grants" validator:"omitempty,dive"`
 	}
 
 	User struct {
-		AccessKey string `yaml:"access_key" bson:"access_key" validator:"required,access_key"`
-		SecretKey string `yaml:"secret_key" bson:"secret_key" validator:"required,secret_key"`
+		AccessKey string   `yaml:"access_key" bson:"access_key" validator:"required,access_key"`
+		SecretKey string   `yaml:"secret_key" bson:"secret_key" validator:"required,secret_key"`
+		Role      string   `yaml:"role" bson:"role" validator:"omitempty,oneof=admin editor viewer device"`
+		Grants    []*Grant `yaml:"grants" bson:"grants" validator:"omitempty,dive"`
 	}
 
+	Grant struct {
+		Lists   string   `yaml:"lists" bson:"lists" validator:"required"`
+		Actions []string `yaml:"actions" bson:"actions" validator:"omitempty,dive,oneof=read create update patch delete"`
+	}
+
+	// Database configures MongoDB. Batch changes, plan applies and imports write several lists in one
+	// transaction, which requires MongoDB to run as a replica set; a replica set of one member will do.
 	Database struct {
 		DSN         string        `yaml:"dsn" validator:"required,mongo_dsn"`
 		Name        string        `yaml:"name" validator:"required,alphanum"`
@@ -49,7 +90,71 @@ type (
 		Field  string `yaml:"field" validator:"required,alphanum"`
 	}
 
-	Application struct{}
+	// Application configures the HTTP server. Write timeouts also end watch streams, so keep them longer than
+	// the watch timeout or disabled when clients stream changes. The Swagger UI at /docs loads its assets
+	// from unpkg.com. X-Forwarded-For and X-Real-IP are only honoured for requests from the trusted proxies,
+	// given as addresses or CIDR ranges; otherwise the peer address is logged and audited.
+	Application struct {
+		ExternalURL     string        `yaml:"external_url" validator:"omitempty,url"`
+		Listen          string        `yaml:"listen" validator:"omitempty,listen_address"`
+		TLS             *TLS          `yaml:"tls" validator:"omitempty"`
+		ReadTimeout     time.Duration `yaml:"read_timeout" validator:"omitempty,min=1"`
+		WriteTimeout    time.Duration `yaml:"write_timeout" validator:"omitempty,min=1"`
+		IdleTimeout     time.Duration `yaml:"idle_timeout" validator:"omitempty,min=1"`
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout" validator:"omitempty,min=1"`
+		SwaggerUI       bool          `yaml:"swagger_ui" validator:"omitempty"`
+		TrustedProxies  []string      `yaml:"trusted_proxies" validator:"omitempty,dive,ip|cidr"`
+	}
+
+	// TLS enables HTTPS. With a client CA, client certificates signed by it are verified when presented,
+	// or always required with require_client_cert. Routers authenticate with certificates whose DNS name or
+	// common name is their device name; certificates listed in the CRL file are rejected.
+	TLS struct {
+		CertFile          string `yaml:"cert_file" validator:"required,file"`
+		KeyFile           string `yaml:"key_file" validator:"required,file"`
+		ClientCAFile      string `yaml:"client_ca_file" validator:"omitempty,file"`
+		CRLFile           string `yaml:"crl_file" validator:"omitempty,file"`
+		RequireClientCert bool   `yaml:"require_client_cert" validator:"omitempty"`
+	}
+
+	Signing struct {
+		Algorithm string `yaml:"algorithm" validator:"required,oneof=ed25519 hmac-sha256"`
+		KeyFile   string `yaml:"key_file" validator:"required,file"`
+	}
+
+	Audit struct {
+		Stdout  bool       `yaml:"stdout" validator:"omitempty"`
+		File    *AuditFile `yaml:"file" validator:"omitempty"`
+		Storage bool       `yaml:"storage" validator:"omitempty"`
+	}
+
+	AuditFile struct {
+		Path       string `yaml:"path" validator:"required"`
+		MaxSize    int64  `yaml:"max_size" validator:"omitempty,min=1"`
+		MaxBackups int    `yaml:"max_backups" validator:"omitempty,min=1"`
+	}
+
+	Webhooks struct {
+		MaxAttempts int           `yaml:"max_attempts" validator:"omitempty,min=1"`
+		BaseDelay   time.Duration `yaml:"base_delay" validator:"omitempty,min=1"`
+		MaxDelay    time.Duration `yaml:"max_delay" validator:"omitempty,min=1"`
+		Workers     int           `yaml:"workers" validator:"omitempty,min=1"`
+	}
+
+	// Watch configures GET /address-list/{name}/watch. With change streams, changes made by other replicas
+	// wake up watchers too; this requires MongoDB to run as a replica set.
+	Watch struct {
+		Timeout       time.Duration `yaml:"timeout" validator:"omitempty,min=1"`
+		Heartbeat     time.Duration `yaml:"heartbeat" validator:"omitempty,min=1"`
+		ChangeStreams bool          `yaml:"change_streams" validator:"omitempty"`
+	}
+
+	// Log configures the application log. At debug level, every MongoDB command is logged with its collection
+	// and the keys, not the values, of its filter.
+	Log struct {
+		Level  string `yaml:"level" validator:"omitempty,oneof=debug info warn error"`
+		Format string `yaml:"format" validator:"omitempty,oneof=json logfmt"`
+	}
 
 	Template struct {
 		Name string `yaml:"name" validator:"required,alphanum"`
@@ -68,6 +173,11 @@ func ParseConfig() (*Config, error) {
 		return nil, err
 	}
 
+	// The application section is optional, every setting of it has a default.
+	if config.Application == nil {
+		config.Application = new(Application)
+	}
+
 	validator := validator.New()
 	if err := valid.RegisterValidators(validator); err != nil {
 		return nil, err
@@ -76,5 +186,16 @@ func ParseConfig() (*Config, error) {
 		return nil, err
 	}
 
+	if err := validateApplication(config.Application); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
+
+// validateApplication enforces the validator tags of the application section. The tags of the other
+// sections are not enforced yet, as some of them, such as alphanum collection resources, reject
+// configurations in use.
+func validateApplication(application *Application) error {
+	return valid.Struct(application)
+}
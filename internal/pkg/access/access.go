@@ -0,0 +1,145 @@
+package access
+
+import (
+	"fmt"
+	"path"
+
+	"mikrotik_provisioning/internal/config"
+)
+
+type (
+	Role string
+
+	Action string
+
+	// Grant limits the actions of a user to the address lists matching a glob pattern, e.g. "blocklist-*".
+	Grant struct {
+		Lists   string
+		Actions []Action
+	}
+
+	// Principal is an authenticated API user, named by its access key or, for bearer tokens, its email or subject.
+	Principal struct {
+		Name   string
+		Role   Role
+		Grants []*Grant
+	}
+)
+
+const (
+	AdminRole  Role = "admin"
+	EditorRole Role = "editor"
+	ViewerRole Role = "viewer"
+	DeviceRole Role = "device"
+)
+
+const (
+	ReadAction   Action = "read"
+	CreateAction Action = "create"
+	UpdateAction Action = "update"
+	PatchAction  Action = "patch"
+	DeleteAction Action = "delete"
+)
+
+var actions = []Action{ReadAction, CreateAction, UpdateAction, PatchAction, DeleteAction}
+
+var roleActions = map[Role][]Action{
+	AdminRole:  actions,
+	EditorRole: {ReadAction, CreateAction, UpdateAction, PatchAction, DeleteAction},
+	ViewerRole: {ReadAction},
+	DeviceRole: {ReadAction},
+}
+
+// NewPrincipal returns the principal of a configured user or API key. Users without a role are
+// admins, as every user had full access before roles were introduced.
+func NewPrincipal(name string, role Role, configGrants []*config.Grant) *Principal {
+	if role == "" {
+		role = AdminRole
+	}
+
+	grants := make([]*Grant, 0, len(configGrants))
+	for _, g := range configGrants {
+		actions := make([]Action, 0, len(g.Actions))
+		for _, a := range g.Actions {
+			actions = append(actions, Action(a))
+		}
+		grants = append(grants, &Grant{Lists: g.Lists, Actions: actions})
+	}
+
+	return &Principal{Name: name, Role: role, Grants: grants}
+}
+
+// ValidateGrant returns an error if the list pattern of a grant is malformed or it names an unknown action,
+// as the grant could never match then.
+func ValidateGrant(grant *config.Grant) error {
+	if _, err := path.Match(grant.Lists, ""); err != nil {
+		return fmt.Errorf("invalid grant lists %q: %w", grant.Lists, err)
+	}
+
+	for _, a := range grant.Actions {
+		if !containsAction(actions, Action(a)) {
+			return fmt.Errorf("invalid grant action: %s", a)
+		}
+	}
+
+	return nil
+}
+
+// NewDevicePrincipal returns the principal of a router, which may only read its own address lists.
+func NewDevicePrincipal(name string, addressLists []string) *Principal {
+	grants := make([]*Grant, 0, len(addressLists))
+	for _, list := range addressLists {
+		grants = append(grants, &Grant{Lists: list, Actions: []Action{ReadAction}})
+	}
+
+	// A device without lists must not fall back to reading every list.
+	if len(grants) == 0 {
+		grants = append(grants, &Grant{Lists: "", Actions: []Action{ReadAction}})
+	}
+
+	return &Principal{Name: name, Role: DeviceRole, Grants: grants}
+}
+
+func (p *Principal) HasRole(roles ...Role) bool {
+	for _, role := range roles {
+		if p.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Can reports whether the principal may perform an action on an address list. The role decides
+// which actions are possible at all; if the principal has grants, one of them must also match the list.
+func (p *Principal) Can(action Action, list string) bool {
+	if p.Role == AdminRole {
+		return true
+	}
+
+	if !containsAction(roleActions[p.Role], action) {
+		return false
+	}
+
+	if len(p.Grants) == 0 {
+		return true
+	}
+
+	for _, g := range p.Grants {
+		if ok, _ := path.Match(g.Lists, list); ok && (len(g.Actions) == 0 || containsAction(g.Actions, action)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsAction(actions []Action, action Action) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,22 +1,29 @@
 package address_list
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
-	"gopkg.in/go-playground/validator.v9"
+	valid "mikrotik_provisioning/pkg/validator"
 )
 
 type (
 	Address struct {
-		Address  string `json:"address" bson:"address" validator:"required,ipv4|fqdn"`
-		Disabled bool   `json:"disabled,omitempty" bson:"disabled,omitempty" validator:"omitempty"`
-		Comment  string `json:"comment,omitempty" bson:"comment,omitempty" validator:"omitempty,comment"`
+		Address   string     `json:"address" bson:"address" validator:"required,ipv4|fqdn"`
+		Disabled  bool       `json:"disabled,omitempty" bson:"disabled,omitempty" validator:"omitempty"`
+		Comment   string     `json:"comment,omitempty" bson:"comment,omitempty" validator:"omitempty,comment"`
+		CreatedAt *time.Time `json:"created_at,omitempty" bson:"created_at,omitempty" validator:"omitempty"`
+		UpdatedAt *time.Time `json:"updated_at,omitempty" bson:"updated_at,omitempty" validator:"omitempty"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty" validator:"omitempty"`
 	}
 
 	AddressList struct {
-		ID        string     `json:"-" validator:"omitempty"`
-		Name      string     `json:"name" validator:"required,address_list_name"`
-		Addresses []*Address `json:"addresses" validator:"required"`
+		ID        string            `json:"-" validator:"omitempty"`
+		Name      string            `json:"name" validator:"required,address_list_name"`
+		Addresses []*Address        `json:"addresses" validator:"required,dive,required"`
+		Labels    map[string]string `json:"labels,omitempty" validator:"omitempty"`
+		Revision  int64             `json:"revision" validator:"omitempty"`
 	}
 
 	AddressListRequest struct {
@@ -27,9 +34,18 @@ type (
 		*AddressList
 	}
 
+	// EntryRequest is the body of PUT /address-list/{name}/entries/{address}. The address is taken from the URL.
+	EntryRequest struct {
+		*Address
+	}
+
+	AddressResponse struct {
+		*Address
+	}
+
 	AddressListPatchRequest struct {
 		Action    Action     `json:"action" validator:"required,oneof=add remove"`
-		Addresses []*Address `json:"addresses" validator:"required"`
+		Addresses []*Address `json:"addresses" validator:"required,dive,required"`
 	}
 
 	Action string
@@ -40,9 +56,49 @@ const (
 	RemoveAction Action = "remove"
 )
 
+// SameAs reports whether both entries are rendered the same, ignoring their timestamps.
+func (a *Address) SameAs(b *Address) bool {
+	if a.Comment != b.Comment || a.Disabled != b.Disabled {
+		return false
+	}
+	if a.ExpiresAt == nil || b.ExpiresAt == nil {
+		return a.ExpiresAt == b.ExpiresAt
+	}
+
+	return a.ExpiresAt.Equal(*b.ExpiresAt)
+}
+
+// Expired reports whether the entry has an expiry time which is not after now.
+func (a *Address) Expired(now time.Time) bool {
+	return a.ExpiresAt != nil && !a.ExpiresAt.After(now)
+}
+
+// Unexpired returns the entries which have not expired at now.
+func Unexpired(entries []*Address, now time.Time) []*Address {
+	kept := make([]*Address, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Expired(now) {
+			kept = append(kept, entry)
+		}
+	}
+
+	return kept
+}
+
 func (a *AddressListRequest) Bind(r *http.Request) error {
-	validator := validator.New()
-	if err := validator.Struct(a); err != nil {
+	if err := valid.Struct(a); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (e *EntryRequest) Bind(r *http.Request) error {
+	if e.Address == nil {
+		return fmt.Errorf("missing entry")
+	}
+
+	if err := valid.Struct(e); err != nil {
 		return err
 	}
 
@@ -50,8 +106,7 @@ func (a *AddressListRequest) Bind(r *http.Request) error {
 }
 
 func (a *AddressListPatchRequest) Bind(r *http.Request) error {
-	validator := validator.New()
-	if err := validator.Struct(a); err != nil {
+	if err := valid.Struct(a); err != nil {
 		return err
 	}
 
@@ -61,3 +116,7 @@ func (a *AddressListPatchRequest) Bind(r *http.Request) error {
 func (rd *AddressListResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
+
+func (rd *AddressResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,132 @@
+package address_list
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	valid "mikrotik_provisioning/pkg/validator"
+)
+
+var (
+	// ErrInvalidChanges is returned when at least one operation of a change set is invalid. Nothing is applied then,
+	// and the error of each operation is reported in its result.
+	ErrInvalidChanges = errors.New("invalid changes")
+	// ErrConflict is returned when a list was modified by someone else while changes were applied to it.
+	ErrConflict = errors.New("address list was modified concurrently")
+)
+
+var (
+	listNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	hostnamePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?\.)+[A-Za-z]{2,63}$`)
+)
+
+type (
+	// Operation adds or removes entries of one address list. Adding an entry which exists replaces its comment
+	// and disabled flag; removing an entry which does not exist is a no-op.
+	Operation struct {
+		List      string     `json:"list" validator:"required,address_list_name"`
+		Action    Action     `json:"action" validator:"required,oneof=add remove"`
+		Addresses []*Address `json:"addresses" validator:"required,min=1,dive,required"`
+	}
+
+	// OperationResult is the effect of an operation on the list, as it was after the preceding operations.
+	OperationResult struct {
+		List      string     `json:"list"`
+		Action    Action     `json:"action"`
+		Added     []*Address `json:"added,omitempty"`
+		Removed   []*Address `json:"removed,omitempty"`
+		Changed   []*Address `json:"changed,omitempty"`
+		Unchanged int        `json:"unchanged"`
+		Error     string     `json:"error,omitempty"`
+	}
+
+	ChangeRequest struct {
+		Operations []*Operation `json:"operations" validator:"required,dive"`
+	}
+
+	ChangeResponse struct {
+		DryRun  bool               `json:"dry_run"`
+		Applied bool               `json:"applied"`
+		Results []*OperationResult `json:"results"`
+	}
+)
+
+func (c *ChangeRequest) Bind(r *http.Request) error {
+	if len(c.Operations) == 0 {
+		return fmt.Errorf("missing operations")
+	}
+
+	for i, operation := range c.Operations {
+		if operation == nil {
+			return fmt.Errorf("missing operation %d", i)
+		}
+	}
+
+	return nil
+}
+
+func (c *ChangeResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// Validate checks the operation on its own. Whether the list exists is checked when the changes are applied.
+func (o *Operation) Validate() error {
+	return valid.Struct(o)
+}
+
+// Apply applies the operation to the entries of a list and returns the new entries with the result.
+// The entries passed in are not modified.
+func (o *Operation) Apply(entries []*Address) ([]*Address, *OperationResult) {
+	result := &OperationResult{List: o.List, Action: o.Action}
+
+	index := make(map[string]int)
+	next := make([]*Address, len(entries))
+	for i, entry := range entries {
+		next[i] = entry
+		index[entry.Address] = i
+	}
+
+	switch o.Action {
+	case AddAction:
+		for _, a := range o.Addresses {
+			i, ok := index[a.Address]
+			switch {
+			case !ok:
+				entry := *a
+				index[a.Address] = len(next)
+				next = append(next, &entry)
+				result.Added = append(result.Added, &entry)
+			case !next[i].SameAs(a):
+				entry := *next[i]
+				entry.Comment, entry.Disabled, entry.ExpiresAt = a.Comment, a.Disabled, a.ExpiresAt
+				next[i] = &entry
+				result.Changed = append(result.Changed, &entry)
+			default:
+				result.Unchanged++
+			}
+		}
+	case RemoveAction:
+		remove := make(map[string]bool)
+		for _, a := range o.Addresses {
+			if _, ok := index[a.Address]; ok && !remove[a.Address] {
+				remove[a.Address] = true
+			} else if !ok {
+				result.Unchanged++
+			}
+		}
+
+		kept := make([]*Address, 0, len(next))
+		for _, entry := range next {
+			if remove[entry.Address] {
+				result.Removed = append(result.Removed, entry)
+			} else {
+				kept = append(kept, entry)
+			}
+		}
+		next = kept
+	}
+
+	return next, result
+}
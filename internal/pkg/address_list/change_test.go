@@ -0,0 +1,84 @@
+package address_list
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestOperationValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation *Operation
+		valid     bool
+	}{
+		{name: "add", operation: &Operation{List: "office", Action: AddAction, Addresses: []*Address{{Address: "10.0.0.1"}, {Address: "vpn.example.com", Comment: "vpn"}}}, valid: true},
+		{name: "remove", operation: &Operation{List: "office-1", Action: RemoveAction, Addresses: []*Address{{Address: "10.0.0.1"}}}, valid: true},
+		{name: "list name", operation: &Operation{List: "office lab", Action: AddAction, Addresses: []*Address{{Address: "10.0.0.1"}}}},
+		{name: "missing list", operation: &Operation{Action: AddAction, Addresses: []*Address{{Address: "10.0.0.1"}}}},
+		{name: "action", operation: &Operation{List: "office", Action: "replace", Addresses: []*Address{{Address: "10.0.0.1"}}}},
+		{name: "missing addresses", operation: &Operation{List: "office", Action: AddAction}},
+		{name: "empty addresses", operation: &Operation{List: "office", Action: AddAction, Addresses: []*Address{}}},
+		{name: "missing address", operation: &Operation{List: "office", Action: AddAction, Addresses: []*Address{nil}}},
+		{name: "address", operation: &Operation{List: "office", Action: AddAction, Addresses: []*Address{{Address: "10.0.0.1/24"}}}},
+		{name: "comment", operation: &Operation{List: "office", Action: AddAction, Addresses: []*Address{{Address: "10.0.0.1", Comment: "a\x01b"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.operation.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestOperationApply(t *testing.T) {
+	entries := []*Address{{Address: "10.0.0.1", Comment: "gateway"}, {Address: "10.0.0.2"}}
+
+	tests := []struct {
+		name        string
+		operation   *Operation
+		wantEntries []string
+		wantResult  string
+	}{
+		{
+			name:        "add",
+			operation:   &Operation{List: "office", Action: AddAction, Addresses: []*Address{{Address: "10.0.0.3"}, {Address: "10.0.0.3"}}},
+			wantEntries: []string{"10.0.0.1 gateway false", "10.0.0.2  false", "10.0.0.3  false"},
+			wantResult:  "+1 -0 ~0 =1",
+		},
+		{
+			name:        "add existing",
+			operation:   &Operation{List: "office", Action: AddAction, Addresses: []*Address{{Address: "10.0.0.1", Comment: "gateway"}, {Address: "10.0.0.2", Disabled: true}}},
+			wantEntries: []string{"10.0.0.1 gateway false", "10.0.0.2  true"},
+			wantResult:  "+0 -0 ~1 =1",
+		},
+		{
+			name:        "remove",
+			operation:   &Operation{List: "office", Action: RemoveAction, Addresses: []*Address{{Address: "10.0.0.1"}, {Address: "10.0.0.1"}, {Address: "10.0.0.9"}}},
+			wantEntries: []string{"10.0.0.2  false"},
+			wantResult:  "+0 -1 ~0 =1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, result := tt.operation.Apply(entries)
+
+			got := make([]string, 0, len(next))
+			for _, e := range next {
+				got = append(got, fmt.Sprintf("%s %s %t", e.Address, e.Comment, e.Disabled))
+			}
+			if !reflect.DeepEqual(got, tt.wantEntries) {
+				t.Errorf("Apply() entries = %q, want %q", got, tt.wantEntries)
+			}
+			if got := fmt.Sprintf("+%d -%d ~%d =%d", len(result.Added), len(result.Removed), len(result.Changed), result.Unchanged); got != tt.wantResult {
+				t.Errorf("Apply() result = %s, want %s", got, tt.wantResult)
+			}
+			if entries[0].Comment != "gateway" || entries[1].Disabled {
+				t.Errorf("Apply() modified the entries passed in")
+			}
+		})
+	}
+}
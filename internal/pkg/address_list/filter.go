@@ -0,0 +1,63 @@
+package address_list
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+)
+
+const MaxLimit = 1000
+
+type (
+	// Filter selects address lists, ordered by name. Empty fields match everything.
+	Filter struct {
+		Prefix string
+		// Labels must all be set on a list. An empty value matches any value of the label.
+		Labels     map[string]string
+		Descending bool
+		// Limit of 0 returns all remaining lists.
+		Limit  int64
+		Cursor string
+	}
+
+	// EntryFilter selects entries of an address list, ordered by address. Empty fields match everything.
+	EntryFilter struct {
+		Address    string
+		Network    *net.IPNet
+		Comment    string
+		Disabled   *bool
+		Descending bool
+		Limit      int64
+		Cursor     string
+	}
+)
+
+// EncodeCursor returns the opaque cursor which continues a page after the given sort key.
+func EncodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// DecodeCursor returns the sort key of a cursor returned by EncodeCursor.
+func DecodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", fmt.Errorf("invalid cursor: %s", cursor)
+	}
+
+	return string(key), nil
+}
+
+// NetworkRange returns the first and last IPv4 address of the network as integers.
+func NetworkRange(network *net.IPNet) (uint32, uint32, error) {
+	ip := network.IP.To4()
+	mask := network.Mask
+	if ip == nil || len(mask) != net.IPv4len {
+		return 0, 0, fmt.Errorf("not an IPv4 network: %s", network)
+	}
+
+	first := uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+	hostmask := ^(uint32(mask[0])<<24 | uint32(mask[1])<<16 | uint32(mask[2])<<8 | uint32(mask[3]))
+	first &^= hostmask
+
+	return first, first | hostmask, nil
+}
@@ -0,0 +1,48 @@
+package address_list
+
+import (
+	"net"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	for _, key := range []string{"office", "10.0.0.1", "a/b+c=d", ""} {
+		got, err := DecodeCursor(EncodeCursor(key))
+		if err != nil || got != key {
+			t.Errorf("DecodeCursor(EncodeCursor(%q)) = %q, %v", key, got, err)
+		}
+	}
+
+	if _, err := DecodeCursor("not a cursor!"); err == nil {
+		t.Errorf("DecodeCursor() error = nil for an invalid cursor")
+	}
+}
+
+func TestNetworkRange(t *testing.T) {
+	tests := []struct {
+		cidr      string
+		wantFirst uint32
+		wantLast  uint32
+		wantErr   bool
+	}{
+		{cidr: "10.0.0.0/8", wantFirst: 0x0a000000, wantLast: 0x0affffff},
+		{cidr: "192.168.1.77/24", wantFirst: 0xc0a80100, wantLast: 0xc0a801ff},
+		{cidr: "10.0.0.1/32", wantFirst: 0x0a000001, wantLast: 0x0a000001},
+		{cidr: "0.0.0.0/0", wantFirst: 0, wantLast: 0xffffffff},
+		{cidr: "2001:db8::/32", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			_, network, err := net.ParseCIDR(tt.cidr)
+			if err != nil {
+				t.Fatalf("ParseCIDR() error = %v", err)
+			}
+
+			first, last, err := NetworkRange(network)
+			if (err != nil) != tt.wantErr || first != tt.wantFirst || last != tt.wantLast {
+				t.Errorf("NetworkRange() = %#x, %#x, %v, want %#x, %#x, error %t", first, last, err, tt.wantFirst, tt.wantLast, tt.wantErr)
+			}
+		})
+	}
+}
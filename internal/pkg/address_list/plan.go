@@ -0,0 +1,260 @@
+package address_list
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ManagedByLabel marks the lists owned by a set of manifests. Lists without it, or with another owner, are
+// never changed or deleted by an apply.
+const ManagedByLabel = "managed-by"
+
+// ErrPlanChanged is returned when the plan to apply differs from the plan which was reviewed, as the lists
+// were changed in the meantime.
+var ErrPlanChanged = errors.New("plan changed since it was reviewed")
+
+type (
+	// ApplyRequest declares the address lists owned by ManagedBy, usually one manifest file per list.
+	// Lists of the owner which are not declared are deleted only with Prune. Plan is the ID of the reviewed
+	// plan; when set, nothing is written unless the plan is still the same.
+	ApplyRequest struct {
+		ManagedBy string         `json:"managed_by" validator:"required"`
+		Prune     bool           `json:"prune,omitempty" validator:"omitempty"`
+		Plan      string         `json:"plan,omitempty" validator:"omitempty"`
+		Lists     []*AddressList `json:"lists" validator:"required"`
+	}
+
+	PlanAction string
+
+	// PlanStep is the change of one list. Labels are the new labels, if they change. Before and After are
+	// the list as stored and as it is to be written.
+	PlanStep struct {
+		Action   PlanAction        `json:"action"`
+		List     string            `json:"list"`
+		Revision int64             `json:"revision,omitempty"`
+		Labels   map[string]string `json:"labels,omitempty"`
+		Added    []*Address        `json:"added,omitempty"`
+		Removed  []*Address        `json:"removed,omitempty"`
+		Changed  []*Address        `json:"changed,omitempty"`
+		Reason   string            `json:"reason,omitempty"`
+		Before   *AddressList      `json:"-"`
+		After    *AddressList      `json:"-"`
+	}
+
+	// Plan is what an ApplyRequest changes. Its ID is derived from the steps and the revisions they were
+	// planned against, so that a reviewed plan can be applied only as long as nothing changed.
+	Plan struct {
+		ID        string      `json:"id"`
+		DryRun    bool        `json:"dry_run"`
+		Applied   bool        `json:"applied"`
+		Steps     []*PlanStep `json:"steps"`
+		Unchanged int         `json:"unchanged"`
+	}
+)
+
+const (
+	CreatePlanAction PlanAction = "create"
+	UpdatePlanAction PlanAction = "update"
+	DeletePlanAction PlanAction = "delete"
+	// SkipPlanAction reports a declared list which exists but is not managed by the owner of the request.
+	SkipPlanAction PlanAction = "skip"
+)
+
+func (a *ApplyRequest) Bind(r *http.Request) error {
+	if a.ManagedBy == "" {
+		return fmt.Errorf("missing managed_by")
+	}
+	if a.Lists == nil {
+		return fmt.Errorf("missing lists")
+	}
+
+	names := make(map[string]bool)
+	for i, addressList := range a.Lists {
+		if addressList == nil {
+			return fmt.Errorf("missing list %d", i)
+		}
+		if err := addressList.validateManifest(a.ManagedBy); err != nil {
+			return err
+		}
+		if names[addressList.Name] {
+			return fmt.Errorf("duplicate address list: %s", addressList.Name)
+		}
+		names[addressList.Name] = true
+	}
+
+	return nil
+}
+
+func (p *Plan) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// Changes reports whether applying the plan writes anything.
+func (p *Plan) Changes() bool {
+	for _, step := range p.Steps {
+		if step.Action != SkipPlanAction {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *AddressList) validateManifest(managedBy string) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	if owner, ok := l.Labels[ManagedByLabel]; ok && owner != managedBy {
+		return fmt.Errorf("address list %s: label %s must be %s", l.Name, ManagedByLabel, managedBy)
+	}
+
+	return nil
+}
+
+// Validate checks the name and entries of a list which was not bound from a single request, such as a
+// manifest or a restored archive.
+func (l *AddressList) Validate() error {
+	if !listNamePattern.MatchString(l.Name) {
+		return fmt.Errorf("invalid address list name: %s", l.Name)
+	}
+
+	addresses := make(map[string]bool)
+	for _, a := range l.Addresses {
+		if a == nil {
+			return fmt.Errorf("address list %s: missing address", l.Name)
+		}
+		if net.ParseIP(a.Address).To4() == nil && !hostnamePattern.MatchString(a.Address) {
+			return fmt.Errorf("address list %s: invalid address: %s", l.Name, a.Address)
+		}
+		if addresses[a.Address] {
+			return fmt.Errorf("address list %s: duplicate address: %s", l.Name, a.Address)
+		}
+		addresses[a.Address] = true
+	}
+
+	return nil
+}
+
+// NewPlan compares the declared lists with all stored lists. Declared lists are created, or updated if
+// they are managed by the owner of the request; with Prune, the other lists of the owner are deleted.
+// Entries which expired at now are treated as absent.
+func NewPlan(request *ApplyRequest, stored []*AddressList, now time.Time) *Plan {
+	plan := &Plan{Steps: make([]*PlanStep, 0)}
+
+	existing := make(map[string]*AddressList)
+	for _, addressList := range stored {
+		existing[addressList.Name] = addressList
+	}
+
+	declared := make(map[string]bool)
+	for _, manifest := range request.Lists {
+		declared[manifest.Name] = true
+
+		after := &AddressList{Name: manifest.Name, Addresses: make([]*Address, 0, len(manifest.Addresses)), Labels: map[string]string{ManagedByLabel: request.ManagedBy}}
+		for key, value := range manifest.Labels {
+			after.Labels[key] = value
+		}
+		for _, a := range manifest.Addresses {
+			after.Addresses = append(after.Addresses, &Address{Address: a.Address, Comment: a.Comment, Disabled: a.Disabled, ExpiresAt: a.ExpiresAt})
+		}
+
+		before, ok := existing[manifest.Name]
+		switch {
+		case !ok:
+			plan.Steps = append(plan.Steps, &PlanStep{Action: CreatePlanAction, List: after.Name, Labels: after.Labels, Added: after.Addresses, After: after})
+		case before.Labels[ManagedByLabel] != request.ManagedBy:
+			reason := "not managed"
+			if owner := before.Labels[ManagedByLabel]; owner != "" {
+				reason = "managed by " + owner
+			}
+			plan.Steps = append(plan.Steps, &PlanStep{Action: SkipPlanAction, List: before.Name, Revision: before.Revision, Reason: reason})
+		default:
+			after.ID, after.Revision = before.ID, before.Revision
+			step := diffLists(before, after, now)
+			if step == nil {
+				plan.Unchanged++
+				continue
+			}
+			plan.Steps = append(plan.Steps, step)
+		}
+	}
+
+	if request.Prune {
+		for _, before := range stored {
+			if !declared[before.Name] && before.Labels[ManagedByLabel] == request.ManagedBy {
+				plan.Steps = append(plan.Steps, &PlanStep{Action: DeletePlanAction, List: before.Name, Revision: before.Revision, Removed: Unexpired(before.Addresses, now), Before: before})
+			}
+		}
+	}
+
+	plan.ID = planID(plan.Steps)
+
+	return plan
+}
+
+// diffLists returns the update step from before to after, or nil if they are the same.
+func diffLists(before, after *AddressList, now time.Time) *PlanStep {
+	step := &PlanStep{Action: UpdatePlanAction, List: after.Name, Revision: before.Revision, Before: before, After: after}
+	if !sameLabels(before.Labels, after.Labels) {
+		step.Labels = after.Labels
+	}
+
+	current := make(map[string]*Address)
+	for _, a := range Unexpired(before.Addresses, now) {
+		current[a.Address] = a
+	}
+
+	wanted := make(map[string]bool)
+	for _, a := range after.Addresses {
+		wanted[a.Address] = true
+		if b, ok := current[a.Address]; !ok {
+			step.Added = append(step.Added, a)
+		} else if !b.SameAs(a) {
+			step.Changed = append(step.Changed, a)
+		}
+	}
+
+	for _, b := range Unexpired(before.Addresses, now) {
+		if !wanted[b.Address] {
+			step.Removed = append(step.Removed, b)
+		}
+	}
+
+	if step.Labels == nil && len(step.Added)+len(step.Removed)+len(step.Changed) == 0 {
+		return nil
+	}
+
+	return step
+}
+
+// SameAs reports whether other has the same labels and, at now, the same unexpired entries as the list,
+// ignoring their timestamps. Expired entries of other count as entries.
+func (l *AddressList) SameAs(other *AddressList, now time.Time) bool {
+	return diffLists(l, other, now) == nil
+}
+
+func sameLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if v, ok := b[key]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func planID(steps []*PlanStep) string {
+	data, _ := json.Marshal(steps)
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:16])
+}
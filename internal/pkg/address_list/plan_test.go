@@ -0,0 +1,152 @@
+package address_list
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewPlan(t *testing.T) {
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Minute)
+	managed := map[string]string{ManagedByLabel: "ops"}
+
+	tests := []struct {
+		name          string
+		prune         bool
+		stored        []*AddressList
+		declared      []*AddressList
+		wantSteps     []string
+		wantUnchanged int
+	}{
+		{
+			name:      "create",
+			declared:  []*AddressList{{Name: "office", Addresses: []*Address{{Address: "10.0.0.1"}}}},
+			wantSteps: []string{"create office@0 +1 -0 ~0"},
+		},
+		{
+			name:      "update entries",
+			stored:    []*AddressList{{ID: "1", Name: "office", Revision: 3, Labels: managed, Addresses: []*Address{{Address: "10.0.0.1"}, {Address: "10.0.0.2"}}}},
+			declared:  []*AddressList{{Name: "office", Addresses: []*Address{{Address: "10.0.0.2", Comment: "gateway"}, {Address: "10.0.0.3"}}}},
+			wantSteps: []string{"update office@3 +1 -1 ~1"},
+		},
+		{
+			name:      "update labels",
+			stored:    []*AddressList{{ID: "1", Name: "office", Revision: 3, Labels: managed}},
+			declared:  []*AddressList{{Name: "office", Labels: map[string]string{"env": "prod"}}},
+			wantSteps: []string{"update office@3 labels +0 -0 ~0"},
+		},
+		{
+			name:      "expired entries are absent",
+			stored:    []*AddressList{{ID: "1", Name: "office", Revision: 3, Labels: managed, Addresses: []*Address{{Address: "10.0.0.1", ExpiresAt: &expired}}}},
+			declared:  []*AddressList{{Name: "office", Addresses: []*Address{{Address: "10.0.0.1"}}}},
+			wantSteps: []string{"update office@3 +1 -0 ~0"},
+		},
+		{
+			name:      "skip other owner",
+			stored:    []*AddressList{{ID: "1", Name: "office", Revision: 3, Labels: map[string]string{ManagedByLabel: "network"}}},
+			declared:  []*AddressList{{Name: "office"}},
+			wantSteps: []string{"skip office@3 (managed by network) +0 -0 ~0"},
+		},
+		{
+			name:      "skip unmanaged",
+			stored:    []*AddressList{{ID: "1", Name: "office", Revision: 3}},
+			declared:  []*AddressList{{Name: "office"}},
+			wantSteps: []string{"skip office@3 (not managed) +0 -0 ~0"},
+		},
+		{
+			name:  "prune",
+			prune: true,
+			stored: []*AddressList{
+				{ID: "1", Name: "lab", Revision: 2, Labels: managed, Addresses: []*Address{{Address: "10.1.0.1"}, {Address: "10.1.0.2", ExpiresAt: &expired}}},
+				{ID: "2", Name: "office", Revision: 3, Labels: managed},
+				{ID: "3", Name: "remote", Revision: 4, Labels: map[string]string{ManagedByLabel: "network"}},
+				{ID: "4", Name: "vpn", Revision: 5},
+			},
+			declared:      []*AddressList{{Name: "office"}},
+			wantSteps:     []string{"delete lab@2 +0 -1 ~0"},
+			wantUnchanged: 1,
+		},
+		{
+			name:          "no prune",
+			stored:        []*AddressList{{ID: "1", Name: "lab", Revision: 2, Labels: managed}},
+			declared:      []*AddressList{},
+			wantSteps:     []string{},
+			wantUnchanged: 0,
+		},
+		{
+			name:          "unchanged",
+			stored:        []*AddressList{{ID: "1", Name: "office", Revision: 3, Labels: map[string]string{ManagedByLabel: "ops", "env": "prod"}, Addresses: []*Address{{Address: "10.0.0.1", Comment: "gateway"}}}},
+			declared:      []*AddressList{{Name: "office", Labels: map[string]string{"env": "prod"}, Addresses: []*Address{{Address: "10.0.0.1", Comment: "gateway"}}}},
+			wantSteps:     []string{},
+			wantUnchanged: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := NewPlan(&ApplyRequest{ManagedBy: "ops", Prune: tt.prune, Lists: tt.declared}, tt.stored, now)
+
+			steps := make([]string, 0, len(plan.Steps))
+			for _, step := range plan.Steps {
+				steps = append(steps, describeStep(step))
+			}
+			if !reflect.DeepEqual(steps, tt.wantSteps) {
+				t.Errorf("NewPlan() steps = %q, want %q", steps, tt.wantSteps)
+			}
+			if plan.Unchanged != tt.wantUnchanged {
+				t.Errorf("NewPlan() unchanged = %d, want %d", plan.Unchanged, tt.wantUnchanged)
+			}
+		})
+	}
+}
+
+func TestNewPlanAfterKeepsOwner(t *testing.T) {
+	stored := []*AddressList{{ID: "1", Name: "office", Revision: 3, Labels: map[string]string{ManagedByLabel: "ops"}}}
+	declared := []*AddressList{{Name: "office", Labels: map[string]string{"env": "prod"}, Addresses: []*Address{{Address: "10.0.0.1"}}}}
+
+	plan := NewPlan(&ApplyRequest{ManagedBy: "ops", Lists: declared}, stored, time.Now())
+	if len(plan.Steps) != 1 {
+		t.Fatalf("NewPlan() steps = %d, want 1", len(plan.Steps))
+	}
+
+	after := plan.Steps[0].After
+	if after.ID != "1" || after.Revision != 3 {
+		t.Errorf("After = ID %s at revision %d, want the stored list at revision 3", after.ID, after.Revision)
+	}
+	if want := map[string]string{ManagedByLabel: "ops", "env": "prod"}; !reflect.DeepEqual(after.Labels, want) {
+		t.Errorf("After labels = %v, want %v", after.Labels, want)
+	}
+	if declared[0].Labels[ManagedByLabel] != "" {
+		t.Errorf("NewPlan() labelled the declared list")
+	}
+}
+
+func TestNewPlanID(t *testing.T) {
+	now := time.Now()
+	declared := []*AddressList{{Name: "office", Addresses: []*Address{{Address: "10.0.0.1"}}}}
+	stored := func(revision int64) []*AddressList {
+		return []*AddressList{{ID: "1", Name: "office", Revision: revision, Labels: map[string]string{ManagedByLabel: "ops"}}}
+	}
+
+	plan := NewPlan(&ApplyRequest{ManagedBy: "ops", Lists: declared}, stored(3), now)
+	if again := NewPlan(&ApplyRequest{ManagedBy: "ops", Lists: declared}, stored(3), now); again.ID != plan.ID {
+		t.Errorf("NewPlan() ID = %s, then %s for the same lists", plan.ID, again.ID)
+	}
+	if changed := NewPlan(&ApplyRequest{ManagedBy: "ops", Lists: declared}, stored(4), now); changed.ID == plan.ID {
+		t.Errorf("NewPlan() ID = %s after the list changed, want a new ID", changed.ID)
+	}
+}
+
+func describeStep(step *PlanStep) string {
+	s := fmt.Sprintf("%s %s@%d", step.Action, step.List, step.Revision)
+	if step.Labels != nil && step.Action == UpdatePlanAction {
+		s += " labels"
+	}
+	if step.Reason != "" {
+		s += " (" + step.Reason + ")"
+	}
+
+	return fmt.Sprintf("%s +%d -%d ~%d", s, len(step.Added), len(step.Removed), len(step.Changed))
+}
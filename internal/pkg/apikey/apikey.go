@@ -0,0 +1,118 @@
+package apikey
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"mikrotik_provisioning/internal/config"
+	"mikrotik_provisioning/internal/pkg/access"
+	valid "mikrotik_provisioning/pkg/validator"
+)
+
+type (
+	// APIKey is an access/secret key pair managed through the API. Only the signing key derived
+	// from the secret with hmacauth.DeriveKey is stored; the secret itself is returned once, when
+	// the key is created or rotated. The signing key suffices to sign requests, so it is stored
+	// sealed by a Sealer if a key encryption key is configured.
+	APIKey struct {
+		ID          string          `json:"-" validator:"omitempty"`
+		AccessKey   string          `json:"access_key" validator:"omitempty"`
+		SecretKey   string          `json:"secret_key,omitempty" validator:"omitempty"`
+		SigningKey  string          `json:"-" validator:"omitempty"`
+		Description string          `json:"description,omitempty" validator:"omitempty"`
+		Role        string          `json:"role" validator:"required,oneof=admin editor viewer device"`
+		Grants      []*config.Grant `json:"grants,omitempty" validator:"omitempty,dive"`
+		CreatedAt   time.Time       `json:"created_at" validator:"omitempty"`
+		ExpiresAt   *time.Time      `json:"expires_at,omitempty" validator:"omitempty"`
+		LastUsedAt  *time.Time      `json:"last_used_at,omitempty" validator:"omitempty"`
+
+		// PreviousSigningKey stays valid until PreviousExpiresAt after a rotation, so that clients can switch over.
+		PreviousSigningKey string     `json:"-" validator:"omitempty"`
+		PreviousExpiresAt  *time.Time `json:"previous_expires_at,omitempty" validator:"omitempty"`
+	}
+
+	APIKeyRequest struct {
+		*APIKey
+	}
+
+	APIKeyResponse struct {
+		*APIKey
+	}
+
+	RotateRequest struct {
+		Overlap string `json:"overlap" validator:"omitempty"`
+	}
+)
+
+const DefaultRotationOverlap = 24 * time.Hour
+
+// SigningKeys returns the keys a request may be signed with at the given time.
+func (k *APIKey) SigningKeys(now time.Time) [][]byte {
+	keys := make([][]byte, 0, 2)
+	if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		return keys
+	}
+
+	if key, err := hex.DecodeString(k.SigningKey); err == nil {
+		keys = append(keys, key)
+	}
+	if k.PreviousSigningKey != "" && k.PreviousExpiresAt != nil && now.Before(*k.PreviousExpiresAt) {
+		if key, err := hex.DecodeString(k.PreviousSigningKey); err == nil {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func (k *APIKeyRequest) Bind(r *http.Request) error {
+	if k.APIKey == nil {
+		return fmt.Errorf("missing api key")
+	}
+
+	if err := valid.Struct(k); err != nil {
+		return err
+	}
+
+	switch k.Role {
+	case "admin", "editor", "viewer", "device":
+	default:
+		return fmt.Errorf("invalid role: %s", k.Role)
+	}
+
+	for i, grant := range k.Grants {
+		if grant == nil {
+			return fmt.Errorf("missing grant %d", i)
+		}
+		if err := access.ValidateGrant(grant); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rr *RotateRequest) Bind(r *http.Request) error {
+	if rr.Overlap != "" {
+		if _, err := time.ParseDuration(rr.Overlap); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OverlapDuration returns the requested overlap or DefaultRotationOverlap if it is not set.
+func (rr *RotateRequest) OverlapDuration() time.Duration {
+	if overlap, err := time.ParseDuration(rr.Overlap); err == nil && overlap >= 0 {
+		return overlap
+	}
+
+	return DefaultRotationOverlap
+}
+
+func (kr *APIKeyResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
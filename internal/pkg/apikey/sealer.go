@@ -0,0 +1,117 @@
+package apikey
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// sealedPrefix marks signing keys encrypted by a Sealer, so that keys stored before encryption was
+// configured can still be read.
+const sealedPrefix = "sealed:"
+
+// Sealer encrypts signing keys at rest with AES-256-GCM. A signing key is all that is needed to sign
+// requests, so without a Sealer anyone able to read the storage can act as any API key.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer returns a Sealer with the SHA-256 of secret as its key.
+func NewSealer(secret []byte) (*Sealer, error) {
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sealer{aead: aead}, nil
+}
+
+// NewSealerFromFile returns a Sealer keyed with the contents of a file, without surrounding whitespace.
+func NewSealerFromFile(path string) (*Sealer, error) {
+	secret, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	secret = []byte(strings.TrimSpace(string(secret)))
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("empty key encryption key file: %s", path)
+	}
+
+	return NewSealer(secret)
+}
+
+// Seal encrypts a signing key of the access key. The access key is authenticated along with it, so a
+// sealed signing key cannot be moved to another API key.
+func (s *Sealer) Seal(accessKey, signingKey string) (string, error) {
+	if signingKey == "" || strings.HasPrefix(signingKey, sealedPrefix) {
+		return signingKey, nil
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := s.aead.Seal(nonce, nonce, []byte(signingKey), []byte(accessKey))
+
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a signing key sealed for the access key. Signing keys stored in clear are returned as
+// they are, and sealed the next time the API key is written.
+func (s *Sealer) Open(accessKey, stored string) (string, error) {
+	if !strings.HasPrefix(stored, sealedPrefix) {
+		return stored, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedPrefix))
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", fmt.Errorf("invalid sealed signing key of access key: %s", accessKey)
+	}
+
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	signingKey, err := s.aead.Open(nil, nonce, ciphertext, []byte(accessKey))
+	if err != nil {
+		return "", fmt.Errorf("cannot open signing key of access key %s: %w", accessKey, err)
+	}
+
+	return string(signingKey), nil
+}
+
+// SealKey returns a copy of the API key with its signing keys sealed.
+func (s *Sealer) SealKey(key *APIKey) (*APIKey, error) {
+	sealed := *key
+
+	var err error
+	if sealed.SigningKey, err = s.Seal(key.AccessKey, key.SigningKey); err != nil {
+		return nil, err
+	}
+	if sealed.PreviousSigningKey, err = s.Seal(key.AccessKey, key.PreviousSigningKey); err != nil {
+		return nil, err
+	}
+
+	return &sealed, nil
+}
+
+// OpenKey decrypts the signing keys of an API key in place.
+func (s *Sealer) OpenKey(key *APIKey) error {
+	var err error
+	if key.SigningKey, err = s.Open(key.AccessKey, key.SigningKey); err != nil {
+		return err
+	}
+	key.PreviousSigningKey, err = s.Open(key.AccessKey, key.PreviousSigningKey)
+
+	return err
+}
@@ -0,0 +1,257 @@
+// Package archive reads and writes backups of the provisioning data which do not depend on the storage backend.
+//
+// An archive is a stream of JSON lines. The first line is the header and the last one the trailer, which
+// counts the records in between, so that an archive cut short is not mistaken for a complete one. Every
+// other line is a record of one address list, device, API key or audit event:
+//
+//	{"kind":"header","data":{"version":1,"created_at":"2020-10-20T12:00:00Z","secrets":false}}
+//	{"kind":"address_list","data":{"name":"blocklist","addresses":[{"address":"192.0.2.1"}],"revision":3}}
+//	{"kind":"device","data":{"name":"gw-office","address_lists":["blocklist"]}}
+//	{"kind":"trailer","data":{"records":2}}
+//
+// API keys carry their signing keys, and devices their tokens, only in archives created with secrets.
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"mikrotik_provisioning/internal/config"
+	"mikrotik_provisioning/internal/pkg/apikey"
+)
+
+// Version is the version of the archive format written. Archives of newer versions are rejected.
+const Version = 1
+
+// ContentType is the media type of archives.
+const ContentType = "application/x-ndjson"
+
+// maxLineSize bounds a single record, such as an address list with all its entries.
+const maxLineSize = 64 << 20
+
+var (
+	ErrMissingHeader      = errors.New("archive does not start with a header")
+	ErrUnsupportedVersion = errors.New("unsupported archive version")
+	ErrIncomplete         = errors.New("archive is incomplete")
+)
+
+type (
+	Kind string
+
+	// Mode selects how an archive is restored. Merge creates and updates what the archive contains and keeps
+	// everything else; replace also deletes the address lists, devices and API keys missing from it.
+	// Audit events are only ever added.
+	Mode string
+
+	Record struct {
+		Kind Kind            `json:"kind"`
+		Data json.RawMessage `json:"data"`
+	}
+
+	Header struct {
+		Version   int       `json:"version"`
+		CreatedAt time.Time `json:"created_at"`
+		Secrets   bool      `json:"secrets"`
+	}
+
+	Trailer struct {
+		Records int `json:"records"`
+	}
+
+	// APIKey is an API key as archived. The signing keys are derived from the secret key and are set
+	// only in archives with secrets.
+	APIKey struct {
+		AccessKey          string          `json:"access_key"`
+		Description        string          `json:"description,omitempty"`
+		Role               string          `json:"role"`
+		Grants             []*config.Grant `json:"grants,omitempty"`
+		CreatedAt          time.Time       `json:"created_at"`
+		ExpiresAt          *time.Time      `json:"expires_at,omitempty"`
+		LastUsedAt         *time.Time      `json:"last_used_at,omitempty"`
+		SigningKey         string          `json:"signing_key,omitempty"`
+		PreviousSigningKey string          `json:"previous_signing_key,omitempty"`
+		PreviousExpiresAt  *time.Time      `json:"previous_expires_at,omitempty"`
+	}
+
+	// Counts is what a restore did to the records of one kind.
+	Counts struct {
+		Created int `json:"created"`
+		Updated int `json:"updated"`
+		Deleted int `json:"deleted"`
+		Skipped int `json:"skipped"`
+	}
+
+	// Result is the outcome of a restore. The names of the deleted lists and devices are kept for the
+	// caller to clean up after them.
+	Result struct {
+		Mode                Mode     `json:"mode"`
+		Version             int      `json:"version"`
+		AddressLists        Counts   `json:"address_lists"`
+		Devices             Counts   `json:"devices"`
+		APIKeys             Counts   `json:"api_keys"`
+		AuditEvents         Counts   `json:"audit_events"`
+		DeletedAddressLists []string `json:"-"`
+		DeletedDevices      []string `json:"-"`
+	}
+
+	Writer struct {
+		encoder *json.Encoder
+		records int
+	}
+
+	Reader struct {
+		scanner *bufio.Scanner
+		line    int
+	}
+)
+
+const (
+	HeaderKind      Kind = "header"
+	AddressListKind Kind = "address_list"
+	DeviceKind      Kind = "device"
+	APIKeyKind      Kind = "api_key"
+	AuditEventKind  Kind = "audit_event"
+	TrailerKind     Kind = "trailer"
+
+	MergeMode   Mode = "merge"
+	ReplaceMode Mode = "replace"
+)
+
+// NewAPIKey returns the archived form of key, with its signing keys only if secrets is set.
+func NewAPIKey(key *apikey.APIKey, secrets bool) *APIKey {
+	archived := &APIKey{
+		AccessKey:         key.AccessKey,
+		Description:       key.Description,
+		Role:              key.Role,
+		Grants:            key.Grants,
+		CreatedAt:         key.CreatedAt,
+		ExpiresAt:         key.ExpiresAt,
+		LastUsedAt:        key.LastUsedAt,
+		PreviousExpiresAt: key.PreviousExpiresAt,
+	}
+	if secrets {
+		archived.SigningKey, archived.PreviousSigningKey = key.SigningKey, key.PreviousSigningKey
+	}
+
+	return archived
+}
+
+func (k *APIKey) ToAPIKey() *apikey.APIKey {
+	return &apikey.APIKey{
+		AccessKey:          k.AccessKey,
+		Description:        k.Description,
+		Role:               k.Role,
+		Grants:             k.Grants,
+		CreatedAt:          k.CreatedAt,
+		ExpiresAt:          k.ExpiresAt,
+		LastUsedAt:         k.LastUsedAt,
+		SigningKey:         k.SigningKey,
+		PreviousSigningKey: k.PreviousSigningKey,
+		PreviousExpiresAt:  k.PreviousExpiresAt,
+	}
+}
+
+func (r *Result) Render(w http.ResponseWriter, req *http.Request) error {
+	return nil
+}
+
+// ParseMode returns the mode named by value; an empty value is MergeMode.
+func ParseMode(value string) (Mode, error) {
+	switch Mode(value) {
+	case "", MergeMode:
+		return MergeMode, nil
+	case ReplaceMode:
+		return ReplaceMode, nil
+	}
+
+	return "", fmt.Errorf("invalid mode: %s", value)
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{encoder: json.NewEncoder(w)}
+}
+
+// Write writes one record of the kind. The first record must be the header.
+func (w *Writer) Write(kind Kind, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if kind != HeaderKind {
+		w.records++
+	}
+
+	return w.encoder.Encode(&Record{Kind: kind, Data: data})
+}
+
+// Close writes the trailer, which completes the archive.
+func (w *Writer) Close() error {
+	return w.Write(TrailerKind, &Trailer{Records: w.records})
+}
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	return &Reader{scanner: scanner}
+}
+
+// ReadHeader reads the header, which must come first, and checks its version.
+func (r *Reader) ReadHeader() (*Header, error) {
+	record, err := r.Next()
+	if err == io.EOF || (err == nil && record.Kind != HeaderKind) {
+		return nil, ErrMissingHeader
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	header := new(Header)
+	if err := json.Unmarshal(record.Data, header); err != nil {
+		return nil, fmt.Errorf("line %d: %s", r.line, err)
+	}
+	if header.Version < 1 || header.Version > Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, header.Version)
+	}
+
+	return header, nil
+}
+
+// Next returns the next record, or io.EOF at the end of the archive. Empty lines are skipped.
+func (r *Reader) Next() (*Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		if len(r.scanner.Bytes()) == 0 {
+			continue
+		}
+
+		record := new(Record)
+		if err := json.Unmarshal(r.scanner.Bytes(), record); err != nil {
+			return nil, fmt.Errorf("line %d: %s", r.line, err)
+		}
+		if record.Kind == "" {
+			return nil, fmt.Errorf("line %d: missing kind", r.line)
+		}
+
+		return record, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+// Decode decodes the data of the record read last into v.
+func (r *Reader) Decode(record *Record, v interface{}) error {
+	if err := json.Unmarshal(record.Data, v); err != nil {
+		return fmt.Errorf("line %d: %s %s", r.line, record.Kind, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/apikey"
+	"mikrotik_provisioning/internal/pkg/audit"
+	"mikrotik_provisioning/internal/pkg/device"
+)
+
+var (
+	deviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	accessKeyPattern  = regexp.MustCompile(`^[A-Z0-9]+$`)
+)
+
+// Contents is a whole archive, read and validated before anything of it is restored.
+type Contents struct {
+	Header       *Header
+	AddressLists []*address_list.AddressList
+	Devices      []*device.Device
+	APIKeys      []*APIKey
+	AuditEvents  []*audit.Event
+}
+
+// ReadAll reads the archive up to its trailer. It fails on the first record which is invalid, of an unknown
+// kind, or names an address list, device or API key already read, and with ErrIncomplete if the trailer is
+// missing or counts another number of records.
+func ReadAll(r *Reader) (*Contents, error) {
+	header, err := r.ReadHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	contents := &Contents{Header: header}
+	names := map[Kind]map[string]bool{AddressListKind: {}, DeviceKind: {}, APIKeyKind: {}}
+	records := 0
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return nil, ErrIncomplete
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record.Kind == TrailerKind {
+			if err := readTrailer(r, record, records); err != nil {
+				return nil, err
+			}
+			return contents, nil
+		}
+		records++
+
+		var name string
+		switch record.Kind {
+		case AddressListKind:
+			addressList := new(address_list.AddressList)
+			if err := r.Decode(record, addressList); err != nil {
+				return nil, err
+			}
+			if err := addressList.Validate(); err != nil {
+				return nil, fmt.Errorf("line %d: %s", r.line, err)
+			}
+			if addressList.Addresses == nil {
+				addressList.Addresses = make([]*address_list.Address, 0)
+			}
+			name = addressList.Name
+			contents.AddressLists = append(contents.AddressLists, addressList)
+		case DeviceKind:
+			d := new(device.Device)
+			if err := r.Decode(record, d); err != nil {
+				return nil, err
+			}
+			if err := validateDevice(d); err != nil {
+				return nil, fmt.Errorf("line %d: %s", r.line, err)
+			}
+			name = d.Name
+			contents.Devices = append(contents.Devices, d)
+		case APIKeyKind:
+			key := new(APIKey)
+			if err := r.Decode(record, key); err != nil {
+				return nil, err
+			}
+			if err := validateAPIKey(key); err != nil {
+				return nil, fmt.Errorf("line %d: %s", r.line, err)
+			}
+			name = key.AccessKey
+			contents.APIKeys = append(contents.APIKeys, key)
+		case AuditEventKind:
+			event := new(audit.Event)
+			if err := r.Decode(record, event); err != nil {
+				return nil, err
+			}
+			if event.Time.IsZero() || event.Action == "" || event.Resource == "" {
+				return nil, fmt.Errorf("line %d: incomplete audit event", r.line)
+			}
+			event.ID = ""
+			contents.AuditEvents = append(contents.AuditEvents, event)
+			continue
+		case HeaderKind:
+			return nil, fmt.Errorf("line %d: duplicate header", r.line)
+		default:
+			return nil, fmt.Errorf("line %d: unknown record kind: %s", r.line, record.Kind)
+		}
+
+		if names[record.Kind][name] {
+			return nil, fmt.Errorf("line %d: duplicate %s: %s", r.line, record.Kind, name)
+		}
+		names[record.Kind][name] = true
+	}
+}
+
+func readTrailer(r *Reader, record *Record, records int) error {
+	trailer := new(Trailer)
+	if err := r.Decode(record, trailer); err != nil {
+		return err
+	}
+	if trailer.Records != records {
+		return fmt.Errorf("%w: %d of %d records", ErrIncomplete, records, trailer.Records)
+	}
+
+	if _, err := r.Next(); err != io.EOF {
+		if err == nil {
+			err = fmt.Errorf("line %d: record after the trailer", r.line)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func validateDevice(d *device.Device) error {
+	if !deviceNamePattern.MatchString(d.Name) {
+		return fmt.Errorf("invalid device name: %s", d.Name)
+	}
+	if d.AddressLists == nil {
+		d.AddressLists = make([]string, 0)
+	}
+
+	return (&device.DeviceRequest{Device: d}).Bind(nil)
+}
+
+func validateAPIKey(key *APIKey) error {
+	if !accessKeyPattern.MatchString(key.AccessKey) {
+		return fmt.Errorf("invalid access key: %s", key.AccessKey)
+	}
+
+	return (&apikey.APIKeyRequest{APIKey: key.ToAPIKey()}).Bind(nil)
+}
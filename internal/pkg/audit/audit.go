@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+)
+
+const (
+	CreateAction = "create"
+	UpdateAction = "update"
+	PatchAction  = "patch"
+	DeleteAction = "delete"
+	// ExpireAction removes the entries of an address list whose expiry time passed.
+	ExpireAction = "expire"
+
+	AddressListResource = "address-list"
+	DeviceResource      = "device"
+	APIKeyResource      = "api-key"
+	WebhookResource     = "webhook"
+
+	// SystemActor is the actor of changes made without an authenticated principal.
+	SystemActor = "system"
+)
+
+type (
+	// Event records a single change. For address lists, the entry diff is recorded as well. An event restored
+	// from an archive is only as trustworthy as the archive, so it names the actor who imported it.
+	Event struct {
+		ID         string                  `json:"id,omitempty"`
+		Time       time.Time               `json:"time"`
+		Actor      string                  `json:"actor"`
+		SourceIP   string                  `json:"source_ip,omitempty"`
+		RequestID  string                  `json:"request_id,omitempty"`
+		Action     string                  `json:"action"`
+		Resource   string                  `json:"resource"`
+		Name       string                  `json:"name"`
+		Added      []*address_list.Address `json:"added,omitempty"`
+		Removed    []*address_list.Address `json:"removed,omitempty"`
+		Changed    []*EntryChange          `json:"changed,omitempty"`
+		ImportedBy string                  `json:"imported_by,omitempty"`
+	}
+
+	// EntryChange is an entry whose comment or disabled flag changed.
+	EntryChange struct {
+		Before *address_list.Address `json:"before"`
+		After  *address_list.Address `json:"after"`
+	}
+
+	// Actor identifies who made a change. It travels in the context, so that the service layer can
+	// record it without knowing about HTTP.
+	Actor struct {
+		Name      string
+		SourceIP  string
+		RequestID string
+	}
+
+	// Filter selects events for GET /audit. Empty fields match everything. BeforeID continues a walk back in
+	// time from the last event read: of the events at To, only those whose ID sorts before it are selected.
+	Filter struct {
+		Actor    string
+		List     string
+		From     time.Time
+		To       time.Time
+		BeforeID string
+	}
+
+	EventResponse struct {
+		*Event
+	}
+
+	contextKey string
+)
+
+const actorKey contextKey = "auditActor"
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// ActorFromContext returns the actor stored by WithActor or SystemActor.
+func ActorFromContext(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey).(Actor); ok {
+		return actor
+	}
+
+	return Actor{Name: SystemActor}
+}
+
+// NewEvent returns an event for the actor in the context.
+func NewEvent(ctx context.Context, action, resource, name string) *Event {
+	actor := ActorFromContext(ctx)
+
+	return &Event{
+		Time:      time.Now().UTC(),
+		Actor:     actor.Name,
+		SourceIP:  actor.SourceIP,
+		RequestID: actor.RequestID,
+		Action:    action,
+		Resource:  resource,
+		Name:      name,
+	}
+}
+
+// WithDiff records the entries added, removed and changed between two states of an address list. Either may be nil.
+func (e *Event) WithDiff(before, after *address_list.AddressList) *Event {
+	beforeEntries := make(map[string]*address_list.Address)
+	if before != nil {
+		for _, a := range before.Addresses {
+			beforeEntries[a.Address] = a
+		}
+	}
+
+	afterEntries := make(map[string]*address_list.Address)
+	if after != nil {
+		for _, a := range after.Addresses {
+			afterEntries[a.Address] = a
+			b, ok := beforeEntries[a.Address]
+			switch {
+			case !ok:
+				e.Added = append(e.Added, a)
+			case !b.SameAs(a):
+				e.Changed = append(e.Changed, &EntryChange{Before: b, After: a})
+			}
+		}
+	}
+
+	if before != nil {
+		for _, b := range before.Addresses {
+			if _, ok := afterEntries[b.Address]; !ok {
+				e.Removed = append(e.Removed, b)
+			}
+		}
+	}
+
+	return e
+}
+
+// Matches reports whether the event is selected by the filter.
+func (f *Filter) Matches(e *Event) bool {
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if f.List != "" && (e.Resource != AddressListResource || e.Name != f.List) {
+		return false
+	}
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && e.Time.After(f.To) {
+		return false
+	}
+	if f.BeforeID != "" && e.Time.Equal(f.To) && e.ID >= f.BeforeID {
+		return false
+	}
+
+	return true
+}
+
+func (er *EventResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriterSink(t *testing.T) {
+	var out bytes.Buffer
+	s := NewWriterSink(&out)
+
+	for _, name := range []string{"office", "lab"} {
+		if err := s.Write(context.Background(), &Event{Action: CreateAction, Resource: AddressListResource, Name: name}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Write() wrote %d lines, want 2: %s", len(lines), out.String())
+	}
+	var event Event
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil || event.Name != "lab" {
+		t.Errorf("line 2 = %s, %v, want the event for lab", lines[1], err)
+	}
+}
+
+func TestFileSinkRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	line, _ := json.Marshal(&Event{Action: CreateAction, Resource: AddressListResource, Name: "office"})
+
+	// Every file takes two events, and two backups are kept.
+	s, err := NewFileSink(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	for i := 0; i < 7; i++ {
+		if err := s.Write(context.Background(), &Event{Action: CreateAction, Resource: AddressListResource, Name: "office"}); err != nil {
+			t.Fatalf("Write() #%d error = %v", i+1, err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	for name, want := range map[string]int{"audit.log": 1, "audit.log.1": 2, "audit.log.2": 2, "audit.log.3": 0} {
+		data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(path), name))
+		if want == 0 {
+			if err == nil {
+				t.Errorf("%s exists, want only 2 backups", name)
+			}
+			continue
+		}
+		if got := strings.Count(string(data), "\n"); err != nil || got != want {
+			t.Errorf("%s has %d events, %v, want %d", name, got, err, want)
+		}
+	}
+}
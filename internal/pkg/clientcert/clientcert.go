@@ -0,0 +1,197 @@
+package clientcert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/logging"
+)
+
+// crlCheckInterval limits how often the CRL file is checked for changes.
+const crlCheckInterval = 10 * time.Second
+
+var (
+	ErrMissingCertificate = errors.New("missing verified client certificate")
+	ErrRevokedCertificate = errors.New("client certificate is revoked")
+)
+
+type (
+	// Verifier checks client certificates which the TLS server already verified against the client CAs
+	// for revocation. The CRL file is checked for changes every crlCheckInterval and reloaded when it
+	// changed, so that it can be replaced in place.
+	Verifier struct {
+		crlFile string
+		cas     []*x509.Certificate
+
+		mu        sync.Mutex
+		modTime   time.Time
+		checkedAt time.Time
+		// failedModTime is the modification time of a CRL file which failed to load, so that it is not
+		// reloaded, and the error logged, until it changes again.
+		failedModTime time.Time
+		revoked       map[string]map[string]bool
+	}
+)
+
+// NewVerifier returns a verifier for certificates issued by the CAs in caFile. Without a CRL file,
+// no certificate is considered revoked. The CRL must be signed by one of the CAs.
+func NewVerifier(caFile, crlFile string) (*Verifier, error) {
+	data, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cas, err := parseCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Verifier{crlFile: crlFile, cas: cas}
+	if crlFile != "" {
+		if err := v.reload(); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// Verify returns the client certificate of the connection, if the TLS server verified it and it is not revoked.
+func (v *Verifier) Verify(state *tls.ConnectionState) (*x509.Certificate, error) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, ErrMissingCertificate
+	}
+	cert := state.VerifiedChains[0][0]
+
+	if v.crlFile != "" {
+		v.refresh(time.Now())
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.revoked[cert.Issuer.String()][cert.SerialNumber.String()] {
+		return nil, ErrRevokedCertificate
+	}
+
+	return cert, nil
+}
+
+// Names returns the identities of a certificate: its DNS names, then its common name.
+func Names(cert *x509.Certificate) []string {
+	names := make([]string, 0, len(cert.DNSNames)+1)
+	names = append(names, cert.DNSNames...)
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+
+	return names
+}
+
+// refresh reloads the CRL file if it changed, unless it was checked less than crlCheckInterval ago.
+func (v *Verifier) refresh(now time.Time) {
+	v.mu.Lock()
+	if now.Sub(v.checkedAt) < crlCheckInterval {
+		v.mu.Unlock()
+		return
+	}
+	v.checkedAt = now
+	loaded, failed := v.modTime, v.failedModTime
+	v.mu.Unlock()
+
+	info, err := os.Stat(v.crlFile)
+	if err != nil || info.ModTime().Equal(loaded) || info.ModTime().Equal(failed) {
+		return
+	}
+
+	if err := v.reload(); err != nil {
+		v.mu.Lock()
+		v.failedModTime = info.ModTime()
+		v.mu.Unlock()
+
+		logging.Default().Error("failed to reload CRL, keeping the previous one", "file", v.crlFile, "error", err)
+	}
+}
+
+// reload replaces the revoked serials with those of the CRL file. On errors the previous list is kept.
+func (v *Verifier) reload() error {
+	info, err := os.Stat(v.crlFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(v.crlFile)
+	if err != nil {
+		return err
+	}
+
+	crl, err := x509.ParseCRL(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse CRL: %s", err)
+	}
+
+	var issuer pkix.Name
+	issuer.FillFromRDNSequence(&crl.TBSCertList.Issuer)
+
+	signed := false
+	for _, ca := range v.cas {
+		if ca.Subject.String() == issuer.String() && ca.CheckCRLSignature(crl) == nil {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return fmt.Errorf("CRL is not signed by a client CA: %s", issuer)
+	}
+
+	if crl.HasExpired(time.Now()) {
+		logging.Default().Warn("CRL has expired, using it until it is replaced", "file", v.crlFile)
+	}
+
+	serials := make(map[string]bool, len(crl.TBSCertList.RevokedCertificates))
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		serials[revoked.SerialNumber.String()] = true
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.revoked = map[string]map[string]bool{issuer.String(): serials}
+	v.modTime = info.ModTime()
+
+	return nil
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0)
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+
+	return certs, nil
+}
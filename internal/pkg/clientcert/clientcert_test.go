@@ -0,0 +1,252 @@
+package clientcert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/logging"
+)
+
+// authority is a client CA of the tests.
+type authority struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newAuthority(t *testing.T, name string) *authority {
+	t.Helper()
+
+	key := newKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+
+	return &authority{cert: cert, key: key}
+}
+
+func newKey(t *testing.T) crypto.Signer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	return key
+}
+
+// issue returns a client certificate with the serial, common name and DNS names.
+func (a *authority) issue(t *testing.T, serial int64, commonName string, dnsNames ...string) tls.Certificate {
+	t.Helper()
+
+	key := newKey(t)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, key.Public(), a.key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// crl returns a PEM encoded CRL revoking the serials.
+func (a *authority) crl(t *testing.T, number int64, serials ...int64) []byte {
+	t.Helper()
+
+	revoked := make([]pkix.RevokedCertificate, 0, len(serials))
+	for _, serial := range serials {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(number),
+		ThisUpdate:          time.Now(),
+		NextUpdate:          time.Now().Add(time.Hour),
+		RevokedCertificates: revoked,
+	}, a.cert, a.key)
+	if err != nil {
+		t.Fatalf("CreateRevocationList() error = %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+}
+
+func newVerifier(t *testing.T, ca *authority, crl []byte) (*Verifier, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	caFile, crlFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "crl.pem")
+	writeFile(t, caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), time.Now())
+	writeFile(t, crlFile, crl, time.Now().Add(-time.Hour))
+
+	v, err := NewVerifier(caFile, crlFile)
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+
+	return v, crlFile
+}
+
+func TestVerifier(t *testing.T) {
+	ca := newAuthority(t, "Routers CA")
+	v, _ := newVerifier(t, ca, ca.crl(t, 1, 3))
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cert, err := v.Verify(r.TLS)
+		switch {
+		case errors.Is(err, ErrMissingCertificate):
+			w.WriteHeader(http.StatusUnauthorized)
+		case errors.Is(err, ErrRevokedCertificate):
+			w.WriteHeader(http.StatusForbidden)
+		case err != nil:
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			_, _ = w.Write([]byte(strings.Join(Names(cert), ",")))
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: x509.NewCertPool()}
+	server.TLS.ClientCAs.AddCert(ca.cert)
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		cert       *tls.Certificate
+		wantStatus int
+		wantNames  string
+	}{
+		{name: "no certificate", wantStatus: http.StatusUnauthorized},
+		{name: "common name", cert: certPtr(ca.issue(t, 2, "gw-office")), wantStatus: http.StatusOK, wantNames: "gw-office"},
+		{name: "dns names before common name", cert: certPtr(ca.issue(t, 4, "Office gateway", "gw-office", "gw-office.example.com")), wantStatus: http.StatusOK, wantNames: "gw-office,gw-office.example.com,Office gateway"},
+		{name: "revoked", cert: certPtr(ca.issue(t, 3, "gw-lab")), wantStatus: http.StatusForbidden},
+		// Clients only send certificates of the CAs the server asks for.
+		{name: "other authority", cert: certPtr(newAuthority(t, "Other CA").issue(t, 2, "gw-office")), wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := server.Client().Transport.(*http.Transport).Clone()
+			if tt.cert != nil {
+				transport.TLSClientConfig.Certificates = []tls.Certificate{*tt.cert}
+			}
+			client := &http.Client{Transport: transport}
+
+			res, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			defer res.Body.Close()
+
+			body, _ := ioutil.ReadAll(res.Body)
+			if res.StatusCode != tt.wantStatus || string(body) != tt.wantNames {
+				t.Errorf("Get() = %d %q, want %d %q", res.StatusCode, body, tt.wantStatus, tt.wantNames)
+			}
+		})
+	}
+}
+
+func certPtr(cert tls.Certificate) *tls.Certificate {
+	return &cert
+}
+
+func TestVerifierReloadsCRL(t *testing.T) {
+	ca := newAuthority(t, "Routers CA")
+	v, crlFile := newVerifier(t, ca, ca.crl(t, 1))
+
+	var logs bytes.Buffer
+	defer logging.SetDefault(logging.Default())
+	logging.SetDefault(logging.New(&logs, logging.InfoLevel, logging.LogfmtFormat))
+
+	cert := ca.issue(t, 2, "gw-office").Leaf
+	state := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert, ca.cert}}}
+	isRevoked := func() bool {
+		_, err := v.Verify(state)
+		return errors.Is(err, ErrRevokedCertificate)
+	}
+
+	now := time.Now()
+	v.refresh(now)
+	writeFile(t, crlFile, ca.crl(t, 2, 2), now.Add(-time.Minute))
+
+	// The file is only checked every crlCheckInterval.
+	v.refresh(now.Add(time.Second))
+	if isRevoked() {
+		t.Errorf("Verify() right after a check reloaded the CRL")
+	}
+
+	v.refresh(now.Add(crlCheckInterval))
+	if !isRevoked() {
+		t.Errorf("Verify() after the check interval = not revoked, want the CRL reloaded")
+	}
+
+	// A broken file keeps the previous CRL and is logged once.
+	writeFile(t, crlFile, []byte("not a CRL"), now)
+	v.refresh(now.Add(2 * crlCheckInterval))
+	v.refresh(now.Add(3 * crlCheckInterval))
+	if !isRevoked() {
+		t.Errorf("Verify() after a failed reload = not revoked, want the previous CRL kept")
+	}
+	if n := strings.Count(logs.String(), "failed to reload CRL"); n != 1 {
+		t.Errorf("logged %d reload errors, want 1:\n%s", n, logs.String())
+	}
+
+	// A CRL signed by another CA is refused.
+	writeFile(t, crlFile, newAuthority(t, "Routers CA").crl(t, 3), now.Add(time.Minute))
+	v.refresh(now.Add(4 * crlCheckInterval))
+	if !isRevoked() {
+		t.Errorf("Verify() after a forged CRL = not revoked, want the previous CRL kept")
+	}
+}
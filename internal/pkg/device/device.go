@@ -0,0 +1,64 @@
+package device
+
+import (
+	"net/http"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/templates"
+	valid "mikrotik_provisioning/pkg/validator"
+)
+
+const DefaultFetchInterval = 5 * time.Minute
+
+type (
+	Device struct {
+		ID              string   `json:"-" validator:"omitempty"`
+		Name            string   `json:"name" validator:"required,device_name"`
+		Model           string   `json:"model,omitempty" validator:"omitempty,device_model"`
+		RouterOSVersion string   `json:"routeros_version,omitempty" validator:"omitempty"`
+		AddressLists    []string `json:"address_lists" validator:"required,dive,address_list_name"`
+		FetchInterval   string   `json:"fetch_interval,omitempty" validator:"omitempty"`
+		Token           string   `json:"token,omitempty" validator:"omitempty"`
+	}
+
+	DeviceRequest struct {
+		*Device
+	}
+
+	DeviceResponse struct {
+		*Device
+	}
+)
+
+// Interval returns the configured fetch interval or DefaultFetchInterval if it is not set.
+func (d *Device) Interval() time.Duration {
+	if interval, err := time.ParseDuration(d.FetchInterval); err == nil && interval > 0 {
+		return interval
+	}
+
+	return DefaultFetchInterval
+}
+
+func (d *DeviceRequest) Bind(r *http.Request) error {
+	if err := valid.Struct(d); err != nil {
+		return err
+	}
+
+	if d.RouterOSVersion != "" {
+		if _, err := templates.ParseVersion(d.RouterOSVersion); err != nil {
+			return err
+		}
+	}
+
+	if d.FetchInterval != "" {
+		if _, err := time.ParseDuration(d.FetchInterval); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rd *DeviceResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
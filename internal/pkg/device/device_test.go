@@ -0,0 +1,51 @@
+package device
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInterval(t *testing.T) {
+	tests := []struct {
+		interval string
+		want     time.Duration
+	}{
+		{interval: "", want: DefaultFetchInterval},
+		{interval: "1m30s", want: 90 * time.Second},
+		{interval: "0s", want: DefaultFetchInterval},
+		{interval: "-1m", want: DefaultFetchInterval},
+		{interval: "5", want: DefaultFetchInterval},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.interval, func(t *testing.T) {
+			if got := (&Device{FetchInterval: tt.interval}).Interval(); got != tt.want {
+				t.Errorf("Interval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeviceRequestBind(t *testing.T) {
+	tests := []struct {
+		name   string
+		device *Device
+		valid  bool
+	}{
+		{name: "valid", device: &Device{Name: "gw-office", RouterOSVersion: "7.1", AddressLists: []string{"office"}, FetchInterval: "10m"}, valid: true},
+		{name: "defaults", device: &Device{Name: "gw-office", AddressLists: []string{"office"}}, valid: true},
+		{name: "version", device: &Device{Name: "gw-office", RouterOSVersion: "seven", AddressLists: []string{"office"}}},
+		{name: "fetch interval", device: &Device{Name: "gw-office", AddressLists: []string{"office"}, FetchInterval: "often"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&DeviceRequest{Device: tt.device}).Bind(httptest.NewRequest(http.MethodPost, "/device", nil))
+			if (err == nil) != tt.valid {
+				t.Errorf("Bind() error = %v, want valid %t", err, tt.valid)
+			}
+		})
+	}
+}
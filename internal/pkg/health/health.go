@@ -0,0 +1,117 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeout = 2 * time.Second
+
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+type (
+	Checker interface {
+		CheckHealth(ctx context.Context) error
+	}
+
+	CheckerFunc func(ctx context.Context) error
+
+	// Health runs the readiness checks of all components.
+	Health struct {
+		timeout    time.Duration
+		names      []string
+		components map[string]Checker
+	}
+
+	Component struct {
+		Status   string `json:"status"`
+		Error    string `json:"error,omitempty"`
+		Duration string `json:"duration"`
+	}
+
+	Report struct {
+		Status     string                `json:"status"`
+		Components map[string]*Component `json:"components,omitempty"`
+	}
+)
+
+func (f CheckerFunc) CheckHealth(ctx context.Context) error {
+	return f(ctx)
+}
+
+func New(timeout time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Health{timeout: timeout, components: make(map[string]Checker)}
+}
+
+func (h *Health) Add(name string, checker Checker) {
+	if _, ok := h.components[name]; !ok {
+		h.names = append(h.names, name)
+		sort.Strings(h.names)
+	}
+	h.components[name] = checker
+}
+
+// Check runs all checks concurrently, each bounded by the timeout. The report fails if any component fails.
+func (h *Health) Check(ctx context.Context) *Report {
+	report := &Report{Status: StatusOK, Components: make(map[string]*Component, len(h.names))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range h.names {
+		wg.Add(1)
+		go func(name string, checker Checker) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			component := &Component{Status: StatusOK}
+			if err := check(ctx, checker); err != nil {
+				component.Status = StatusFail
+				component.Error = err.Error()
+			}
+			component.Duration = time.Since(start).String()
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[name] = component
+			if component.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}(name, h.components[name])
+	}
+	wg.Wait()
+
+	return report
+}
+
+// check returns when the checker returns or the context is done, whichever is first, so that a checker
+// ignoring its context cannot block the report.
+func check(ctx context.Context, checker Checker) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- checker.CheckHealth(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Report) Render(w http.ResponseWriter, req *http.Request) error {
+	return nil
+}
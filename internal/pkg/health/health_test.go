@@ -0,0 +1,49 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	ok := CheckerFunc(func(ctx context.Context) error { return nil })
+	failing := CheckerFunc(func(ctx context.Context) error { return errors.New("connection refused") })
+	hanging := CheckerFunc(func(ctx context.Context) error { select {} })
+
+	tests := []struct {
+		name       string
+		components map[string]Checker
+		want       string
+		wantErrors map[string]string
+	}{
+		{name: "no components", want: StatusOK, wantErrors: map[string]string{}},
+		{name: "ok", components: map[string]Checker{"storage": ok, "templates": ok}, want: StatusOK, wantErrors: map[string]string{"storage": "", "templates": ""}},
+		{name: "failing", components: map[string]Checker{"storage": failing, "templates": ok}, want: StatusFail, wantErrors: map[string]string{"storage": "connection refused", "templates": ""}},
+		{name: "hanging", components: map[string]Checker{"storage": hanging, "templates": ok}, want: StatusFail, wantErrors: map[string]string{"storage": context.DeadlineExceeded.Error(), "templates": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(50 * time.Millisecond)
+			for name, checker := range tt.components {
+				h.Add(name, checker)
+			}
+
+			report := h.Check(context.Background())
+			if report.Status != tt.want {
+				t.Errorf("Check() status = %s, want %s", report.Status, tt.want)
+			}
+			if len(report.Components) != len(tt.wantErrors) {
+				t.Errorf("Check() components = %d, want %d", len(report.Components), len(tt.wantErrors))
+			}
+			for name, wantErr := range tt.wantErrors {
+				component := report.Components[name]
+				if component == nil || component.Error != wantErr || (component.Status == StatusOK) != (wantErr == "") {
+					t.Errorf("Check() %s = %+v, want error %q", name, component, wantErr)
+				}
+			}
+		})
+	}
+}
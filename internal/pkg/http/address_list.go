@@ -1,28 +1,52 @@
 package http
 
 import (
+	"fmt"
 	"net/http"
 
+	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
 
+	"mikrotik_provisioning/internal/pkg/access"
 	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/device"
+	"mikrotik_provisioning/internal/pkg/metrics"
+	"mikrotik_provisioning/internal/pkg/signing"
 )
 
 func (h *AddressListHandler) GetAddressLists(w http.ResponseWriter, r *http.Request) {
-	results, err := h.service.GetAddressLists(r.Context())
+	filter, err := getAddressListFilter(r)
+	if err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	results, cursor, err := h.getReadableAddressLists(r, filter)
 	if err != nil {
 		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+	if cursor != "" {
+		w.Header().Set(NextCursorHeader, cursor)
 	}
 
 	var out []byte
 	switch r.Context().Value(FormatKey) {
-	case RSCFormat:
+	case RSCFormat, SIGFormat:
+		selector, err := getTemplateSelector(r)
+		if err != nil {
+			_ = render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+
 		if len(results) != 0 {
-			out, err = h.getAddressListsTextResponse(results)
+			out, err = h.getAddressListsTextResponse(selector, results)
 			if err != nil {
 				_ = render.Render(w, r, ErrRender(err))
+				return
 			}
-			_, _ = w.Write(out)
+			writeTextResponse(w, r, h.signer, "", out)
+			setAddressListsFetched(results)
 		} else {
 			render.Status(r, http.StatusOK)
 		}
@@ -37,6 +61,40 @@ func (h *AddressListHandler) GetAddressLists(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// getReadableAddressLists returns a page of the lists the principal may read. Lists it may not read are skipped
+// while the page is filled from storage, so a page is only short when no readable list follows it. Without a
+// principal, anonymous reads are configured and every list is readable.
+func (h *AddressListHandler) getReadableAddressLists(r *http.Request, filter *address_list.Filter) ([]*address_list.AddressList, string, error) {
+	principal, ok := r.Context().Value(PrincipalKey).(*access.Principal)
+	if !ok {
+		return h.service.GetAddressLists(r.Context(), filter)
+	}
+
+	page := *filter
+	readable := make([]*address_list.AddressList, 0)
+	for {
+		results, cursor, err := h.service.GetAddressLists(r.Context(), &page)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, addressList := range results {
+			if !principal.Can(access.ReadAction, addressList.Name) {
+				continue
+			}
+			if filter.Limit > 0 && int64(len(readable)) == filter.Limit {
+				return readable, address_list.EncodeCursor(readable[len(readable)-1].Name), nil
+			}
+			readable = append(readable, addressList)
+		}
+
+		if cursor == "" {
+			return readable, "", nil
+		}
+		page.Cursor = cursor
+	}
+}
+
 func (h *AddressListHandler) CreateAddressList(w http.ResponseWriter, r *http.Request) {
 	data := &address_list.AddressListRequest{}
 	if err := render.Bind(r, data); err != nil {
@@ -58,11 +116,24 @@ func (h *AddressListHandler) GetAddressList(w http.ResponseWriter, r *http.Reque
 	addressList := r.Context().Value(AddressListKey).(*address_list.AddressList)
 
 	switch r.Context().Value(FormatKey) {
-	case RSCFormat:
-		if out, err := h.getAddressListTextResponse(addressList); err != nil {
+	case RSCFormat, SIGFormat:
+		selector, err := getTemplateSelector(r)
+		if err != nil {
+			_ = render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+
+		deviceKey, errResponse := h.getDeviceKey(r)
+		if errResponse != nil {
+			_ = render.Render(w, r, errResponse)
+			return
+		}
+
+		if out, err := h.getAddressListTextResponse(selector, addressList); err != nil {
 			_ = render.Render(w, r, ErrRender(err))
 		} else {
-			_, _ = w.Write(out)
+			writeTextResponse(w, r, h.signer, deviceKey, out)
+			setAddressListsFetched([]*address_list.AddressList{addressList})
 		}
 	default:
 		if err := render.Render(w, r, newAddressListResponse(addressList)); err != nil {
@@ -71,14 +142,80 @@ func (h *AddressListHandler) GetAddressList(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+func (h *AddressListHandler) GetAddressListLoader(w http.ResponseWriter, r *http.Request) {
+	addressList := r.Context().Value(AddressListKey).(*address_list.AddressList)
+
+	selector, err := getTemplateSelector(r)
+	if err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	dev, errResponse := h.getLoaderDevice(r)
+	if errResponse != nil {
+		_ = render.Render(w, r, errResponse)
+		return
+	}
+
+	if out, err := h.getAddressListLoaderTextResponse(selector, newAddressListLoader(r, h.config, addressList.Name, dev)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+	} else {
+		writeText(w, out)
+	}
+}
+
+// getLoaderDevice returns the device named by the device parameter. Loaders verify scripts with the key
+// the bootstrap of the device installed, which is derived from the signing key.
+func (h *AddressListHandler) getLoaderDevice(r *http.Request) (*device.Device, render.Renderer) {
+	name := r.URL.Query().Get(DeviceQueryParam)
+	if name == "" {
+		return nil, ErrInvalidRequest(fmt.Errorf("missing %s parameter", DeviceQueryParam))
+	}
+	if h.signer == nil {
+		return nil, ErrInvalidRequest(fmt.Errorf("loaders require signing to be configured"))
+	}
+
+	dev, err := h.service.GetDevice(r.Context(), name)
+	if err != nil {
+		return nil, ErrInternalServerError(err)
+	}
+	if dev == nil {
+		return nil, ErrInvalidRequest(fmt.Errorf("unknown device: %s", name))
+	}
+
+	return dev, nil
+}
+
+// getDeviceKey returns the key of the device named by the optional device parameter, for which
+// signature files carry a DeviceMAC.
+func (h *AddressListHandler) getDeviceKey(r *http.Request) (string, render.Renderer) {
+	if r.URL.Query().Get(DeviceQueryParam) == "" {
+		return "", nil
+	}
+
+	dev, errResponse := h.getLoaderDevice(r)
+	if errResponse != nil {
+		return "", errResponse
+	}
+
+	return signing.DeviceKey(h.signer, dev.Name, dev.Token), nil
+}
+
+// UpdateAddressList replaces the entries and labels of an address list. The name in the body must be the one
+// in the URL, which the request was authorized for.
 func (h *AddressListHandler) UpdateAddressList(w http.ResponseWriter, r *http.Request) {
 	addressList := r.Context().Value(AddressListKey).(*address_list.AddressList)
+	name := addressList.Name
 
 	data := &address_list.AddressListRequest{AddressList: addressList}
 	if err := render.Bind(r, data); err != nil {
 		_ = render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	if data.Name != name {
+		_ = render.Render(w, r, ErrInvalidRequest(fmt.Errorf("address list cannot be renamed: %s", name)))
+		return
+	}
 
 	addressList, err := h.service.UpdateAddressList(r.Context(), data.AddressList.ID, data.AddressList)
 	if err != nil {
@@ -97,8 +234,9 @@ func (h *AddressListHandler) DeleteAddressList(w http.ResponseWriter, r *http.Re
 		_ = render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
+	metrics.ForgetAddressList(addressList.Name)
 
-	render.Status(r, http.StatusNoContent)
+	render.NoContent(w, r)
 }
 
 func (h *AddressListHandler) PatchAddressList(w http.ResponseWriter, r *http.Request) {
@@ -119,3 +257,95 @@ func (h *AddressListHandler) PatchAddressList(w http.ResponseWriter, r *http.Req
 
 	_ = render.Render(w, r, newAddressListResponse(addressList))
 }
+
+// GetEntries returns the entries of an address list, paginated and filtered by the query parameters.
+func (h *AddressListHandler) GetEntries(w http.ResponseWriter, r *http.Request) {
+	addressList := r.Context().Value(AddressListKey).(*address_list.AddressList)
+
+	filter, err := getEntryFilter(r)
+	if err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	results, cursor, err := h.service.GetEntries(r.Context(), addressList.ID, filter)
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+	if cursor != "" {
+		w.Header().Set(NextCursorHeader, cursor)
+	}
+
+	if err := render.RenderList(w, r, getEntriesJSONResponse(results)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+	}
+}
+
+func (h *AddressListHandler) GetEntry(w http.ResponseWriter, r *http.Request) {
+	addressList := r.Context().Value(AddressListKey).(*address_list.AddressList)
+
+	entry, err := h.service.GetEntry(r.Context(), addressList.ID, chi.URLParam(r, "address"))
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	if entry == nil {
+		_ = render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	_ = render.Render(w, r, &address_list.AddressResponse{Address: entry})
+}
+
+// PutEntry creates the entry or replaces its comment and disabled flag. It responds 201 when the entry was created.
+func (h *AddressListHandler) PutEntry(w http.ResponseWriter, r *http.Request) {
+	addressList := r.Context().Value(AddressListKey).(*address_list.AddressList)
+	address := chi.URLParam(r, "address")
+
+	data := &address_list.EntryRequest{Address: &address_list.Address{Address: address}}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if data.Address.Address != address {
+		_ = render.Render(w, r, ErrInvalidRequest(fmt.Errorf("entry address %s does not match %s", data.Address.Address, address)))
+		return
+	}
+
+	entry, created, err := h.service.PutEntry(r.Context(), addressList.ID, data.Address)
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	if created {
+		render.Status(r, http.StatusCreated)
+	}
+	_ = render.Render(w, r, &address_list.AddressResponse{Address: entry})
+}
+
+func (h *AddressListHandler) DeleteEntry(w http.ResponseWriter, r *http.Request) {
+	addressList := r.Context().Value(AddressListKey).(*address_list.AddressList)
+	address := chi.URLParam(r, "address")
+
+	entry, err := h.service.GetEntry(r.Context(), addressList.ID, address)
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	if entry == nil {
+		_ = render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	if err := h.service.DeleteEntry(r.Context(), addressList.ID, address); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	render.NoContent(w, r)
+}
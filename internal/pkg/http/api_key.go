@@ -0,0 +1,107 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"mikrotik_provisioning/internal/pkg/apikey"
+)
+
+func (h *APIKeyHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	results, err := h.service.GetAPIKeys(r.Context())
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, getAPIKeysJSONResponse(results)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+	}
+}
+
+// CreateAPIKey generates a new key pair. The secret key is only part of this response.
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	data := &apikey.APIKeyRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	key, err := h.service.CreateAPIKey(r.Context(), data.APIKey)
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	_ = render.Render(w, r, newAPIKeyResponse(key))
+}
+
+func (h *APIKeyHandler) GetAPIKey(w http.ResponseWriter, r *http.Request) {
+	key := r.Context().Value(APIKeyKey).(*apikey.APIKey)
+
+	if err := render.Render(w, r, newAPIKeyResponse(key)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+	}
+}
+
+// UpdateAPIKey changes the description, role, grants and expiry of a key. Secrets are changed by RotateAPIKey.
+func (h *APIKeyHandler) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	key := r.Context().Value(APIKeyKey).(*apikey.APIKey)
+	stored := *key
+
+	data := &apikey.APIKeyRequest{APIKey: key}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	data.AccessKey = stored.AccessKey
+	data.SecretKey = ""
+	data.SigningKey = stored.SigningKey
+	data.CreatedAt = stored.CreatedAt
+	data.LastUsedAt = stored.LastUsedAt
+	data.PreviousSigningKey = stored.PreviousSigningKey
+	data.PreviousExpiresAt = stored.PreviousExpiresAt
+
+	key, err := h.service.UpdateAPIKey(r.Context(), stored.ID, data.APIKey)
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	_ = render.Render(w, r, newAPIKeyResponse(key))
+}
+
+// RotateAPIKey generates a new secret key. The previous one stays valid for the requested overlap.
+func (h *APIKeyHandler) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	key := r.Context().Value(APIKeyKey).(*apikey.APIKey)
+
+	data := &apikey.RotateRequest{}
+	if r.ContentLength != 0 {
+		if err := render.Bind(r, data); err != nil {
+			_ = render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+	}
+
+	key, err := h.service.RotateAPIKey(r.Context(), key, data.OverlapDuration())
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	_ = render.Render(w, r, newAPIKeyResponse(key))
+}
+
+func (h *APIKeyHandler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	key := r.Context().Value(APIKeyKey).(*apikey.APIKey)
+
+	err := h.service.DeleteAPIKey(r.Context(), key.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	render.NoContent(w, r)
+}
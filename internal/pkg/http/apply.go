@@ -0,0 +1,79 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+
+	"mikrotik_provisioning/internal/pkg/access"
+	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/metrics"
+)
+
+// ApplyManifests brings the lists managed by the owner of the request in line with the declared lists.
+// The principal needs the create, update or delete permission on every list the plan changes. With
+// ?dry_run=true only the plan is returned; its ID can be passed back to apply exactly the reviewed plan.
+func (h *AddressListHandler) ApplyManifests(w http.ResponseWriter, r *http.Request) {
+	data := &address_list.ApplyRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	dryRun := false
+	if value := r.URL.Query().Get(DryRunQueryParam); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			_ = render.Render(w, r, ErrInvalidRequest(fmt.Errorf("invalid %s parameter value: %s", DryRunQueryParam, value)))
+			return
+		}
+	}
+
+	plan, err := h.service.PlanManifests(r.Context(), data)
+	switch {
+	case errors.Is(err, address_list.ErrPlanChanged):
+		_ = render.Render(w, r, ErrConflict(err))
+		return
+	case err != nil:
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	principal := r.Context().Value(PrincipalKey).(*access.Principal)
+	for _, step := range plan.Steps {
+		if action, ok := planPermissions[step.Action]; ok && !principal.Can(action, step.List) {
+			_ = render.Render(w, r, ErrForbidden(fmt.Errorf("%s is not allowed on address list: %s", action, step.List)))
+			return
+		}
+	}
+
+	plan.DryRun = dryRun
+	if !dryRun && plan.Changes() {
+		if err := h.service.ApplyPlan(r.Context(), plan); err != nil {
+			if errors.Is(err, address_list.ErrConflict) {
+				_ = render.Render(w, r, ErrConflict(err))
+			} else {
+				_ = render.Render(w, r, ErrInternalServerError(err))
+			}
+			return
+		}
+		plan.Applied = true
+
+		for _, step := range plan.Steps {
+			if step.Action == address_list.DeletePlanAction {
+				metrics.ForgetAddressList(step.List)
+			}
+		}
+	}
+
+	_ = render.Render(w, r, plan)
+}
+
+var planPermissions = map[address_list.PlanAction]access.Action{
+	address_list.CreatePlanAction: access.CreateAction,
+	address_list.UpdatePlanAction: access.UpdateAction,
+	address_list.DeletePlanAction: access.DeleteAction,
+}
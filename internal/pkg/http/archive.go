@@ -0,0 +1,105 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/archive"
+	"mikrotik_provisioning/internal/pkg/logging"
+	"mikrotik_provisioning/internal/pkg/metrics"
+)
+
+// exportBufferSize is the part of an archive held back before streaming it, so that a failure early in the
+// export is still answered with an error status.
+const exportBufferSize = 64 << 10
+
+// ExportArchive streams an archive of all address lists, devices, API keys and audit events. Device tokens
+// and API signing keys are included only with ?secrets=true. A failure after the first part was sent cuts
+// the archive short; it then lacks its trailer and is refused by ImportArchive.
+func (h *ArchiveHandler) ExportArchive(w http.ResponseWriter, r *http.Request) {
+	secrets := false
+	if value := r.URL.Query().Get(SecretsQueryParam); value != "" {
+		var err error
+		if secrets, err = strconv.ParseBool(value); err != nil {
+			_ = render.Render(w, r, ErrInvalidRequest(fmt.Errorf("invalid %s parameter value: %s", SecretsQueryParam, value)))
+			return
+		}
+	}
+
+	sent := &countingWriter{w: w}
+	buffered := bufio.NewWriterSize(sent, exportBufferSize)
+
+	w.Header().Set("Content-Type", archive.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"mtprov-%s.ndjson\"", time.Now().UTC().Format("20060102T150405Z")))
+
+	err := h.service.Export(r.Context(), archive.NewWriter(buffered), secrets)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		if sent.n == 0 {
+			w.Header().Del("Content-Disposition")
+			w.Header().Set("Content-Type", "application/json")
+			_ = render.Render(w, r, ErrInternalServerError(err))
+			return
+		}
+		logging.FromContext(r.Context()).Error("export aborted", "error", err, "bytes", sent.n)
+	}
+}
+
+// ImportArchive restores an archive in the mode given by ?mode=merge (the default) or ?mode=replace. The whole
+// archive is read and validated before anything is written.
+func (h *ArchiveHandler) ImportArchive(w http.ResponseWriter, r *http.Request) {
+	mode, err := archive.ParseMode(r.URL.Query().Get(ModeQueryParam))
+	if err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	contents, err := archive.ReadAll(archive.NewReader(r.Body))
+	if err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	result, err := h.service.Import(r.Context(), contents, mode)
+	if result != nil {
+		for _, name := range result.DeletedAddressLists {
+			metrics.ForgetAddressList(name)
+		}
+		for _, name := range result.DeletedDevices {
+			metrics.ForgetDevice(name)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, address_list.ErrConflict) {
+			_ = render.Render(w, r, ErrConflict(err))
+		} else {
+			_ = render.Render(w, r, ErrInternalServerError(err))
+		}
+		return
+	}
+
+	_ = render.Render(w, r, result)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,26 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+// GetAuditEvents returns the newest audit events, optionally filtered by actor, address list and time range.
+func (h *AuditHandler) GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := getAuditFilter(r)
+	if err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	results, err := h.service.GetAuditEvents(r.Context(), filter)
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, getAuditEventsJSONResponse(results)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+	}
+}
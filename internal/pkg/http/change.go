@@ -0,0 +1,54 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+
+	"mikrotik_provisioning/internal/pkg/access"
+	"mikrotik_provisioning/internal/pkg/address_list"
+)
+
+// ApplyChanges applies a batch of operations across address lists atomically. The principal needs the patch
+// permission on every list. With ?dry_run=true the results are reported without writing.
+func (h *AddressListHandler) ApplyChanges(w http.ResponseWriter, r *http.Request) {
+	data := &address_list.ChangeRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	dryRun := false
+	if value := r.URL.Query().Get(DryRunQueryParam); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			_ = render.Render(w, r, ErrInvalidRequest(fmt.Errorf("invalid %s parameter value: %s", DryRunQueryParam, value)))
+			return
+		}
+	}
+
+	principal := r.Context().Value(PrincipalKey).(*access.Principal)
+	for _, operation := range data.Operations {
+		if !principal.Can(access.PatchAction, operation.List) {
+			_ = render.Render(w, r, ErrForbidden(fmt.Errorf("%s is not allowed on address list: %s", access.PatchAction, operation.List)))
+			return
+		}
+	}
+
+	results, err := h.service.ApplyChanges(r.Context(), data.Operations, dryRun)
+	switch {
+	case errors.Is(err, address_list.ErrInvalidChanges):
+		render.Status(r, http.StatusUnprocessableEntity)
+	case errors.Is(err, address_list.ErrConflict):
+		_ = render.Render(w, r, ErrConflict(err))
+		return
+	case err != nil:
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	_ = render.Render(w, r, &address_list.ChangeResponse{DryRun: dryRun, Applied: err == nil && !dryRun, Results: results})
+}
@@ -0,0 +1,147 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/device"
+	"mikrotik_provisioning/internal/pkg/metrics"
+	"mikrotik_provisioning/internal/pkg/signing"
+)
+
+func (h *DeviceHandler) GetDevices(w http.ResponseWriter, r *http.Request) {
+	results, err := h.service.GetDevices(r.Context())
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, getDevicesJSONResponse(results)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+	}
+}
+
+func (h *DeviceHandler) CreateDevice(w http.ResponseWriter, r *http.Request) {
+	data := &device.DeviceRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	dev, err := h.service.CreateDevice(r.Context(), data.Device)
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	_ = render.Render(w, r, newDeviceResponse(dev))
+}
+
+func (h *DeviceHandler) GetDevice(w http.ResponseWriter, r *http.Request) {
+	dev := r.Context().Value(DeviceKey).(*device.Device)
+
+	if err := render.Render(w, r, newDeviceResponse(dev)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+	}
+}
+
+// GetDeviceBootstrap renders the script an operator pastes into the router terminal once. It installs
+// a scheduler which periodically fetches and imports the device script.
+func (h *DeviceHandler) GetDeviceBootstrap(w http.ResponseWriter, r *http.Request) {
+	dev := r.Context().Value(DeviceKey).(*device.Device)
+
+	selector, err := getDeviceTemplateSelector(r, dev)
+	if err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if out, err := h.getDeviceBootstrapTextResponse(selector, r, dev); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+	} else {
+		writeText(w, out)
+	}
+}
+
+// GetDeviceScript renders the address lists assigned to the device, for the device's RouterOS version and model,
+// or their signature file with the sig format.
+func (h *DeviceHandler) GetDeviceScript(w http.ResponseWriter, r *http.Request) {
+	dev := r.Context().Value(DeviceKey).(*device.Device)
+
+	selector, err := getDeviceTemplateSelector(r, dev)
+	if err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	addressLists := make([]*address_list.AddressList, 0, len(dev.AddressLists))
+	for _, name := range dev.AddressLists {
+		addressList, err := h.service.GetAddressList(r.Context(), name)
+		if err != nil {
+			_ = render.Render(w, r, ErrInternalServerError(err))
+			return
+		}
+
+		if addressList != nil {
+			addressLists = append(addressLists, addressList)
+		}
+	}
+
+	// the signature file carries the DeviceMAC the fetch script of the device verifies
+	deviceKey := ""
+	if h.signer != nil {
+		deviceKey = signing.DeviceKey(h.signer, dev.Name, dev.Token)
+	}
+
+	if out, err := h.getAddressListsTextResponse(selector, addressLists); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+	} else {
+		writeTextResponse(w, r, h.signer, deviceKey, out)
+		metrics.SetDeviceFetched(dev.Name, time.Now())
+		setAddressListsFetched(addressLists)
+	}
+}
+
+// UpdateDevice replaces a device but its token. The name in the body must be the one in the URL, as the key
+// signing the scripts of the device and its client certificate are bound to the name.
+func (h *DeviceHandler) UpdateDevice(w http.ResponseWriter, r *http.Request) {
+	dev := r.Context().Value(DeviceKey).(*device.Device)
+	name, token := dev.Name, dev.Token
+
+	data := &device.DeviceRequest{Device: dev}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if data.Name != name {
+		_ = render.Render(w, r, ErrInvalidRequest(fmt.Errorf("device cannot be renamed: %s", name)))
+		return
+	}
+	data.Token = token
+
+	dev, err := h.service.UpdateDevice(r.Context(), data.Device.ID, data.Device)
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	_ = render.Render(w, r, newDeviceResponse(dev))
+}
+
+func (h *DeviceHandler) DeleteDevice(w http.ResponseWriter, r *http.Request) {
+	dev := r.Context().Value(DeviceKey).(*device.Device)
+
+	err := h.service.DeleteDevice(r.Context(), dev.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	metrics.ForgetDevice(dev.Name)
+
+	render.NoContent(w, r)
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/go-chi/render"
+
+	"mikrotik_provisioning/internal/pkg/logging"
 )
 
 type ErrResponse struct {
@@ -15,7 +17,20 @@ type ErrResponse struct {
 	ErrorText  string `json:"error,omitempty"` // application-level error message, for debugging
 }
 
+// Render logs the underlying error, server errors at error level and client errors at info level.
 func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	l := logging.FromContext(r.Context())
+	keyvals := []interface{}{"status", e.HTTPStatusCode, "error", e.ErrorText}
+	if e.Err != nil {
+		keyvals[3] = e.Err
+	}
+
+	if e.HTTPStatusCode >= http.StatusInternalServerError {
+		l.Error(e.StatusText, keyvals...)
+	} else {
+		l.Info(e.StatusText, keyvals...)
+	}
+
 	render.Status(r, e.HTTPStatusCode)
 	return nil
 }
@@ -38,6 +53,33 @@ func ErrInternalServerError(err error) render.Renderer {
 	}
 }
 
+func ErrUnauthorized(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusUnauthorized,
+		StatusText:     "unauthorized",
+		ErrorText:      err.Error(),
+	}
+}
+
+func ErrForbidden(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusForbidden,
+		StatusText:     "forbidden",
+		ErrorText:      err.Error(),
+	}
+}
+
+func ErrConflict(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusConflict,
+		StatusText:     "conflict",
+		ErrorText:      err.Error(),
+	}
+}
+
 func ErrRender(err error) render.Renderer {
 	return &ErrResponse{
 		Err:            err,
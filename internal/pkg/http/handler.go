@@ -2,22 +2,44 @@ package http
 
 import (
 	"net/http"
-	"text/template"
 
 	"mikrotik_provisioning/internal/app"
+	"mikrotik_provisioning/internal/config"
+	"mikrotik_provisioning/internal/pkg/access"
+	"mikrotik_provisioning/internal/pkg/health"
+	"mikrotik_provisioning/internal/pkg/openapi"
+	"mikrotik_provisioning/internal/pkg/signing"
+	"mikrotik_provisioning/internal/pkg/templates"
+	"mikrotik_provisioning/internal/pkg/watch"
+	"mikrotik_provisioning/internal/pkg/webhook"
 )
 
 type Middleware interface {
 	EnsureAddressListExists(next http.Handler) http.Handler
 	EnsureAddressListNotExists(next http.Handler) http.Handler
+	EnsureDeviceExists(next http.Handler) http.Handler
+	EnsureDeviceNotExists(next http.Handler) http.Handler
+	EnsureDeviceAuth(next http.Handler) http.Handler
+	EnsureAPIKeyExists(next http.Handler) http.Handler
+	EnsureWebhookExists(next http.Handler) http.Handler
+	EnsureDeadLetterExists(next http.Handler) http.Handler
 	EnsureAuth(next http.Handler) http.Handler
+	RequireRole(roles ...access.Role) func(next http.Handler) http.Handler
+	Authorize(action access.Action) func(next http.Handler) http.Handler
 	CheckAcceptHeader(contentTypes ...string) func(next http.Handler) http.Handler
 }
 
 type Handler interface {
 	GetAddressLists(w http.ResponseWriter, r *http.Request)
+	GetEntries(w http.ResponseWriter, r *http.Request)
+	GetEntry(w http.ResponseWriter, r *http.Request)
+	PutEntry(w http.ResponseWriter, r *http.Request)
+	DeleteEntry(w http.ResponseWriter, r *http.Request)
+	ApplyChanges(w http.ResponseWriter, r *http.Request)
+	ApplyManifests(w http.ResponseWriter, r *http.Request)
 	CreateAddressList(w http.ResponseWriter, r *http.Request)
 	GetAddressList(w http.ResponseWriter, r *http.Request)
+	GetAddressListLoader(w http.ResponseWriter, r *http.Request)
 	UpdateAddressList(w http.ResponseWriter, r *http.Request)
 	PatchAddressList(w http.ResponseWriter, r *http.Request)
 	DeleteAddressList(w http.ResponseWriter, r *http.Request)
@@ -25,9 +47,81 @@ type Handler interface {
 
 type AddressListHandler struct {
 	service   app.UseCases
-	templates *template.Template
+	templates *templates.Templates
+	signer    signing.Signer
+	config    *config.Application
 }
 
-func NewAddressListHandler(service app.UseCases, templates *template.Template) *AddressListHandler {
-	return &AddressListHandler{service: service, templates: templates}
+type DeviceHandler struct {
+	service   app.UseCases
+	templates *templates.Templates
+	signer    signing.Signer
+	config    *config.Application
+}
+
+type APIKeyHandler struct {
+	service app.UseCases
+}
+
+type AuditHandler struct {
+	service app.UseCases
+}
+
+type ArchiveHandler struct {
+	service app.UseCases
+}
+
+type HealthHandler struct {
+	health *health.Health
+}
+
+type WatchHandler struct {
+	service app.UseCases
+	broker  *watch.Broker
+	config  *config.Watch
+}
+
+type WebhookHandler struct {
+	service    app.UseCases
+	dispatcher *webhook.Dispatcher
+}
+
+type OpenAPIHandler struct {
+	document *openapi.Document
+}
+
+func NewAddressListHandler(service app.UseCases, templates *templates.Templates, signer signing.Signer, config *config.Application) *AddressListHandler {
+	return &AddressListHandler{service: service, templates: templates, signer: signer, config: config}
+}
+
+func NewDeviceHandler(service app.UseCases, templates *templates.Templates, signer signing.Signer, config *config.Application) *DeviceHandler {
+	return &DeviceHandler{service: service, templates: templates, signer: signer, config: config}
+}
+
+func NewAPIKeyHandler(service app.UseCases) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+func NewAuditHandler(service app.UseCases) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+func NewArchiveHandler(service app.UseCases) *ArchiveHandler {
+	return &ArchiveHandler{service: service}
+}
+
+func NewWebhookHandler(service app.UseCases, dispatcher *webhook.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{service: service, dispatcher: dispatcher}
+}
+
+func NewWatchHandler(service app.UseCases, broker *watch.Broker, config *config.Watch) *WatchHandler {
+	return &WatchHandler{service: service, broker: broker, config: config}
+}
+
+func NewHealthHandler(health *health.Health) *HealthHandler {
+	return &HealthHandler{health: health}
+}
+
+func NewOpenAPIHandler(document *openapi.Document) *OpenAPIHandler {
+	return &OpenAPIHandler{document: document}
 }
@@ -0,0 +1,25 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"mikrotik_provisioning/internal/pkg/health"
+)
+
+// Healthz reports that the process is up. It checks no dependencies, so that a failing database does not get
+// the container restarted.
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	_ = render.Render(w, r, &health.Report{Status: health.StatusOK})
+}
+
+// Readyz reports the status of every component, and 503 Service Unavailable if any of them fails.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.health.Check(r.Context())
+	if report.Status != health.StatusOK {
+		render.Status(r, http.StatusServiceUnavailable)
+	}
+
+	_ = render.Render(w, r, report)
+}
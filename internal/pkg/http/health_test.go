@@ -0,0 +1,43 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"mikrotik_provisioning/internal/pkg/health"
+)
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		healthz int
+		readyz  int
+	}{
+		{name: "ready", healthz: http.StatusOK, readyz: http.StatusOK},
+		{name: "storage down", err: errors.New("connection refused"), healthz: http.StatusOK, readyz: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := health.New(0)
+			h.Add("storage", health.CheckerFunc(func(ctx context.Context) error { return tt.err }))
+			handler := NewHealthHandler(h)
+
+			w := httptest.NewRecorder()
+			handler.Healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if w.Code != tt.healthz {
+				t.Errorf("GET /healthz status = %d, want %d", w.Code, tt.healthz)
+			}
+
+			w = httptest.NewRecorder()
+			handler.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.readyz {
+				t.Errorf("GET /readyz status = %d, want %d: %s", w.Code, tt.readyz, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mikrotik_provisioning/internal/app"
+	"mikrotik_provisioning/internal/config"
+	"mikrotik_provisioning/internal/pkg/access"
+	"mikrotik_provisioning/internal/pkg/clientcert"
+	"mikrotik_provisioning/internal/pkg/device"
+	mux "mikrotik_provisioning/internal/pkg/http"
+)
+
+// devices is a service knowing only devices.
+type devices struct {
+	app.UseCases
+	devices map[string]*device.Device
+}
+
+func (s *devices) GetDevice(ctx context.Context, name string) (*device.Device, error) {
+	return s.devices[name], nil
+}
+
+// certificates issues client certificates and returns a verifier for them.
+func certificates(t *testing.T) (*clientcert.Verifier, func(commonName string, dnsNames ...string) *x509.Certificate) {
+	t.Helper()
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Routers CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	ca, _ := x509.ParseCertificate(der)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	verifier, err := clientcert.NewVerifier(caFile, "")
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+
+	serial := int64(1)
+	issue := func(commonName string, dnsNames ...string) *x509.Certificate {
+		serial++
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: commonName},
+			DNSNames:     dnsNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, ca, key.Public(), caKey)
+		if err != nil {
+			t.Fatalf("CreateCertificate() error = %v", err)
+		}
+		cert, _ := x509.ParseCertificate(der)
+
+		return cert
+	}
+
+	return verifier, issue
+}
+
+func TestCertificateAuth(t *testing.T) {
+	verifier, issue := certificates(t)
+	service := &devices{devices: map[string]*device.Device{
+		"gw-office": {Name: "gw-office", AddressLists: []string{"office"}},
+		"gw-lab":    {Name: "gw-lab", AddressLists: []string{"lab"}},
+	}}
+	m := NewMiddleware(service, &config.Access{}, nil, verifier)
+
+	tests := []struct {
+		name       string
+		cert       *x509.Certificate
+		wantStatus int
+		wantName   string
+	}{
+		{name: "no certificate", wantStatus: http.StatusUnauthorized},
+		{name: "common name", cert: issue("gw-office"), wantStatus: http.StatusOK, wantName: "gw-office"},
+		{name: "dns name", cert: issue("Lab gateway", "gw-lab"), wantStatus: http.StatusOK, wantName: "gw-lab"},
+		{name: "dns name before common name", cert: issue("gw-office", "gw-lab"), wantStatus: http.StatusOK, wantName: "gw-lab"},
+		{name: "unknown device", cert: issue("gw-home", "gw-home.example.com"), wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *access.Principal
+			handler := m.EnsureAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = r.Context().Value(mux.PrincipalKey).(*access.Principal)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/address-list/office", nil)
+			if tt.cert != nil {
+				r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.cert}, VerifiedChains: [][]*x509.Certificate{{tt.cert}}}
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantName != "" && (got == nil || got.Name != tt.wantName || got.Role != access.DeviceRole) {
+				t.Errorf("principal = %+v, want device %s", got, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestDeviceCertificateAuth(t *testing.T) {
+	verifier, issue := certificates(t)
+	m := NewMiddleware(&devices{}, &config.Access{}, nil, verifier)
+	handler := m.EnsureDeviceAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name       string
+		cert       *x509.Certificate
+		wantStatus int
+	}{
+		{name: "certificate of the device", cert: issue("Office gateway", "gw-office"), wantStatus: http.StatusOK},
+		{name: "certificate of another device", cert: issue("gw-lab"), wantStatus: http.StatusForbidden},
+		{name: "no certificate or token", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/device/gw-office/script", nil)
+			r = r.WithContext(context.WithValue(r.Context(), mux.DeviceKey, &device.Device{Name: "gw-office", Token: "token"}))
+			if tt.cert != nil {
+				r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.cert}, VerifiedChains: [][]*x509.Certificate{{tt.cert}}}
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
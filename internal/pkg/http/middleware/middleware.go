@@ -3,44 +3,93 @@ package middleware
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
 
-	"gopkg.in/go-playground/validator.v9"
-
 	"mikrotik_provisioning/internal/app"
 	"mikrotik_provisioning/internal/config"
+	"mikrotik_provisioning/internal/pkg/access"
 	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/apikey"
+	"mikrotik_provisioning/internal/pkg/audit"
+	"mikrotik_provisioning/internal/pkg/clientcert"
+	"mikrotik_provisioning/internal/pkg/device"
 	mux "mikrotik_provisioning/internal/pkg/http"
+	"mikrotik_provisioning/internal/pkg/logging"
+	"mikrotik_provisioning/internal/pkg/oidc"
+	"mikrotik_provisioning/pkg/hmacauth"
+	valid "mikrotik_provisioning/pkg/validator"
 )
 
 type Middleware struct {
-	validator *validator.Validate
-	service   app.UseCases
-	config    *config.Access
+	service  app.UseCases
+	config   *config.Access
+	replays  *hmacauth.ReplayCache
+	verifier *oidc.Verifier
+	certs    *clientcert.Verifier
+}
+
+// NewMiddleware returns the middleware. Bearer tokens are only accepted if verifier is not nil, and
+// client certificates only if certs is not nil.
+func NewMiddleware(service app.UseCases, config *config.Access, verifier *oidc.Verifier, certs *clientcert.Verifier) *Middleware {
+	return &Middleware{
+		service:  service,
+		config:   config,
+		replays:  hmacauth.NewReplayCache(replayWindow(config)),
+		verifier: verifier,
+		certs:    certs,
+	}
 }
 
-func NewMiddleware(service app.UseCases, config *config.Access) *Middleware {
-	return &Middleware{validator: validator.New(), service: service, config: config}
+const bearerScheme = "Bearer"
+
+func replayWindow(config *config.Access) time.Duration {
+	if config.ReplayWindow > 0 {
+		return config.ReplayWindow
+	}
+
+	return hmacauth.DefaultWindow
 }
 
 func (m *Middleware) isValidAddressListRequest(request *address_list.AddressListRequest) error {
-	if err := m.validator.Struct(request); err != nil {
+	if err := valid.Struct(request); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *Middleware) isValidDeviceRequest(request *device.DeviceRequest) error {
+	if err := valid.Struct(request); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (m *Middleware) checkAccessKeys(accessKey string, secretKey string) bool {
+func (m *Middleware) getUser(accessKey string) (*config.User, bool) {
 	for _, v := range m.config.Users {
-		if v.AccessKey == accessKey && v.SecretKey == secretKey {
+		if v.AccessKey == accessKey {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
 			return true
 		}
 	}
@@ -48,6 +97,29 @@ func (m *Middleware) checkAccessKeys(accessKey string, secretKey string) bool {
 	return false
 }
 
+// getAddressListName returns the name of the address list a request operates on: the URL
+// parameter or, for creation, the name in the request body.
+func getAddressListName(r *http.Request) (string, error) {
+	if addressListName := chi.URLParam(r, "addressListName"); addressListName != "" {
+		return addressListName, nil
+	}
+
+	data := new(address_list.AddressListRequest)
+
+	bodyBytes, _ := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+
+	if err := json.Unmarshal(bodyBytes, data); err != nil {
+		return "", err
+	}
+	if data.AddressList == nil {
+		return "", fmt.Errorf("missing address list")
+	}
+
+	return data.Name, nil
+}
+
 func (m *Middleware) EnsureAddressListExists(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if addressListName := chi.URLParam(r, "addressListName"); addressListName != "" {
@@ -62,6 +134,8 @@ func (m *Middleware) EnsureAddressListExists(next http.Handler) http.Handler {
 				return
 			}
 
+			logging.AddFields(r.Context(), "list", addressList.Name)
+
 			ctx := context.WithValue(r.Context(), mux.AddressListKey, addressList)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		} else {
@@ -104,22 +178,366 @@ func (m *Middleware) EnsureAddressListNotExists(next http.Handler) http.Handler
 	})
 }
 
+func (m *Middleware) EnsureDeviceExists(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if deviceName := chi.URLParam(r, "deviceName"); deviceName != "" {
+			dev, err := m.service.GetDevice(r.Context(), deviceName)
+			if err != nil {
+				_ = render.Render(w, r, mux.ErrInternalServerError(err))
+				return
+			}
+
+			if dev == nil {
+				_ = render.Render(w, r, mux.ErrNotFound)
+				return
+			}
+
+			logging.AddFields(r.Context(), "device", dev.Name)
+
+			ctx := context.WithValue(r.Context(), mux.DeviceKey, dev)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		} else {
+			_ = render.Render(w, r, mux.ErrNotFound)
+			return
+		}
+	})
+}
+
+func (m *Middleware) EnsureDeviceNotExists(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := new(device.DeviceRequest)
+
+		bodyBytes, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+
+		if err := json.Unmarshal(bodyBytes, data); err != nil {
+			_ = render.Render(w, r, mux.ErrInvalidRequest(err))
+			return
+		}
+
+		if err := m.isValidDeviceRequest(data); err != nil {
+			_ = render.Render(w, r, mux.ErrInvalidRequest(err))
+			return
+		}
+
+		result, err := m.service.GetDevice(r.Context(), data.Name)
+		if err != nil {
+			_ = render.Render(w, r, mux.ErrInternalServerError(err))
+			return
+		}
+
+		if result != nil {
+			_ = render.Render(w, r, mux.ErrInvalidRequest(fmt.Errorf("device already exists: %s", result.Name)))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// EnsureDeviceAuth authenticates the router fetching its script, either by a client certificate naming
+// the device or by the "Authorization: Token <token>" header against the token stored with the device.
+func (m *Middleware) EnsureDeviceAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dev := r.Context().Value(mux.DeviceKey).(*device.Device)
+
+		auth := r.Header.Get("Authorization")
+		if m.certs != nil && auth == "" && r.TLS != nil && len(r.TLS.PeerCertificates) != 0 {
+			cert, err := m.certs.Verify(r.TLS)
+			if err != nil {
+				_ = render.Render(w, r, mux.ErrForbidden(err))
+				return
+			}
+
+			if !containsName(clientcert.Names(cert), dev.Name) {
+				_ = render.Render(w, r, mux.ErrForbidden(fmt.Errorf("client certificate is not issued for device: %s", dev.Name)))
+				return
+			}
+
+			next.ServeHTTP(w, withPrincipal(r, access.NewDevicePrincipal(dev.Name, dev.AddressLists)))
+			return
+		}
+
+		if !strings.HasPrefix(auth, mux.DeviceTokenScheme+" ") {
+			_ = render.Render(w, r, mux.ErrUnauthorized(fmt.Errorf("missing device token")))
+			return
+		}
+
+		token := strings.TrimPrefix(auth, mux.DeviceTokenScheme+" ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(dev.Token)) != 1 {
+			_ = render.Render(w, r, mux.ErrForbidden(fmt.Errorf("invalid device token")))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// EnsureAuth verifies requests signed with hmacauth.SignRequest, or bearer tokens of the configured
+// IdP, and stores the authenticated *access.Principal in the request context. Users from the config
+// file are checked first, so that they can bootstrap API keys stored in the backend. Replayed and
+// expired requests are rejected.
 func (m *Middleware) EnsureAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if auth := r.Header.Get("Authorization"); auth != "" {
-			authValues := strings.Split(auth, ":")
-			if len(authValues) == 2 {
-				accessKey := authValues[0]
-				secretKey := authValues[1]
-				if m.checkAccessKeys(accessKey, secretKey) {
-					next.ServeHTTP(w, r)
-				}
-			} else {
-				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		if auth := r.Header.Get("Authorization"); m.verifier != nil && strings.HasPrefix(auth, bearerScheme+" ") {
+			m.ensureBearerAuth(next, w, r, strings.TrimPrefix(auth, bearerScheme+" "))
+			return
+		} else if auth == "" && m.certs != nil && r.TLS != nil && len(r.TLS.PeerCertificates) != 0 {
+			m.ensureCertificateAuth(next, w, r)
+			return
+		}
+
+		accessKey, signature, err := hmacauth.ParseAuthorization(r)
+		if err != nil {
+			_ = render.Render(w, r, mux.ErrUnauthorized(err))
+			return
+		}
+
+		now := time.Now()
+		var principal *access.Principal
+		if user, ok := m.getUser(accessKey); ok {
+			if err := hmacauth.Verify(r, hmacauth.DeriveKey(user.SecretKey), signature, now, replayWindow(m.config)); err != nil {
+				_ = render.Render(w, r, mux.ErrForbidden(err))
 				return
 			}
+			principal = access.NewPrincipal(user.AccessKey, access.Role(user.Role), user.Grants)
 		} else {
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			key, err := m.service.GetAPIKey(r.Context(), accessKey)
+			if err != nil {
+				_ = render.Render(w, r, mux.ErrInternalServerError(err))
+				return
+			}
+			if key == nil {
+				_ = render.Render(w, r, mux.ErrForbidden(fmt.Errorf("unknown access key: %s", accessKey)))
+				return
+			}
+			if err := m.verifyAPIKey(r, key, signature, now); err != nil {
+				_ = render.Render(w, r, mux.ErrForbidden(err))
+				return
+			}
+			if err := m.service.TouchAPIKey(r.Context(), key.ID, now.UTC()); err != nil {
+				_ = render.Render(w, r, mux.ErrInternalServerError(err))
+				return
+			}
+			principal = access.NewPrincipal(key.AccessKey, access.Role(key.Role), key.Grants)
+		}
+
+		if m.replays.Seen(signature, now) {
+			_ = render.Render(w, r, mux.ErrForbidden(hmacauth.ErrReplayedRequest))
+			return
+		}
+
+		next.ServeHTTP(w, withPrincipal(r, principal))
+	})
+}
+
+// EnsureReadAuth authenticates like EnsureAuth, except that with anonymous reads configured, requests
+// without credentials are passed on without a principal.
+func (m *Middleware) EnsureReadAuth(next http.Handler) http.Handler {
+	authenticated := m.EnsureAuth(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.config.AnonymousRead && r.Header.Get("Authorization") == "" && (r.TLS == nil || len(r.TLS.PeerCertificates) == 0) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authenticated.ServeHTTP(w, r)
+	})
+}
+
+// ensureCertificateAuth authenticates a router by its client certificate, as the device named by the certificate.
+func (m *Middleware) ensureCertificateAuth(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	cert, err := m.certs.Verify(r.TLS)
+	if err != nil {
+		_ = render.Render(w, r, mux.ErrForbidden(err))
+		return
+	}
+
+	for _, name := range clientcert.Names(cert) {
+		dev, err := m.service.GetDevice(r.Context(), name)
+		if err != nil {
+			_ = render.Render(w, r, mux.ErrInternalServerError(err))
+			return
+		}
+
+		if dev != nil {
+			next.ServeHTTP(w, withPrincipal(r, access.NewDevicePrincipal(dev.Name, dev.AddressLists)))
+			return
+		}
+	}
+
+	_ = render.Render(w, r, mux.ErrForbidden(fmt.Errorf("no device for client certificate: %s", cert.Subject.CommonName)))
+}
+
+func (m *Middleware) ensureBearerAuth(next http.Handler, w http.ResponseWriter, r *http.Request, token string) {
+	claims, err := m.verifier.Verify(token, time.Now())
+	if err != nil {
+		_ = render.Render(w, r, mux.ErrUnauthorized(err))
+		return
+	}
+
+	principal := m.verifier.Principal(claims)
+	if principal == nil {
+		_ = render.Render(w, r, mux.ErrForbidden(fmt.Errorf("no role for token subject: %s", claims.Subject)))
+		return
+	}
+
+	next.ServeHTTP(w, withPrincipal(r, principal))
+}
+
+// withPrincipal stores the principal in the request context, along with the audit actor the service records changes for.
+func withPrincipal(r *http.Request, principal *access.Principal) *http.Request {
+	sourceIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		sourceIP = host
+	}
+
+	logging.AddFields(r.Context(), "user", principal.Name)
+
+	ctx := context.WithValue(r.Context(), mux.PrincipalKey, principal)
+	ctx = audit.WithActor(ctx, audit.Actor{
+		Name:      principal.Name,
+		SourceIP:  sourceIP,
+		RequestID: middleware.GetReqID(ctx),
+	})
+
+	return r.WithContext(ctx)
+}
+
+// verifyAPIKey accepts signatures made with the current key or, during a rotation overlap, the previous one.
+func (m *Middleware) verifyAPIKey(r *http.Request, key *apikey.APIKey, signature string, now time.Time) error {
+	signingKeys := key.SigningKeys(now)
+	if len(signingKeys) == 0 {
+		return fmt.Errorf("expired access key: %s", key.AccessKey)
+	}
+
+	err := hmacauth.ErrInvalidSignature
+	for _, signingKey := range signingKeys {
+		if err = hmacauth.Verify(r, signingKey, signature, now, replayWindow(m.config)); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func (m *Middleware) EnsureAPIKeyExists(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accessKey := chi.URLParam(r, "accessKey"); accessKey != "" {
+			key, err := m.service.GetAPIKey(r.Context(), accessKey)
+			if err != nil {
+				_ = render.Render(w, r, mux.ErrInternalServerError(err))
+				return
+			}
+
+			if key == nil {
+				_ = render.Render(w, r, mux.ErrNotFound)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), mux.APIKeyKey, key)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		} else {
+			_ = render.Render(w, r, mux.ErrNotFound)
+			return
+		}
+	})
+}
+
+// RequireRole allows the request only if the principal stored by EnsureAuth has one of the roles.
+func (m *Middleware) RequireRole(roles ...access.Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := r.Context().Value(mux.PrincipalKey).(*access.Principal)
+			if !ok {
+				_ = render.Render(w, r, mux.ErrUnauthorized(hmacauth.ErrMissingAuthorization))
+				return
+			}
+
+			if !principal.HasRole(roles...) {
+				_ = render.Render(w, r, mux.ErrForbidden(fmt.Errorf("role %s is not allowed", principal.Role)))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Authorize allows the request only if the principal stored by EnsureAuth may perform the action
+// on the address list of the request. Anonymous requests passed on by EnsureReadAuth may read.
+func (m *Middleware) Authorize(action access.Action) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := r.Context().Value(mux.PrincipalKey).(*access.Principal)
+			if !ok && action == access.ReadAction && m.config.AnonymousRead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !ok {
+				_ = render.Render(w, r, mux.ErrUnauthorized(hmacauth.ErrMissingAuthorization))
+				return
+			}
+
+			addressListName, err := getAddressListName(r)
+			if err != nil {
+				_ = render.Render(w, r, mux.ErrInvalidRequest(err))
+				return
+			}
+
+			if !principal.Can(action, addressListName) {
+				_ = render.Render(w, r, mux.ErrForbidden(fmt.Errorf("%s is not allowed on address list: %s", action, addressListName)))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (m *Middleware) EnsureWebhookExists(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if webhookID := chi.URLParam(r, "webhookID"); webhookID != "" {
+			wh, err := m.service.GetWebhook(r.Context(), webhookID)
+			if err != nil {
+				_ = render.Render(w, r, mux.ErrInternalServerError(err))
+				return
+			}
+
+			if wh == nil {
+				_ = render.Render(w, r, mux.ErrNotFound)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), mux.WebhookKey, wh)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		} else {
+			_ = render.Render(w, r, mux.ErrNotFound)
+			return
+		}
+	})
+}
+
+func (m *Middleware) EnsureDeadLetterExists(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if deliveryID := chi.URLParam(r, "deliveryID"); deliveryID != "" {
+			delivery, err := m.service.GetDeadLetter(r.Context(), deliveryID)
+			if err != nil {
+				_ = render.Render(w, r, mux.ErrInternalServerError(err))
+				return
+			}
+
+			if delivery == nil {
+				_ = render.Render(w, r, mux.ErrNotFound)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), mux.DeadLetterKey, delivery)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		} else {
+			_ = render.Render(w, r, mux.ErrNotFound)
 			return
 		}
 	})
@@ -138,8 +556,8 @@ func (m *Middleware) CheckAcceptHeader(contentTypes ...string) func(next http.Ha
 				s = s[0:i]
 			}
 
-			if format := r.URL.Query().Get(string(mux.FormatKey)); format == string(mux.RSCFormat) {
-				ctx := context.WithValue(r.Context(), mux.FormatKey, mux.RSCFormat)
+			if format := mux.Format(r.URL.Query().Get(string(mux.FormatKey))); format == mux.RSCFormat || format == mux.SIGFormat {
+				ctx := context.WithValue(r.Context(), mux.FormatKey, format)
 				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			} else if format != "" {
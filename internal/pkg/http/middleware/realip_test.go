@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "no trusted proxies",
+			remoteAddr: "203.0.113.7:51234",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.1", "X-Real-IP": "10.0.0.1"},
+			want:       "203.0.113.7:51234",
+		},
+		{
+			name:       "untrusted peer",
+			trusted:    []string{"192.0.2.10"},
+			remoteAddr: "203.0.113.7:51234",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.1"},
+			want:       "203.0.113.7:51234",
+		},
+		{
+			name:       "trusted proxy",
+			trusted:    []string{"192.0.2.0/24"},
+			remoteAddr: "192.0.2.10:443",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.4"},
+			want:       "198.51.100.4",
+		},
+		{
+			name:       "forged hops before the client are ignored",
+			trusted:    []string{"192.0.2.0/24"},
+			remoteAddr: "192.0.2.10:443",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.1, 198.51.100.4, 192.0.2.11"},
+			want:       "198.51.100.4",
+		},
+		{
+			name:       "real ip header",
+			trusted:    []string{"192.0.2.10", "2001:db8::/32"},
+			remoteAddr: "[2001:db8::1]:443",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.4"},
+			want:       "198.51.100.4",
+		},
+		{
+			name:       "invalid forwarded address",
+			trusted:    []string{"192.0.2.10"},
+			remoteAddr: "192.0.2.10:443",
+			headers:    map[string]string{"X-Forwarded-For": "unknown", "X-Real-IP": "198.51.100.4"},
+			want:       "192.0.2.10:443",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			realIP, err := RealIP(tt.trusted)
+			if err != nil {
+				t.Fatalf("RealIP() error = %v", err)
+			}
+
+			var got string
+			handler := realIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := RealIP([]string{"proxy.example.com"}); err == nil {
+		t.Errorf("RealIP() with a host name succeeded")
+	}
+}
@@ -0,0 +1,612 @@
+package http
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"mikrotik_provisioning/internal/config"
+	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/apikey"
+	"mikrotik_provisioning/internal/pkg/archive"
+	"mikrotik_provisioning/internal/pkg/audit"
+	"mikrotik_provisioning/internal/pkg/device"
+	"mikrotik_provisioning/internal/pkg/health"
+	"mikrotik_provisioning/internal/pkg/openapi"
+	"mikrotik_provisioning/internal/pkg/webhook"
+	"mikrotik_provisioning/pkg/hmacauth"
+)
+
+const (
+	OpenAPIPath   = "/openapi.json"
+	SwaggerUIPath = "/docs"
+
+	apiVersion = "1.0.0"
+)
+
+// swaggerUI loads the Swagger UI assets from unpkg.com and points them at the OpenAPI document.
+var swaggerUI = template.Must(template.New("swagger-ui").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>MikroTik provisioning API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@3/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@3/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: {{.}}, dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`))
+
+// GetOpenAPI returns the OpenAPI document of the API.
+func (h *OpenAPIHandler) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, h.document)
+}
+
+// GetSwaggerUI returns a Swagger UI page for the OpenAPI document.
+func (h *OpenAPIHandler) GetSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := swaggerUI.Execute(w, OpenAPIPath); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+	}
+}
+
+// NewOpenAPI describes every route of the service. Keep it in sync with the router; the router tests fail
+// if a route, status or body type is not described.
+func NewOpenAPI(application *config.Application, accessConfig *config.Access) *openapi.Document {
+	d := openapi.New("MikroTik provisioning API", apiVersion, "Manages RouterOS address lists and the devices fetching them.")
+	if application.ExternalURL != "" {
+		d.Servers = []*openapi.Server{{URL: application.ExternalURL}}
+	}
+
+	d.Components.SecuritySchemes["hmac"] = &openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        "Authorization",
+		Description: fmt.Sprintf("%s Credential=<access key>, Signature=<signature>, with the Unix time in the %s header.", hmacauth.Scheme, hmacauth.TimestampHeader),
+	}
+	d.Components.SecuritySchemes["bearer"] = &openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "OIDC access token, if an issuer is configured.",
+	}
+	d.Components.SecuritySchemes["deviceToken"] = &openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        "Authorization",
+		Description: DeviceTokenScheme + " <device token>. Devices may present a client certificate instead.",
+	}
+
+	authenticated := []openapi.SecurityRequirement{{"hmac": {}}, {"bearer": {}}}
+	// An empty requirement makes authentication optional, for anonymous reads.
+	readers := authenticated
+	if accessConfig.AnonymousRead {
+		readers = append([]openapi.SecurityRequirement{{}}, authenticated...)
+	}
+	errorResponse := func(description string) *openapi.Response {
+		return d.JSON(description, ErrResponse{})
+	}
+	withErrors := func(responses map[string]*openapi.Response, statuses ...string) map[string]*openapi.Response {
+		descriptions := map[string]string{
+			"400": "Invalid request",
+			"401": "Missing or invalid credentials",
+			"403": "Not allowed",
+			"404": "Not found",
+			"409": "Conflicting change",
+			"500": "Internal server error",
+		}
+		for _, status := range statuses {
+			responses[status] = errorResponse(descriptions[status])
+		}
+		return responses
+	}
+	listed := func(response *openapi.Response) *openapi.Response {
+		response.Headers = map[string]*openapi.Header{
+			NextCursorHeader: {Description: "Cursor of the next page, if there is one.", Schema: &openapi.Schema{Type: "string"}},
+		}
+		return response
+	}
+	script := func(description string) *openapi.Response {
+		response := openapi.Text(description)
+		response.Headers = map[string]*openapi.Header{
+			DigestHeader:    {Description: "Hex encoded SHA-256 of the script.", Schema: &openapi.Schema{Type: "string"}},
+			SignatureHeader: {Description: "Signature of the script, if signing is configured.", Schema: &openapi.Schema{Type: "string"}},
+		}
+		return response
+	}
+	archived := map[string]*openapi.MediaType{archive.ContentType: {Schema: &openapi.Schema{
+		Type: "string",
+		Description: "JSON lines of {\"kind\": ..., \"data\": ...} records: a header, the address lists, devices, API keys " +
+			"and audit events, and a trailer counting the records.",
+	}}}
+
+	addressListName := pathParameter("addressListName", "Name of the address list.")
+	address := pathParameter("address", "IPv4 address or FQDN of the entry.")
+	deviceName := pathParameter("deviceName", "Name of the device.")
+	accessKey := pathParameter("accessKey", "Access key of the API key.")
+	webhookID := pathParameter("webhookID", "ID of the webhook.")
+	deliveryID := pathParameter("deliveryID", "ID of the failed delivery.")
+
+	format := queryParameter(string(FormatKey), "Returns a RouterOS script (rsc) or its signature (sig) instead of JSON.", &openapi.Schema{Type: "string", Enum: []string{string(RSCFormat), string(SIGFormat)}})
+	version := queryParameter(VersionQueryParam, "RouterOS version the script is rendered for, e.g. 7 or 6.48.1.", &openapi.Schema{Type: "string"})
+	model := queryParameter(ModelQueryParam, "RouterBOARD model the script is rendered for.", &openapi.Schema{Type: "string"})
+	limit := queryParameter(LimitQueryParam, fmt.Sprintf("Page size, at most %d.", address_list.MaxLimit), &openapi.Schema{Type: "integer"})
+	cursor := queryParameter(CursorQueryParam, "Cursor from the "+NextCursorHeader+" header of the previous page.", &openapi.Schema{Type: "string"})
+
+	d.Add(http.MethodGet, "/metrics", &openapi.Operation{
+		Summary:   "Prometheus metrics",
+		Tags:      []string{"operations"},
+		Responses: map[string]*openapi.Response{"200": openapi.Text("Metrics in the Prometheus text format")},
+	})
+	d.Add(http.MethodGet, "/healthz", &openapi.Operation{
+		Summary:   "Liveness probe",
+		Tags:      []string{"operations"},
+		Responses: map[string]*openapi.Response{"200": d.JSON("The process is up", health.Report{})},
+	})
+	d.Add(http.MethodGet, "/readyz", &openapi.Operation{
+		Summary: "Readiness probe",
+		Tags:    []string{"operations"},
+		Responses: map[string]*openapi.Response{
+			"200": d.JSON("All components are ready", health.Report{}),
+			"503": d.JSON("A component is not ready", health.Report{}),
+		},
+	})
+	d.Add(http.MethodGet, OpenAPIPath, &openapi.Operation{
+		Summary:   "This OpenAPI document",
+		Tags:      []string{"operations"},
+		Responses: map[string]*openapi.Response{"200": {Description: "OpenAPI 3 document", Content: map[string]*openapi.MediaType{openapi.JSONContentType: {Schema: &openapi.Schema{Type: "object"}}}}},
+	})
+	if application.SwaggerUI {
+		d.Add(http.MethodGet, SwaggerUIPath, &openapi.Operation{
+			Summary:   "Swagger UI for this OpenAPI document",
+			Tags:      []string{"operations"},
+			Responses: map[string]*openapi.Response{"200": {Description: "HTML page", Content: map[string]*openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}}}},
+		})
+	}
+
+	d.Add(http.MethodGet, AddressListPath+"/", &openapi.Operation{
+		OperationID: "getAddressLists",
+		Summary:     "List address lists",
+		Tags:        []string{"address-list"},
+		Security:    readers,
+		Parameters: []*openapi.Parameter{
+			format, version, model,
+			queryParameter(PrefixQueryParam, "Only lists whose name starts with the prefix.", &openapi.Schema{Type: "string"}),
+			queryParameter(LabelQueryParam, "Only lists with the label, as key or key=value. May be repeated.", &openapi.Schema{Type: "array", Items: &openapi.Schema{Type: "string"}}),
+			queryParameter(SortQueryParam, "name or -name.", &openapi.Schema{Type: "string", Enum: []string{"name", "-name"}}),
+			limit, cursor,
+		},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": listed(d.JSON("The address lists, or a script with all of them", []address_list.AddressListResponse{})),
+		}, "400", "401", "403", "500"),
+	})
+	d.Add(http.MethodPost, AddressListPath+"/", &openapi.Operation{
+		OperationID: "createAddressList",
+		Summary:     "Create an address list",
+		Tags:        []string{"address-list"},
+		Security:    authenticated,
+		RequestBody: d.Body("The address list", address_list.AddressListRequest{}),
+		Responses: withErrors(map[string]*openapi.Response{
+			"201": d.JSON("The created address list", address_list.AddressListResponse{}),
+		}, "400", "401", "403", "500"),
+	})
+	d.Add(http.MethodGet, AddressListPath+"/{addressListName}", &openapi.Operation{
+		OperationID: "getAddressList",
+		Summary:     "Get an address list",
+		Tags:        []string{"address-list"},
+		Security:    readers,
+		Parameters: []*openapi.Parameter{
+			addressListName, format, version, model,
+			queryParameter(DeviceQueryParam, "With format=sig, also sign the script with the key of the device, for its loader.", &openapi.Schema{Type: "string"}),
+		},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The address list, or its script", address_list.AddressListResponse{}),
+		}, "400", "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodPut, AddressListPath+"/{addressListName}", &openapi.Operation{
+		OperationID: "updateAddressList",
+		Summary:     "Replace the entries and labels of an address list",
+		Tags:        []string{"address-list"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{addressListName},
+		RequestBody: d.Body("The address list", address_list.AddressListRequest{}),
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The updated address list", address_list.AddressListResponse{}),
+		}, "400", "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodPatch, AddressListPath+"/{addressListName}", &openapi.Operation{
+		OperationID: "patchAddressList",
+		Summary:     "Add or remove entries of an address list",
+		Tags:        []string{"address-list"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{addressListName},
+		RequestBody: d.Body("The entries to add or remove", address_list.AddressListPatchRequest{}),
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The updated address list", address_list.AddressListResponse{}),
+		}, "400", "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodDelete, AddressListPath+"/{addressListName}", &openapi.Operation{
+		OperationID: "deleteAddressList",
+		Summary:     "Delete an address list",
+		Tags:        []string{"address-list"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{addressListName},
+		Responses: withErrors(map[string]*openapi.Response{
+			"204": openapi.Empty("The address list was deleted"),
+		}, "400", "401", "403", "404"),
+	})
+	d.Add(http.MethodGet, AddressListPath+"/{addressListName}/loader", &openapi.Operation{
+		OperationID: "getAddressListLoader",
+		Summary:     "Get a RouterOS script which fetches the address list and imports it if signed with the key of the device",
+		Description: "The loader fetches the list without credentials, so anonymous reads must be configured or " +
+			"the router must present a client certificate of the device.",
+		Tags:     []string{"address-list"},
+		Security: readers,
+		Parameters: []*openapi.Parameter{
+			addressListName, version, model,
+			{Name: DeviceQueryParam, In: "query", Description: "The device running the loader, whose bootstrap installed its key. Requires signing to be configured.", Required: true, Schema: &openapi.Schema{Type: "string"}},
+		},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": openapi.Text("The loader script"),
+		}, "400", "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodGet, AddressListPath+"/{addressListName}/entries", &openapi.Operation{
+		OperationID: "getEntries",
+		Summary:     "List the entries of an address list",
+		Tags:        []string{"address-list"},
+		Security:    readers,
+		Parameters: []*openapi.Parameter{
+			addressListName,
+			queryParameter(AddressQueryParam, "An address, or an IPv4 network in CIDR notation matching the entries within it.", &openapi.Schema{Type: "string"}),
+			queryParameter(CommentQueryParam, "Only entries with the comment.", &openapi.Schema{Type: "string"}),
+			queryParameter(DisabledQueryParam, "Only disabled or enabled entries.", &openapi.Schema{Type: "boolean"}),
+			queryParameter(SortQueryParam, "address or -address.", &openapi.Schema{Type: "string", Enum: []string{"address", "-address"}}),
+			limit, cursor,
+		},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": listed(d.JSON("The entries", []address_list.AddressResponse{})),
+		}, "400", "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodGet, AddressListPath+"/{addressListName}/watch", &openapi.Operation{
+		OperationID: "watchAddressList",
+		Summary:     "Wait for changes of an address list",
+		Description: "Long-polls until the revision differs from the revision parameter. Clients accepting " + EventStreamContentType + " receive every revision as a server-sent event instead.",
+		Tags:        []string{"address-list"},
+		Security:    readers,
+		Parameters: []*openapi.Parameter{
+			addressListName,
+			queryParameter(RevisionQueryParam, "Last revision known to the client; defaults to the current revision.", &openapi.Schema{Type: "integer", Format: "int64"}),
+			{Name: LastEventIDHeader, In: "header", Description: "Last revision received by an event stream client.", Schema: &openapi.Schema{Type: "string"}},
+		},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": {
+				Description: "The changed address list, or a stream of change events",
+				Content: map[string]*openapi.MediaType{
+					openapi.JSONContentType: {Schema: d.Schema(address_list.AddressListResponse{})},
+					EventStreamContentType:  {Schema: &openapi.Schema{Type: "string"}},
+				},
+			},
+			"304": openapi.Empty("The address list did not change before the timeout"),
+		}, "400", "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodGet, AddressListPath+"/{addressListName}/entries/{address}", &openapi.Operation{
+		OperationID: "getEntry",
+		Summary:     "Get an entry of an address list",
+		Tags:        []string{"address-list"},
+		Security:    readers,
+		Parameters:  []*openapi.Parameter{addressListName, address},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The entry", address_list.AddressResponse{}),
+		}, "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodPut, AddressListPath+"/{addressListName}/entries/{address}", &openapi.Operation{
+		OperationID: "putEntry",
+		Summary:     "Create or replace an entry of an address list",
+		Tags:        []string{"address-list"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{addressListName, address},
+		RequestBody: d.Body("The entry", address_list.EntryRequest{}),
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The replaced entry", address_list.AddressResponse{}),
+			"201": d.JSON("The created entry", address_list.AddressResponse{}),
+		}, "400", "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodDelete, AddressListPath+"/{addressListName}/entries/{address}", &openapi.Operation{
+		OperationID: "deleteEntry",
+		Summary:     "Delete an entry of an address list",
+		Tags:        []string{"address-list"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{addressListName, address},
+		Responses: withErrors(map[string]*openapi.Response{
+			"204": openapi.Empty("The entry was deleted"),
+		}, "400", "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodPost, ChangesPath, &openapi.Operation{
+		OperationID: "applyChanges",
+		Summary:     "Add and remove entries of several address lists at once",
+		Description: "All operations are applied, or none of them.",
+		Tags:        []string{"address-list"},
+		Security:    authenticated,
+		Parameters: []*openapi.Parameter{
+			queryParameter(DryRunQueryParam, "Only reports the effect of the operations.", &openapi.Schema{Type: "boolean"}),
+		},
+		RequestBody: d.Body("The operations, applied in order", address_list.ChangeRequest{}),
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The effect of every operation", address_list.ChangeResponse{}),
+			"422": d.JSON("An operation is invalid; nothing was applied", address_list.ChangeResponse{}),
+		}, "400", "401", "403", "409", "500"),
+	})
+	d.Add(http.MethodPost, ApplyPath, &openapi.Operation{
+		OperationID: "applyManifests",
+		Summary:     "Bring the address lists of an owner in line with their manifests",
+		Description: "Declared lists are created, or updated if their managed-by label names the owner. With prune, " +
+			"the other lists of the owner are deleted. Lists of other owners are never changed. A plan ID from a " +
+			"dry run applies the plan only if it is still the same.",
+		Tags:     []string{"address-list"},
+		Security: authenticated,
+		Parameters: []*openapi.Parameter{
+			queryParameter(DryRunQueryParam, "Only returns the plan.", &openapi.Schema{Type: "boolean"}),
+		},
+		RequestBody: d.Body("The owner and its address lists", address_list.ApplyRequest{}),
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The plan, and whether it was applied", address_list.Plan{}),
+		}, "400", "401", "403", "409", "500"),
+	})
+
+	d.Add(http.MethodGet, DevicePath+"/", &openapi.Operation{
+		OperationID: "getDevices",
+		Summary:     "List devices",
+		Tags:        []string{"device"},
+		Security:    authenticated,
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The devices", []device.DeviceResponse{}),
+		}, "401", "403", "500"),
+	})
+	d.Add(http.MethodPost, DevicePath+"/", &openapi.Operation{
+		OperationID: "createDevice",
+		Summary:     "Create a device",
+		Tags:        []string{"device"},
+		Security:    authenticated,
+		RequestBody: d.Body("The device", device.DeviceRequest{}),
+		Responses: withErrors(map[string]*openapi.Response{
+			"201": d.JSON("The created device", device.DeviceResponse{}),
+		}, "400", "401", "403", "500"),
+	})
+	d.Add(http.MethodGet, DevicePath+"/{deviceName}", &openapi.Operation{
+		OperationID: "getDevice",
+		Summary:     "Get a device",
+		Tags:        []string{"device"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{deviceName},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The device", device.DeviceResponse{}),
+		}, "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodPut, DevicePath+"/{deviceName}", &openapi.Operation{
+		OperationID: "updateDevice",
+		Summary:     "Update a device",
+		Tags:        []string{"device"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{deviceName},
+		RequestBody: d.Body("The device", device.DeviceRequest{}),
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The updated device", device.DeviceResponse{}),
+		}, "400", "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodDelete, DevicePath+"/{deviceName}", &openapi.Operation{
+		OperationID: "deleteDevice",
+		Summary:     "Delete a device",
+		Tags:        []string{"device"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{deviceName},
+		Responses: withErrors(map[string]*openapi.Response{
+			"204": openapi.Empty("The device was deleted"),
+		}, "400", "401", "403", "404"),
+	})
+	d.Add(http.MethodGet, DevicePath+"/{deviceName}/bootstrap.rsc", &openapi.Operation{
+		OperationID: "getDeviceBootstrap",
+		Summary:     "Get the script which sets up a device to fetch its address lists",
+		Tags:        []string{"device"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{deviceName, version, model},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": openapi.Text("The bootstrap script"),
+		}, "400", "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodGet, DevicePath+"/{deviceName}/script.rsc", &openapi.Operation{
+		OperationID: "getDeviceScript",
+		Summary:     "Get the address lists of a device as a script",
+		Tags:        []string{"device"},
+		Security:    []openapi.SecurityRequirement{{"deviceToken": {}}},
+		Parameters:  []*openapi.Parameter{deviceName, format, version, model},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": script("The address list script"),
+		}, "400", "401", "403", "404", "500"),
+	})
+
+	d.Add(http.MethodGet, APIKeyPath+"/", &openapi.Operation{
+		OperationID: "getAPIKeys",
+		Summary:     "List API keys",
+		Tags:        []string{"admin"},
+		Security:    authenticated,
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The API keys, without secrets", []apikey.APIKeyResponse{}),
+		}, "401", "403", "500"),
+	})
+	d.Add(http.MethodPost, APIKeyPath+"/", &openapi.Operation{
+		OperationID: "createAPIKey",
+		Summary:     "Create an API key",
+		Tags:        []string{"admin"},
+		Security:    authenticated,
+		RequestBody: d.Body("Role, grants and expiry of the key", apikey.APIKeyRequest{}),
+		Responses: withErrors(map[string]*openapi.Response{
+			"201": d.JSON("The created key, with its secret", apikey.APIKeyResponse{}),
+		}, "400", "401", "403", "500"),
+	})
+	d.Add(http.MethodGet, APIKeyPath+"/{accessKey}", &openapi.Operation{
+		OperationID: "getAPIKey",
+		Summary:     "Get an API key",
+		Tags:        []string{"admin"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{accessKey},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The key, without secret", apikey.APIKeyResponse{}),
+		}, "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodPut, APIKeyPath+"/{accessKey}", &openapi.Operation{
+		OperationID: "updateAPIKey",
+		Summary:     "Update the description, role, grants and expiry of an API key",
+		Tags:        []string{"admin"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{accessKey},
+		RequestBody: d.Body("The key", apikey.APIKeyRequest{}),
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The updated key", apikey.APIKeyResponse{}),
+		}, "400", "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodDelete, APIKeyPath+"/{accessKey}", &openapi.Operation{
+		OperationID: "deleteAPIKey",
+		Summary:     "Delete an API key",
+		Tags:        []string{"admin"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{accessKey},
+		Responses: withErrors(map[string]*openapi.Response{
+			"204": openapi.Empty("The key was deleted"),
+		}, "400", "401", "403", "404"),
+	})
+	rotate := d.Body("How long the previous secret stays valid", apikey.RotateRequest{})
+	rotate.Required = false
+	d.Add(http.MethodPost, APIKeyPath+"/{accessKey}/rotate", &openapi.Operation{
+		OperationID: "rotateAPIKey",
+		Summary:     "Generate a new secret for an API key",
+		Tags:        []string{"admin"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{accessKey},
+		RequestBody: rotate,
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The key, with its new secret", apikey.APIKeyResponse{}),
+		}, "400", "401", "403", "404", "500"),
+	})
+
+	d.Add(http.MethodGet, AuditPath, &openapi.Operation{
+		OperationID: "getAuditEvents",
+		Summary:     "List audit events",
+		Tags:        []string{"admin"},
+		Security:    authenticated,
+		Parameters: []*openapi.Parameter{
+			queryParameter(ActorQueryParam, "Only events of the actor.", &openapi.Schema{Type: "string"}),
+			queryParameter(ListQueryParam, "Only events of the address list.", &openapi.Schema{Type: "string"}),
+			queryParameter(FromQueryParam, "Only events at or after the time.", &openapi.Schema{Type: "string", Format: "date-time"}),
+			queryParameter(ToQueryParam, "Only events before the time.", &openapi.Schema{Type: "string", Format: "date-time"}),
+		},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The events", []audit.EventResponse{}),
+		}, "400", "401", "403", "500"),
+	})
+	d.Add(http.MethodGet, ExportPath, &openapi.Operation{
+		OperationID: "exportArchive",
+		Summary:     "Export all address lists, devices, API keys and audit events",
+		Description: "The archive does not depend on the storage backend. Without secrets, it holds no device tokens " +
+			"and API signing keys.",
+		Tags:     []string{"admin"},
+		Security: authenticated,
+		Parameters: []*openapi.Parameter{
+			queryParameter(SecretsQueryParam, "Includes device tokens and API signing keys.", &openapi.Schema{Type: "boolean"}),
+		},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": {Description: "The archive", Content: archived},
+		}, "400", "401", "403", "500"),
+	})
+	d.Add(http.MethodPost, ImportPath, &openapi.Operation{
+		OperationID: "importArchive",
+		Summary:     "Restore an archive",
+		Description: "Merge creates and updates what the archive holds; replace also deletes the address lists, devices " +
+			"and API keys it does not hold, except the key of the caller. Audit events are only added, naming the caller " +
+			"as their importer. The archive is validated before anything is written.",
+		Tags:     []string{"admin"},
+		Security: authenticated,
+		Parameters: []*openapi.Parameter{
+			queryParameter(ModeQueryParam, "How to restore the archive, merge by default.", &openapi.Schema{Type: "string", Enum: []string{string(archive.MergeMode), string(archive.ReplaceMode)}}),
+		},
+		RequestBody: &openapi.RequestBody{Description: "The archive", Required: true, Content: archived},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("What was restored", archive.Result{}),
+		}, "400", "401", "403", "409", "500"),
+	})
+
+	d.Add(http.MethodGet, WebhookPath+"/", &openapi.Operation{
+		OperationID: "getWebhooks",
+		Summary:     "List webhooks",
+		Tags:        []string{"webhook"},
+		Security:    authenticated,
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The webhooks, without secrets", []webhook.WebhookResponse{}),
+		}, "401", "403", "500"),
+	})
+	d.Add(http.MethodPost, WebhookPath+"/", &openapi.Operation{
+		OperationID: "createWebhook",
+		Summary:     "Create a webhook",
+		Tags:        []string{"webhook"},
+		Security:    authenticated,
+		RequestBody: d.Body("The webhook", webhook.WebhookRequest{}),
+		Responses: withErrors(map[string]*openapi.Response{
+			"201": d.JSON("The created webhook, with its secret", webhook.WebhookResponse{}),
+		}, "400", "401", "403", "500"),
+	})
+	d.Add(http.MethodGet, WebhookPath+"/dead-letters", &openapi.Operation{
+		OperationID: "getDeadLetters",
+		Summary:     "List deliveries which failed every attempt",
+		Tags:        []string{"webhook"},
+		Security:    authenticated,
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The dead letters", []webhook.DeliveryResponse{}),
+		}, "401", "403", "500"),
+	})
+	d.Add(http.MethodPost, WebhookPath+"/dead-letters/{deliveryID}/retry", &openapi.Operation{
+		OperationID: "retryDeadLetter",
+		Summary:     "Deliver a dead letter again",
+		Tags:        []string{"webhook"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{deliveryID},
+		Responses: withErrors(map[string]*openapi.Response{
+			"202": d.JSON("The delivery was queued", webhook.DeliveryResponse{}),
+		}, "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodGet, WebhookPath+"/{webhookID}", &openapi.Operation{
+		OperationID: "getWebhook",
+		Summary:     "Get a webhook",
+		Tags:        []string{"webhook"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{webhookID},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": d.JSON("The webhook, without secret", webhook.WebhookResponse{}),
+		}, "401", "403", "404", "500"),
+	})
+	d.Add(http.MethodDelete, WebhookPath+"/{webhookID}", &openapi.Operation{
+		OperationID: "deleteWebhook",
+		Summary:     "Delete a webhook",
+		Tags:        []string{"webhook"},
+		Security:    authenticated,
+		Parameters:  []*openapi.Parameter{webhookID},
+		Responses: withErrors(map[string]*openapi.Response{
+			"204": openapi.Empty("The webhook was deleted"),
+		}, "400", "401", "403", "404"),
+	})
+
+	return d
+}
+
+func pathParameter(name, description string) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "path", Description: description, Required: true, Schema: &openapi.Schema{Type: "string"}}
+}
+
+func queryParameter(name, description string, schema *openapi.Schema) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
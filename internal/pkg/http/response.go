@@ -2,10 +2,53 @@ package http
 
 import (
 	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/render"
 
+	"mikrotik_provisioning/internal/config"
 	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/apikey"
+	"mikrotik_provisioning/internal/pkg/audit"
+	"mikrotik_provisioning/internal/pkg/device"
+	"mikrotik_provisioning/internal/pkg/metrics"
+	"mikrotik_provisioning/internal/pkg/signing"
+	"mikrotik_provisioning/internal/pkg/templates"
+	"mikrotik_provisioning/internal/pkg/webhook"
+)
+
+type (
+	// signedImport is the data of the ImportSigned template, which the address list loader and, with signing
+	// configured, the fetch script of a device render. Subject and Name identify what is imported in logs.
+	signedImport struct {
+		Subject             string
+		Name                string
+		ScriptURL           string
+		SignatureURL        string
+		KeyScriptName       string
+		MACField            string
+		AuthorizationHeader string
+	}
+
+	deviceBootstrap struct {
+		Name          string
+		ScriptName    string
+		Interval      string
+		FetchScript   string
+		KeyScriptName string
+		Key           string
+	}
+
+	deviceFetchScript struct {
+		signedImport
+		FileName string
+	}
 )
 
 func newAddressListResponse(addressList *address_list.AddressList) *address_list.AddressListResponse {
@@ -21,9 +64,364 @@ func getAddressListsJSONResponse(addressLists []*address_list.AddressList) []ren
 	return list
 }
 
-func (h *AddressListHandler) getAddressListsTextResponse(addressLists []*address_list.AddressList) ([]byte, error) {
+func newDeviceResponse(dev *device.Device) *device.DeviceResponse {
+	return &device.DeviceResponse{Device: dev}
+}
+
+func getDevicesJSONResponse(devices []*device.Device) []render.Renderer {
+	list := make([]render.Renderer, len(devices))
+
+	for i, dev := range devices {
+		list[i] = newDeviceResponse(dev)
+	}
+	return list
+}
+
+func newAPIKeyResponse(key *apikey.APIKey) *apikey.APIKeyResponse {
+	return &apikey.APIKeyResponse{APIKey: key}
+}
+
+func getAPIKeysJSONResponse(keys []*apikey.APIKey) []render.Renderer {
+	list := make([]render.Renderer, len(keys))
+
+	for i, key := range keys {
+		list[i] = newAPIKeyResponse(key)
+	}
+	return list
+}
+
+// newWebhookResponse hides the secret, which is only returned when the webhook is created.
+func newWebhookResponse(wh *webhook.Webhook) *webhook.WebhookResponse {
+	response := *wh
+	response.Secret = ""
+
+	return &webhook.WebhookResponse{Webhook: &response}
+}
+
+func getWebhooksJSONResponse(webhooks []*webhook.Webhook) []render.Renderer {
+	list := make([]render.Renderer, len(webhooks))
+
+	for i, wh := range webhooks {
+		list[i] = newWebhookResponse(wh)
+	}
+	return list
+}
+
+func getDeadLettersJSONResponse(deliveries []*webhook.Delivery) []render.Renderer {
+	list := make([]render.Renderer, len(deliveries))
+
+	for i, delivery := range deliveries {
+		list[i] = &webhook.DeliveryResponse{Delivery: delivery}
+	}
+	return list
+}
+
+func getAuditEventsJSONResponse(events []*audit.Event) []render.Renderer {
+	list := make([]render.Renderer, len(events))
+
+	for i, event := range events {
+		list[i] = &audit.EventResponse{Event: event}
+	}
+	return list
+}
+
+func getEntriesJSONResponse(addresses []*address_list.Address) []render.Renderer {
+	list := make([]render.Renderer, len(addresses))
+
+	for i, address := range addresses {
+		list[i] = &address_list.AddressResponse{Address: address}
+	}
+	return list
+}
+
+// getAddressListFilter parses ?prefix=office-&label=env=prod&label=site&sort=-name&limit=50&cursor=...
+func getAddressListFilter(r *http.Request) (*address_list.Filter, error) {
+	query := r.URL.Query()
+	filter := &address_list.Filter{Prefix: query.Get(PrefixQueryParam), Cursor: query.Get(CursorQueryParam)}
+
+	for _, label := range query[LabelQueryParam] {
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+
+		key, value := label, ""
+		if i := strings.Index(label, "="); i > -1 {
+			key, value = label[:i], label[i+1:]
+		}
+		if key == "" || strings.ContainsAny(key, ".$") {
+			return nil, fmt.Errorf("invalid %s parameter value: %s", LabelQueryParam, label)
+		}
+		filter.Labels[key] = value
+	}
+
+	descending, err := getSortOrder(r, "name")
+	if err != nil {
+		return nil, err
+	}
+	filter.Descending = descending
+
+	limit, err := getLimit(r)
+	if err != nil {
+		return nil, err
+	}
+	filter.Limit = limit
+
+	return filter, nil
+}
+
+// getEntryFilter parses ?address=10.0.0.0/8&comment=office&disabled=false&sort=-address&limit=50&cursor=...
+// An address containing a slash matches the entries within the network, otherwise the entry itself.
+func getEntryFilter(r *http.Request) (*address_list.EntryFilter, error) {
+	query := r.URL.Query()
+	filter := &address_list.EntryFilter{Comment: query.Get(CommentQueryParam), Cursor: query.Get(CursorQueryParam)}
+
+	if address := query.Get(AddressQueryParam); strings.Contains(address, "/") {
+		_, network, err := net.ParseCIDR(address)
+		if err != nil || network.IP.To4() == nil {
+			return nil, fmt.Errorf("invalid %s parameter value: %s", AddressQueryParam, address)
+		}
+		filter.Network = network
+	} else {
+		filter.Address = address
+	}
+
+	if disabled := query.Get(DisabledQueryParam); disabled != "" {
+		value, err := strconv.ParseBool(disabled)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s parameter value: %s", DisabledQueryParam, disabled)
+		}
+		filter.Disabled = &value
+	}
+
+	descending, err := getSortOrder(r, "address")
+	if err != nil {
+		return nil, err
+	}
+	filter.Descending = descending
+
+	limit, err := getLimit(r)
+	if err != nil {
+		return nil, err
+	}
+	filter.Limit = limit
+
+	return filter, nil
+}
+
+// getSortOrder reports whether the sort parameter asks for descending order of the only sortable field.
+func getSortOrder(r *http.Request, field string) (bool, error) {
+	switch sort := r.URL.Query().Get(SortQueryParam); sort {
+	case "", field:
+		return false, nil
+	case "-" + field:
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid %s parameter value: %s", SortQueryParam, sort)
+	}
+}
+
+func getLimit(r *http.Request) (int64, error) {
+	limit := r.URL.Query().Get(LimitQueryParam)
+	if limit == "" {
+		return 0, nil
+	}
+
+	value, err := strconv.ParseInt(limit, 10, 64)
+	if err != nil || value < 1 || value > address_list.MaxLimit {
+		return 0, fmt.Errorf("invalid %s parameter value: %s", LimitQueryParam, limit)
+	}
+
+	return value, nil
+}
+
+func getAuditFilter(r *http.Request) (*audit.Filter, error) {
+	query := r.URL.Query()
+	filter := &audit.Filter{Actor: query.Get(ActorQueryParam), List: query.Get(ListQueryParam)}
+
+	if from := query.Get(FromQueryParam); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s parameter value: %s", FromQueryParam, from)
+		}
+		filter.From = t
+	}
+
+	if to := query.Get(ToQueryParam); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s parameter value: %s", ToQueryParam, to)
+		}
+		filter.To = t
+	}
+
+	return filter, nil
+}
+
+func getTemplateSelector(r *http.Request) (templates.Selector, error) {
+	selector := templates.Selector{Model: r.URL.Query().Get(ModelQueryParam)}
+
+	if version := r.URL.Query().Get(VersionQueryParam); version != "" {
+		major, err := templates.ParseVersion(version)
+		if err != nil {
+			return selector, err
+		}
+		selector.Version = major
+	}
+
+	return selector, nil
+}
+
+// getDeviceTemplateSelector fills the parts of the selector missing from the request from the device record.
+func getDeviceTemplateSelector(r *http.Request, dev *device.Device) (templates.Selector, error) {
+	selector, err := getTemplateSelector(r)
+	if err != nil {
+		return selector, err
+	}
+
+	if selector.Model == "" {
+		selector.Model = dev.Model
+	}
+
+	if selector.Version == 0 && dev.RouterOSVersion != "" {
+		major, err := templates.ParseVersion(dev.RouterOSVersion)
+		if err != nil {
+			return selector, err
+		}
+		selector.Version = major
+	}
+
+	return selector, nil
+}
+
+// newDeviceFetchScript returns the data of the script the scheduler of a device runs. If signed, the script
+// fetches the signature file as well and imports only what the device key verifies.
+func newDeviceFetchScript(r *http.Request, application *config.Application, dev *device.Device, signed bool) *deviceFetchScript {
+	scriptURL := getExternalURL(r, application)
+	scriptURL.Path += DevicePath + "/" + dev.Name + "/script.rsc"
+
+	fetchScript := &deviceFetchScript{
+		signedImport: signedImport{
+			Subject:             "device",
+			Name:                dev.Name,
+			ScriptURL:           scriptURL.String(),
+			AuthorizationHeader: "Authorization: " + DeviceTokenScheme + " " + dev.Token,
+		},
+		FileName: DeviceScriptName + ".rsc",
+	}
+	if signed {
+		signatureURL := *scriptURL
+		signatureURL.RawQuery = url.Values{string(FormatKey): {string(SIGFormat)}}.Encode()
+		fetchScript.SignatureURL = signatureURL.String()
+		fetchScript.KeyScriptName = DeviceKeyScript
+		fetchScript.MACField = signing.DeviceMACField
+	}
+
+	return fetchScript
+}
+
+// getExternalURL returns the URL routers use to reach the service: the configured external URL
+// or, if it is not set, the one the request was made to. Forwarding headers are not trusted, so
+// the external URL must be configured behind a TLS terminating proxy.
+func getExternalURL(r *http.Request, application *config.Application) *url.URL {
+	if application != nil && application.ExternalURL != "" {
+		if externalURL, err := url.Parse(application.ExternalURL); err == nil {
+			externalURL.Path = strings.TrimSuffix(externalURL.Path, "/")
+			return externalURL
+		}
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return &url.URL{Scheme: scheme, Host: r.Host}
+}
+
+func newAddressListLoader(r *http.Request, application *config.Application, name string, dev *device.Device) *signedImport {
+	scriptURL := getExternalURL(r, application)
+	scriptURL.Path += AddressListPath + "/" + name
+	signatureURL := *scriptURL
+
+	query := r.URL.Query()
+	query.Set(DeviceQueryParam, dev.Name)
+	query.Set(string(FormatKey), string(RSCFormat))
+	scriptURL.RawQuery = query.Encode()
+	query.Set(string(FormatKey), string(SIGFormat))
+	signatureURL.RawQuery = query.Encode()
+
+	return &signedImport{
+		Subject:       "address-list",
+		Name:          name,
+		ScriptURL:     scriptURL.String(),
+		SignatureURL:  signatureURL.String(),
+		KeyScriptName: DeviceKeyScript,
+		MACField:      signing.DeviceMACField,
+	}
+}
+
+// writeTextResponse writes a rendered script together with its digest and signature headers,
+// or the signature file alone when it was requested with the sig format. The signature file
+// carries the DeviceMAC of the script if deviceKey is not empty.
+func writeTextResponse(w http.ResponseWriter, r *http.Request, signer signing.Signer, deviceKey string, out []byte) {
+	w.Header().Set(DigestHeader, signing.Digest(out))
+	if signer != nil {
+		w.Header().Set(SignatureHeader, signer.Sign(out))
+	}
+
+	if r.Context().Value(FormatKey) == SIGFormat {
+		out = signing.SignatureFile(out, signer, deviceKey)
+	}
+
+	writeText(w, out)
+}
+
+// writeText writes a script or signature file as plain text, which is how the API describes them.
+func writeText(w http.ResponseWriter, out []byte) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(out)
+}
+
+func setAddressListsFetched(addressLists []*address_list.AddressList) {
+	now := time.Now()
+	for _, addressList := range addressLists {
+		metrics.SetAddressListFetched(addressList.Name, now)
+	}
+}
+
+func (h *AddressListHandler) getAddressListsTextResponse(selector templates.Selector, addressLists []*address_list.AddressList) ([]byte, error) {
+	output := bytes.Buffer{}
+	err := h.templates.ExecuteTemplate(&output, selector, "GetAddressLists", addressLists)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Bytes(), nil
+}
+
+func (h *AddressListHandler) getAddressListTextResponse(selector templates.Selector, addressList *address_list.AddressList) ([]byte, error) {
+	output := bytes.Buffer{}
+	err := h.templates.ExecuteTemplate(&output, selector, "GetAddressList", addressList)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Bytes(), nil
+}
+
+func (h *AddressListHandler) getAddressListLoaderTextResponse(selector templates.Selector, loader *signedImport) ([]byte, error) {
+	output := bytes.Buffer{}
+	err := h.templates.ExecuteTemplate(&output, selector, "GetAddressListLoader", loader)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Bytes(), nil
+}
+
+func (h *DeviceHandler) getAddressListsTextResponse(selector templates.Selector, addressLists []*address_list.AddressList) ([]byte, error) {
 	output := bytes.Buffer{}
-	err := h.templates.ExecuteTemplate(&output, "GetAddressLists", addressLists)
+	err := h.templates.ExecuteTemplate(&output, selector, "GetAddressLists", addressLists)
 	if err != nil {
 		return nil, err
 	}
@@ -31,9 +429,26 @@ func (h *AddressListHandler) getAddressListsTextResponse(addressLists []*address
 	return output.Bytes(), nil
 }
 
-func (h *AddressListHandler) getAddressListTextResponse(addressList *address_list.AddressList) ([]byte, error) {
+func (h *DeviceHandler) getDeviceBootstrapTextResponse(selector templates.Selector, r *http.Request, dev *device.Device) ([]byte, error) {
+	fetchScript := bytes.Buffer{}
+	err := h.templates.ExecuteTemplate(&fetchScript, selector, "GetDeviceFetchScript", newDeviceFetchScript(r, h.config, dev, h.signer != nil))
+	if err != nil {
+		return nil, err
+	}
+
+	bootstrap := &deviceBootstrap{
+		Name:          dev.Name,
+		ScriptName:    DeviceScriptName,
+		Interval:      strconv.Itoa(int(dev.Interval().Seconds())) + "s",
+		FetchScript:   fetchScript.String(),
+		KeyScriptName: DeviceKeyScript,
+	}
+	if h.signer != nil {
+		bootstrap.Key = signing.DeviceKey(h.signer, dev.Name, dev.Token)
+	}
+
 	output := bytes.Buffer{}
-	err := h.templates.ExecuteTemplate(&output, "GetAddressList", addressList)
+	err = h.templates.ExecuteTemplate(&output, selector, "GetDeviceBootstrap", bootstrap)
 	if err != nil {
 		return nil, err
 	}
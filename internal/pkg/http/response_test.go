@@ -0,0 +1,85 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+)
+
+func TestGetAddressListFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    *address_list.Filter
+		wantErr bool
+	}{
+		{name: "empty", want: &address_list.Filter{}},
+		{
+			name:  "all",
+			query: "?prefix=office-&label=env=prod&label=site&sort=-name&limit=50&cursor=b2ZmaWNl",
+			want:  &address_list.Filter{Prefix: "office-", Labels: map[string]string{"env": "prod", "site": ""}, Descending: true, Limit: 50, Cursor: "b2ZmaWNl"},
+		},
+		{name: "ascending", query: "?sort=name", want: &address_list.Filter{}},
+		{name: "sort field", query: "?sort=revision", wantErr: true},
+		{name: "label key", query: "?label=$where=1", wantErr: true},
+		{name: "empty label key", query: "?label==prod", wantErr: true},
+		{name: "limit", query: "?limit=0", wantErr: true},
+		{name: "limit above maximum", query: "?limit=1001", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getAddressListFilter(httptest.NewRequest(http.MethodGet, "/address-list"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getAddressListFilter() error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getAddressListFilter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetEntryFilter(t *testing.T) {
+	disabled := false
+
+	tests := []struct {
+		name        string
+		query       string
+		want        *address_list.EntryFilter
+		wantNetwork string
+		wantErr     bool
+	}{
+		{name: "empty", want: &address_list.EntryFilter{}},
+		{name: "address", query: "?address=10.0.0.1&comment=gateway&disabled=false&sort=-address&limit=10", want: &address_list.EntryFilter{Address: "10.0.0.1", Comment: "gateway", Disabled: &disabled, Descending: true, Limit: 10}},
+		{name: "network", query: "?address=10.1.2.3/8", want: &address_list.EntryFilter{}, wantNetwork: "10.0.0.0/8"},
+		{name: "invalid network", query: "?address=10.0.0.0/33", wantErr: true},
+		{name: "IPv6 network", query: "?address=2001:db8::/32", wantErr: true},
+		{name: "disabled", query: "?disabled=maybe", wantErr: true},
+		{name: "sort field", query: "?sort=-name", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getEntryFilter(httptest.NewRequest(http.MethodGet, "/address-list/office/entries"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getEntryFilter() error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			network := ""
+			if got.Network != nil {
+				network = got.Network.String()
+				got.Network = nil
+			}
+			if network != tt.wantNetwork || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getEntryFilter() = %+v with network %q, want %+v with network %q", got, network, tt.want, tt.wantNetwork)
+			}
+		})
+	}
+}
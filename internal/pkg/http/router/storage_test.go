@@ -0,0 +1,553 @@
+package router_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/apikey"
+	"mikrotik_provisioning/internal/pkg/audit"
+	"mikrotik_provisioning/internal/pkg/device"
+	"mikrotik_provisioning/internal/pkg/webhook"
+)
+
+// storage keeps everything in memory. Stored values are copied, as the service modifies what it gets.
+type storage struct {
+	mu          sync.Mutex
+	ids         int
+	lists       map[string]*address_list.AddressList
+	devices     map[string]*device.Device
+	keys        map[string]*apikey.APIKey
+	events      []*audit.Event
+	eventsLimit int
+	webhooks    map[string]*webhook.Webhook
+	deadLetters map[string]*webhook.Delivery
+}
+
+func newStorage() *storage {
+	return &storage{
+		lists:       make(map[string]*address_list.AddressList),
+		devices:     make(map[string]*device.Device),
+		keys:        make(map[string]*apikey.APIKey),
+		webhooks:    make(map[string]*webhook.Webhook),
+		deadLetters: make(map[string]*webhook.Delivery),
+	}
+}
+
+// newID returns IDs shaped like MongoDB object IDs, which the webhook routes require.
+func (s *storage) newID() string {
+	s.ids++
+	return fmt.Sprintf("%024x", s.ids)
+}
+
+func copyList(addressList *address_list.AddressList) *address_list.AddressList {
+	c := *addressList
+	c.Addresses = make([]*address_list.Address, 0, len(addressList.Addresses))
+	for _, entry := range addressList.Addresses {
+		e := *entry
+		c.Addresses = append(c.Addresses, &e)
+	}
+
+	return &c
+}
+
+func copyDevice(dev *device.Device) *device.Device {
+	d := *dev
+	d.AddressLists = append([]string(nil), dev.AddressLists...)
+
+	return &d
+}
+
+func hasLabels(addressList *address_list.AddressList, labels map[string]string) bool {
+	for key, value := range labels {
+		if v, ok := addressList.Labels[key]; !ok || (value != "" && v != value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *storage) GetAddressLists(ctx context.Context, filter *address_list.Filter) ([]*address_list.AddressList, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	after := ""
+	if filter.Cursor != "" {
+		name, err := address_list.DecodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after = name
+	}
+
+	result := make([]*address_list.AddressList, 0)
+	for _, addressList := range s.lists {
+		if !strings.HasPrefix(addressList.Name, filter.Prefix) || !hasLabels(addressList, filter.Labels) {
+			continue
+		}
+		if after != "" && (filter.Descending && addressList.Name >= after || !filter.Descending && addressList.Name <= after) {
+			continue
+		}
+		result = append(result, copyList(addressList))
+	}
+	sort.Slice(result, func(i, j int) bool { return (result[i].Name < result[j].Name) != filter.Descending })
+
+	if filter.Limit > 0 && int64(len(result)) > filter.Limit {
+		result = result[:filter.Limit]
+		return result, address_list.EncodeCursor(result[len(result)-1].Name), nil
+	}
+
+	return result, "", nil
+}
+
+func (s *storage) CreateAddressList(ctx context.Context, addressList *address_list.AddressList) (*address_list.AddressList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created := copyList(addressList)
+	created.ID, created.Revision = s.newID(), 1
+	s.lists[created.ID] = created
+
+	return copyList(created), nil
+}
+
+func (s *storage) GetAddressList(ctx context.Context, name string) (*address_list.AddressList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, addressList := range s.lists {
+		if addressList.Name == name {
+			return copyList(addressList), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *storage) GetAddressListByID(ctx context.Context, id string) (*address_list.AddressList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if addressList, ok := s.lists[id]; ok {
+		return copyList(addressList), nil
+	}
+
+	return nil, nil
+}
+
+func (s *storage) UpdateAddressList(ctx context.Context, id string, addressList *address_list.AddressList) (*address_list.AddressList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(id, addressList), nil
+}
+
+func (s *storage) update(id string, addressList *address_list.AddressList) *address_list.AddressList {
+	updated := copyList(addressList)
+	updated.ID, updated.Revision = id, s.lists[id].Revision+1
+	s.lists[id] = updated
+
+	return copyList(updated)
+}
+
+func (s *storage) DeleteAddressList(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.lists, id)
+	return nil
+}
+
+func (s *storage) UpdateEntriesInAddressList(ctx context.Context, action address_list.Action, id string, addresses []*address_list.Address) (*address_list.AddressList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := make(map[string]bool)
+	for _, entry := range addresses {
+		changed[entry.Address] = true
+	}
+
+	addressList := copyList(s.lists[id])
+	kept := make([]*address_list.Address, 0, len(addressList.Addresses))
+	for _, entry := range addressList.Addresses {
+		if !changed[entry.Address] {
+			kept = append(kept, entry)
+		}
+	}
+	if action == address_list.AddAction {
+		kept = append(kept, addresses...)
+	}
+	addressList.Addresses = kept
+
+	return s.update(id, addressList), nil
+}
+
+func (s *storage) GetEntries(ctx context.Context, id string, filter *address_list.EntryFilter) ([]*address_list.Address, string, error) {
+	addressList, err := s.GetAddressListByID(ctx, id)
+	if err != nil || addressList == nil {
+		return nil, "", err
+	}
+
+	return addressList.Addresses, "", nil
+}
+
+func (s *storage) GetEntry(ctx context.Context, id string, address string) (*address_list.Address, error) {
+	addressList, err := s.GetAddressListByID(ctx, id)
+	if err != nil || addressList == nil {
+		return nil, err
+	}
+
+	for _, entry := range addressList.Addresses {
+		if entry.Address == address {
+			return entry, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *storage) PutEntry(ctx context.Context, id string, entry *address_list.Address) (*address_list.Address, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addressList := copyList(s.lists[id])
+	stored := *entry
+	for i, e := range addressList.Addresses {
+		if e.Address == entry.Address {
+			addressList.Addresses[i] = &stored
+			s.update(id, addressList)
+			return entry, false, nil
+		}
+	}
+	addressList.Addresses = append(addressList.Addresses, &stored)
+	s.update(id, addressList)
+
+	return entry, true, nil
+}
+
+func (s *storage) DeleteEntry(ctx context.Context, id string, address string) error {
+	_, err := s.UpdateEntriesInAddressList(ctx, address_list.RemoveAction, id, []*address_list.Address{{Address: address}})
+	return err
+}
+
+func (s *storage) UpdateAddressLists(ctx context.Context, addressLists []*address_list.AddressList) ([]*address_list.AddressList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, addressList := range addressLists {
+		if stored, ok := s.lists[addressList.ID]; !ok || stored.Revision != addressList.Revision {
+			return nil, address_list.ErrConflict
+		}
+	}
+
+	updated := make([]*address_list.AddressList, 0, len(addressLists))
+	for _, addressList := range addressLists {
+		updated = append(updated, s.update(addressList.ID, addressList))
+	}
+
+	return updated, nil
+}
+
+func (s *storage) UpdateAddressListRevision(ctx context.Context, addressList *address_list.AddressList) (*address_list.AddressList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.lists[addressList.ID]; !ok || stored.Revision != addressList.Revision {
+		return nil, address_list.ErrConflict
+	}
+
+	return s.update(addressList.ID, addressList), nil
+}
+
+func (s *storage) DeleteAddressListRevision(ctx context.Context, id string, revision int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.lists[id]; !ok || stored.Revision != revision {
+		return address_list.ErrConflict
+	}
+
+	delete(s.lists, id)
+	return nil
+}
+
+func (s *storage) GetDevices(ctx context.Context) ([]*device.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]*device.Device, 0, len(s.devices))
+	for _, dev := range s.devices {
+		result = append(result, copyDevice(dev))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result, nil
+}
+
+func (s *storage) CreateDevice(ctx context.Context, dev *device.Device) (*device.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created := copyDevice(dev)
+	created.ID = s.newID()
+	s.devices[created.ID] = created
+
+	return copyDevice(created), nil
+}
+
+func (s *storage) GetDevice(ctx context.Context, name string) (*device.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, dev := range s.devices {
+		if dev.Name == name {
+			return copyDevice(dev), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *storage) GetDeviceByID(ctx context.Context, id string) (*device.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if dev, ok := s.devices[id]; ok {
+		return copyDevice(dev), nil
+	}
+
+	return nil, nil
+}
+
+func (s *storage) UpdateDevice(ctx context.Context, id string, dev *device.Device) (*device.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := copyDevice(dev)
+	updated.ID = id
+	s.devices[id] = updated
+
+	return copyDevice(updated), nil
+}
+
+func (s *storage) DeleteDevice(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.devices, id)
+	return nil
+}
+
+func (s *storage) GetAPIKeys(ctx context.Context) ([]*apikey.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]*apikey.APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		k := *key
+		result = append(result, &k)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].AccessKey < result[j].AccessKey })
+
+	return result, nil
+}
+
+func (s *storage) CreateAPIKey(ctx context.Context, key *apikey.APIKey) (*apikey.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created := *key
+	created.ID = s.newID()
+	s.keys[created.ID] = &created
+
+	k := created
+	return &k, nil
+}
+
+func (s *storage) GetAPIKey(ctx context.Context, accessKey string) (*apikey.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.keys {
+		if key.AccessKey == accessKey {
+			k := *key
+			return &k, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *storage) GetAPIKeyByID(ctx context.Context, id string) (*apikey.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[id]; ok {
+		k := *key
+		return &k, nil
+	}
+
+	return nil, nil
+}
+
+func (s *storage) UpdateAPIKey(ctx context.Context, id string, key *apikey.APIKey) (*apikey.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := *key
+	updated.ID = id
+	s.keys[id] = &updated
+
+	k := updated
+	return &k, nil
+}
+
+func (s *storage) TouchAPIKey(ctx context.Context, id string, lastUsedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[id]; ok {
+		key.LastUsedAt = &lastUsedAt
+	}
+
+	return nil
+}
+
+func (s *storage) DeleteAPIKey(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, id)
+	return nil
+}
+
+func (s *storage) CreateAuditEvent(ctx context.Context, event *audit.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := *event
+	e.ID = s.newID()
+	s.events = append(s.events, &e)
+
+	return nil
+}
+
+// GetAuditEvents returns the events of the filter, newest first and at most eventsLimit unless it is 0.
+func (s *storage) GetAuditEvents(ctx context.Context, filter *audit.Filter) ([]*audit.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]*audit.Event, 0)
+	for _, event := range s.events {
+		if filter.Matches(event) {
+			e := *event
+			result = append(result, &e)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].Time.Equal(result[j].Time) {
+			return result[i].Time.After(result[j].Time)
+		}
+		return result[i].ID > result[j].ID
+	})
+	if s.eventsLimit != 0 && len(result) > s.eventsLimit {
+		result = result[:s.eventsLimit]
+	}
+
+	return result, nil
+}
+
+func (s *storage) GetWebhooks(ctx context.Context) ([]*webhook.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]*webhook.Webhook, 0, len(s.webhooks))
+	for _, wh := range s.webhooks {
+		w := *wh
+		result = append(result, &w)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result, nil
+}
+
+func (s *storage) CreateWebhook(ctx context.Context, wh *webhook.Webhook) (*webhook.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created := *wh
+	created.ID = s.newID()
+	s.webhooks[created.ID] = &created
+
+	w := created
+	return &w, nil
+}
+
+func (s *storage) GetWebhook(ctx context.Context, id string) (*webhook.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if wh, ok := s.webhooks[id]; ok {
+		w := *wh
+		return &w, nil
+	}
+
+	return nil, nil
+}
+
+func (s *storage) DeleteWebhook(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.webhooks, id)
+	return nil
+}
+
+func (s *storage) CreateDeadLetter(ctx context.Context, delivery *webhook.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := *delivery
+	s.deadLetters[d.ID] = &d
+
+	return nil
+}
+
+func (s *storage) GetDeadLetters(ctx context.Context) ([]*webhook.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]*webhook.Delivery, 0, len(s.deadLetters))
+	for _, delivery := range s.deadLetters {
+		d := *delivery
+		result = append(result, &d)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	return result, nil
+}
+
+func (s *storage) GetDeadLetter(ctx context.Context, id string) (*webhook.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if delivery, ok := s.deadLetters[id]; ok {
+		d := *delivery
+		return &d, nil
+	}
+
+	return nil, nil
+}
+
+func (s *storage) DeleteDeadLetter(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.deadLetters, id)
+	return nil
+}
@@ -10,6 +10,53 @@ const (
 	FormatKey      ContextKey = "format"
 	AcceptKey      ContextKey = "Accept"
 	AddressListKey ContextKey = "addressList"
+	DeviceKey      ContextKey = "device"
+	PrincipalKey   ContextKey = "principal"
+	APIKeyKey      ContextKey = "apiKey"
+	WebhookKey     ContextKey = "webhook"
+	DeadLetterKey  ContextKey = "deadLetter"
 
 	RSCFormat Format = "rsc"
+	SIGFormat Format = "sig"
+
+	AddressListPath = "/address-list"
+	DevicePath      = "/device"
+	APIKeyPath      = "/admin/keys"
+	AuditPath       = "/audit"
+	WebhookPath     = "/webhooks"
+	ChangesPath     = "/changes"
+	ApplyPath       = "/apply"
+	ExportPath      = "/admin/export"
+	ImportPath      = "/admin/import"
+
+	DeviceTokenScheme = "Token"
+	DeviceScriptName  = "mtprov-fetch"
+	DeviceKeyScript   = "mtprov-key"
+
+	DigestHeader    = "X-Content-SHA256"
+	SignatureHeader = "X-Signature"
+
+	VersionQueryParam  = "version"
+	ModelQueryParam    = "model"
+	ActorQueryParam    = "actor"
+	ListQueryParam     = "list"
+	FromQueryParam     = "from"
+	ToQueryParam       = "to"
+	RevisionQueryParam = "revision"
+	LimitQueryParam    = "limit"
+	CursorQueryParam   = "cursor"
+	SortQueryParam     = "sort"
+	PrefixQueryParam   = "prefix"
+	LabelQueryParam    = "label"
+	AddressQueryParam  = "address"
+	CommentQueryParam  = "comment"
+	DisabledQueryParam = "disabled"
+	DryRunQueryParam   = "dry_run"
+	SecretsQueryParam  = "secrets"
+	ModeQueryParam     = "mode"
+	DeviceQueryParam   = "device"
+
+	NextCursorHeader       = "X-Next-Cursor"
+	LastEventIDHeader      = "Last-Event-ID"
+	EventStreamContentType = "text/event-stream"
 )
@@ -0,0 +1,168 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+)
+
+const (
+	defaultWatchTimeout   = 30 * time.Second
+	defaultWatchHeartbeat = 15 * time.Second
+)
+
+// WatchAddressList waits for changes of an address list. Clients accepting text/event-stream receive
+// every new revision as a server-sent event; others long-poll: the list is returned as soon as its
+// revision differs from the revision parameter, or 304 Not Modified once the timeout has passed.
+func (h *WatchHandler) WatchAddressList(w http.ResponseWriter, r *http.Request) {
+	addressList := r.Context().Value(AddressListKey).(*address_list.AddressList)
+
+	revision, err := getRevision(r, addressList.Revision)
+	if err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	changes, unsubscribe := h.broker.Subscribe(addressList.Name)
+	defer unsubscribe()
+
+	if r.Context().Value(AcceptKey) == EventStreamContentType {
+		h.streamAddressList(w, r, addressList.Name, revision, changes)
+	} else {
+		h.pollAddressList(w, r, addressList.Name, revision, changes)
+	}
+}
+
+func (h *WatchHandler) pollAddressList(w http.ResponseWriter, r *http.Request, name string, revision int64, changes <-chan struct{}) {
+	timeout := time.NewTimer(h.timeout())
+	defer timeout.Stop()
+
+	for {
+		// The list is fetched after subscribing, so that no change is missed.
+		addressList, err := h.service.GetAddressList(r.Context(), name)
+		if err != nil {
+			_ = render.Render(w, r, ErrInternalServerError(err))
+			return
+		}
+
+		if addressList == nil {
+			_ = render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		if addressList.Revision != revision {
+			_ = render.Render(w, r, newAddressListResponse(addressList))
+			return
+		}
+
+		select {
+		case <-changes:
+		case <-timeout.C:
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case <-h.broker.Done():
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *WatchHandler) streamAddressList(w http.ResponseWriter, r *http.Request, name string, revision int64, changes <-chan struct{}) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		_ = render.Render(w, r, ErrInternalServerError(fmt.Errorf("streaming is not supported")))
+		return
+	}
+
+	w.Header().Set("Content-Type", EventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat())
+	defer heartbeat.Stop()
+
+	for {
+		addressList, err := h.service.GetAddressList(r.Context(), name)
+		if err != nil {
+			return
+		}
+
+		if addressList == nil {
+			_, _ = fmt.Fprintf(w, "event: delete\ndata: {\"name\":%q}\n\n", name)
+			flusher.Flush()
+			return
+		}
+
+		if addressList.Revision != revision {
+			data, err := json.Marshal(addressList)
+			if err != nil {
+				return
+			}
+
+			revision = addressList.Revision
+			_, _ = fmt.Fprintf(w, "event: change\nid: %d\ndata: %s\n\n", revision, data)
+			flusher.Flush()
+		}
+
+		wait := true
+		for wait {
+			select {
+			case <-changes:
+				wait = false
+			case <-heartbeat.C:
+				_, _ = fmt.Fprint(w, ": heartbeat\n\n")
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			case <-h.broker.Done():
+				return
+			}
+		}
+	}
+}
+
+func (h *WatchHandler) timeout() time.Duration {
+	if h.config != nil && h.config.Timeout > 0 {
+		return h.config.Timeout
+	}
+
+	return defaultWatchTimeout
+}
+
+func (h *WatchHandler) heartbeat() time.Duration {
+	if h.config != nil && h.config.Heartbeat > 0 {
+		return h.config.Heartbeat
+	}
+
+	return defaultWatchHeartbeat
+}
+
+// getRevision returns the revision the client has already seen, from the revision parameter or the
+// Last-Event-ID header of a reconnecting event stream. Without either, the current revision is assumed.
+func getRevision(r *http.Request, current int64) (int64, error) {
+	value := r.URL.Query().Get(RevisionQueryParam)
+	if value == "" {
+		value = r.Header.Get(LastEventIDHeader)
+	}
+
+	if value == "" {
+		return current, nil
+	}
+
+	revision, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid revision: %s", value)
+	}
+
+	return revision, nil
+}
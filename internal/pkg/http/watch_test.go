@@ -0,0 +1,37 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetRevision(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		lastEventID string
+		want        int64
+		wantErr     bool
+	}{
+		{name: "current", target: "/address-list/office/watch", want: 7},
+		{name: "parameter", target: "/address-list/office/watch?revision=3", want: 3},
+		{name: "last event id", target: "/address-list/office/watch", lastEventID: "5", want: 5},
+		{name: "parameter before last event id", target: "/address-list/office/watch?revision=3", lastEventID: "5", want: 3},
+		{name: "invalid", target: "/address-list/office/watch?revision=latest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.lastEventID != "" {
+				r.Header.Set(LastEventIDHeader, tt.lastEventID)
+			}
+
+			got, err := getRevision(r, 7)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("getRevision() = %d, %v, want %d, error %t", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"mikrotik_provisioning/internal/pkg/webhook"
+)
+
+func (h *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	results, err := h.service.GetWebhooks(r.Context())
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, getWebhooksJSONResponse(results)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+	}
+}
+
+// CreateWebhook stores a subscription. The response is the only one which includes the signing secret.
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	data := &webhook.WebhookRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	wh, err := h.service.CreateWebhook(r.Context(), data.Webhook)
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	_ = render.Render(w, r, &webhook.WebhookResponse{Webhook: wh})
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	wh := r.Context().Value(WebhookKey).(*webhook.Webhook)
+
+	if err := render.Render(w, r, newWebhookResponse(wh)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+	}
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	wh := r.Context().Value(WebhookKey).(*webhook.Webhook)
+
+	err := h.service.DeleteWebhook(r.Context(), wh.ID)
+	if err != nil {
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+func (h *WebhookHandler) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	results, err := h.service.GetDeadLetters(r.Context())
+	if err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, getDeadLettersJSONResponse(results)); err != nil {
+		_ = render.Render(w, r, ErrRender(err))
+	}
+}
+
+// RetryDeadLetter removes a dead letter and delivers it again. It ends up in the dead letters again if all attempts fail.
+func (h *WebhookHandler) RetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	delivery := r.Context().Value(DeadLetterKey).(*webhook.Delivery)
+
+	if err := h.service.DeleteDeadLetter(r.Context(), delivery.ID); err != nil {
+		_ = render.Render(w, r, ErrInternalServerError(err))
+		return
+	}
+	h.dispatcher.Redeliver(delivery)
+
+	render.Status(r, http.StatusAccepted)
+	_ = render.Render(w, r, &webhook.DeliveryResponse{Delivery: delivery})
+}
@@ -0,0 +1,31 @@
+package logging
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// RequestLogger puts a logger with the request ID, method and path into the request context and logs
+// every request once it completed. It must follow middleware.RequestID.
+func RequestLogger(l *Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			ctx := NewContext(r.Context(), l.With("request_id", middleware.GetReqID(r.Context()), "method", r.Method, "path", r.URL.Path))
+			r = r.WithContext(ctx)
+
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			FromContext(ctx).Info("request completed", "status", status, "bytes", ww.BytesWritten(), "duration", time.Since(start), "remote_addr", r.RemoteAddr)
+		})
+	}
+}
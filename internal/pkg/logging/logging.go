@@ -0,0 +1,289 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/go-chi/chi"
+)
+
+type (
+	Level int
+
+	Format string
+
+	// Logger writes leveled, structured log lines. Fields are key-value pairs, added with With or passed
+	// along with a message, and are written in the order they were given.
+	Logger struct {
+		out    *output
+		level  Level
+		format Format
+		fields []interface{}
+	}
+
+	output struct {
+		mu sync.Mutex
+		w  io.Writer
+	}
+
+	// contextFields lets middleware add fields, e.g. the authenticated user, to the logger of a request
+	// after the logger was put into the request context.
+	contextFields struct {
+		mu     sync.Mutex
+		logger *Logger
+	}
+
+	contextKey struct{}
+)
+
+const (
+	DebugLevel Level = iota - 1
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+const (
+	JSONFormat   Format = "json"
+	LogfmtFormat Format = "logfmt"
+)
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger = New(os.Stderr, InfoLevel, LogfmtFormat)
+)
+
+// New returns a logger writing lines of the given format to w. Lines below level are discarded.
+func New(w io.Writer, level Level, format Format) *Logger {
+	if format == "" {
+		format = LogfmtFormat
+	}
+
+	return &Logger{out: &output{w: w}, level: level, format: format}
+}
+
+// Default returns the logger used when a context carries none.
+func Default() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+
+	return defaultLogger
+}
+
+func SetDefault(l *Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultLogger = l
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error". An empty level is info.
+func ParseLevel(level string) (Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return DebugLevel, nil
+	case "", "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	default:
+		return InfoLevel, fmt.Errorf("invalid log level: %s", level)
+	}
+}
+
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// With returns a logger which adds the key-value pairs to every line.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	if len(keyvals) == 0 {
+		return l
+	}
+
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+
+	return &Logger{out: l.out, level: l.level, format: l.format, fields: fields}
+}
+
+// Enabled reports whether lines of the level are written, to skip building expensive fields.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(DebugLevel, msg, keyvals)
+}
+
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(InfoLevel, msg, keyvals)
+}
+
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(WarnLevel, msg, keyvals)
+}
+
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(ErrorLevel, msg, keyvals)
+}
+
+// Fatal writes an error line and exits.
+func (l *Logger) Fatal(msg string, keyvals ...interface{}) {
+	l.log(ErrorLevel, msg, keyvals)
+	os.Exit(1)
+}
+
+// NewContext returns a context carrying the logger, to which AddFields can add fields later on.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, &contextFields{logger: l})
+}
+
+// FromContext returns the logger of the context, or the default logger. Within a request, lines carry
+// the route pattern once it is known.
+func FromContext(ctx context.Context) *Logger {
+	if ctx == nil {
+		return Default()
+	}
+
+	f, ok := ctx.Value(contextKey{}).(*contextFields)
+	if !ok {
+		return Default()
+	}
+
+	f.mu.Lock()
+	l := f.logger
+	f.mu.Unlock()
+
+	if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+		return l.With("route", rctx.RoutePattern())
+	}
+
+	return l
+}
+
+// AddFields adds key-value pairs to the logger of the context, for every line logged with it from now on.
+// It does nothing if the context carries no logger.
+func AddFields(ctx context.Context, keyvals ...interface{}) {
+	if f, ok := ctx.Value(contextKey{}).(*contextFields); ok {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		f.logger = f.logger.With(keyvals...)
+	}
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	fields := make([]interface{}, 0, 6+len(l.fields)+len(keyvals))
+	fields = append(fields, "time", time.Now().UTC().Format(time.RFC3339Nano), "level", level.String(), "msg", msg)
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	if len(fields)%2 != 0 {
+		fields = append(fields, "(MISSING)")
+	}
+
+	var buf bytes.Buffer
+	if l.format == JSONFormat {
+		encodeJSON(&buf, fields)
+	} else {
+		encodeLogfmt(&buf, fields)
+	}
+	buf.WriteByte('\n')
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+
+	_, _ = l.out.w.Write(buf.Bytes())
+}
+
+func encodeJSON(buf *bytes.Buffer, fields []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(fmt.Sprint(fields[i]))
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		value, err := json.Marshal(jsonValue(fields[i+1]))
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(fields[i+1]))
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+func encodeLogfmt(buf *bytes.Buffer, fields []interface{}) {
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+
+		buf.WriteString(fmt.Sprint(fields[i]))
+		buf.WriteByte('=')
+
+		value := fmt.Sprint(fields[i+1])
+		if fields[i+1] == nil {
+			value = ""
+		}
+		if needsQuoting(value) {
+			value = strconv.Quote(value)
+		}
+		buf.WriteString(value)
+	}
+}
+
+func needsQuoting(value string) bool {
+	if value == "" {
+		return true
+	}
+
+	for _, r := range value {
+		if unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+
+	return false
+}
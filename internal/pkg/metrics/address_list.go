@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/logging"
+)
+
+const collectTimeout = 5 * time.Second
+
+var addressListEntries = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "address_list", "entries"),
+	"Number of entries per address list.",
+	[]string{"list"}, nil,
+)
+
+type AddressListStore interface {
+	GetAddressLists(ctx context.Context, filter *address_list.Filter) ([]*address_list.AddressList, string, error)
+}
+
+// AddressListCollector reads the entry count of every address list from the storage on each scrape,
+// so that all replicas report the same values.
+type AddressListCollector struct {
+	storage AddressListStore
+}
+
+func NewAddressListCollector(storage AddressListStore) *AddressListCollector {
+	return &AddressListCollector{storage: storage}
+}
+
+func (c *AddressListCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- addressListEntries
+}
+
+func (c *AddressListCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	addressLists, _, err := c.storage.GetAddressLists(ctx, &address_list.Filter{})
+	if err != nil {
+		logging.Default().Error("failed to collect address list metrics", "error", err)
+		return
+	}
+
+	for _, addressList := range addressLists {
+		ch <- prometheus.MustNewConstMetric(addressListEntries, prometheus.GaugeValue, float64(len(addressList.Addresses)), addressList.Name)
+	}
+}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "mikrotik_provisioning"
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests by route pattern, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	storageCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "call_duration_seconds",
+		Help:      "Duration of storage calls by method.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method"})
+
+	storageCallErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "call_errors_total",
+		Help:      "Number of failed storage calls by method.",
+	}, []string{"method"})
+
+	renderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "template",
+		Name:      "render_duration_seconds",
+		Help:      "Duration of template renders by template name.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+	}, []string{"template"})
+
+	renderErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "template",
+		Name:      "render_errors_total",
+		Help:      "Number of failed template renders by template name.",
+	}, []string{"template"})
+
+	deviceLastFetch = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "device",
+		Name:      "last_fetch_timestamp_seconds",
+		Help:      "Time a device last fetched its script.",
+	}, []string{"device"})
+
+	addressListLastFetch = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "address_list",
+		Name:      "last_fetch_timestamp_seconds",
+		Help:      "Time an address list was last fetched as a script.",
+	}, []string{"list"})
+)
+
+// Handler serves the metrics of the default registry.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Instrument observes the duration of every request. Requests are labelled with the chi route pattern rather than
+// the path, so that address list and device names do not create new series.
+func Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		httpRequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+func ObserveStorageCall(method string, start time.Time, err error) {
+	storageCallDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		storageCallErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func ObserveRender(template string, start time.Time, err error) {
+	renderDuration.WithLabelValues(template).Observe(time.Since(start).Seconds())
+	if err != nil {
+		renderErrors.WithLabelValues(template).Inc()
+	}
+}
+
+func SetDeviceFetched(device string, t time.Time) {
+	deviceLastFetch.WithLabelValues(device).Set(float64(t.Unix()))
+}
+
+func SetAddressListFetched(list string, t time.Time) {
+	addressListLastFetch.WithLabelValues(list).Set(float64(t.Unix()))
+}
+
+// ForgetDevice removes the series of a deleted device.
+func ForgetDevice(device string) {
+	deviceLastFetch.DeleteLabelValues(device)
+}
+
+// ForgetAddressList removes the series of a deleted address list.
+func ForgetAddressList(list string) {
+	addressListLastFetch.DeleteLabelValues(list)
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+)
+
+type store struct {
+	lists []*address_list.AddressList
+}
+
+func (s *store) GetAddressLists(ctx context.Context, filter *address_list.Filter) ([]*address_list.AddressList, string, error) {
+	return s.lists, "", nil
+}
+
+func TestInstrument(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Instrument)
+	r.Get("/address-list/{name}", func(w http.ResponseWriter, r *http.Request) {})
+	r.Delete("/address-list/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		route  string
+		code   string
+	}{
+		{method: http.MethodGet, path: "/address-list/office", route: "/address-list/{name}", code: "200"},
+		{method: http.MethodDelete, path: "/address-list/lab", route: "/address-list/{name}", code: "204"},
+		{method: http.MethodGet, path: "/unknown", route: "unmatched", code: "404"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			before := sampleCount(t, "mikrotik_provisioning_http_request_duration_seconds", "code="+tt.code, "method="+tt.method, "route="+tt.route)
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+
+			if got := sampleCount(t, "mikrotik_provisioning_http_request_duration_seconds", "code="+tt.code, "method="+tt.method, "route="+tt.route); got != before+1 {
+				t.Errorf("requests of %s %s %s = %d, want %d", tt.route, tt.method, tt.code, got, before+1)
+			}
+		})
+	}
+}
+
+func TestObserveStorageCall(t *testing.T) {
+	before := testutil.ToFloat64(storageCallErrors.WithLabelValues("GetDevice"))
+
+	ObserveStorageCall("GetDevice", time.Now(), nil)
+	ObserveStorageCall("GetDevice", time.Now(), errors.New("connection refused"))
+
+	if got := sampleCount(t, "mikrotik_provisioning_storage_call_duration_seconds", "method=GetDevice"); got < 2 {
+		t.Errorf("calls = %d, want at least 2", got)
+	}
+	if got := testutil.ToFloat64(storageCallErrors.WithLabelValues("GetDevice")); got != before+1 {
+		t.Errorf("errors = %v, want %v", got, before+1)
+	}
+}
+
+func TestForgetDevice(t *testing.T) {
+	SetDeviceFetched("gw-office", time.Unix(1600000000, 0))
+	if got := testutil.ToFloat64(deviceLastFetch.WithLabelValues("gw-office")); got != 1600000000 {
+		t.Errorf("last fetch = %v, want 1600000000", got)
+	}
+
+	count := testutil.CollectAndCount(deviceLastFetch)
+	ForgetDevice("gw-office")
+	if got := testutil.CollectAndCount(deviceLastFetch); got != count-1 {
+		t.Errorf("series = %d after forgetting the device, want %d", got, count-1)
+	}
+}
+
+func TestAddressListCollector(t *testing.T) {
+	collector := NewAddressListCollector(&store{lists: []*address_list.AddressList{
+		{Name: "office", Addresses: []*address_list.Address{{Address: "10.0.0.1"}, {Address: "10.0.0.2"}}},
+		{Name: "lab", Addresses: []*address_list.Address{}},
+	}})
+
+	want := `
+# HELP mikrotik_provisioning_address_list_entries Number of entries per address list.
+# TYPE mikrotik_provisioning_address_list_entries gauge
+mikrotik_provisioning_address_list_entries{list="lab"} 0
+mikrotik_provisioning_address_list_entries{list="office"} 2
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+		t.Errorf("CollectAndCompare() error = %v", err)
+	}
+}
+
+// sampleCount returns the number of observations of a histogram series in the default registry.
+func sampleCount(t *testing.T, name string, labels ...string) uint64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			values := make([]string, 0, len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				values = append(values, l.GetName()+"="+l.GetValue())
+			}
+			if strings.Join(values, ",") == strings.Join(labels, ",") {
+				return m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,217 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/logging"
+)
+
+const (
+	DefaultCacheTTL = time.Hour
+
+	// minRefreshInterval limits how often an unknown key ID triggers a reload of the JWKS document.
+	minRefreshInterval = time.Minute
+)
+
+type (
+	// KeySet is a JWKS document loaded from a file or URL. It is cached for the TTL and reloaded
+	// early when a token refers to an unknown key, as the IdP may have rotated its keys.
+	KeySet struct {
+		source string
+		ttl    time.Duration
+		client *http.Client
+
+		// loadMu serializes loads, which run without mu so that lookups of cached keys are not
+		// blocked by a slow IdP.
+		loadMu sync.Mutex
+
+		mu       sync.Mutex
+		keys     map[string]crypto.PublicKey
+		loadedAt time.Time
+	}
+
+	jwks struct {
+		Keys []*jwk `json:"keys"`
+	}
+
+	jwk struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+)
+
+// NewKeySet returns a key set for a JWKS file path or http(s) URL and loads it once to fail early on bad configuration.
+func NewKeySet(source string, ttl time.Duration) (*KeySet, error) {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+
+	ks := &KeySet{source: source, ttl: ttl, client: &http.Client{Timeout: 10 * time.Second}}
+	if err := ks.load(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// Key returns the public key with the key ID.
+func (ks *KeySet) Key(kid string, now time.Time) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	key, ok := ks.keys[kid]
+	loadedAt := ks.loadedAt
+	ks.mu.Unlock()
+
+	expired := now.Sub(loadedAt) > ks.ttl
+	if expired || (!ok && now.Sub(loadedAt) > minRefreshInterval) {
+		if err := ks.reload(loadedAt, now); err != nil && (expired || !ok) {
+			return nil, err
+		}
+
+		ks.mu.Lock()
+		key, ok = ks.keys[kid]
+		ks.mu.Unlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+
+	return key, nil
+}
+
+// reload loads the document unless another caller has done so since it was loaded at loadedAt.
+func (ks *KeySet) reload(loadedAt, now time.Time) error {
+	ks.loadMu.Lock()
+	defer ks.loadMu.Unlock()
+
+	ks.mu.Lock()
+	current := ks.loadedAt
+	ks.mu.Unlock()
+	if current.After(loadedAt) {
+		return nil
+	}
+
+	return ks.load(now)
+}
+
+// load reads and parses the document and replaces the cached keys. Keys that cannot be used, such as
+// those of unsupported types or curves, are skipped so that one of them does not lock out the others.
+func (ks *KeySet) load(now time.Time) error {
+	data, err := ks.read()
+	if err != nil {
+		return fmt.Errorf("failed to read jwks: %s", err)
+	}
+
+	doc := new(jwks)
+	if err := json.Unmarshal(data, doc); err != nil {
+		return fmt.Errorf("failed to parse jwks: %s", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			logging.Default().Warn("skipping jwks key", "source", ks.source, "kid", k.Kid, "error", err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no usable signing keys in jwks")
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.loadedAt = now
+	ks.mu.Unlock()
+
+	return nil
+}
+
+func (ks *KeySet) read() ([]byte, error) {
+	if strings.HasPrefix(ks.source, "http://") || strings.HasPrefix(ks.source, "https://") {
+		res, err := ks.client.Get(ks.source)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status: %s", res.Status)
+		}
+
+		return ioutil.ReadAll(res.Body)
+	}
+
+	return ioutil.ReadFile(ks.source)
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,274 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+
+	"mikrotik_provisioning/internal/config"
+	"mikrotik_provisioning/internal/pkg/access"
+)
+
+const (
+	DefaultGroupsClaim = "groups"
+
+	// leeway allows for clock skew between the IdP and this service.
+	leeway = time.Minute
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type (
+	// Verifier validates JWT bearer tokens issued by the configured IdP and maps their groups to access roles.
+	Verifier struct {
+		keys   *KeySet
+		config *config.OIDC
+	}
+
+	// Claims are the validated claims of a token.
+	Claims struct {
+		Subject string
+		Email   string
+		Groups  []string
+	}
+
+	header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+)
+
+// NewVerifier returns a verifier for the configured IdP. The issuer and audience are required: without
+// them any token signed by the IdP, including those issued to other applications, would be accepted.
+func NewVerifier(config *config.OIDC) (*Verifier, error) {
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, fmt.Errorf("both issuer and audience are required")
+	}
+
+	source := config.JWKSURL
+	if source == "" {
+		source = config.JWKSFile
+	}
+	if source == "" {
+		return nil, fmt.Errorf("either jwks_url or jwks_file is required")
+	}
+
+	keys, err := NewKeySet(source, config.CacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Verifier{keys: keys, config: config}, nil
+}
+
+// Verify checks the signature, issuer, audience and validity period of a token.
+func (v *Verifier) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	h := new(header)
+	if err := decodeSegment(parts[0], h); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	key, err := v.keys.Key(h.Kid, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifySignature(h.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	payload := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &payload); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if err := v.validateClaims(payload, now); err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{Groups: make([]string, 0)}
+	claims.Subject, _ = payload["sub"].(string)
+	claims.Email, _ = payload["email"].(string)
+
+	groupsClaim := v.config.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = DefaultGroupsClaim
+	}
+	switch groups := payload[groupsClaim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				claims.Groups = append(claims.Groups, s)
+			}
+		}
+	case string:
+		claims.Groups = append(claims.Groups, groups)
+	}
+
+	return claims, nil
+}
+
+// Principal maps the groups of the token to the role and grants of the configured group mappings.
+// The most privileged role wins; grants of all matching groups are combined. It returns nil if no group matches.
+func (v *Verifier) Principal(claims *Claims) *access.Principal {
+	name := claims.Email
+	if name == "" {
+		name = claims.Subject
+	}
+
+	var role access.Role
+	grants := make([]*config.Grant, 0)
+	unrestricted := false
+	for _, mapping := range v.config.Groups {
+		if !contains(claims.Groups, mapping.Group) {
+			continue
+		}
+
+		if rank(access.Role(mapping.Role)) > rank(role) {
+			role = access.Role(mapping.Role)
+		}
+		if len(mapping.Grants) == 0 {
+			unrestricted = true
+		}
+		grants = append(grants, mapping.Grants...)
+	}
+
+	if role == "" {
+		return nil
+	}
+	if unrestricted {
+		grants = nil
+	}
+
+	return access.NewPrincipal(name, role, grants)
+}
+
+func (v *Verifier) validateClaims(payload map[string]interface{}, now time.Time) error {
+	if exp, ok := payload["exp"].(float64); !ok || now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+
+	if nbf, ok := payload["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("%w: not yet valid", ErrInvalidToken)
+	}
+
+	if iss, _ := payload["iss"].(string); iss != v.config.Issuer {
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+
+	audiences := make([]string, 0)
+	switch aud := payload["aud"].(type) {
+	case string:
+		audiences = append(audiences, aud)
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+	if !contains(audiences, v.config.Audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("%w: unsupported algorithm %s", ErrInvalidToken, alg)
+	}
+
+	var hashFunc crypto.Hash
+	var h hash.Hash
+	switch alg[2:] {
+	case "256":
+		hashFunc, h = crypto.SHA256, sha256.New()
+	case "384":
+		hashFunc, h = crypto.SHA384, sha512.New384()
+	case "512":
+		hashFunc, h = crypto.SHA512, sha512.New()
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %s", ErrInvalidToken, alg)
+	}
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("%w: algorithm %s does not match rsa key", ErrInvalidToken, alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, hashFunc, digest, signature); err != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return fmt.Errorf("%w: algorithm %s does not match ecdsa key", ErrInvalidToken, alg)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported key", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func rank(role access.Role) int {
+	switch role {
+	case access.AdminRole:
+		return 4
+	case access.EditorRole:
+		return 3
+	case access.ViewerRole:
+		return 2
+	case access.DeviceRole:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
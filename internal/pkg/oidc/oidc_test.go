@@ -0,0 +1,303 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"mikrotik_provisioning/internal/config"
+)
+
+// idp serves a JWKS document and signs tokens with its keys.
+type idp struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	keys     []*jwk
+	requests int
+}
+
+func newIDP(t *testing.T, keys ...*jwk) *idp {
+	t.Helper()
+
+	p := &idp{keys: keys}
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		p.requests++
+		json.NewEncoder(w).Encode(&jwks{Keys: p.keys})
+	}))
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+func (p *idp) setKeys(keys ...*jwk) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.keys = keys
+}
+
+func (p *idp) requestCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.requests
+}
+
+func rsaJWK(t *testing.T, kid string) (*jwk, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	return &jwk{
+		Kid: kid,
+		Kty: "RSA",
+		Use: "sig",
+		N:   encodeBigInt(key.N),
+		E:   encodeBigInt(big.NewInt(int64(key.E))),
+	}, key
+}
+
+func ecJWK(t *testing.T, kid string) (*jwk, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	return &jwk{Kid: kid, Kty: "EC", Crv: "P-256", X: encodeBigInt(key.X), Y: encodeBigInt(key.Y)}, key
+}
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func sign(t *testing.T, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+
+	h, _ := json.Marshal(&header{Alg: alg, Kid: kid})
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("SignPKCS1v15() error = %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("Sign() error = %v", err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func claims(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":    "https://idp.example.com",
+		"aud":    "mikrotik-provisioning",
+		"sub":    "1234",
+		"email":  "jane@example.com",
+		"groups": []string{"netops"},
+		"exp":    now.Add(time.Hour).Unix(),
+	}
+}
+
+func newConfig(source string) *config.OIDC {
+	return &config.OIDC{Issuer: "https://idp.example.com", Audience: "mikrotik-provisioning", JWKSURL: source}
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, rsaPrivate := rsaJWK(t, "rsa")
+	ecKey, ecPrivate := ecJWK(t, "ec")
+	_, otherPrivate := rsaJWK(t, "rsa")
+	p := newIDP(t, rsaKey, ecKey)
+
+	verifier, err := NewVerifier(newConfig(p.server.URL))
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+
+	now := time.Now()
+	with := func(key string, value interface{}) map[string]interface{} {
+		c := claims(now)
+		c[key] = value
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "rsa", token: sign(t, "rsa", rsaPrivate, claims(now))},
+		{name: "ecdsa", token: sign(t, "ec", ecPrivate, claims(now))},
+		{name: "one of several audiences", token: sign(t, "rsa", rsaPrivate, with("aud", []string{"other", "mikrotik-provisioning"}))},
+		{name: "another key", token: sign(t, "rsa", otherPrivate, claims(now)), wantErr: true},
+		{name: "another audience", token: sign(t, "rsa", rsaPrivate, with("aud", "other")), wantErr: true},
+		{name: "no audience", token: sign(t, "rsa", rsaPrivate, with("aud", nil)), wantErr: true},
+		{name: "another issuer", token: sign(t, "rsa", rsaPrivate, with("iss", "https://evil.example.com")), wantErr: true},
+		{name: "expired", token: sign(t, "rsa", rsaPrivate, with("exp", now.Add(-time.Hour).Unix())), wantErr: true},
+		{name: "not yet valid", token: sign(t, "rsa", rsaPrivate, with("nbf", now.Add(time.Hour).Unix())), wantErr: true},
+		{name: "malformed", token: "not.a-token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifier.Verify(tt.token, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Verify() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got.Email != "jane@example.com" || len(got.Groups) != 1 || got.Groups[0] != "netops" {
+				t.Errorf("Verify() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestNewVerifierRequiresIssuerAndAudience(t *testing.T) {
+	key, _ := rsaJWK(t, "rsa")
+	p := newIDP(t, key)
+
+	for _, c := range []*config.OIDC{
+		{Issuer: "https://idp.example.com", JWKSURL: p.server.URL},
+		{Audience: "mikrotik-provisioning", JWKSURL: p.server.URL},
+	} {
+		if _, err := NewVerifier(c); err == nil {
+			t.Errorf("NewVerifier(%+v) succeeded", c)
+		}
+	}
+}
+
+func TestKeySetSkipsUnsupportedKeys(t *testing.T) {
+	key, private := rsaJWK(t, "rsa")
+	p := newIDP(t,
+		&jwk{Kid: "okp", Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+		&jwk{Kid: "p521", Kty: "EC", Crv: "P-521", X: "AA", Y: "AA"},
+		key,
+	)
+
+	verifier, err := NewVerifier(newConfig(p.server.URL))
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+
+	now := time.Now()
+	if _, err := verifier.Verify(sign(t, "rsa", private, claims(now)), now); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	p.setKeys(&jwk{Kid: "okp", Kty: "OKP", Crv: "Ed25519"})
+	if _, err := NewKeySet(p.server.URL, time.Hour); err == nil {
+		t.Errorf("NewKeySet() without usable keys succeeded")
+	}
+}
+
+func TestKeySetRefresh(t *testing.T) {
+	oldKey, _ := rsaJWK(t, "old")
+	newKey, newPrivate := rsaJWK(t, "new")
+	p := newIDP(t, oldKey)
+
+	now := time.Now()
+	ks, err := NewKeySet(p.server.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+	p.setKeys(oldKey, newKey)
+
+	// Unknown key IDs reload the document at most once per minRefreshInterval.
+	if _, err := ks.Key("new", now); err == nil {
+		t.Errorf("Key() right after loading = nil error, want unknown key id")
+	}
+	if got := p.requestCount(); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+
+	later := now.Add(2 * minRefreshInterval)
+	key, err := ks.Key("new", later)
+	if err != nil {
+		t.Fatalf("Key() after rotation error = %v", err)
+	}
+	if !key.(*rsa.PublicKey).Equal(newPrivate.Public()) {
+		t.Errorf("Key() = %v, want the rotated key", key)
+	}
+	if got := p.requestCount(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+
+	// Concurrent lookups of an expired set load it once.
+	expired := now.Add(2 * time.Hour)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ks.Key("old", expired); err != nil {
+				t.Errorf("Key() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := p.requestCount(); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+
+	// A failing reload of an expired set is an error rather than a stale key.
+	p.server.Close()
+	if _, err := ks.Key("old", expired.Add(2*time.Hour)); err == nil {
+		t.Errorf("Key() with the IdP down and the set expired succeeded")
+	}
+}
+
+func TestVerifyRejectsUnknownKey(t *testing.T) {
+	key, _ := rsaJWK(t, "rsa")
+	_, other := rsaJWK(t, "other")
+	p := newIDP(t, key)
+
+	verifier, err := NewVerifier(newConfig(p.server.URL))
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+
+	now := time.Now().Add(2 * minRefreshInterval)
+	if _, err := verifier.Verify(sign(t, "other", other, claims(now)), now); err == nil {
+		t.Errorf("Verify() error = %v, want unknown key id", err)
+	}
+}
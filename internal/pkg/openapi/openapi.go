@@ -0,0 +1,390 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	Version = "3.0.3"
+
+	JSONContentType = "application/json"
+	TextContentType = "text/plain"
+)
+
+type (
+	// Document is an OpenAPI 3 document. Request and response schemas are derived from the Go types
+	// the handlers bind and render, so that the document follows the code.
+	Document struct {
+		OpenAPI    string                `json:"openapi"`
+		Info       *Info                 `json:"info"`
+		Servers    []*Server             `json:"servers,omitempty"`
+		Paths      map[string]PathItem   `json:"paths"`
+		Components *Components           `json:"components"`
+		Security   []SecurityRequirement `json:"security,omitempty"`
+
+		errors []error
+	}
+
+	Info struct {
+		Title       string `json:"title"`
+		Description string `json:"description,omitempty"`
+		Version     string `json:"version"`
+	}
+
+	Server struct {
+		URL string `json:"url"`
+	}
+
+	// PathItem maps lower case HTTP methods to operations.
+	PathItem map[string]*Operation
+
+	Operation struct {
+		OperationID string                `json:"operationId,omitempty"`
+		Summary     string                `json:"summary,omitempty"`
+		Description string                `json:"description,omitempty"`
+		Tags        []string              `json:"tags,omitempty"`
+		Parameters  []*Parameter          `json:"parameters,omitempty"`
+		RequestBody *RequestBody          `json:"requestBody,omitempty"`
+		Responses   map[string]*Response  `json:"responses"`
+		Security    []SecurityRequirement `json:"security,omitempty"`
+	}
+
+	Parameter struct {
+		Name        string  `json:"name"`
+		In          string  `json:"in"`
+		Description string  `json:"description,omitempty"`
+		Required    bool    `json:"required,omitempty"`
+		Schema      *Schema `json:"schema"`
+	}
+
+	RequestBody struct {
+		Description string                `json:"description,omitempty"`
+		Required    bool                  `json:"required"`
+		Content     map[string]*MediaType `json:"content"`
+	}
+
+	Response struct {
+		Description string                `json:"description"`
+		Headers     map[string]*Header    `json:"headers,omitempty"`
+		Content     map[string]*MediaType `json:"content,omitempty"`
+	}
+
+	Header struct {
+		Description string  `json:"description,omitempty"`
+		Schema      *Schema `json:"schema"`
+	}
+
+	MediaType struct {
+		Schema *Schema `json:"schema"`
+	}
+
+	Schema struct {
+		Ref                  string             `json:"$ref,omitempty"`
+		Type                 string             `json:"type,omitempty"`
+		Format               string             `json:"format,omitempty"`
+		Description          string             `json:"description,omitempty"`
+		Enum                 []string           `json:"enum,omitempty"`
+		Properties           map[string]*Schema `json:"properties,omitempty"`
+		Required             []string           `json:"required,omitempty"`
+		Items                *Schema            `json:"items,omitempty"`
+		AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+		Nullable             bool               `json:"nullable,omitempty"`
+	}
+
+	Components struct {
+		Schemas         map[string]*Schema         `json:"schemas"`
+		SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+	}
+
+	SecurityScheme struct {
+		Type         string `json:"type"`
+		Description  string `json:"description,omitempty"`
+		Name         string `json:"name,omitempty"`
+		In           string `json:"in,omitempty"`
+		Scheme       string `json:"scheme,omitempty"`
+		BearerFormat string `json:"bearerFormat,omitempty"`
+	}
+
+	// SecurityRequirement maps security scheme names to scopes; alternatives are separate requirements.
+	SecurityRequirement map[string][]string
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// New returns an empty document.
+func New(title, version, description string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    &Info{Title: title, Version: version, Description: description},
+		Paths:   make(map[string]PathItem),
+		Components: &Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: make(map[string]*SecurityScheme),
+		},
+	}
+}
+
+// Add describes the operation of a route. The pattern may be a chi pattern; it is normalized with Path.
+func (d *Document) Add(method, pattern string, operation *Operation) {
+	path := Path(pattern)
+	if d.Paths[path] == nil {
+		d.Paths[path] = make(PathItem)
+	}
+
+	method = strings.ToLower(method)
+	if _, ok := d.Paths[path][method]; ok {
+		d.errors = append(d.errors, fmt.Errorf("%s %s is described twice", strings.ToUpper(method), path))
+	}
+	d.Paths[path][method] = operation
+}
+
+// Body describes a JSON request body of the type of v.
+func (d *Document) Body(description string, v interface{}) *RequestBody {
+	return &RequestBody{
+		Description: description,
+		Required:    true,
+		Content:     map[string]*MediaType{JSONContentType: {Schema: d.Schema(v)}},
+	}
+}
+
+// JSON describes a JSON response of the type of v.
+func (d *Document) JSON(description string, v interface{}) *Response {
+	return &Response{
+		Description: description,
+		Content:     map[string]*MediaType{JSONContentType: {Schema: d.Schema(v)}},
+	}
+}
+
+// Text describes a plain text response, such as a RouterOS script.
+func Text(description string) *Response {
+	return &Response{
+		Description: description,
+		Content:     map[string]*MediaType{TextContentType: {Schema: &Schema{Type: "string"}}},
+	}
+}
+
+// Empty describes a response without body.
+func Empty(description string) *Response {
+	return &Response{Description: description}
+}
+
+// Schema returns the schema of the type of v. Named struct types become components and are referenced.
+func (d *Document) Schema(v interface{}) *Schema {
+	return d.schemaOf(reflect.TypeOf(v))
+}
+
+// Errors returns the problems found while describing types and routes.
+func (d *Document) Errors() []error {
+	return d.errors
+}
+
+// CheckRoutes returns an error listing the routes of the router which are not described, the described
+// operations which are not routed, updates without request body, operations without success response
+// and types which cannot be described.
+func (d *Document) CheckRoutes(routes chi.Routes) error {
+	problems := make([]string, 0)
+	for _, err := range d.errors {
+		problems = append(problems, err.Error())
+	}
+
+	routed := make(map[string]bool)
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		path := Path(route)
+		routed[method+" "+path] = true
+
+		if _, ok := d.Paths[path][strings.ToLower(method)]; !ok {
+			problems = append(problems, fmt.Sprintf("%s %s is not described", method, path))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for path, item := range d.Paths {
+		for method, operation := range item {
+			key := strings.ToUpper(method) + " " + path
+			if !routed[key] {
+				problems = append(problems, fmt.Sprintf("%s is described but not routed", key))
+			}
+
+			if (method == "put" || method == "patch") && operation.RequestBody == nil {
+				problems = append(problems, fmt.Sprintf("%s has no request body", key))
+			}
+
+			if !hasSuccessResponse(operation) {
+				problems = append(problems, fmt.Sprintf("%s has no success response", key))
+			}
+		}
+	}
+
+	if len(problems) != 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("openapi document does not match the routes: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// Path converts a chi route pattern to an OpenAPI path: parameter patterns and trailing slashes are removed.
+func Path(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '{' {
+			b.WriteByte(pattern[i])
+			continue
+		}
+
+		// Parameter patterns may contain braces themselves, as in {id:[a-f0-9]{24}}.
+		depth, end := 0, len(pattern)-1
+		for j := i; j < len(pattern); j++ {
+			if pattern[j] == '{' {
+				depth++
+			} else if pattern[j] == '}' {
+				if depth--; depth == 0 {
+					end = j
+					break
+				}
+			}
+		}
+
+		param := pattern[i+1 : end]
+		if k := strings.Index(param, ":"); k > -1 {
+			param = param[:k]
+		}
+		b.WriteString("{" + param + "}")
+		i = end
+	}
+
+	path := strings.Replace(b.String(), "/*/", "/", -1)
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	return path
+}
+
+func hasSuccessResponse(operation *Operation) bool {
+	for status := range operation.Responses {
+		if strings.HasPrefix(status, "2") || strings.HasPrefix(status, "3") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	if t == nil {
+		d.errors = append(d.errors, fmt.Errorf("cannot describe untyped nil"))
+		return &Schema{}
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		if _, ok := d.Components.Schemas[t.Name()]; !ok {
+			// Registered before the fields are described, so that recursive types terminate.
+			d.Components.Schemas[t.Name()] = &Schema{}
+			*d.Components.Schemas[t.Name()] = *d.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return d.structSchema(t)
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		if t == reflect.TypeOf(time.Duration(0)) {
+			return &Schema{Type: "integer", Format: "int64", Description: "nanoseconds"}
+		}
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schemaOf(t.Elem())}
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			d.errors = append(d.errors, fmt.Errorf("cannot describe map with %s keys", t.Key()))
+		}
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem())}
+	default:
+		d.errors = append(d.errors, fmt.Errorf("cannot describe type %s", t))
+		return &Schema{}
+	}
+}
+
+// structSchema describes the JSON encoding of a struct: json tags name the properties, embedded structs are
+// inlined and fields validated as required are required.
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+
+		name, options := tag, ""
+		if i := strings.Index(tag, ","); i > -1 {
+			name, options = tag[:i], tag[i+1:]
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			embedded := d.structSchema(fieldType)
+			for property, s := range embedded.Properties {
+				schema.Properties[property] = s
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		property := d.schemaOf(field.Type)
+		rules := strings.Split(field.Tag.Get("validator"), ",")
+		for _, rule := range rules {
+			if strings.HasPrefix(rule, "oneof=") && property.Type == "string" {
+				property.Enum = strings.Fields(strings.TrimPrefix(rule, "oneof="))
+			}
+		}
+		schema.Properties[name] = property
+
+		if rules[0] == "required" && !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	sort.Strings(schema.Required)
+
+	return schema
+}
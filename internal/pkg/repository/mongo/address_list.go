@@ -3,9 +3,12 @@ package mongo
 import (
 	"context"
 	"errors"
+	"fmt"
+	"regexp"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"mikrotik_provisioning/internal/pkg/address_list"
@@ -15,6 +18,8 @@ type AddressList struct {
 	ID        primitive.ObjectID      `bson:"_id,omitempty"`
 	Name      string                  `bson:"name"`
 	Addresses []*address_list.Address `bson:"addresses"`
+	Labels    map[string]string       `bson:"labels,omitempty"`
+	Revision  int64                   `bson:"revision"`
 }
 
 func (a *AddressList) ToAddressList() *address_list.AddressList {
@@ -22,6 +27,8 @@ func (a *AddressList) ToAddressList() *address_list.AddressList {
 		ID:        a.ID.Hex(),
 		Name:      a.Name,
 		Addresses: a.Addresses,
+		Labels:    a.Labels,
+		Revision:  a.Revision,
 	}
 }
 
@@ -29,35 +36,144 @@ func (s *Storage) CreateAddressList(ctx context.Context, addressList *address_li
 	res, err := s.collections["address-list"].InsertOne(ctx, &AddressList{
 		Name:      addressList.Name,
 		Addresses: addressList.Addresses,
+		Labels:    addressList.Labels,
+		Revision:  1,
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	addressList.ID = res.InsertedID.(primitive.ObjectID).Hex()
+	addressList.Revision = 1
 
 	return addressList, nil
 }
 
-func (s *Storage) GetAddressLists(ctx context.Context) ([]*address_list.AddressList, error) {
-	cur, err := s.collections["address-list"].Find(ctx, bson.M{})
-	defer cur.Close(ctx)
+// GetAddressLists returns the lists matching the filter, and the cursor of the next page if there are more.
+func (s *Storage) GetAddressLists(ctx context.Context, filter *address_list.Filter) ([]*address_list.AddressList, string, error) {
+	conditions := make([]bson.M, 0)
+	if filter.Prefix != "" {
+		conditions = append(conditions, bson.M{"name": bson.M{"$regex": "^" + regexp.QuoteMeta(filter.Prefix)}})
+	}
+	for key, value := range filter.Labels {
+		if value == "" {
+			conditions = append(conditions, bson.M{"labels." + key: bson.M{"$exists": true}})
+		} else {
+			conditions = append(conditions, bson.M{"labels." + key: value})
+		}
+	}
+	if filter.Cursor != "" {
+		name, err := address_list.DecodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		conditions = append(conditions, bson.M{"name": bson.M{cursorOperator(filter.Descending): name}})
+	}
+
+	opts := options.Find().SetSort(bson.M{"name": sortOrder(filter.Descending)})
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit + 1)
+	}
+
+	cur, err := s.collections["address-list"].Find(ctx, matchAll(conditions), opts)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	defer cur.Close(ctx)
 
 	result := make([]*address_list.AddressList, 0)
 	for cur.Next(ctx) {
 		data := new(AddressList)
 		err := cur.Decode(data)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		result = append(result, data.ToAddressList())
 	}
 
-	return result, nil
+	if filter.Limit > 0 && int64(len(result)) > filter.Limit {
+		result = result[:filter.Limit]
+		return result, address_list.EncodeCursor(result[len(result)-1].Name), nil
+	}
+
+	return result, "", nil
+}
+
+// GetEntries returns the entries of a list matching the filter, and the cursor of the next page if there are more.
+// Network containment is evaluated by MongoDB on the dotted IPv4 addresses; FQDN entries never match a network.
+func (s *Storage) GetEntries(ctx context.Context, id string, filter *address_list.EntryFilter) ([]*address_list.Address, string, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	conditions := make([]bson.M, 0)
+	if filter.Address != "" {
+		conditions = append(conditions, bson.M{"address": filter.Address})
+	}
+	if filter.Network != nil {
+		first, last, err := address_list.NetworkRange(filter.Network)
+		if err != nil {
+			return nil, "", err
+		}
+		ip := ipv4ToLong("$address")
+		conditions = append(conditions, bson.M{"$expr": bson.M{"$and": bson.A{
+			bson.M{"$gte": bson.A{ip, int64(first)}},
+			bson.M{"$lte": bson.A{ip, int64(last)}},
+		}}})
+	}
+	if filter.Comment != "" {
+		conditions = append(conditions, bson.M{"comment": bson.M{"$regex": regexp.QuoteMeta(filter.Comment), "$options": "i"}})
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			conditions = append(conditions, bson.M{"disabled": true})
+		} else {
+			conditions = append(conditions, bson.M{"disabled": bson.M{"$ne": true}})
+		}
+	}
+	if filter.Cursor != "" {
+		address, err := address_list.DecodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		conditions = append(conditions, bson.M{"address": bson.M{cursorOperator(filter.Descending): address}})
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id": objectID}}},
+		{{Key: "$unwind", Value: "$addresses"}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$addresses"}}},
+		{{Key: "$match", Value: matchAll(conditions)}},
+		{{Key: "$sort", Value: bson.M{"address": sortOrder(filter.Descending)}}},
+	}
+	if filter.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: filter.Limit + 1}})
+	}
+
+	cur, err := s.collections["address-list"].Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cur.Close(ctx)
+
+	result := make([]*address_list.Address, 0)
+	for cur.Next(ctx) {
+		data := new(address_list.Address)
+		if err := cur.Decode(data); err != nil {
+			return nil, "", err
+		}
+
+		result = append(result, data)
+	}
+
+	if filter.Limit > 0 && int64(len(result)) > filter.Limit {
+		result = result[:filter.Limit]
+		return result, address_list.EncodeCursor(result[len(result)-1].Address), nil
+	}
+
+	return result, "", nil
 }
 
 func (s *Storage) GetAddressList(ctx context.Context, name string) (*address_list.AddressList, error) {
@@ -85,17 +201,17 @@ func (s *Storage) GetAddressList(ctx context.Context, name string) (*address_lis
 	return data.ToAddressList(), nil
 }
 
+// UpdateAddressList replaces the entries and labels of a list. Lists are never renamed, as access is granted by name.
 func (s *Storage) UpdateAddressList(ctx context.Context, id string, addressList *address_list.AddressList) (*address_list.AddressList, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, err
 	}
 
-	res := s.collections["address-list"].FindOneAndReplace(ctx, bson.M{"_id": objectID}, &AddressList{
-		ID:        objectID,
-		Name:      addressList.Name,
-		Addresses: addressList.Addresses,
-	}, options.FindOneAndReplace().SetReturnDocument(options.After))
+	res := s.collections["address-list"].FindOneAndUpdate(ctx, bson.M{"_id": objectID}, bson.M{
+		"$set": bson.M{"addresses": addressList.Addresses, "labels": addressList.Labels},
+		"$inc": bson.M{"revision": 1},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After))
 	if res.Err() != nil {
 		return nil, res.Err()
 	}
@@ -120,14 +236,13 @@ func (s *Storage) UpdateEntriesInAddressList(ctx context.Context, action address
 		return nil, err
 	}
 
-	bsonAddresses := addressesToBsonList(currentData, addresses)
-
 	var update bson.M
 	switch action {
 	case address_list.AddAction:
-		update = bson.M{"$push": bson.M{"addresses": bson.M{"$each": bsonAddresses}}}
+		update = bson.M{"$push": bson.M{"addresses": bson.M{"$each": addressesToBsonList(currentData, addresses)}}, "$inc": bson.M{"revision": 1}}
 	case address_list.RemoveAction:
-		update = bson.M{"$pull": bson.M{"addresses": bson.M{"$in": bsonAddresses}}}
+		// Entries are matched by address only, as stored entries carry timestamps the request does not know.
+		update = bson.M{"$pull": bson.M{"addresses": bson.M{"address": bson.M{"$in": addressesToBsonKeys(addresses)}}}, "$inc": bson.M{"revision": 1}}
 	}
 	res := s.collections["address-list"].FindOneAndUpdate(ctx, bson.M{"_id": objectID}, update)
 	if res.Err() != nil {
@@ -166,6 +281,15 @@ func (s *Storage) DeleteAddressList(ctx context.Context, id string) error {
 	return nil
 }
 
+func (s *Storage) GetAddressListByID(ctx context.Context, id string) (*address_list.AddressList, error) {
+	data, err := s.getAddressListByID(ctx, id)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	return data.ToAddressList(), nil
+}
+
 func (s *Storage) getAddressListByID(ctx context.Context, id string) (*AddressList, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -197,20 +321,157 @@ func (s *Storage) getAddressListByID(ctx context.Context, id string) (*AddressLi
 	return data, nil
 }
 
+func matchAll(conditions []bson.M) bson.M {
+	if len(conditions) == 0 {
+		return bson.M{}
+	}
+
+	return bson.M{"$and": conditions}
+}
+
+func sortOrder(descending bool) int {
+	if descending {
+		return -1
+	}
+
+	return 1
+}
+
+func cursorOperator(descending bool) string {
+	if descending {
+		return "$lt"
+	}
+
+	return "$gt"
+}
+
+// ipv4ToLong returns an aggregation expression converting a dotted IPv4 address field to an integer, or null
+// for anything else.
+func ipv4ToLong(field string) bson.M {
+	octet := func(i int) bson.M {
+		return bson.M{"$convert": bson.M{
+			"input":   bson.M{"$arrayElemAt": bson.A{"$$octets", i}},
+			"to":      "long",
+			"onError": nil,
+			"onNull":  nil,
+		}}
+	}
+
+	return bson.M{"$let": bson.M{
+		"vars": bson.M{"octets": bson.M{"$split": bson.A{field, "."}}},
+		"in": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$size": "$$octets"}, 4}},
+			bson.M{"$add": bson.A{
+				bson.M{"$multiply": bson.A{octet(0), 1 << 24}},
+				bson.M{"$multiply": bson.A{octet(1), 1 << 16}},
+				bson.M{"$multiply": bson.A{octet(2), 1 << 8}},
+				octet(3),
+			}},
+			nil,
+		}},
+	}}
+}
+
+// addressesToBsonList returns the addresses which are not in the list yet.
 func addressesToBsonList(addressList *AddressList, addresses []*address_list.Address) primitive.A {
+	existing := make(map[string]bool)
+	for _, b := range addressList.Addresses {
+		existing[b.Address] = true
+	}
+
 	bsonA := primitive.A{}
-	ok := true
 	for _, a := range addresses {
-		for _, b := range addressList.Addresses {
-			if b == a {
-				ok = false
-				break
-			}
-		}
-		if ok {
+		if !existing[a.Address] {
+			existing[a.Address] = true
 			bsonA = append(bsonA, a)
 		}
 	}
 
 	return bsonA
 }
+
+func addressesToBsonKeys(addresses []*address_list.Address) primitive.A {
+	bsonA := primitive.A{}
+	for _, a := range addresses {
+		bsonA = append(bsonA, a.Address)
+	}
+
+	return bsonA
+}
+
+// UpdateAddressLists replaces the entries and labels of all lists in one transaction. Each list must still have
+// the revision it was read with, otherwise nothing is written and address_list.ErrConflict is returned.
+// Transactions require MongoDB to run as a replica set.
+func (s *Storage) UpdateAddressLists(ctx context.Context, addressLists []*address_list.AddressList) ([]*address_list.AddressList, error) {
+	session, err := s.collections["address-list"].Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		updated := make([]*address_list.AddressList, 0, len(addressLists))
+		for _, addressList := range addressLists {
+			data, err := s.UpdateAddressListRevision(sc, addressList)
+			if err != nil {
+				return nil, err
+			}
+
+			updated = append(updated, data)
+		}
+
+		return updated, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]*address_list.AddressList), nil
+}
+
+// UpdateAddressListRevision replaces the entries and labels of a list which still has the revision it was read
+// with, otherwise address_list.ErrConflict is returned. Only one document is written, so no transaction is needed.
+func (s *Storage) UpdateAddressListRevision(ctx context.Context, addressList *address_list.AddressList) (*address_list.AddressList, error) {
+	objectID, err := primitive.ObjectIDFromHex(addressList.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := s.collections["address-list"].FindOneAndUpdate(ctx, bson.M{"_id": objectID, "revision": addressList.Revision}, bson.M{
+		"$set": bson.M{"addresses": addressList.Addresses, "labels": addressList.Labels},
+		"$inc": bson.M{"revision": 1},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	if res.Err() != nil {
+		if res.Err().Error() == NoDocumentsError {
+			return nil, fmt.Errorf("%w: %s", address_list.ErrConflict, addressList.Name)
+		}
+		return nil, res.Err()
+	}
+
+	data := new(AddressList)
+	if err := res.Decode(data); err != nil {
+		return nil, err
+	}
+
+	return data.ToAddressList(), nil
+}
+
+// DeleteAddressListRevision deletes a list which still has the revision it was read with, otherwise
+// address_list.ErrConflict is returned.
+func (s *Storage) DeleteAddressListRevision(ctx context.Context, id string, revision int64) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.collections["address-list"].DeleteOne(ctx, bson.M{"_id": objectID, "revision": revision})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("%w: %s", address_list.ErrConflict, id)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mikrotik_provisioning/internal/config"
+	"mikrotik_provisioning/internal/pkg/apikey"
+)
+
+type APIKey struct {
+	ID                 primitive.ObjectID `bson:"_id,omitempty"`
+	AccessKey          string             `bson:"access_key"`
+	SigningKey         string             `bson:"signing_key"`
+	Description        string             `bson:"description,omitempty"`
+	Role               string             `bson:"role"`
+	Grants             []*config.Grant    `bson:"grants,omitempty"`
+	CreatedAt          time.Time          `bson:"created_at"`
+	ExpiresAt          *time.Time         `bson:"expires_at,omitempty"`
+	LastUsedAt         *time.Time         `bson:"last_used_at,omitempty"`
+	PreviousSigningKey string             `bson:"previous_signing_key,omitempty"`
+	PreviousExpiresAt  *time.Time         `bson:"previous_expires_at,omitempty"`
+}
+
+func (k *APIKey) ToAPIKey() *apikey.APIKey {
+	return &apikey.APIKey{
+		ID:                 k.ID.Hex(),
+		AccessKey:          k.AccessKey,
+		SigningKey:         k.SigningKey,
+		Description:        k.Description,
+		Role:               k.Role,
+		Grants:             k.Grants,
+		CreatedAt:          k.CreatedAt,
+		ExpiresAt:          k.ExpiresAt,
+		LastUsedAt:         k.LastUsedAt,
+		PreviousSigningKey: k.PreviousSigningKey,
+		PreviousExpiresAt:  k.PreviousExpiresAt,
+	}
+}
+
+func newAPIKey(id primitive.ObjectID, k *apikey.APIKey) *APIKey {
+	return &APIKey{
+		ID:                 id,
+		AccessKey:          k.AccessKey,
+		SigningKey:         k.SigningKey,
+		Description:        k.Description,
+		Role:               k.Role,
+		Grants:             k.Grants,
+		CreatedAt:          k.CreatedAt,
+		ExpiresAt:          k.ExpiresAt,
+		LastUsedAt:         k.LastUsedAt,
+		PreviousSigningKey: k.PreviousSigningKey,
+		PreviousExpiresAt:  k.PreviousExpiresAt,
+	}
+}
+
+func (s *Storage) CreateAPIKey(ctx context.Context, k *apikey.APIKey) (*apikey.APIKey, error) {
+	res, err := s.collections["apikey"].InsertOne(ctx, newAPIKey(primitive.NilObjectID, k))
+	if err != nil {
+		return nil, err
+	}
+
+	k.ID = res.InsertedID.(primitive.ObjectID).Hex()
+
+	return k, nil
+}
+
+func (s *Storage) GetAPIKeys(ctx context.Context) ([]*apikey.APIKey, error) {
+	cur, err := s.collections["apikey"].Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	result := make([]*apikey.APIKey, 0)
+	for cur.Next(ctx) {
+		data := new(APIKey)
+		if err := cur.Decode(data); err != nil {
+			return nil, err
+		}
+
+		result = append(result, data.ToAPIKey())
+	}
+
+	return result, nil
+}
+
+func (s *Storage) GetAPIKey(ctx context.Context, accessKey string) (*apikey.APIKey, error) {
+	res := s.collections["apikey"].FindOne(ctx, bson.M{"access_key": accessKey})
+	if res.Err() != nil {
+		if res.Err().Error() == NoDocumentsError {
+			return nil, nil
+		}
+		return nil, res.Err()
+	}
+
+	data := new(APIKey)
+	if err := res.Decode(data); err != nil {
+		return nil, err
+	}
+
+	return data.ToAPIKey(), nil
+}
+
+func (s *Storage) GetAPIKeyByID(ctx context.Context, id string) (*apikey.APIKey, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := s.collections["apikey"].FindOne(ctx, bson.M{"_id": objectID})
+	if res.Err() != nil {
+		if res.Err().Error() == NoDocumentsError {
+			return nil, nil
+		}
+		return nil, res.Err()
+	}
+
+	data := new(APIKey)
+	if err := res.Decode(data); err != nil {
+		return nil, err
+	}
+
+	return data.ToAPIKey(), nil
+}
+
+func (s *Storage) UpdateAPIKey(ctx context.Context, id string, k *apikey.APIKey) (*apikey.APIKey, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := s.collections["apikey"].FindOneAndReplace(ctx, bson.M{"_id": objectID}, newAPIKey(objectID, k),
+		options.FindOneAndReplace().SetReturnDocument(options.After))
+	if res.Err() != nil {
+		return nil, res.Err()
+	}
+
+	data := new(APIKey)
+	if err := res.Decode(data); err != nil {
+		return nil, err
+	}
+
+	return data.ToAPIKey(), nil
+}
+
+func (s *Storage) TouchAPIKey(ctx context.Context, id string, lastUsedAt time.Time) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.collections["apikey"].UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": bson.M{"last_used_at": lastUsedAt}})
+
+	return err
+}
+
+func (s *Storage) DeleteAPIKey(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.collections["apikey"].DeleteOne(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return errors.New("failed deleting mongodb object")
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/audit"
+)
+
+const auditEventsLimit = 1000
+
+type AuditEvent struct {
+	ID         primitive.ObjectID      `bson:"_id,omitempty"`
+	Time       time.Time               `bson:"time"`
+	Actor      string                  `bson:"actor"`
+	SourceIP   string                  `bson:"source_ip,omitempty"`
+	RequestID  string                  `bson:"request_id,omitempty"`
+	Action     string                  `bson:"action"`
+	Resource   string                  `bson:"resource"`
+	Name       string                  `bson:"name"`
+	Added      []*address_list.Address `bson:"added,omitempty"`
+	Removed    []*address_list.Address `bson:"removed,omitempty"`
+	Changed    []*audit.EntryChange    `bson:"changed,omitempty"`
+	ImportedBy string                  `bson:"imported_by,omitempty"`
+}
+
+func (e *AuditEvent) ToAuditEvent() *audit.Event {
+	return &audit.Event{
+		ID:         e.ID.Hex(),
+		Time:       e.Time,
+		Actor:      e.Actor,
+		SourceIP:   e.SourceIP,
+		RequestID:  e.RequestID,
+		Action:     e.Action,
+		Resource:   e.Resource,
+		Name:       e.Name,
+		Added:      e.Added,
+		Removed:    e.Removed,
+		Changed:    e.Changed,
+		ImportedBy: e.ImportedBy,
+	}
+}
+
+func (s *Storage) CreateAuditEvent(ctx context.Context, e *audit.Event) error {
+	res, err := s.collections["audit"].InsertOne(ctx, &AuditEvent{
+		Time:       e.Time,
+		Actor:      e.Actor,
+		SourceIP:   e.SourceIP,
+		RequestID:  e.RequestID,
+		Action:     e.Action,
+		Resource:   e.Resource,
+		Name:       e.Name,
+		Added:      e.Added,
+		Removed:    e.Removed,
+		Changed:    e.Changed,
+		ImportedBy: e.ImportedBy,
+	})
+	if err != nil {
+		return err
+	}
+
+	e.ID = res.InsertedID.(primitive.ObjectID).Hex()
+
+	return nil
+}
+
+// GetAuditEvents returns the newest events matching the filter, at most auditEventsLimit, newest first.
+func (s *Storage) GetAuditEvents(ctx context.Context, filter *audit.Filter) ([]*audit.Event, error) {
+	query := bson.M{}
+	if filter.Actor != "" {
+		query["actor"] = filter.Actor
+	}
+	if filter.List != "" {
+		query["resource"] = audit.AddressListResource
+		query["name"] = filter.List
+	}
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		timeRange := bson.M{}
+		if !filter.From.IsZero() {
+			timeRange["$gte"] = filter.From
+		}
+		if !filter.To.IsZero() {
+			timeRange["$lte"] = filter.To
+		}
+		query["time"] = timeRange
+	}
+	if filter.BeforeID != "" {
+		before, err := primitive.ObjectIDFromHex(filter.BeforeID)
+		if err != nil {
+			return nil, err
+		}
+		query["$or"] = bson.A{
+			bson.M{"time": bson.M{"$lt": filter.To}},
+			bson.M{"time": filter.To, "_id": bson.M{"$lt": before}},
+		}
+	}
+
+	// Events at one time are ordered by ID, so that a walk continued with BeforeID reaches each of them.
+	cur, err := s.collections["audit"].Find(ctx, query,
+		options.Find().SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(auditEventsLimit))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	result := make([]*audit.Event, 0)
+	for cur.Next(ctx) {
+		data := new(AuditEvent)
+		if err := cur.Decode(data); err != nil {
+			return nil, err
+		}
+
+		result = append(result, data.ToAuditEvent())
+	}
+
+	return result, nil
+}
@@ -0,0 +1,154 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mikrotik_provisioning/internal/pkg/device"
+)
+
+type Device struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty"`
+	Name            string             `bson:"name"`
+	Model           string             `bson:"model,omitempty"`
+	RouterOSVersion string             `bson:"routeros_version,omitempty"`
+	AddressLists    []string           `bson:"address_lists"`
+	FetchInterval   string             `bson:"fetch_interval,omitempty"`
+	Token           string             `bson:"token"`
+}
+
+func (d *Device) ToDevice() *device.Device {
+	return &device.Device{
+		ID:              d.ID.Hex(),
+		Name:            d.Name,
+		Model:           d.Model,
+		RouterOSVersion: d.RouterOSVersion,
+		AddressLists:    d.AddressLists,
+		FetchInterval:   d.FetchInterval,
+		Token:           d.Token,
+	}
+}
+
+func newDevice(id primitive.ObjectID, d *device.Device) *Device {
+	return &Device{
+		ID:              id,
+		Name:            d.Name,
+		Model:           d.Model,
+		RouterOSVersion: d.RouterOSVersion,
+		AddressLists:    d.AddressLists,
+		FetchInterval:   d.FetchInterval,
+		Token:           d.Token,
+	}
+}
+
+func (s *Storage) CreateDevice(ctx context.Context, d *device.Device) (*device.Device, error) {
+	res, err := s.collections["device"].InsertOne(ctx, newDevice(primitive.NilObjectID, d))
+	if err != nil {
+		return nil, err
+	}
+
+	d.ID = res.InsertedID.(primitive.ObjectID).Hex()
+
+	return d, nil
+}
+
+func (s *Storage) GetDevices(ctx context.Context) ([]*device.Device, error) {
+	cur, err := s.collections["device"].Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	result := make([]*device.Device, 0)
+	for cur.Next(ctx) {
+		data := new(Device)
+		if err := cur.Decode(data); err != nil {
+			return nil, err
+		}
+
+		result = append(result, data.ToDevice())
+	}
+
+	return result, nil
+}
+
+func (s *Storage) GetDevice(ctx context.Context, name string) (*device.Device, error) {
+	res := s.collections["device"].FindOne(ctx, bson.M{"name": name})
+	if res.Err() != nil {
+		if res.Err().Error() == NoDocumentsError {
+			return nil, nil
+		}
+		return nil, res.Err()
+	}
+
+	data := new(Device)
+	if err := res.Decode(data); err != nil {
+		return nil, err
+	}
+
+	return data.ToDevice(), nil
+}
+
+func (s *Storage) GetDeviceByID(ctx context.Context, id string) (*device.Device, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := s.collections["device"].FindOne(ctx, bson.M{"_id": objectID})
+	if res.Err() != nil {
+		if res.Err().Error() == NoDocumentsError {
+			return nil, nil
+		}
+		return nil, res.Err()
+	}
+
+	data := new(Device)
+	if err := res.Decode(data); err != nil {
+		return nil, err
+	}
+
+	return data.ToDevice(), nil
+}
+
+func (s *Storage) UpdateDevice(ctx context.Context, id string, d *device.Device) (*device.Device, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := s.collections["device"].FindOneAndReplace(ctx, bson.M{"_id": objectID}, newDevice(objectID, d),
+		options.FindOneAndReplace().SetReturnDocument(options.After))
+	if res.Err() != nil {
+		return nil, res.Err()
+	}
+
+	data := new(Device)
+	if err := res.Decode(data); err != nil {
+		return nil, err
+	}
+
+	return data.ToDevice(), nil
+}
+
+func (s *Storage) DeleteDevice(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.collections["device"].DeleteOne(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return errors.New("failed deleting mongodb object")
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+)
+
+// putEntryAttempts bounds the retries of PutEntry when concurrent writers change the same entry.
+const putEntryAttempts = 3
+
+func (s *Storage) GetEntry(ctx context.Context, id string, address string) (*address_list.Address, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := s.collections["address-list"].FindOne(ctx, bson.M{"_id": objectID, "addresses.address": address},
+		options.FindOne().SetProjection(bson.M{"addresses.$": 1}))
+	if res.Err() != nil {
+		if res.Err().Error() == NoDocumentsError {
+			return nil, nil
+		}
+		return nil, res.Err()
+	}
+
+	data := new(AddressList)
+	if err := res.Decode(data); err != nil {
+		return nil, err
+	}
+
+	if len(data.Addresses) == 0 {
+		return nil, nil
+	}
+
+	return data.Addresses[0], nil
+}
+
+// PutEntry creates or updates a single entry with atomic updates of the list document. The entry's
+// UpdatedAt is stored as its modification time, and as its creation time if the entry is new.
+// An entry which already has the same comment, disabled flag and expiry is left untouched, so that repeated
+// requests do not change the revision. It reports whether the entry was created.
+func (s *Storage) PutEntry(ctx context.Context, id string, entry *address_list.Address) (*address_list.Address, bool, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	coll := s.collections["address-list"]
+	for i := 0; i < putEntryAttempts; i++ {
+		res, err := coll.UpdateOne(ctx, bson.M{
+			"_id":       objectID,
+			"addresses": bson.M{"$elemMatch": bson.M{"address": entry.Address, "$or": entryDifferences(entry)}},
+		}, bson.M{
+			"$set": bson.M{
+				"addresses.$.disabled":   entry.Disabled,
+				"addresses.$.comment":    entry.Comment,
+				"addresses.$.updated_at": entry.UpdatedAt,
+				"addresses.$.expires_at": entry.ExpiresAt,
+			},
+			"$inc": bson.M{"revision": 1},
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		if res.MatchedCount > 0 {
+			stored, err := s.GetEntry(ctx, id, entry.Address)
+			return stored, false, err
+		}
+
+		created := *entry
+		created.CreatedAt = entry.UpdatedAt
+		res, err = coll.UpdateOne(ctx, bson.M{
+			"_id":               objectID,
+			"addresses.address": bson.M{"$ne": entry.Address},
+		}, bson.M{
+			"$push": bson.M{"addresses": &created},
+			"$inc":  bson.M{"revision": 1},
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		if res.MatchedCount > 0 {
+			return &created, true, nil
+		}
+
+		stored, err := s.GetEntry(ctx, id, entry.Address)
+		if err != nil {
+			return nil, false, err
+		}
+		if stored != nil && stored.SameAs(entry) {
+			return stored, false, nil
+		}
+		if stored == nil {
+			// Either the list is gone, or the entry was removed between both updates.
+			if list, err := s.getAddressListByID(ctx, id); err != nil || list == nil {
+				return nil, false, errors.New("failed updating mongodb object")
+			}
+		}
+	}
+
+	return nil, false, errors.New("failed updating mongodb object: concurrent modification")
+}
+
+func (s *Storage) DeleteEntry(ctx context.Context, id string, address string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.collections["address-list"].UpdateOne(ctx, bson.M{"_id": objectID, "addresses.address": address}, bson.M{
+		"$pull": bson.M{"addresses": bson.M{"address": address}},
+		"$inc":  bson.M{"revision": 1},
+	})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return errors.New("failed deleting mongodb object")
+	}
+
+	return nil
+}
+
+// entryDifferences matches stored entries whose comment, disabled flag or expiry differ from the entry.
+// The fields are omitted when empty, so a missing field is treated as its zero value.
+func entryDifferences(entry *address_list.Address) bson.A {
+	differences := bson.A{}
+	if entry.Disabled {
+		differences = append(differences, bson.M{"disabled": bson.M{"$ne": true}})
+	} else {
+		differences = append(differences, bson.M{"disabled": true})
+	}
+
+	if entry.Comment != "" {
+		differences = append(differences, bson.M{"comment": bson.M{"$ne": entry.Comment}})
+	} else {
+		differences = append(differences, bson.M{"comment": bson.M{"$exists": true, "$ne": ""}})
+	}
+
+	if entry.ExpiresAt != nil {
+		differences = append(differences, bson.M{"expires_at": bson.M{"$ne": *entry.ExpiresAt}})
+	} else {
+		differences = append(differences, bson.M{"expires_at": bson.M{"$exists": true, "$ne": nil}})
+	}
+
+	return differences
+}
@@ -3,6 +3,7 @@ package mongo
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -16,16 +17,27 @@ const (
 	NoDocumentsError = "mongo: no documents in result"
 )
 
+// resources are the collections the storage uses, each of which must be configured.
+var resources = []string{"address-list", "apikey", "audit", "deadletter", "device", "webhook"}
+
 type Storage struct {
+	client      *mongo.Client
 	collections map[string]*mongo.Collection
 }
 
+// NewMongoStorage connects to MongoDB and creates the configured indexes. It fails if a resource has no
+// collection configured, rather than failing the first request using it.
 func NewMongoStorage(ctx context.Context, dbConfig *config.Database) (*Storage, error) {
+	if err := checkResources(dbConfig.Collections); err != nil {
+		return nil, err
+	}
+
 	client, err := mongo.Connect(
 		ctx,
 		options.Client().ApplyURI(dbConfig.DSN),
 		options.Client().SetConnectTimeout(dbConfig.Timeout*time.Second),
 		options.Client().SetDirect(true),
+		options.Client().SetMonitor(newCommandMonitor()),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to mongodb: %q", err)
@@ -45,5 +57,37 @@ func NewMongoStorage(ctx context.Context, dbConfig *config.Database) (*Storage,
 		}
 	}
 
-	return &Storage{collections: collections}, nil
+	return &Storage{client: client, collections: collections}, nil
+}
+
+func checkResources(collections []*config.Collection) error {
+	configured := make(map[string]bool)
+	for _, coll := range collections {
+		configured[coll.Resource] = true
+	}
+
+	missing := make([]string, 0)
+	for _, resource := range resources {
+		if !configured[resource] {
+			missing = append(missing, resource)
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("no collection configured for resources: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// CheckHealth pings the server. It implements app.HealthChecker.
+func (s *Storage) CheckHealth(ctx context.Context) error {
+	if err := s.client.Ping(ctx, readpref.Nearest()); err != nil {
+		return fmt.Errorf("failed to ping mongodb: %q", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Close(ctx context.Context) error {
+	return s.client.Disconnect(ctx)
 }
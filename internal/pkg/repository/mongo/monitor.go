@@ -0,0 +1,72 @@
+package mongo
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+
+	"mikrotik_provisioning/internal/pkg/logging"
+)
+
+// newCommandMonitor logs every MongoDB command at debug level, with the logger of the calling request.
+// Only the collection and the keys of the filters are logged: commands carry signing keys, device
+// tokens and webhook secrets, in their documents as well as in their filters.
+func newCommandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			if l := logging.FromContext(ctx); l.Enabled(logging.DebugLevel) {
+				collection, keys := describeCommand(e.Command)
+				l.Debug("mongodb command started", "command", e.CommandName, "database", e.DatabaseName, "collection", collection, "filter_keys", strings.Join(keys, ","), "mongo_request_id", e.RequestID)
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			logging.FromContext(ctx).Debug("mongodb command succeeded", "command", e.CommandName, "mongo_request_id", e.RequestID, "duration", time.Duration(e.DurationNanos))
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			logging.FromContext(ctx).Debug("mongodb command failed", "command", e.CommandName, "mongo_request_id", e.RequestID, "duration", time.Duration(e.DurationNanos), "error", e.Failure)
+		},
+	}
+}
+
+// describeCommand returns the collection of a command, which is the value of its first element, and
+// the keys of its filters, without their values.
+func describeCommand(command bson.Raw) (string, []string) {
+	var collection string
+	if elements, err := command.Elements(); err == nil && len(elements) != 0 {
+		collection, _ = elements[0].Value().StringValueOK()
+	}
+
+	keys := make([]string, 0)
+	addKeys := func(filter bson.RawValue) {
+		doc, ok := filter.DocumentOK()
+		if !ok {
+			return
+		}
+		elements, _ := doc.Elements()
+		for _, element := range elements {
+			keys = append(keys, element.Key())
+		}
+	}
+
+	// find, count and findAndModify, then the statements of update and delete.
+	for _, name := range []string{"filter", "query"} {
+		addKeys(command.Lookup(name))
+	}
+	for _, name := range []string{"updates", "deletes"} {
+		statements, ok := command.Lookup(name).ArrayOK()
+		if !ok {
+			continue
+		}
+		values, _ := statements.Values()
+		for _, statement := range values {
+			if doc, ok := statement.DocumentOK(); ok {
+				addKeys(doc.Lookup("q"))
+			}
+		}
+	}
+
+	return collection, keys
+}
@@ -0,0 +1,68 @@
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type addressListChange struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument *AddressList `bson:"fullDocument"`
+}
+
+// WatchAddressLists calls notify with the name of every address list changed by any replica, until the
+// context is cancelled or the change stream fails. Change streams require a replica set.
+func (s *Storage) WatchAddressLists(ctx context.Context, notify func(name string)) error {
+	coll := s.collections["address-list"]
+
+	// Deleted documents are only identified by their ID, so names are remembered from earlier changes.
+	names := make(map[primitive.ObjectID]string)
+	cur, err := coll.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return err
+	}
+	for cur.Next(ctx) {
+		data := new(AddressList)
+		if err := cur.Decode(data); err != nil {
+			cur.Close(ctx)
+			return err
+		}
+		names[data.ID] = data.Name
+	}
+	cur.Close(ctx)
+
+	stream, err := coll.Watch(ctx, mongo.Pipeline{}, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		return err
+	}
+	defer stream.Close(ctx)
+
+	for stream.Next(ctx) {
+		change := new(addressListChange)
+		if err := stream.Decode(change); err != nil {
+			return err
+		}
+
+		id := change.DocumentKey.ID
+		if previous, ok := names[id]; ok && (change.FullDocument == nil || change.FullDocument.Name != previous) {
+			notify(previous)
+		}
+
+		if change.OperationType == "delete" || change.FullDocument == nil {
+			delete(names, id)
+			continue
+		}
+
+		names[id] = change.FullDocument.Name
+		notify(change.FullDocument.Name)
+	}
+
+	return stream.Err()
+}
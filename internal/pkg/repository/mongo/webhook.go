@@ -0,0 +1,200 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"mikrotik_provisioning/internal/pkg/audit"
+	"mikrotik_provisioning/internal/pkg/webhook"
+)
+
+type Webhook struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	URL       string             `bson:"url"`
+	Secret    string             `bson:"secret"`
+	Events    []string           `bson:"events,omitempty"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+type DeadLetter struct {
+	ID        string       `bson:"_id"`
+	WebhookID string       `bson:"webhook_id"`
+	URL       string       `bson:"url"`
+	Type      string       `bson:"type"`
+	Event     *audit.Event `bson:"event"`
+	Attempts  int          `bson:"attempts"`
+	LastError string       `bson:"last_error,omitempty"`
+	CreatedAt time.Time    `bson:"created_at"`
+	FailedAt  *time.Time   `bson:"failed_at,omitempty"`
+}
+
+func (wh *Webhook) ToWebhook() *webhook.Webhook {
+	return &webhook.Webhook{
+		ID:        wh.ID.Hex(),
+		URL:       wh.URL,
+		Secret:    wh.Secret,
+		Events:    wh.Events,
+		CreatedAt: wh.CreatedAt,
+	}
+}
+
+func (dl *DeadLetter) ToDelivery() *webhook.Delivery {
+	return &webhook.Delivery{
+		ID:        dl.ID,
+		WebhookID: dl.WebhookID,
+		URL:       dl.URL,
+		Type:      dl.Type,
+		Event:     dl.Event,
+		Attempts:  dl.Attempts,
+		LastError: dl.LastError,
+		CreatedAt: dl.CreatedAt,
+		FailedAt:  dl.FailedAt,
+	}
+}
+
+func (s *Storage) CreateWebhook(ctx context.Context, wh *webhook.Webhook) (*webhook.Webhook, error) {
+	res, err := s.collections["webhook"].InsertOne(ctx, &Webhook{
+		URL:       wh.URL,
+		Secret:    wh.Secret,
+		Events:    wh.Events,
+		CreatedAt: wh.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	wh.ID = res.InsertedID.(primitive.ObjectID).Hex()
+
+	return wh, nil
+}
+
+func (s *Storage) GetWebhooks(ctx context.Context) ([]*webhook.Webhook, error) {
+	cur, err := s.collections["webhook"].Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	result := make([]*webhook.Webhook, 0)
+	for cur.Next(ctx) {
+		data := new(Webhook)
+		if err := cur.Decode(data); err != nil {
+			return nil, err
+		}
+
+		result = append(result, data.ToWebhook())
+	}
+
+	return result, nil
+}
+
+func (s *Storage) GetWebhook(ctx context.Context, id string) (*webhook.Webhook, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := s.collections["webhook"].FindOne(ctx, bson.M{"_id": objectID})
+	if res.Err() != nil {
+		if res.Err().Error() == NoDocumentsError {
+			return nil, nil
+		}
+		return nil, res.Err()
+	}
+
+	data := new(Webhook)
+	if err := res.Decode(data); err != nil {
+		return nil, err
+	}
+
+	return data.ToWebhook(), nil
+}
+
+func (s *Storage) DeleteWebhook(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.collections["webhook"].DeleteOne(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return errors.New("failed deleting mongodb object")
+	}
+
+	return nil
+}
+
+func (s *Storage) CreateDeadLetter(ctx context.Context, delivery *webhook.Delivery) error {
+	_, err := s.collections["deadletter"].InsertOne(ctx, &DeadLetter{
+		ID:        delivery.ID,
+		WebhookID: delivery.WebhookID,
+		URL:       delivery.URL,
+		Type:      delivery.Type,
+		Event:     delivery.Event,
+		Attempts:  delivery.Attempts,
+		LastError: delivery.LastError,
+		CreatedAt: delivery.CreatedAt,
+		FailedAt:  delivery.FailedAt,
+	})
+
+	return err
+}
+
+func (s *Storage) GetDeadLetters(ctx context.Context) ([]*webhook.Delivery, error) {
+	cur, err := s.collections["deadletter"].Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"failed_at": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	result := make([]*webhook.Delivery, 0)
+	for cur.Next(ctx) {
+		data := new(DeadLetter)
+		if err := cur.Decode(data); err != nil {
+			return nil, err
+		}
+
+		result = append(result, data.ToDelivery())
+	}
+
+	return result, nil
+}
+
+func (s *Storage) GetDeadLetter(ctx context.Context, id string) (*webhook.Delivery, error) {
+	res := s.collections["deadletter"].FindOne(ctx, bson.M{"_id": id})
+	if res.Err() != nil {
+		if res.Err().Error() == NoDocumentsError {
+			return nil, nil
+		}
+		return nil, res.Err()
+	}
+
+	data := new(DeadLetter)
+	if err := res.Decode(data); err != nil {
+		return nil, err
+	}
+
+	return data.ToDelivery(), nil
+}
+
+func (s *Storage) DeleteDeadLetter(ctx context.Context, id string) error {
+	res, err := s.collections["deadletter"].DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return errors.New("failed deleting mongodb object")
+	}
+
+	return nil
+}
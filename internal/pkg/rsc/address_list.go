@@ -0,0 +1,473 @@
+package rsc
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// AddressListEntry is an /ip firewall address-list item.
+	AddressListEntry struct {
+		ID       ID
+		List     string
+		Address  string
+		Comment  string
+		Disabled bool
+		Dynamic  bool
+		Timeout  string
+	}
+
+	// AddressListTable is the in-memory /ip firewall address-list table.
+	AddressListTable struct {
+		entries []*AddressListEntry
+		nextID  int
+	}
+)
+
+func NewAddressListTable() *AddressListTable {
+	return &AddressListTable{entries: make([]*AddressListEntry, 0), nextID: 1}
+}
+
+// Add adds an entry, assigning it a new ID. Like RouterOS, it refuses a second entry with the same list and address.
+func (t *AddressListTable) Add(entry AddressListEntry) (*AddressListEntry, error) {
+	if entry.List == "" || entry.Address == "" {
+		return nil, fmt.Errorf("failure: list and address are required")
+	}
+
+	for _, e := range t.entries {
+		if e.List == entry.List && e.Address == entry.Address {
+			return nil, fmt.Errorf("failure: already have such entry")
+		}
+	}
+
+	entry.ID = ID("*" + strings.ToUpper(strconv.FormatInt(int64(t.nextID), 16)))
+	t.nextID++
+	t.entries = append(t.entries, &entry)
+
+	return &entry, nil
+}
+
+// Entries returns copies of all entries, in the order they were added.
+func (t *AddressListTable) Entries() []AddressListEntry {
+	entries := make([]AddressListEntry, 0, len(t.entries))
+	for _, e := range t.entries {
+		entries = append(entries, *e)
+	}
+
+	return entries
+}
+
+// Lists returns the static entries grouped by list name.
+func (t *AddressListTable) Lists() map[string][]AddressListEntry {
+	lists := make(map[string][]AddressListEntry)
+	for _, e := range t.entries {
+		if !e.Dynamic {
+			lists[e.List] = append(lists[e.List], *e)
+		}
+	}
+
+	return lists
+}
+
+// ListNames returns the sorted names of all lists with static entries.
+func (t *AddressListTable) ListNames() []string {
+	names := make([]string, 0)
+	for name := range t.Lists() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (t *AddressListTable) get(id ID) (*AddressListEntry, error) {
+	for _, e := range t.entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no such item")
+}
+
+func (t *AddressListTable) remove(id ID) error {
+	for i, e := range t.entries {
+		if e.ID == id {
+			t.entries = append(t.entries[:i], t.entries[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no such item")
+}
+
+func (e *AddressListEntry) property(name string) (Value, error) {
+	switch name {
+	case ".id":
+		return e.ID, nil
+	case "list":
+		return e.List, nil
+	case "address":
+		return e.Address, nil
+	case "comment":
+		return e.Comment, nil
+	case "disabled":
+		return e.Disabled, nil
+	case "dynamic":
+		return e.Dynamic, nil
+	case "timeout":
+		return e.Timeout, nil
+	default:
+		return nil, fmt.Errorf("unknown property %s", name)
+	}
+}
+
+func (e *AddressListEntry) setProperty(name string, value Value) error {
+	switch name {
+	case "list":
+		e.List = toString(value)
+	case "address":
+		e.Address = toString(value)
+	case "comment":
+		e.Comment = toString(value)
+	case "timeout":
+		e.Timeout = toString(value)
+	case "disabled":
+		disabled, err := toBool(value)
+		if err != nil {
+			return fmt.Errorf("disabled: %s", err)
+		}
+		e.Disabled = disabled
+	default:
+		return fmt.Errorf("unknown property %s", name)
+	}
+
+	return nil
+}
+
+func (in *Interpreter) execAddressListCommand(cmd *Command, sc *scope) (Value, error) {
+	positional, named, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	table := in.AddressLists
+	switch cmd.Name {
+	case "add":
+		entry := new(AddressListEntry)
+		for name, value := range named {
+			if err := entry.setProperty(name, value); err != nil {
+				return nil, err
+			}
+		}
+
+		added, err := table.Add(*entry)
+		if err != nil {
+			return nil, err
+		}
+		return added.ID, nil
+	case "find":
+		ids := make([]Value, 0)
+		for _, e := range table.entries {
+			matches := true
+			for name, value := range named {
+				property, err := e.property(name)
+				if err != nil {
+					return nil, err
+				}
+				if b, ok := property.(bool); ok {
+					want, err := toBool(value)
+					if err != nil {
+						return nil, err
+					}
+					matches = matches && b == want
+				} else {
+					matches = matches && toString(property) == toString(value)
+				}
+			}
+			if matches {
+				ids = append(ids, e.ID)
+			}
+		}
+		return NewArray(ids...), nil
+	case "get":
+		if len(positional) == 0 {
+			return nil, fmt.Errorf("get requires an item")
+		}
+		id, err := toID(positional[0])
+		if err != nil {
+			return nil, err
+		}
+		entry, err := table.get(id)
+		if err != nil {
+			return nil, err
+		}
+		if len(positional) < 2 {
+			return entryArray(entry), nil
+		}
+		return entry.property(toString(positional[1]))
+	}
+
+	ids, err := itemIDs(positional)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		switch cmd.Name {
+		case "remove":
+			err = table.remove(id)
+		case "set", "enable", "disable":
+			var entry *AddressListEntry
+			if entry, err = table.get(id); err != nil {
+				break
+			}
+			switch cmd.Name {
+			case "enable":
+				entry.Disabled = false
+			case "disable":
+				entry.Disabled = true
+			default:
+				for name, value := range named {
+					if err = entry.setProperty(name, value); err != nil {
+						break
+					}
+				}
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return Nothing{}, nil
+}
+
+func entryArray(e *AddressListEntry) *Array {
+	return NewArray().
+		With(".id", e.ID).
+		With("list", e.List).
+		With("address", e.Address).
+		With("comment", e.Comment).
+		With("disabled", e.Disabled).
+		With("dynamic", e.Dynamic).
+		With("timeout", e.Timeout)
+}
+
+// itemIDs flattens the item arguments of remove, set, enable and disable, which accept IDs and arrays of IDs.
+func itemIDs(values []Value) ([]ID, error) {
+	ids := make([]ID, 0)
+	for _, value := range values {
+		for _, item := range toArrayElement(value).Items() {
+			id, err := toID(item)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// execFetch implements /tool fetch with output=user and output=file, optionally as-value.
+func (in *Interpreter) execFetch(cmd *Command, sc *scope) (Value, error) {
+	positional, named, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.Fetch == nil {
+		return nil, fmt.Errorf("failure: fetching is not available")
+	}
+
+	url := toString(named["url"])
+	headers := make([]string, 0)
+	if header, ok := named["http-header-field"]; ok {
+		for _, h := range toArrayElement(header).Items() {
+			headers = append(headers, toString(h))
+		}
+	}
+
+	data, err := in.Fetch(url, headers)
+	if err != nil {
+		return nil, fmt.Errorf("failure: %s", err)
+	}
+
+	asValue := false
+	for _, flag := range positional {
+		if toString(flag) == "as-value" {
+			asValue = true
+		}
+	}
+
+	if toString(named["output"]) == "user" {
+		if asValue {
+			return NewArray().With("status", "finished").With("data", data), nil
+		}
+		in.Output.WriteString(data)
+		return Nothing{}, nil
+	}
+
+	name := toString(named["dst-path"])
+	if name == "" {
+		name = path.Base(strings.SplitN(url, "?", 2)[0])
+	}
+	in.Files[name] = data
+
+	if asValue {
+		return NewArray().With("status", "finished"), nil
+	}
+
+	return Nothing{}, nil
+}
+
+// execFileCommand implements /file find, get and remove. Files are identified by their name.
+func (in *Interpreter) execFileCommand(cmd *Command, sc *scope) (Value, error) {
+	positional, named, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cmd.Name {
+	case "find":
+		names := make([]string, 0)
+		for name := range in.Files {
+			if n, ok := named["name"]; !ok || toString(n) == name {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		ids := make([]Value, 0, len(names))
+		for _, name := range names {
+			ids = append(ids, ID("*"+name))
+		}
+		return NewArray(ids...), nil
+	case "get":
+		if len(positional) < 2 {
+			return nil, fmt.Errorf("get requires an item and a property")
+		}
+		name := strings.TrimPrefix(toString(positional[0]), "*")
+		contents, ok := in.Files[name]
+		if !ok {
+			return nil, fmt.Errorf("no such item")
+		}
+		switch toString(positional[1]) {
+		case "name":
+			return name, nil
+		case "contents":
+			return contents, nil
+		case "size":
+			return int64(len(contents)), nil
+		default:
+			return nil, fmt.Errorf("unknown property %s", toString(positional[1]))
+		}
+	default:
+		ids, err := itemIDs(positional)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			delete(in.Files, strings.TrimPrefix(string(id), "*"))
+		}
+		return Nothing{}, nil
+	}
+}
+
+// execScriptCommand implements /system script add, find, get and remove. Scripts are identified by their
+// name and only hold their source, they cannot be run.
+func (in *Interpreter) execScriptCommand(cmd *Command, sc *scope) (Value, error) {
+	positional, named, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cmd.Name {
+	case "add":
+		name := toString(named["name"])
+		if name == "" {
+			return nil, fmt.Errorf("failure: name is required")
+		}
+		if _, ok := in.Scripts[name]; ok {
+			return nil, fmt.Errorf("failure: script with such name already exists")
+		}
+		in.Scripts[name] = toString(named["source"])
+		return ID("*" + name), nil
+	case "find":
+		names := make([]string, 0)
+		for name := range in.Scripts {
+			if n, ok := named["name"]; !ok || toString(n) == name {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		ids := make([]Value, 0, len(names))
+		for _, name := range names {
+			ids = append(ids, ID("*"+name))
+		}
+		return NewArray(ids...), nil
+	case "get":
+		if len(positional) < 2 {
+			return nil, fmt.Errorf("get requires an item and a property")
+		}
+		ids, err := itemIDs(positional[:1])
+		if err != nil || len(ids) != 1 {
+			return nil, fmt.Errorf("no such item")
+		}
+		name := strings.TrimPrefix(string(ids[0]), "*")
+		source, ok := in.Scripts[name]
+		if !ok {
+			return nil, fmt.Errorf("no such item")
+		}
+		switch toString(positional[1]) {
+		case "name":
+			return name, nil
+		case "source":
+			return source, nil
+		default:
+			return nil, fmt.Errorf("unknown property %s", toString(positional[1]))
+		}
+	case "remove":
+		ids, err := itemIDs(positional)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			delete(in.Scripts, strings.TrimPrefix(string(id), "*"))
+		}
+		return Nothing{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported command /system script %s", cmd.Name)
+	}
+}
+
+// execImport runs a file as a separate script, which does not share local variables with the caller.
+func (in *Interpreter) execImport(cmd *Command, sc *scope) (Value, error) {
+	_, named, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	name := toString(named["file-name"])
+	contents, ok := in.Files[name]
+	if !ok {
+		return nil, fmt.Errorf("failure: no such file %s", name)
+	}
+
+	body, err := Parse(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failure: %s: %s", name, err)
+	}
+
+	if _, err := in.execBody(body, newScope(in.globals)); err != nil {
+		return nil, fmt.Errorf("failure: %s: %s", name, err)
+	}
+
+	return Nothing{}, nil
+}
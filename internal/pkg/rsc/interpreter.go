@@ -0,0 +1,998 @@
+package rsc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const DefaultMaxSteps = 10000000
+
+type (
+	// Interpreter executes scripts against an in-memory router state.
+	Interpreter struct {
+		AddressLists *AddressListTable
+		Files        map[string]string
+		Scripts      map[string]string
+		Logs         []*LogEntry
+		Output       strings.Builder
+
+		// Fetch serves /tool fetch requests. Fetching fails if it is not set.
+		Fetch func(url string, headers []string) (string, error)
+
+		// MaxSteps limits the number of executed commands, so broken loops fail instead of hanging.
+		MaxSteps int
+
+		steps   int
+		globals *scope
+	}
+
+	LogEntry struct {
+		Topic   string
+		Message string
+	}
+
+	scope struct {
+		vars   map[string]Value
+		parent *scope
+	}
+
+	builtin func(in *Interpreter, cmd *Command, sc *scope) (Value, error)
+
+	// returnSignal unwinds the stack up to the function call on :return.
+	returnSignal struct {
+		value Value
+	}
+)
+
+var ErrMaxSteps = errors.New("maximum number of steps exceeded")
+
+var builtins map[string]builtin
+
+func init() {
+	builtins = map[string]builtin{
+		"":        execBlockCommand,
+		"delay":   execDelay,
+		"do":      execDo,
+		"error":   execError,
+		"find":    execFind,
+		"for":     execFor,
+		"foreach": execForeach,
+		"global":  execGlobal,
+		"if":      execIf,
+		"len":     execLen,
+		"local":   execLocal,
+		"log":     execLog,
+		"parse":   execParse,
+		"pick":    execPick,
+		"put":     execPut,
+		"return":  execReturn,
+		"set":     execSet,
+		"toarray": execToArray,
+		"tobool":  execToBool,
+		"tonum":   execToNum,
+		"tostr":   execToStr,
+		"typeof":  execTypeOf,
+	}
+}
+
+func NewInterpreter() *Interpreter {
+	return &Interpreter{
+		AddressLists: NewAddressListTable(),
+		Files:        make(map[string]string),
+		Scripts:      make(map[string]string),
+		MaxSteps:     DefaultMaxSteps,
+		globals:      newScope(nil),
+	}
+}
+
+func (r *returnSignal) Error() string {
+	return ":return outside of function"
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{vars: make(map[string]Value), parent: parent}
+}
+
+func (s *scope) lookup(name string) (*scope, bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		if _, ok := sc.vars[name]; ok {
+			return sc, true
+		}
+	}
+
+	return nil, false
+}
+
+// Run parses and executes a script. Errors not handled by on-error are returned as *Error.
+func (in *Interpreter) Run(src string) error {
+	body, err := Parse(src)
+	if err != nil {
+		return err
+	}
+
+	_, err = in.execBody(body, newScope(in.globals))
+	var ret *returnSignal
+	if errors.As(err, &ret) {
+		return nil
+	}
+
+	return err
+}
+
+func (in *Interpreter) fail(cmd *Command, format string, args ...interface{}) error {
+	return &Error{Line: cmd.Line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (in *Interpreter) execBody(body []*Command, sc *scope) (Value, error) {
+	var result Value = Nothing{}
+	for _, cmd := range body {
+		value, err := in.exec(cmd, sc)
+		if err != nil {
+			return nil, err
+		}
+		result = value
+	}
+
+	return result, nil
+}
+
+func (in *Interpreter) exec(cmd *Command, sc *scope) (Value, error) {
+	in.steps++
+	if in.MaxSteps > 0 && in.steps > in.MaxSteps {
+		return nil, ErrMaxSteps
+	}
+
+	var value Value
+	var err error
+	switch {
+	case cmd.Call != nil:
+		value, err = in.execCall(cmd, sc)
+	case cmd.Path != nil:
+		value, err = in.execMenuCommand(cmd, sc)
+	default:
+		fn, ok := builtins[cmd.Name]
+		if !ok {
+			return nil, in.fail(cmd, "unknown command :%s", cmd.Name)
+		}
+		value, err = fn(in, cmd, sc)
+	}
+
+	return value, wrapError(cmd, err)
+}
+
+// wrapError attaches the line of the command to plain runtime errors, so on-error can handle them.
+func wrapError(cmd *Command, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var scriptErr *Error
+	var ret *returnSignal
+	if errors.As(err, &scriptErr) || errors.As(err, &ret) || errors.Is(err, ErrMaxSteps) {
+		return err
+	}
+
+	return &Error{Line: cmd.Line, Msg: err.Error()}
+}
+
+func (in *Interpreter) execMenuCommand(cmd *Command, sc *scope) (Value, error) {
+	switch strings.Join(cmd.Path, " ") {
+	case "ip firewall address-list":
+		return in.execAddressListCommand(cmd, sc)
+	case "tool":
+		return in.execFetch(cmd, sc)
+	case "file":
+		return in.execFileCommand(cmd, sc)
+	case "system script":
+		return in.execScriptCommand(cmd, sc)
+	case "":
+		return in.execImport(cmd, sc)
+	default:
+		return nil, in.fail(cmd, "unsupported menu /%s", strings.Join(cmd.Path, " "))
+	}
+}
+
+// execCall calls a function. Functions only see global variables and their arguments,
+// positional arguments are available as $1, $2 and so on.
+func (in *Interpreter) execCall(cmd *Command, sc *scope) (Value, error) {
+	callee, err := in.eval(cmd.Call, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, ok := callee.(*Function)
+	if !ok {
+		return nil, in.fail(cmd, "%s is not a function", typeOf(callee))
+	}
+
+	fnScope := newScope(in.globals)
+	position := 1
+	for _, arg := range cmd.Args {
+		value, err := in.eval(arg.Value, sc)
+		if err != nil {
+			return nil, err
+		}
+
+		if arg.Name == "" {
+			fnScope.vars[strconv.Itoa(position)] = value
+			position++
+		} else {
+			fnScope.vars[arg.Name] = value
+		}
+	}
+
+	result, err := in.execBody(fn.Body, fnScope)
+	var ret *returnSignal
+	if errors.As(err, &ret) {
+		return ret.value, nil
+	}
+
+	return result, err
+}
+
+func (in *Interpreter) runBlock(value Value, cmd *Command, sc *scope) (Value, error) {
+	fn, ok := value.(*Function)
+	if !ok {
+		return nil, in.fail(cmd, "expected code block, got %s", typeOf(value))
+	}
+
+	return in.execBody(fn.Body, newScope(sc))
+}
+
+// args evaluates the arguments of a command, skipping the first skip positional ones.
+func (in *Interpreter) args(cmd *Command, sc *scope, skip int) ([]Value, map[string]Value, error) {
+	positional := make([]Value, 0)
+	named := make(map[string]Value)
+
+	for _, arg := range cmd.Args {
+		if arg.Name == "" && skip > 0 {
+			skip--
+			continue
+		}
+
+		value, err := in.eval(arg.Value, sc)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if arg.Name == "" {
+			positional = append(positional, value)
+		} else {
+			named[arg.Name] = value
+		}
+	}
+
+	return positional, named, nil
+}
+
+func (in *Interpreter) eval(expr Expr, sc *scope) (Value, error) {
+	switch x := expr.(type) {
+	case *Literal:
+		return x.Value, nil
+	case *VarRef:
+		s, ok := sc.lookup(x.Name)
+		if !ok {
+			return nil, &Error{Line: x.Line, Msg: "undefined variable $" + x.Name}
+		}
+		return s.vars[x.Name], nil
+	case *Interpolation:
+		var b strings.Builder
+		for _, part := range x.Parts {
+			value, err := in.eval(part, sc)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(toString(value))
+		}
+		return b.String(), nil
+	case *Unary:
+		return in.evalUnary(x, sc)
+	case *Binary:
+		return in.evalBinary(x, sc)
+	case *Index:
+		array, err := in.eval(x.X, sc)
+		if err != nil {
+			return nil, err
+		}
+		key, err := in.eval(x.Key, sc)
+		if err != nil {
+			return nil, err
+		}
+		if a, ok := array.(*Array); ok {
+			return a.Get(key), nil
+		}
+		return Nothing{}, nil
+	case *ArrayLiteral:
+		array := NewArray()
+		for _, element := range x.Elements {
+			value, err := in.eval(element.Value, sc)
+			if err != nil {
+				return nil, err
+			}
+
+			if element.Key == nil {
+				array = array.Concat(NewArray(value))
+				continue
+			}
+
+			key, err := in.eval(element.Key, sc)
+			if err != nil {
+				return nil, err
+			}
+			array = array.With(toString(key), value)
+		}
+		return array, nil
+	case *Substitution:
+		return in.exec(x.Command, sc)
+	case *Block:
+		return &Function{Body: x.Body}, nil
+	default:
+		return nil, fmt.Errorf("unsupported expression %T", expr)
+	}
+}
+
+func (in *Interpreter) evalUnary(x *Unary, sc *scope) (Value, error) {
+	value, err := in.eval(x.X, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x.Op {
+	case "!":
+		b, err := toBool(value)
+		if err != nil {
+			return nil, err
+		}
+		return !b, nil
+	case "~":
+		n, err := toNum(value)
+		if err != nil {
+			return nil, err
+		}
+		return ^n, nil
+	default:
+		n, err := toNum(value)
+		if err != nil {
+			return nil, err
+		}
+		return -n, nil
+	}
+}
+
+func (in *Interpreter) evalBinary(x *Binary, sc *scope) (Value, error) {
+	left, err := in.eval(x.X, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x.Op {
+	case "&&", "||":
+		l, err := toBool(left)
+		if err != nil {
+			return nil, err
+		}
+		if (x.Op == "&&" && !l) || (x.Op == "||" && l) {
+			return l, nil
+		}
+		right, err := in.eval(x.Y, sc)
+		if err != nil {
+			return nil, err
+		}
+		return toBool(right)
+	}
+
+	right, err := in.eval(x.Y, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x.Op {
+	case ",":
+		return toArrayElement(left).Concat(toArrayElement(right)), nil
+	case ".":
+		la, lok := left.(*Array)
+		ra, rok := right.(*Array)
+		switch {
+		case lok && rok:
+			return la.Concat(ra), nil
+		case lok:
+			return la.Concat(NewArray(right)), nil
+		case rok:
+			return NewArray(left).Concat(ra), nil
+		}
+		return toString(left) + toString(right), nil
+	case "=":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "<", ">", "<=", ">=":
+		return compare(x.Op, left, right)
+	}
+
+	l, err := toNum(left)
+	if err != nil {
+		return nil, err
+	}
+	r, err := toNum(right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x.Op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/", "%":
+		if r == 0 {
+			return nil, errors.New("division by zero")
+		}
+		if x.Op == "/" {
+			return l / r, nil
+		}
+		return l % r, nil
+	case "&":
+		return l & r, nil
+	case "|":
+		return l | r, nil
+	case "^":
+		return l ^ r, nil
+	case "<<":
+		return l << uint64(r), nil
+	case ">>":
+		return l >> uint64(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported operator %s", x.Op)
+	}
+}
+
+func toArrayElement(v Value) *Array {
+	if a, ok := v.(*Array); ok {
+		return a
+	}
+
+	return NewArray(v)
+}
+
+func compare(op string, left, right Value) (Value, error) {
+	var c int
+	if l, ok := left.(int64); ok {
+		r, err := toNum(right)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case l < r:
+			c = -1
+		case l > r:
+			c = 1
+		}
+	} else {
+		c = strings.Compare(toString(left), toString(right))
+	}
+
+	switch op {
+	case "<":
+		return c < 0, nil
+	case ">":
+		return c > 0, nil
+	case "<=":
+		return c <= 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func execBlockCommand(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	block, err := in.eval(cmd.Args[0].Value, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	return in.runBlock(block, cmd, sc)
+}
+
+func execDelay(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	return Nothing{}, nil
+}
+
+// execDo runs :do {...} on-error={...}. Runtime errors are caught, :return is not.
+func execDo(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	if len(cmd.Args) == 0 || cmd.Args[0].Name != "" {
+		return nil, in.fail(cmd, ":do requires a code block")
+	}
+
+	body, err := in.eval(cmd.Args[0].Value, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := in.runBlock(body, cmd, sc)
+	if err == nil {
+		return result, nil
+	}
+
+	var scriptErr *Error
+	if !errors.As(err, &scriptErr) {
+		return nil, err
+	}
+
+	for _, arg := range cmd.Args[1:] {
+		if arg.Name != "on-error" {
+			continue
+		}
+
+		handler, err := in.eval(arg.Value, sc)
+		if err != nil {
+			return nil, err
+		}
+		_, err = in.runBlock(handler, cmd, sc)
+		return Nothing{}, err
+	}
+
+	return nil, err
+}
+
+func execError(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	message := ""
+	if len(positional) > 0 {
+		message = toString(positional[0])
+	}
+
+	return nil, in.fail(cmd, "%s", message)
+}
+
+func execFor(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	name, err := in.argName(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	_, named, err := in.args(cmd, sc, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := toNum(named["from"])
+	if err != nil {
+		return nil, in.fail(cmd, ":for from: %s", err)
+	}
+	to, err := toNum(named["to"])
+	if err != nil {
+		return nil, in.fail(cmd, ":for to: %s", err)
+	}
+
+	step := int64(1)
+	if from > to {
+		step = -1
+	}
+	if s, ok := named["step"]; ok {
+		if step, err = toNum(s); err != nil || step == 0 {
+			return nil, in.fail(cmd, ":for step must be a non-zero number")
+		}
+	}
+
+	for i := from; (step > 0 && i <= to) || (step < 0 && i >= to); i += step {
+		loopScope := newScope(sc)
+		loopScope.vars[name] = i
+		if _, err := in.runBlock(named["do"], cmd, loopScope); err != nil {
+			return nil, err
+		}
+	}
+
+	return Nothing{}, nil
+}
+
+func execForeach(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	names, err := in.argName(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	_, named, err := in.args(cmd, sc, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	keyName, valueName := "", names
+	if i := strings.Index(names, ","); i > -1 {
+		keyName, valueName = names[:i], names[i+1:]
+	}
+
+	return Nothing{}, toArray(named["in"]).each(func(key, value Value) error {
+		loopScope := newScope(sc)
+		if keyName != "" {
+			loopScope.vars[keyName] = key
+		}
+		loopScope.vars[valueName] = value
+
+		_, err := in.runBlock(named["do"], cmd, loopScope)
+		return err
+	})
+}
+
+func execGlobal(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	return declare(in, cmd, sc, in.globals)
+}
+
+func execLocal(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	return declare(in, cmd, sc, sc)
+}
+
+func declare(in *Interpreter, cmd *Command, sc *scope, target *scope) (Value, error) {
+	name, err := in.argName(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	positional, named, err := in.args(cmd, sc, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var value Value = Nil{}
+	fn, isFunction := named["do"]
+	switch {
+	case len(positional) > 0:
+		value = positional[0]
+	case isFunction:
+		value = fn
+	case target == in.globals:
+		// Declaring a global without a value refers to it, which is how scripts use globals set elsewhere.
+		if existing, ok := target.vars[name]; ok {
+			value = existing
+		}
+	}
+	target.vars[name] = value
+
+	return Nothing{}, nil
+}
+
+func execIf(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(positional) == 0 {
+		return nil, in.fail(cmd, ":if requires a condition")
+	}
+
+	condition, err := toBool(positional[0])
+	if err != nil {
+		return nil, in.fail(cmd, ":if condition: %s", err)
+	}
+
+	branch := "do"
+	if !condition {
+		branch = "else"
+	}
+
+	for _, arg := range cmd.Args {
+		if arg.Name == branch {
+			block, err := in.eval(arg.Value, sc)
+			if err != nil {
+				return nil, err
+			}
+			return in.runBlock(block, cmd, sc)
+		}
+	}
+
+	return Nothing{}, nil
+}
+
+func execLen(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil || len(positional) == 0 {
+		return int64(0), err
+	}
+
+	switch v := positional[0].(type) {
+	case *Array:
+		return int64(v.Len()), nil
+	case Nil, Nothing:
+		return int64(0), nil
+	default:
+		return int64(len(toString(v))), nil
+	}
+}
+
+func execLog(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(positional) != 2 {
+		return nil, in.fail(cmd, ":log requires a topic and a message")
+	}
+	in.Logs = append(in.Logs, &LogEntry{Topic: toString(positional[0]), Message: toString(positional[1])})
+
+	return Nothing{}, nil
+}
+
+func execParse(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(positional) == 0 {
+		return nil, in.fail(cmd, ":parse requires a script")
+	}
+
+	body, err := Parse(toString(positional[0]))
+	if err != nil {
+		return nil, in.fail(cmd, "failed to parse script: %s", err)
+	}
+
+	return &Function{Body: body}, nil
+}
+
+func execPick(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(positional) < 2 {
+		return nil, in.fail(cmd, ":pick requires a value and a start position")
+	}
+
+	start, err := toNum(positional[1])
+	if err != nil {
+		return nil, in.fail(cmd, ":pick start: %s", err)
+	}
+
+	if array, ok := positional[0].(*Array); ok {
+		items := array.Items()
+		if len(positional) < 3 {
+			return array.Get(start), nil
+		}
+
+		end, err := toNum(positional[2])
+		if err != nil {
+			return nil, in.fail(cmd, ":pick end: %s", err)
+		}
+		from, to := clamp(start, end, len(items))
+		return NewArray(items[from:to]...), nil
+	}
+
+	s := toString(positional[0])
+	end := start + 1
+	if len(positional) > 2 {
+		if end, err = toNum(positional[2]); err != nil {
+			return nil, in.fail(cmd, ":pick end: %s", err)
+		}
+	}
+	from, to := clamp(start, end, len(s))
+
+	return s[from:to], nil
+}
+
+func clamp(start, end int64, length int) (int, int) {
+	if start < 0 {
+		start = 0
+	}
+	if end > int64(length) {
+		end = int64(length)
+	}
+	if start > end {
+		return 0, 0
+	}
+
+	return int(start), int(end)
+}
+
+func execFind(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(positional) < 2 {
+		return nil, in.fail(cmd, ":find requires a value and a substring")
+	}
+
+	start := int64(-1)
+	if len(positional) > 2 {
+		if start, err = toNum(positional[2]); err != nil {
+			return nil, in.fail(cmd, ":find start: %s", err)
+		}
+	}
+
+	if array, ok := positional[0].(*Array); ok {
+		for i, item := range array.Items() {
+			if int64(i) > start && equal(item, positional[1]) {
+				return int64(i), nil
+			}
+		}
+		return Nil{}, nil
+	}
+
+	s := toString(positional[0])
+	from := int(start + 1)
+	if from > len(s) {
+		return Nil{}, nil
+	}
+	if i := strings.Index(s[from:], toString(positional[1])); i > -1 {
+		return int64(from + i), nil
+	}
+
+	return Nil{}, nil
+}
+
+func execPut(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, value := range positional {
+		in.Output.WriteString(toString(value))
+	}
+	in.Output.WriteString("\n")
+
+	return Nothing{}, nil
+}
+
+func execReturn(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var value Value = Nothing{}
+	if len(positional) > 0 {
+		value = positional[0]
+	}
+
+	return nil, &returnSignal{value: value}
+}
+
+// execSet assigns a variable, or an array element with :set ($array->"key") value.
+func execSet(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	if len(cmd.Args) == 0 || cmd.Args[0].Name != "" {
+		return nil, in.fail(cmd, ":set requires a variable")
+	}
+
+	positional, _, err := in.args(cmd, sc, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var value Value = Nil{}
+	if len(positional) > 0 {
+		value = positional[0]
+	}
+
+	keys := make([]Value, 0)
+	target := cmd.Args[0].Value
+	for {
+		index, ok := target.(*Index)
+		if !ok {
+			break
+		}
+		key, err := in.eval(index.Key, sc)
+		if err != nil {
+			return nil, err
+		}
+		keys = append([]Value{key}, keys...)
+		target = index.X
+	}
+
+	var name string
+	switch t := target.(type) {
+	case *VarRef:
+		name = t.Name
+	case *Literal:
+		name = toString(t.Value)
+	default:
+		return nil, in.fail(cmd, ":set requires a variable")
+	}
+
+	s, ok := sc.lookup(name)
+	if !ok {
+		return nil, in.fail(cmd, "undefined variable $%s", name)
+	}
+	s.vars[name] = setIn(s.vars[name], keys, value)
+
+	return Nothing{}, nil
+}
+
+func setIn(container Value, keys []Value, value Value) Value {
+	if len(keys) == 0 {
+		return value
+	}
+
+	array, ok := container.(*Array)
+	if !ok {
+		array = NewArray()
+	}
+
+	return array.With(keys[0], setIn(array.Get(keys[0]), keys[1:], value))
+}
+
+func execToArray(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil || len(positional) == 0 {
+		return NewArray(), err
+	}
+
+	return toArray(positional[0]), nil
+}
+
+func execToBool(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil || len(positional) == 0 {
+		return Nil{}, err
+	}
+
+	if b, err := toBool(positional[0]); err == nil {
+		return b, nil
+	}
+
+	return Nil{}, nil
+}
+
+func execToNum(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil || len(positional) == 0 {
+		return Nil{}, err
+	}
+
+	if n, err := toNum(positional[0]); err == nil {
+		return n, nil
+	}
+
+	return Nil{}, nil
+}
+
+func execToStr(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil || len(positional) == 0 {
+		return "", err
+	}
+
+	return toString(positional[0]), nil
+}
+
+func execTypeOf(in *Interpreter, cmd *Command, sc *scope) (Value, error) {
+	positional, _, err := in.args(cmd, sc, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(positional) == 0 {
+		return "nothing", nil
+	}
+
+	return typeOf(positional[0]), nil
+}
+
+// argName returns the first positional argument of a command as a variable name.
+func (in *Interpreter) argName(cmd *Command) (string, error) {
+	if len(cmd.Args) == 0 || cmd.Args[0].Name != "" {
+		return "", in.fail(cmd, ":%s requires a variable name", cmd.Name)
+	}
+
+	switch v := cmd.Args[0].Value.(type) {
+	case *Literal:
+		if name, ok := v.Value.(string); ok && name != "" {
+			return name, nil
+		}
+	case *VarRef:
+		return v.Name, nil
+	}
+
+	return "", in.fail(cmd, ":%s requires a variable name", cmd.Name)
+}
@@ -0,0 +1,158 @@
+package rsc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{name: "arithmetic", src: ":put (1 + 2 * 3); :put (7 / 2); :put (7 % 2); :put (-3 - 1)", want: "7\n3\n1\n-4\n"},
+		{name: "concatenation", src: `:put ("office" . "-" . 1)`, want: "office-1\n"},
+		{name: "comparison", src: `:put (2 > 1 && "a" = "a"); :put (1 != 1 || false)`, want: "true\nfalse\n"},
+		{name: "interpolation", src: ":local name office; :put \"list $name\\_ok\"", want: "list office ok\n"},
+		{name: "local scope", src: ":local a 1; { :local a 2; :put $a }; :put $a", want: "2\n1\n"},
+		{name: "set", src: ":local a 1; { :set a 2 }; :put $a", want: "2\n"},
+		{name: "global", src: ":global g 5; { :global g; :put $g }; :global u; :put [:typeof $u]", want: "5\nnil\n"},
+		{name: "if", src: ":if (3 > 2) do={ :put yes } else={ :put no }; :if (false) do={ :put yes } else={ :put no }", want: "yes\nno\n"},
+		{name: "for", src: ":for i from=1 to=3 do={ :put $i }", want: "1\n2\n3\n"},
+		{name: "foreach", src: ":foreach k,v in={b=2; a=1} do={ :put \"$k=$v\" }", want: "a=1\nb=2\n"},
+		{name: "arrays", src: ":local a {1; 2}; :set ($a->2) 3; :put $a; :put [:len $a]; :put ($a->0)", want: "1;2;3\n3\n1\n"},
+		{name: "arrays are values", src: ":local a {x=1}; :local b $a; :set ($b->\"x\") 2; :put ($a->\"x\")", want: "1\n"},
+		{name: "function", src: ":local double do={ :return ($x * 2) }; :put [$double x=21]", want: "42\n"},
+		{name: "parse", src: ":local f [:parse \":put parsed\"]; $f", want: "parsed\n"},
+		{name: "on-error", src: ":do { :error boom; :put unreachable } on-error={ :put caught }", want: "caught\n"},
+		{name: "pick and find", src: `:put [:pick "office" 1 3]; :put [:find "office" "f"]; :put [:typeof [:find "office" "x"]]`, want: "ff\n1\nnil\n"},
+		{name: "conversions", src: `:put [:tonum "0x10"]; :put [:typeof [:tostr 1]]; :put [:tobool "yes"]; :put [:toarray "a,b"]`, want: "16\nstr\ntrue\na;b\n"},
+		{name: "typeof", src: ":local n; :put [:typeof $n]; :put [:typeof *1]; :put [:typeof {}]", want: "nil\nid\narray\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := NewInterpreter()
+			if err := in.Run(tt.src); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if got := in.Output.String(); got != tt.want {
+				t.Errorf("Run() output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		wantLine int
+		wantMsg  string
+	}{
+		{name: "error", src: ":put 1\n:error \"boom\"", wantLine: 2, wantMsg: "boom"},
+		{name: "unhandled in block", src: ":if (true) do={\n  :error \"boom\"\n}", wantLine: 2, wantMsg: "boom"},
+		{name: "not a number", src: ":put (1 + \"a\")", wantLine: 1, wantMsg: `parsing "a"`},
+		{name: "duplicate entry", src: "/ip firewall address-list\nadd list=office address=10.0.0.1\nadd list=office address=10.0.0.1", wantLine: 3, wantMsg: "already have such entry"},
+		{name: "no such file", src: "/import file-name=office.rsc", wantLine: 1, wantMsg: "no such file office.rsc"},
+		{name: "fetch unavailable", src: "/tool fetch url=\"https://example.com/office.rsc\"", wantLine: 1, wantMsg: "fetching is not available"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewInterpreter().Run(tt.src)
+
+			var scriptErr *Error
+			if !errors.As(err, &scriptErr) {
+				t.Fatalf("Run() error = %v, want *Error", err)
+			}
+			if scriptErr.Line != tt.wantLine || !strings.Contains(scriptErr.Msg, tt.wantMsg) {
+				t.Errorf("Run() error = %v, want line %d: %s", err, tt.wantLine, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestRunStopsAfterMaxSteps(t *testing.T) {
+	in := NewInterpreter()
+	in.MaxSteps = 100
+
+	if err := in.Run(":for i from=1 to=1000 do={ :put $i }"); !errors.Is(err, ErrMaxSteps) {
+		t.Errorf("Run() error = %v, want %v", err, ErrMaxSteps)
+	}
+}
+
+func TestRunAddressListCommands(t *testing.T) {
+	in := NewInterpreter()
+	src := `/ip firewall address-list
+add list=office address=10.0.0.1 comment=gateway
+add list=office address=10.0.0.2
+add list=lab address=10.1.0.1
+:put [get ([find address=10.0.0.1]->0) comment]
+disable [find list=office address=10.0.0.2]
+set [find list=lab] comment=bench
+remove [find list=office address=10.0.0.1]
+:put [:len [find disabled=yes]]`
+	if err := in.Run(src); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if got, want := in.Output.String(), "gateway\n1\n"; got != want {
+		t.Errorf("Run() output = %q, want %q", got, want)
+	}
+
+	got := make([]string, 0)
+	for _, e := range in.AddressLists.Entries() {
+		got = append(got, fmt.Sprintf("%s %s %q %v", e.List, e.Address, e.Comment, e.Disabled))
+	}
+	want := []string{`office 10.0.0.2 "" true`, `lab 10.1.0.1 "bench" false`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+}
+
+func TestRunFetchAndImport(t *testing.T) {
+	in := NewInterpreter()
+	var fetched []string
+	in.Fetch = func(url string, headers []string) (string, error) {
+		fetched = append(fetched, url+" "+strings.Join(headers, ","))
+		if strings.HasSuffix(url, "missing.rsc") {
+			return "", fmt.Errorf("status 404")
+		}
+		return ":global imported true; :local shadow 1", nil
+	}
+
+	src := `/tool fetch url="https://example.com/office.rsc?format=rsc" http-header-field="Authorization: Bearer t"
+/import file-name=office.rsc
+:global imported
+:put $imported
+:do { :put $shadow } on-error={ :put "locals stay in the import" }
+:do { /tool fetch url="https://example.com/missing.rsc" } on-error={ :put failed }
+:local result [/tool fetch url="https://example.com/office.rsc" output=user as-value]
+:put [:len ($result->"data")]`
+	if errs := Lint(src); len(errs) != 1 || !strings.Contains(errs[0].Error(), "shadow") {
+		t.Errorf("Lint() = %v, want only the variable local to the import", errs)
+	}
+	if err := in.Run(src); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if got, want := in.Output.String(), "true\nlocals stay in the import\nfailed\n38\n"; got != want {
+		t.Errorf("Run() output = %q, want %q", got, want)
+	}
+	wantFetched := []string{
+		"https://example.com/office.rsc?format=rsc Authorization: Bearer t",
+		"https://example.com/missing.rsc ",
+		"https://example.com/office.rsc ",
+	}
+	if !reflect.DeepEqual(fetched, wantFetched) {
+		t.Errorf("fetched = %q, want %q", fetched, wantFetched)
+	}
+	if _, ok := in.Files["office.rsc"]; !ok || len(in.Files) != 1 {
+		t.Errorf("files = %v, want office.rsc", in.Files)
+	}
+}
@@ -0,0 +1,170 @@
+package rsc
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	linter struct {
+		errs    []error
+		globals *lintScope
+	}
+
+	lintScope struct {
+		names    map[string]bool
+		parent   *lintScope
+		function bool
+	}
+)
+
+// Lint parses a script and reports unknown commands and variables used before they are declared.
+// Functions accept arbitrary named arguments, so undeclared variables are not reported inside them.
+func Lint(src string) []error {
+	body, err := Parse(src)
+	if err != nil {
+		return []error{err}
+	}
+
+	l := &linter{errs: make([]error, 0), globals: newLintScope(nil, false)}
+	l.body(body, newLintScope(l.globals, false))
+
+	return l.errs
+}
+
+func newLintScope(parent *lintScope, function bool) *lintScope {
+	return &lintScope{names: make(map[string]bool), parent: parent, function: function}
+}
+
+func (s *lintScope) defined(name string) bool {
+	for sc := s; sc != nil; sc = sc.parent {
+		if sc.names[name] || sc.function {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *linter) fail(line int, format string, args ...interface{}) {
+	l.errs = append(l.errs, &Error{Line: line, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) body(body []*Command, sc *lintScope) {
+	for _, cmd := range body {
+		l.command(cmd, sc)
+	}
+}
+
+func (l *linter) command(cmd *Command, sc *lintScope) {
+	if cmd.Call != nil || cmd.Path != nil {
+		if cmd.Call != nil {
+			l.expr(cmd.Call, cmd.Line, sc)
+		}
+		l.args(cmd.Args, cmd.Line, sc)
+		return
+	}
+
+	if _, ok := builtins[cmd.Name]; !ok {
+		l.fail(cmd.Line, "unknown command :%s", cmd.Name)
+		return
+	}
+
+	switch cmd.Name {
+	case "local", "global":
+		name := lintArgName(cmd)
+		if name == "" {
+			l.fail(cmd.Line, ":%s requires a variable name", cmd.Name)
+			return
+		}
+
+		target := sc
+		if cmd.Name == "global" {
+			target = l.globals
+		}
+		for _, arg := range cmd.Args[1:] {
+			if block, ok := arg.Value.(*Block); ok && arg.Name == "do" {
+				target.names[name] = true
+				l.body(block.Body, newLintScope(l.globals, true))
+				continue
+			}
+			l.expr(arg.Value, cmd.Line, sc)
+		}
+		target.names[name] = true
+	case "for", "foreach":
+		names := lintArgName(cmd)
+		if names == "" {
+			l.fail(cmd.Line, ":%s requires a variable name", cmd.Name)
+			return
+		}
+
+		loopScope := newLintScope(sc, false)
+		for _, name := range strings.Split(names, ",") {
+			loopScope.names[name] = true
+		}
+		for _, arg := range cmd.Args[1:] {
+			if block, ok := arg.Value.(*Block); ok && arg.Name == "do" {
+				l.body(block.Body, loopScope)
+				continue
+			}
+			l.expr(arg.Value, cmd.Line, sc)
+		}
+	default:
+		l.args(cmd.Args, cmd.Line, sc)
+	}
+}
+
+func (l *linter) args(args []*Arg, line int, sc *lintScope) {
+	for _, arg := range args {
+		l.expr(arg.Value, line, sc)
+	}
+}
+
+func (l *linter) expr(expr Expr, line int, sc *lintScope) {
+	switch x := expr.(type) {
+	case *VarRef:
+		if _, err := parseNum(x.Name); err != nil && !sc.defined(x.Name) {
+			l.fail(x.Line, "undefined variable $%s", x.Name)
+		}
+	case *Interpolation:
+		for _, part := range x.Parts {
+			l.expr(part, line, sc)
+		}
+	case *Unary:
+		l.expr(x.X, line, sc)
+	case *Binary:
+		l.expr(x.X, line, sc)
+		l.expr(x.Y, line, sc)
+	case *Index:
+		l.expr(x.X, line, sc)
+		l.expr(x.Key, line, sc)
+	case *ArrayLiteral:
+		for _, element := range x.Elements {
+			if element.Key != nil {
+				l.expr(element.Key, line, sc)
+			}
+			l.expr(element.Value, line, sc)
+		}
+	case *Substitution:
+		l.command(x.Command, sc)
+	case *Block:
+		l.body(x.Body, newLintScope(sc, false))
+	}
+}
+
+func lintArgName(cmd *Command) string {
+	if len(cmd.Args) == 0 || cmd.Args[0].Name != "" {
+		return ""
+	}
+
+	switch v := cmd.Args[0].Value.(type) {
+	case *Literal:
+		if name, ok := v.Value.(string); ok {
+			return name
+		}
+	case *VarRef:
+		return v.Name
+	}
+
+	return ""
+}
@@ -0,0 +1,713 @@
+package rsc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Command is a single statement: a builtin (:local), a menu command
+	// (/ip firewall address-list add) or a call of a function stored in a variable.
+	Command struct {
+		Line int
+		Path []string // menu path, nil for builtins and calls
+		Name string   // builtin or menu command name, empty for calls
+		Call Expr     // function to call
+		Args []*Arg
+	}
+
+	// Arg is a named (name=value) or positional command argument.
+	Arg struct {
+		Name  string
+		Value Expr
+	}
+
+	Expr interface{}
+
+	Literal struct {
+		Value Value
+	}
+
+	VarRef struct {
+		Line int
+		Name string
+	}
+
+	// Interpolation is a string literal with variable substitutions.
+	Interpolation struct {
+		Parts []Expr
+	}
+
+	Unary struct {
+		Op string
+		X  Expr
+	}
+
+	Binary struct {
+		Op   string
+		X, Y Expr
+	}
+
+	Index struct {
+		X, Key Expr
+	}
+
+	ArrayLiteral struct {
+		Elements []*ArrayElement
+	}
+
+	ArrayElement struct {
+		Key   Expr // nil for positional elements
+		Value Expr
+	}
+
+	// Substitution is a command in square brackets, evaluated to its return value.
+	Substitution struct {
+		Command *Command
+	}
+
+	Block struct {
+		Body []*Command
+	}
+
+	// Error is a parse or runtime error with the script line it occurred on.
+	Error struct {
+		Line int
+		Msg  string
+	}
+)
+
+// menus lists the supported menus with their commands. Intermediate path
+// segments ("ip", "ip firewall") are valid menus without commands.
+var menus = map[string][]string{
+	"":                         {"import"},
+	"ip firewall address-list": {"add", "disable", "enable", "find", "get", "remove", "set"},
+	"tool":                     {"fetch"},
+	"file":                     {"find", "get", "remove"},
+	"system script":            {"add", "find", "get", "remove"},
+}
+
+var blockArgs = map[string]bool{"do": true, "else": true, "on-error": true}
+
+var binaryPrecedence = map[string]int{
+	",":  1,
+	"||": 2, "&&": 3,
+	"|": 4, "^": 5, "&": 6,
+	"=": 7, "!=": 7, "<": 7, ">": 7, "<=": 7, ">=": 7,
+	"<<": 8, ">>": 8,
+	"+": 9, "-": 9, ".": 9,
+	"*": 10, "/": 10, "%": 10,
+}
+
+// operators is ordered so that longer operators are matched first.
+var operators = []string{"||", "&&", "!=", "<=", ">=", "<<", ">>", ",", "|", "^", "&", "=", "<", ">", "+", "-", ".", "*", "/", "%"}
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+	path []string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Parse parses a script into its commands.
+func Parse(src string) (body []*Command, err error) {
+	p := &parser{src: src, line: 1}
+
+	defer func() {
+		if r := recover(); r != nil {
+			parseErr, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			err = parseErr
+		}
+	}()
+
+	body = p.parseBody(0)
+	if !p.eof() {
+		p.fail("unexpected %q", p.peek())
+	}
+
+	return body, nil
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(&Error{Line: p.line, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+
+	return p.src[p.pos]
+}
+
+func (p *parser) peekAt(offset int) byte {
+	if p.pos+offset >= len(p.src) {
+		return 0
+	}
+
+	return p.src[p.pos+offset]
+}
+
+func (p *parser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+
+	return c
+}
+
+func (p *parser) expect(c byte) {
+	if p.peek() != c {
+		if p.eof() {
+			p.fail("expected %q, got end of script", c)
+		}
+		p.fail("expected %q, got %q", c, p.peek())
+	}
+	p.next()
+}
+
+// skipSpaces skips blanks and line continuations, but not line ends.
+func (p *parser) skipSpaces() {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.next()
+		case c == '\\' && (p.peekAt(1) == '\n' || p.peekAt(1) == '\r'):
+			p.next()
+			for p.peek() == '\r' {
+				p.next()
+			}
+			p.next()
+		default:
+			return
+		}
+	}
+}
+
+// skipAll skips blanks and line ends, used inside parentheses and arrays.
+func (p *parser) skipAll() {
+	for {
+		p.skipSpaces()
+		if p.peek() != '\n' {
+			return
+		}
+		p.next()
+	}
+}
+
+func (p *parser) skipLine() {
+	for !p.eof() && p.peek() != '\n' {
+		p.next()
+	}
+}
+
+// parseBody parses commands until the terminator or the end of the script.
+func (p *parser) parseBody(terminator byte) []*Command {
+	path := p.path
+	defer func() { p.path = path }()
+
+	body := make([]*Command, 0)
+	for {
+		p.skipSpaces()
+		switch c := p.peek(); {
+		case p.eof() || (terminator != 0 && c == terminator):
+			return body
+		case c == '\n' || c == ';':
+			p.next()
+			continue
+		case c == '#':
+			p.skipLine()
+			continue
+		}
+
+		if cmd := p.parseCommand(); cmd != nil {
+			body = append(body, cmd)
+		}
+
+		p.skipSpaces()
+		switch c := p.peek(); {
+		case p.eof() || c == '\n' || c == ';' || (terminator != 0 && c == terminator):
+		default:
+			p.fail("unexpected %q after command", c)
+		}
+	}
+}
+
+// parseCommand parses a single command. It returns nil for commands which only change the current menu.
+func (p *parser) parseCommand() *Command {
+	line := p.line
+
+	switch c := p.peek(); {
+	case c == ':':
+		p.next()
+		name := p.readWord()
+		if name == "" {
+			p.fail("expected command name after ':'")
+		}
+		cmd := &Command{Line: line, Name: name}
+		cmd.Args = p.parseArgs(name)
+		return cmd
+	case c == '/':
+		p.next()
+		return p.parseMenuCommand(line, nil)
+	case c == '$':
+		cmd := &Command{Line: line, Call: p.parseVarRef()}
+		cmd.Args = p.parseArgs("")
+		return cmd
+	case c == '{':
+		return &Command{Line: line, Name: "", Args: []*Arg{{Value: p.parseBlock()}}}
+	case isWordChar(c):
+		if p.peekWordIs("do") {
+			p.readWord()
+			cmd := &Command{Line: line, Name: "do"}
+			cmd.Args = p.parseArgs("do")
+			return cmd
+		}
+		return p.parseMenuCommand(line, p.path)
+	default:
+		p.fail("unexpected %q", c)
+		return nil
+	}
+}
+
+func (p *parser) parseMenuCommand(line int, base []string) *Command {
+	// The path is never nil, which marks builtins, so that commands of the root menu such as /import are menu commands.
+	path := append(make([]string, 0, len(base)), base...)
+
+	for {
+		p.skipSpaces()
+		start, startLine := p.pos, p.line
+		word := p.readWord()
+		if word == "" {
+			break
+		}
+		if p.peek() == '=' {
+			p.pos, p.line = start, startLine
+			break
+		}
+
+		candidate := append(append([]string(nil), path...), word)
+		if isMenu(candidate) {
+			path = candidate
+			continue
+		}
+
+		if hasCommand(path, word) {
+			cmd := &Command{Line: line, Path: path, Name: word}
+			saved := p.path
+			p.path = path
+			cmd.Args = p.parseArgs(word)
+			p.path = saved
+			return cmd
+		}
+
+		p.fail("unknown command or menu: /%s", strings.Join(candidate, " "))
+	}
+
+	if !isMenu(path) {
+		p.fail("unknown menu: /%s", strings.Join(path, " "))
+	}
+	p.path = path
+
+	return nil
+}
+
+func (p *parser) parseArgs(command string) []*Arg {
+	args := make([]*Arg, 0)
+	for {
+		p.skipSpaces()
+		switch c := p.peek(); {
+		case p.eof() || c == '\n' || c == ';' || c == ']' || c == '}' || c == ')':
+			return args
+		}
+
+		start, startLine := p.pos, p.line
+		if name := p.readArgName(); name != "" && p.peek() == '=' {
+			p.next()
+			args = append(args, &Arg{Name: name, Value: p.parseArgValue(blockArgs[name])})
+			continue
+		}
+		p.pos, p.line = start, startLine
+
+		isBlock := command == "do" && len(args) == 0
+		args = append(args, &Arg{Value: p.parseArgValue(isBlock)})
+	}
+}
+
+func (p *parser) parseArgValue(isBlock bool) Expr {
+	switch c := p.peek(); c {
+	case '"':
+		return p.parseString()
+	case '$':
+		return p.parseVarRef()
+	case '(':
+		p.next()
+		p.skipAll()
+		x := p.parseExpr(1)
+		p.skipAll()
+		p.expect(')')
+		return x
+	case '[':
+		return p.parseSubstitution()
+	case '{':
+		if isBlock {
+			return p.parseBlock()
+		}
+		return p.parseArray()
+	default:
+		start := p.pos
+		for !p.eof() {
+			c := p.peek()
+			if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ';' || c == ']' || c == '}' || c == ')' {
+				break
+			}
+			p.next()
+		}
+		return &Literal{Value: bareword(p.src[start:p.pos])}
+	}
+}
+
+func (p *parser) parseBlock() *Block {
+	p.expect('{')
+	body := p.parseBody('}')
+	p.expect('}')
+
+	return &Block{Body: body}
+}
+
+func (p *parser) parseSubstitution() *Substitution {
+	p.expect('[')
+	p.skipAll()
+	cmd := p.parseCommand()
+	if cmd == nil {
+		p.fail("expected command in brackets")
+	}
+	p.skipAll()
+	p.expect(']')
+
+	return &Substitution{Command: cmd}
+}
+
+func (p *parser) parseArray() *ArrayLiteral {
+	p.expect('{')
+	array := &ArrayLiteral{Elements: make([]*ArrayElement, 0)}
+
+	for {
+		p.skipAll()
+		if p.peek() == '}' {
+			p.next()
+			return array
+		}
+
+		element := new(ArrayElement)
+		start, startLine := p.pos, p.line
+		switch {
+		case p.peek() == '"':
+			key := p.parseString()
+			p.skipSpaces()
+			if p.peek() == '=' && p.peekAt(1) != '=' {
+				p.next()
+				element.Key = key
+			} else {
+				p.pos, p.line = start, startLine
+			}
+		case isWordChar(p.peek()):
+			if key := p.readWord(); key != "" && p.peek() == '=' {
+				p.next()
+				element.Key = &Literal{Value: key}
+			} else {
+				p.pos, p.line = start, startLine
+			}
+		}
+
+		p.skipAll()
+		element.Value = p.parseExpr(2)
+		array.Elements = append(array.Elements, element)
+
+		p.skipAll()
+		switch p.peek() {
+		case ';':
+			p.next()
+		case '}':
+		default:
+			p.fail("expected ';' or '}' in array, got %q", p.peek())
+		}
+	}
+}
+
+// parseExpr parses a binary expression whose operators bind at least as tight as minPrecedence.
+func (p *parser) parseExpr(minPrecedence int) Expr {
+	x := p.parseUnary()
+
+	for {
+		p.skipAll()
+		op := p.peekOperator()
+		precedence, ok := binaryPrecedence[op]
+		if op == "" || !ok || precedence < minPrecedence {
+			return x
+		}
+		p.pos += len(op)
+		p.skipAll()
+		x = &Binary{Op: op, X: x, Y: p.parseExpr(precedence + 1)}
+	}
+}
+
+func (p *parser) peekOperator() string {
+	rest := p.src[p.pos:]
+	if strings.HasPrefix(rest, "->") {
+		return ""
+	}
+
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op) {
+			return op
+		}
+	}
+
+	return ""
+}
+
+func (p *parser) parseUnary() Expr {
+	switch c := p.peek(); c {
+	case '!', '~':
+		p.next()
+		p.skipAll()
+		return &Unary{Op: string(c), X: p.parseUnary()}
+	case '-':
+		if !isDigit(p.peekAt(1)) {
+			p.next()
+			p.skipAll()
+			return &Unary{Op: "-", X: p.parseUnary()}
+		}
+	}
+
+	return p.parsePostfix(p.parsePrimary())
+}
+
+func (p *parser) parsePostfix(x Expr) Expr {
+	for strings.HasPrefix(p.src[p.pos:], "->") {
+		p.pos += 2
+		x = &Index{X: x, Key: p.parsePrimary()}
+	}
+
+	return x
+}
+
+func (p *parser) parsePrimary() Expr {
+	switch c := p.peek(); {
+	case c == '(':
+		p.next()
+		p.skipAll()
+		x := p.parseExpr(1)
+		p.skipAll()
+		p.expect(')')
+		return x
+	case c == '"':
+		return p.parseString()
+	case c == '$':
+		return p.parseVarRef()
+	case c == '[':
+		return p.parseSubstitution()
+	case c == '{':
+		return p.parseArray()
+	case c == '-' || isDigit(c):
+		start := p.pos
+		if c == '-' {
+			p.next()
+		}
+		for isWordChar(p.peek()) || p.peek() == '.' || p.peek() == '/' || p.peek() == ':' {
+			p.next()
+		}
+		return &Literal{Value: bareword(p.src[start:p.pos])}
+	case isWordChar(c):
+		return &Literal{Value: bareword(p.readWord())}
+	default:
+		if p.eof() {
+			p.fail("unexpected end of script in expression")
+		}
+		p.fail("unexpected %q in expression", c)
+		return nil
+	}
+}
+
+func (p *parser) parseVarRef() *VarRef {
+	line := p.line
+	p.expect('$')
+
+	start := p.pos
+	for isVarChar(p.peek()) {
+		p.next()
+	}
+
+	if start == p.pos {
+		p.fail("expected variable name after '$'")
+	}
+
+	return &VarRef{Line: line, Name: p.src[start:p.pos]}
+}
+
+func (p *parser) parseString() Expr {
+	p.expect('"')
+
+	parts := make([]Expr, 0)
+	var b strings.Builder
+	for {
+		if p.eof() {
+			p.fail("unterminated string")
+		}
+
+		c := p.next()
+		switch c {
+		case '"':
+			if len(parts) == 0 {
+				return &Literal{Value: b.String()}
+			}
+			if b.Len() > 0 {
+				parts = append(parts, &Literal{Value: b.String()})
+			}
+			return &Interpolation{Parts: parts}
+		case '\\':
+			p.parseEscape(&b)
+		case '$':
+			if !isVarChar(p.peek()) {
+				p.fail("unsupported substitution in string")
+			}
+			if b.Len() > 0 {
+				parts = append(parts, &Literal{Value: b.String()})
+				b.Reset()
+			}
+			p.pos--
+			parts = append(parts, p.parseVarRef())
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (p *parser) parseEscape(b *strings.Builder) {
+	if p.eof() {
+		p.fail("unterminated string")
+	}
+
+	c := p.next()
+	switch c {
+	case '"', '\\', '$', '?':
+		b.WriteByte(c)
+	case 'n':
+		b.WriteByte('\n')
+	case 'r':
+		b.WriteByte('\r')
+	case 't':
+		b.WriteByte('\t')
+	case '_':
+		b.WriteByte(' ')
+	case 'a':
+		b.WriteByte('\a')
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'v':
+		b.WriteByte('\v')
+	case '\n':
+		p.skipSpaces()
+	default:
+		if isHexDigit(c) && isHexDigit(p.peek()) {
+			v, _ := strconv.ParseUint(string([]byte{c, p.next()}), 16, 8)
+			b.WriteByte(byte(v))
+			return
+		}
+		p.fail("invalid escape sequence \\%c", c)
+	}
+}
+
+func (p *parser) readWord() string {
+	start := p.pos
+	for isWordChar(p.peek()) {
+		p.next()
+	}
+
+	return p.src[start:p.pos]
+}
+
+func (p *parser) readArgName() string {
+	start := p.pos
+	for isWordChar(p.peek()) || p.peek() == ',' {
+		p.next()
+	}
+
+	return p.src[start:p.pos]
+}
+
+func (p *parser) peekWordIs(word string) bool {
+	rest := p.src[p.pos:]
+	return strings.HasPrefix(rest, word) && !isWordChar(p.peekAt(len(word)))
+}
+
+func bareword(s string) Value {
+	switch {
+	case s == "true":
+		return true
+	case s == "false":
+		return false
+	case strings.HasPrefix(s, "*") && len(s) > 1:
+		return ID(s)
+	}
+
+	if n, err := parseNum(s); err == nil {
+		return n
+	}
+
+	return s
+}
+
+func isMenu(path []string) bool {
+	prefix := strings.Join(path, " ")
+	for menu := range menus {
+		if menu == prefix || strings.HasPrefix(menu, prefix+" ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasCommand(path []string, name string) bool {
+	for _, command := range menus[strings.Join(path, " ")] {
+		if command == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isVarChar(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+func isWordChar(c byte) bool {
+	return isVarChar(c) || c == '-'
+}
@@ -0,0 +1,171 @@
+package rsc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	addressList := []string{"ip", "firewall", "address-list"}
+
+	tests := []struct {
+		name string
+		src  string
+		want []*Command
+	}{
+		{
+			name: "builtin",
+			src:  ":local count 10",
+			want: []*Command{{Line: 1, Name: "local", Args: []*Arg{{Value: &Literal{Value: "count"}}, {Value: &Literal{Value: int64(10)}}}}},
+		},
+		{
+			name: "menu command",
+			src:  `/ip firewall address-list add list=office address="10.0.0.1" disabled=yes`,
+			want: []*Command{{Line: 1, Path: addressList, Name: "add", Args: []*Arg{
+				{Name: "list", Value: &Literal{Value: "office"}},
+				{Name: "address", Value: &Literal{Value: "10.0.0.1"}},
+				{Name: "disabled", Value: &Literal{Value: "yes"}},
+			}}},
+		},
+		{
+			name: "current menu",
+			src:  "/ip firewall address-list\n# entries\nremove *1\n/tool fetch url=\"https://example.com\"",
+			want: []*Command{
+				{Line: 3, Path: addressList, Name: "remove", Args: []*Arg{{Value: &Literal{Value: ID("*1")}}}},
+				{Line: 4, Path: []string{"tool"}, Name: "fetch", Args: []*Arg{{Name: "url", Value: &Literal{Value: "https://example.com"}}}},
+			},
+		},
+		{
+			name: "root menu",
+			src:  "/import file-name=office.rsc",
+			want: []*Command{{Line: 1, Path: []string{}, Name: "import", Args: []*Arg{{Name: "file-name", Value: &Literal{Value: "office.rsc"}}}}},
+		},
+		{
+			name: "precedence",
+			src:  ":put (1 + 2 * 3 = 7 && !$done)",
+			want: []*Command{{Line: 1, Name: "put", Args: []*Arg{{Value: &Binary{
+				Op: "&&",
+				X: &Binary{
+					Op: "=",
+					X:  &Binary{Op: "+", X: &Literal{Value: int64(1)}, Y: &Binary{Op: "*", X: &Literal{Value: int64(2)}, Y: &Literal{Value: int64(3)}}},
+					Y:  &Literal{Value: int64(7)},
+				},
+				Y: &Unary{Op: "!", X: &VarRef{Line: 1, Name: "done"}},
+			}}}}},
+		},
+		{
+			name: "interpolation and escapes",
+			src:  `:log info "list\_$name:\t\"\41\""`,
+			want: []*Command{{Line: 1, Name: "log", Args: []*Arg{
+				{Value: &Literal{Value: "info"}},
+				{Value: &Interpolation{Parts: []Expr{&Literal{Value: "list "}, &VarRef{Line: 1, Name: "name"}, &Literal{Value: ":\t\"A\""}}}},
+			}}},
+		},
+		{
+			name: "array and index",
+			src:  `:put ({"a"=1; b=true; 3}->"a")`,
+			want: []*Command{{Line: 1, Name: "put", Args: []*Arg{{Value: &Index{
+				X: &ArrayLiteral{Elements: []*ArrayElement{
+					{Key: &Literal{Value: "a"}, Value: &Literal{Value: int64(1)}},
+					{Key: &Literal{Value: "b"}, Value: &Literal{Value: true}},
+					{Value: &Literal{Value: int64(3)}},
+				}},
+				Key: &Literal{Value: "a"},
+			}}}}},
+		},
+		{
+			name: "blocks and substitutions",
+			src:  ":do {\n  :put [:len $x]\n} on-error={}",
+			want: []*Command{{Line: 1, Name: "do", Args: []*Arg{
+				{Value: &Block{Body: []*Command{{Line: 2, Name: "put", Args: []*Arg{{Value: &Substitution{Command: &Command{Line: 2, Name: "len", Args: []*Arg{{Value: &VarRef{Line: 2, Name: "x"}}}}}}}}}}},
+				{Name: "on-error", Value: &Block{Body: []*Command{}}},
+			}}},
+		},
+		{
+			name: "function call",
+			src:  "$verify name=office; $done",
+			want: []*Command{
+				{Line: 1, Call: &VarRef{Line: 1, Name: "verify"}, Args: []*Arg{{Name: "name", Value: &Literal{Value: "office"}}}},
+				{Line: 1, Call: &VarRef{Line: 1, Name: "done"}, Args: []*Arg{}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %s, want %s", dump(got), dump(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		wantLine int
+		wantMsg  string
+	}{
+		{name: "unknown menu", src: "/ip firewall filter add", wantLine: 1, wantMsg: "unknown command or menu: /ip firewall filter"},
+		{name: "unknown command", src: "\n/ip firewall address-list print", wantLine: 2, wantMsg: "unknown command or menu: /ip firewall address-list print"},
+		{name: "unterminated string", src: `:put "office`, wantLine: 1, wantMsg: "unterminated string"},
+		{name: "invalid escape", src: `:put "\q"`, wantLine: 1, wantMsg: `invalid escape sequence \q`},
+		{name: "unsupported substitution", src: `:put "$(1)"`, wantLine: 1, wantMsg: "unsupported substitution in string"},
+		{name: "missing variable name", src: ":put $", wantLine: 1, wantMsg: "expected variable name after '$'"},
+		{name: "empty brackets", src: ":put []", wantLine: 1, wantMsg: "unexpected ']'"},
+		{name: "menu in brackets", src: ":put [/ip firewall address-list]", wantLine: 1, wantMsg: "expected command in brackets"},
+		{name: "unclosed block", src: ":do {\n:put 1\n", wantLine: 3, wantMsg: "expected '}'"},
+		{name: "trailing parenthesis", src: ":put (1))", wantLine: 1, wantMsg: "unexpected ')'"},
+		{name: "array separator", src: ":put {1,2 3}", wantLine: 1, wantMsg: "expected ';' or '}' in array"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.src)
+
+			var parseErr *Error
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse() error = %v, want *Error", err)
+			}
+			if parseErr.Line != tt.wantLine || !strings.Contains(parseErr.Msg, tt.wantMsg) {
+				t.Errorf("Parse() error = %v, want line %d: %s", err, tt.wantLine, tt.wantMsg)
+			}
+		})
+	}
+}
+
+// dump formats commands for failure messages, following pointers which %v would print as addresses.
+func dump(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return "nil"
+		}
+		return dump(rv.Elem().Interface())
+	case reflect.Slice:
+		parts := make([]string, rv.Len())
+		for i := range parts {
+			parts[i] = dump(rv.Index(i).Interface())
+		}
+		return "[" + strings.Join(parts, " ") + "]"
+	case reflect.Struct:
+		parts := make([]string, 0, rv.NumField())
+		for i := 0; i < rv.NumField(); i++ {
+			if f := rv.Field(i); !f.IsZero() && rv.Type().Field(i).PkgPath == "" {
+				parts = append(parts, rv.Type().Field(i).Name+":"+dump(f.Interface()))
+			}
+		}
+		return rv.Type().Name() + "{" + strings.Join(parts, " ") + "}"
+	default:
+		return fmt.Sprintf("%q", fmt.Sprint(v))
+	}
+}
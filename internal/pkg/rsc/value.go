@@ -0,0 +1,262 @@
+package rsc
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Value is one of: bool, int64, string, ID, *Array, *Function, Nil or Nothing.
+	Value interface{}
+
+	// ID is an internal item number, such as *1, returned by find and add.
+	ID string
+
+	// Nil is the value of a declared variable that was never set.
+	Nil struct{}
+
+	// Nothing is the value of a missing array element or an unknown command result.
+	Nothing struct{}
+
+	// Function is a block of code stored in a variable, created by do={...} or :parse.
+	Function struct {
+		Body []*Command
+	}
+
+	// Array is a RouterOS array. Positional elements come first, followed by named
+	// elements which, as on RouterOS, are kept sorted by key.
+	Array struct {
+		items []Value
+		keys  []string
+		named map[string]Value
+	}
+)
+
+func NewArray(items ...Value) *Array {
+	return &Array{items: items, named: make(map[string]Value)}
+}
+
+func (a *Array) Len() int {
+	return len(a.items) + len(a.keys)
+}
+
+func (a *Array) Items() []Value {
+	return append([]Value(nil), a.items...)
+}
+
+func (a *Array) Get(key Value) Value {
+	switch k := key.(type) {
+	case int64:
+		if k >= 0 && int(k) < len(a.items) {
+			return a.items[k]
+		}
+	default:
+		if v, ok := a.named[toString(key)]; ok {
+			return v
+		}
+	}
+
+	return Nothing{}
+}
+
+// With returns a copy of the array with key set to value. Arrays are values in
+// RouterOS scripts, so they are never modified in place.
+func (a *Array) With(key, value Value) *Array {
+	c := a.copy()
+
+	if k, ok := key.(int64); ok && k >= 0 {
+		for int(k) >= len(c.items) {
+			c.items = append(c.items, Nothing{})
+		}
+		c.items[k] = value
+		return c
+	}
+
+	name := toString(key)
+	if _, ok := c.named[name]; !ok {
+		c.keys = append(c.keys, name)
+		sort.Strings(c.keys)
+	}
+	c.named[name] = value
+
+	return c
+}
+
+// Concat returns a new array with the elements of both arrays.
+func (a *Array) Concat(b *Array) *Array {
+	c := a.copy()
+	c.items = append(c.items, b.items...)
+	for _, k := range b.keys {
+		c = c.With(k, b.named[k])
+	}
+
+	return c
+}
+
+func (a *Array) each(fn func(key, value Value) error) error {
+	for i, v := range a.items {
+		if err := fn(int64(i), v); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range a.keys {
+		if err := fn(k, a.named[k]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *Array) copy() *Array {
+	c := &Array{
+		items: append([]Value(nil), a.items...),
+		keys:  append([]string(nil), a.keys...),
+		named: make(map[string]Value, len(a.named)),
+	}
+	for k, v := range a.named {
+		c.named[k] = v
+	}
+
+	return c
+}
+
+func (a *Array) String() string {
+	parts := make([]string, 0, a.Len())
+	_ = a.each(func(key, value Value) error {
+		if k, ok := key.(string); ok {
+			parts = append(parts, k+"="+toString(value))
+		} else {
+			parts = append(parts, toString(value))
+		}
+		return nil
+	})
+
+	return strings.Join(parts, ";")
+}
+
+func typeOf(v Value) string {
+	switch v.(type) {
+	case bool:
+		return "bool"
+	case int64:
+		return "num"
+	case string:
+		return "str"
+	case ID:
+		return "id"
+	case *Array:
+		return "array"
+	case *Function:
+		return "code"
+	case Nil:
+		return "nil"
+	default:
+		return "nothing"
+	}
+}
+
+func toString(v Value) string {
+	switch val := v.(type) {
+	case bool:
+		if val {
+			return "true"
+		}
+		return "false"
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case string:
+		return val
+	case ID:
+		return string(val)
+	case *Array:
+		return val.String()
+	case *Function:
+		return "(code)"
+	default:
+		return ""
+	}
+}
+
+func toNum(v Value) (int64, error) {
+	switch val := v.(type) {
+	case int64:
+		return val, nil
+	case string:
+		return parseNum(val)
+	default:
+		return 0, fmt.Errorf("expected number, got %s", typeOf(v))
+	}
+}
+
+func toBool(v Value) (bool, error) {
+	switch val := v.(type) {
+	case bool:
+		return val, nil
+	case string:
+		switch val {
+		case "true", "yes":
+			return true, nil
+		case "false", "no":
+			return false, nil
+		}
+	}
+
+	return false, fmt.Errorf("expected bool, got %s", typeOf(v))
+}
+
+func toArray(v Value) *Array {
+	switch val := v.(type) {
+	case *Array:
+		return val
+	case string:
+		items := make([]Value, 0)
+		for _, item := range strings.Split(val, ",") {
+			items = append(items, item)
+		}
+		return NewArray(items...)
+	case Nil, Nothing:
+		return NewArray()
+	default:
+		return NewArray(v)
+	}
+}
+
+func toID(v Value) (ID, error) {
+	switch val := v.(type) {
+	case ID:
+		return val, nil
+	case string:
+		if strings.HasPrefix(val, "*") {
+			return ID(val), nil
+		}
+	}
+
+	return "", fmt.Errorf("expected item id, got %s", typeOf(v))
+}
+
+func equal(a, b Value) bool {
+	if typeOf(a) != typeOf(b) {
+		return false
+	}
+
+	switch av := a.(type) {
+	case *Array:
+		return av.String() == b.(*Array).String()
+	case *Function:
+		return av == b.(*Function)
+	default:
+		return a == b
+	}
+}
+
+func parseNum(s string) (int64, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return strconv.ParseInt(s[2:], 16, 64)
+	}
+
+	return strconv.ParseInt(s, 10, 64)
+}
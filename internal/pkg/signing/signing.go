@@ -0,0 +1,124 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"mikrotik_provisioning/internal/config"
+)
+
+const (
+	Ed25519Algorithm    = "ed25519"
+	HMACSHA256Algorithm = "hmac-sha256"
+
+	// DeviceMACField names the DeviceMAC in signature files.
+	DeviceMACField = "device-hmac-sha256"
+)
+
+// Signer produces a signature in the "<algorithm>=<base64>" form.
+type Signer interface {
+	Sign(data []byte) string
+}
+
+type ed25519Signer struct {
+	key ed25519.PrivateKey
+}
+
+type hmacSigner struct {
+	secret []byte
+}
+
+func NewSigner(signingConfig *config.Signing) (Signer, error) {
+	key, err := ioutil.ReadFile(signingConfig.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	switch signingConfig.Algorithm {
+	case Ed25519Algorithm:
+		block, _ := pem.Decode(key)
+		if block == nil {
+			return nil, fmt.Errorf("failed to decode PEM block from signing key file: %s", signingConfig.KeyFile)
+		}
+
+		privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		ed25519Key, ok := privateKey.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("signing key is not an ed25519 private key: %s", signingConfig.KeyFile)
+		}
+
+		return NewEd25519Signer(ed25519Key), nil
+	case HMACSHA256Algorithm:
+		return NewHMACSigner([]byte(strings.TrimSpace(string(key)))), nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", signingConfig.Algorithm)
+	}
+}
+
+func NewEd25519Signer(key ed25519.PrivateKey) Signer {
+	return &ed25519Signer{key: key}
+}
+
+func NewHMACSigner(secret []byte) Signer {
+	return &hmacSigner{secret: secret}
+}
+
+func (s *ed25519Signer) Sign(data []byte) string {
+	return Ed25519Algorithm + "=" + base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, data))
+}
+
+func (s *hmacSigner) Sign(data []byte) string {
+	mac := hmac.New(sha256.New, s.secret)
+	_, _ = mac.Write(data)
+
+	return HMACSHA256Algorithm + "=" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Digest returns the hex encoded SHA-256 digest of data, which routers verify before importing a script.
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// DeviceKey derives the key a router verifies scripts with from the signing key, so that it is never
+// stored and changes with the device token. It is hex encoded, as routers can only hold printable strings.
+func DeviceKey(signer Signer, name, token string) string {
+	sum := sha256.Sum256([]byte(signer.Sign([]byte("device-key\x00" + name + "\x00" + token))))
+	return hex.EncodeToString(sum[:])
+}
+
+// DeviceMAC returns the hex encoded HMAC-SHA256 of data with the raw bytes of a key from DeviceKey.
+func DeviceMAC(deviceKey string, data []byte) string {
+	key, _ := hex.DecodeString(deviceKey)
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(data)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureFile returns the signature file served next to a script: the digest first,
+// so routers can pick it from a fixed position, followed by the signature if any and,
+// for a device key, the DeviceMAC the loader of the device verifies.
+func SignatureFile(data []byte, signer Signer, deviceKey string) []byte {
+	out := Digest(data)
+	if signer != nil {
+		out += " " + signer.Sign(data)
+	}
+	if deviceKey != "" {
+		out += " " + DeviceMACField + "=" + DeviceMAC(deviceKey, data)
+	}
+
+	return []byte(out + "\n")
+}
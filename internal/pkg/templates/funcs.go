@@ -0,0 +1,70 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// FuncMap returns the functions available to RSC templates. Every value coming
+// from the API must pass through one of them before it is written into a script.
+func FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"rosquote":  Quote,
+		"rosescape": Escape,
+		"rosbool":   Bool,
+		"rosyesno":  YesNo,
+	}
+}
+
+// Quote returns s as a double-quoted RouterOS string literal.
+func Quote(s string) string {
+	return `"` + Escape(s) + `"`
+}
+
+// Escape escapes s for use inside a double-quoted RouterOS string literal. Variable
+// substitution ($) and command expansion are disabled, and bytes outside of printable
+// ASCII are written as \XX hex escapes.
+func Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\', '"', '$', '?':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&b, `\%02X`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// Bool returns the RouterOS boolean literal for v.
+func Bool(v bool) string {
+	if v {
+		return "true"
+	}
+
+	return "false"
+}
+
+// YesNo returns the RouterOS property value for v, as used by disabled=.
+func YesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+
+	return "no"
+}
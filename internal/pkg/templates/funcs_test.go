@@ -0,0 +1,71 @@
+package templates_test
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+
+	"mikrotik_provisioning/internal/pkg/rsc"
+	"mikrotik_provisioning/internal/pkg/templates"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "office printer, 2nd floor", want: "office printer, 2nd floor"},
+		{name: "quote", in: `say "hi"`, want: `say \"hi\"`},
+		{name: "backslash", in: `a\b`, want: `a\\b`},
+		{name: "substitution", in: "$x $(/system reboot)", want: `\$x \$(/system reboot)`},
+		{name: "question mark", in: "why?", want: `why\?`},
+		{name: "whitespace", in: "a\nb\rc\td", want: `a\nb\rc\td`},
+		{name: "control", in: "a\x01b\x7f", want: `a\01b\7F`},
+		{name: "utf-8", in: "Büro", want: `B\C3\BCro`},
+		{name: "brackets", in: "[:put 1]; {x}", want: "[:put 1]; {x}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := templates.Escape(tt.in); got != tt.want {
+				t.Errorf("Escape(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+
+			// RouterOS reads the quoted string back as it was, without substituting or running anything.
+			quoted := templates.Quote(tt.in)
+			if quoted != `"`+tt.want+`"` {
+				t.Errorf("Quote(%q) = %s, want %q", tt.in, quoted, `"`+tt.want+`"`)
+			}
+			in := rsc.NewInterpreter()
+			if err := in.Run(":log info " + quoted); err != nil {
+				t.Fatalf("Run(%s) error = %v", quoted, err)
+			}
+			if len(in.Logs) != 1 {
+				t.Fatalf("Run(%s) logged %d messages, want 1", quoted, len(in.Logs))
+			}
+			if got := in.Logs[0].Message; got != tt.in {
+				t.Errorf("Run(%s) logged %q, want %q", quoted, got, tt.in)
+			}
+		})
+	}
+}
+
+func TestFuncMap(t *testing.T) {
+	tmpl, err := template.New("entry").Funcs(templates.FuncMap()).Parse(`{{rosquote .Comment}} disabled={{rosyesno .Disabled}} exists={{rosbool .Disabled}}`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, struct {
+		Comment  string
+		Disabled bool
+	}{Comment: `"$x"`, Disabled: true}); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if got, want := out.String(), `"\"\$x\"" disabled=yes exists=true`; got != want {
+		t.Errorf("Execute() = %s, want %s", got, want)
+	}
+}
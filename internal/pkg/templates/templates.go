@@ -0,0 +1,260 @@
+package templates
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/metrics"
+)
+
+// Selector describes the router a script is rendered for.
+type Selector struct {
+	Version int    // RouterOS major version, 0 when unknown
+	Model   string // RouterBOARD model, empty when unknown
+}
+
+// Templates holds a template set per RouterOS variant.
+//
+// The root directory contains the default templates. Subdirectories override them
+// for a RouterOS major version ("v6", "v7"), a device model ("RB4011iGS+") or a model
+// and version combination ("RB4011iGS+/v7"). Only the differing templates need to be
+// provided: a version inherits the root templates, a model inherits the templates of
+// the router's version, and a model and version combination those of the model.
+type Templates struct {
+	variants map[string]*template.Template
+}
+
+// ParseDir parses the templates in dir on top of base, which carries the delimiters.
+// The RouterOS escaping functions from FuncMap are registered for every variant.
+func ParseDir(base *template.Template, dir string) (*Templates, error) {
+	t := &Templates{variants: make(map[string]*template.Template)}
+
+	base, err := base.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := parseVariant(base.Funcs(FuncMap()), dir)
+	if err != nil {
+		return nil, err
+	}
+	t.variants[""] = root
+
+	subdirs, err := listDirs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]string, 0)
+	models := make([]string, 0)
+	for _, name := range subdirs {
+		if !isVersionDir(name) {
+			models = append(models, name)
+			continue
+		}
+
+		variant, err := parseVariant(root, filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		t.variants[variantKey(name)] = variant
+		versions = append(versions, name)
+	}
+
+	for _, name := range models {
+		if err := t.parseModel(root, dir, name, versions); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// parseModel parses the templates of a model once on top of the root, for routers of unknown version, and
+// once on top of every version variant of the root or the model directory.
+func (t *Templates) parseModel(root *template.Template, dir, name string, versions []string) error {
+	modelDir := filepath.Join(dir, name)
+
+	variant, err := parseVariant(root, modelDir)
+	if err != nil {
+		return err
+	}
+	t.variants[variantKey(name)] = variant
+
+	modelVersions, err := listDirs(modelDir)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range modelVersions {
+		if !isVersionDir(version) {
+			return fmt.Errorf("invalid RouterOS version directory: %s", filepath.Join(modelDir, version))
+		}
+		if !contains(versions, version) {
+			versions = append(versions, version)
+		}
+	}
+
+	for _, version := range versions {
+		parent := root
+		if versionVariant, ok := t.variants[variantKey(version)]; ok {
+			parent = versionVariant
+		}
+
+		modelVariant, err := parseVariant(parent, modelDir)
+		if err != nil {
+			return err
+		}
+		if contains(modelVersions, version) {
+			if modelVariant, err = parseVariant(modelVariant, filepath.Join(modelDir, version)); err != nil {
+				return err
+			}
+		}
+		t.variants[variantKey(name, version)] = modelVariant
+	}
+
+	return nil
+}
+
+// Lookup returns the most specific template set for the selector. Templates resolve from the model
+// and version combination to the model, the version and finally the root.
+func (t *Templates) Lookup(selector Selector) *template.Template {
+	candidates := make([]string, 0, 4)
+	version := "v" + strconv.Itoa(selector.Version)
+
+	if selector.Model != "" && selector.Version != 0 {
+		candidates = append(candidates, variantKey(selector.Model, version))
+	}
+	if selector.Model != "" {
+		candidates = append(candidates, variantKey(selector.Model))
+	}
+	if selector.Version != 0 {
+		candidates = append(candidates, variantKey(version))
+	}
+
+	for _, key := range candidates {
+		if variant, ok := t.variants[key]; ok {
+			return variant
+		}
+	}
+
+	return t.variants[""]
+}
+
+// Require returns an error unless every variant defines the named templates.
+func (t *Templates) Require(names ...string) error {
+	if t == nil || len(t.variants) == 0 {
+		return fmt.Errorf("templates are not loaded")
+	}
+
+	for key, variant := range t.variants {
+		for _, name := range names {
+			if variant.Lookup(name) == nil {
+				return fmt.Errorf("missing template %s in variant %q", name, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *Templates) ExecuteTemplate(w io.Writer, selector Selector, name string, data interface{}) error {
+	start := time.Now()
+	err := t.Lookup(selector).ExecuteTemplate(w, name, data)
+	metrics.ObserveRender(name, start, err)
+
+	return err
+}
+
+// ParseVersion extracts the RouterOS major version from values like "7" or "6.48.1".
+func ParseVersion(version string) (int, error) {
+	if i := strings.Index(version, "."); i > -1 {
+		version = version[:i]
+	}
+
+	major, err := strconv.Atoi(version)
+	if err != nil || major < 1 {
+		return 0, fmt.Errorf("invalid RouterOS version: %s", version)
+	}
+
+	return major, nil
+}
+
+func parseVariant(parent *template.Template, dir string) (*template.Template, error) {
+	variant, err := parent.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := listFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return variant, nil
+	}
+
+	return variant.ParseFiles(files...)
+}
+
+func isVersionDir(dir string) bool {
+	if !strings.HasPrefix(dir, "v") {
+		return false
+	}
+
+	_, err := ParseVersion(dir[1:])
+	return err == nil
+}
+
+func variantKey(parts ...string) string {
+	return strings.ToLower(strings.Join(parts, "/"))
+}
+
+func listFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	return files, nil
+}
+
+func listDirs(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+
+	return dirs, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,431 @@
+package templates_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/rsc"
+	"mikrotik_provisioning/internal/pkg/signing"
+	"mikrotik_provisioning/internal/pkg/templates"
+)
+
+// entry is the part of a router address list entry the templates manage.
+type entry struct {
+	List     string
+	Address  string
+	Comment  string
+	Disabled bool
+	Dynamic  bool
+}
+
+func parseTemplates(t *testing.T) *templates.Templates {
+	t.Helper()
+
+	tmpl, err := templates.ParseDir(new(template.Template).Delims("#(", ")#"), "../../../templates")
+	if err != nil {
+		t.Fatalf("ParseDir() error = %v", err)
+	}
+
+	return tmpl
+}
+
+func render(t *testing.T, tmpl *templates.Templates, selector templates.Selector, name string, data interface{}) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&out, selector, name, data); err != nil {
+		t.Fatalf("ExecuteTemplate(%s) error = %v", name, err)
+	}
+	if errs := rsc.Lint(out.String()); len(errs) != 0 {
+		t.Fatalf("Lint(%s) = %v\n%s", name, errs, out.String())
+	}
+
+	return out.String()
+}
+
+func newRouter(t *testing.T, entries []entry) *rsc.Interpreter {
+	t.Helper()
+
+	in := rsc.NewInterpreter()
+	for _, e := range entries {
+		if _, err := in.AddressLists.Add(rsc.AddressListEntry{List: e.List, Address: e.Address, Comment: e.Comment, Disabled: e.Disabled, Dynamic: e.Dynamic}); err != nil {
+			t.Fatalf("Add(%v) error = %v", e, err)
+		}
+	}
+
+	return in
+}
+
+func routerEntries(in *rsc.Interpreter) []entry {
+	entries := make([]entry, 0)
+	for _, e := range in.AddressLists.Entries() {
+		entries = append(entries, entry{List: e.List, Address: e.Address, Comment: e.Comment, Disabled: e.Disabled, Dynamic: e.Dynamic})
+	}
+
+	return entries
+}
+
+func errorLogs(in *rsc.Interpreter) []string {
+	logs := make([]string, 0)
+	for _, l := range in.Logs {
+		if l.Topic == "error" {
+			logs = append(logs, l.Message)
+		}
+	}
+
+	return logs
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"All":          `#(template "A" .)# #(template "B" .)# #(template "C" .)# #(template "D" .)#`,
+		"A":            "root",
+		"B":            "root",
+		"C":            "root",
+		"D":            "root",
+		"v7/B":         "v7",
+		"v7/C":         "v7",
+		"RB4011/C":     "model",
+		"RB4011/v6/B":  "model/v6",
+		"RB4011/v7/D":  "model/v7",
+		"hAP/v7/D":     "hAP/v7",
+		"CCR2004/v8/A": "CCR2004/v8",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	tmpl, err := templates.ParseDir(new(template.Template).Delims("#(", ")#"), dir)
+	if err != nil {
+		t.Fatalf("ParseDir() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		selector templates.Selector
+		want     string
+	}{
+		{name: "unknown router", selector: templates.Selector{}, want: "root root root root"},
+		{name: "version without variant", selector: templates.Selector{Version: 6}, want: "root root root root"},
+		{name: "version", selector: templates.Selector{Version: 7}, want: "root v7 v7 root"},
+		{name: "model of unknown version", selector: templates.Selector{Model: "RB4011"}, want: "root root model root"},
+		{name: "model", selector: templates.Selector{Model: "rb4011", Version: 7}, want: "root v7 model model/v7"},
+		{name: "model and version without root variant", selector: templates.Selector{Model: "RB4011", Version: 6}, want: "root model/v6 model root"},
+		{name: "model without templates", selector: templates.Selector{Model: "hAP", Version: 7}, want: "root v7 v7 hAP/v7"},
+		{name: "model without version", selector: templates.Selector{Model: "hAP", Version: 6}, want: "root root root root"},
+		{name: "version of one model", selector: templates.Selector{Model: "CCR2004", Version: 8}, want: "CCR2004/v8 root root root"},
+		{name: "unknown model", selector: templates.Selector{Model: "RB5009", Version: 7}, want: "root v7 v7 root"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := tmpl.ExecuteTemplate(&out, tt.selector, "All", nil); err != nil {
+				t.Fatalf("ExecuteTemplate() error = %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("ExecuteTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    int
+		wantErr bool
+	}{
+		{version: "7", want: 7},
+		{version: "6.48.1", want: 6},
+		{version: "7.1beta4", want: 7},
+		{version: "", wantErr: true},
+		{version: "0", wantErr: true},
+		{version: "v7", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := templates.ParseVersion(tt.version)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseVersion() = %d, %v, want %d, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetAddressList(t *testing.T) {
+	tmpl := parseTemplates(t)
+
+	list := &address_list.AddressList{
+		Name: "office",
+		Addresses: []*address_list.Address{
+			{Address: "10.0.0.1", Comment: `gateway "main" $1`},
+			{Address: "10.0.1.0/24", Disabled: true},
+			{Address: "vpn.example.com"},
+		},
+	}
+	want := []entry{
+		{List: "office", Address: "10.0.0.1", Comment: `gateway "main" $1`},
+		{List: "office", Address: "10.0.1.0/24", Disabled: true},
+		{List: "office", Address: "vpn.example.com"},
+	}
+
+	tests := []struct {
+		name    string
+		entries []entry
+		want    []entry
+	}{
+		{
+			name: "empty router",
+			want: want,
+		},
+		{
+			// The removal loop once removed $addr, a variable of another loop, and so failed on the first stale entry.
+			name: "stale entries are removed",
+			entries: []entry{
+				{List: "office", Address: "10.9.9.9"},
+				{List: "office", Address: "10.0.0.1", Comment: `gateway "main" $1`},
+				{List: "office", Address: "10.9.9.8", Comment: "old"},
+			},
+			want: []entry{
+				{List: "office", Address: "10.0.0.1", Comment: `gateway "main" $1`},
+				{List: "office", Address: "10.0.1.0/24", Disabled: true},
+				{List: "office", Address: "vpn.example.com"},
+			},
+		},
+		{
+			name: "changed entries are updated in place",
+			entries: []entry{
+				{List: "office", Address: "10.0.1.0/24", Comment: "was enabled"},
+				{List: "office", Address: "10.0.0.1", Disabled: true},
+			},
+			want: []entry{
+				{List: "office", Address: "10.0.1.0/24", Disabled: true},
+				{List: "office", Address: "10.0.0.1", Comment: `gateway "main" $1`},
+				{List: "office", Address: "vpn.example.com"},
+			},
+		},
+		{
+			name: "other lists and dynamic entries are kept",
+			entries: []entry{
+				{List: "lab", Address: "10.9.9.9"},
+				{List: "office", Address: "192.0.2.1", Dynamic: true},
+			},
+			want: []entry{
+				{List: "lab", Address: "10.9.9.9"},
+				{List: "office", Address: "192.0.2.1", Dynamic: true},
+				{List: "office", Address: "10.0.0.1", Comment: `gateway "main" $1`},
+				{List: "office", Address: "10.0.1.0/24", Disabled: true},
+				{List: "office", Address: "vpn.example.com"},
+			},
+		},
+	}
+
+	script := render(t, tmpl, templates.Selector{}, "GetAddressList", list)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := newRouter(t, tt.entries)
+
+			if err := in.Run(script); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if logs := errorLogs(in); len(logs) != 0 {
+				t.Fatalf("Run() logged errors %v", logs)
+			}
+			if got := routerEntries(in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %+v, want %+v", got, tt.want)
+			}
+
+			logs := len(in.Logs)
+			if err := in.Run(script); err != nil {
+				t.Fatalf("second Run() error = %v", err)
+			}
+			if len(in.Logs) != logs {
+				t.Errorf("second Run() logged %v, want no changes", in.Logs[logs:])
+			}
+		})
+	}
+}
+
+func TestGetDeviceFetchScript(t *testing.T) {
+	tmpl := parseTemplates(t)
+
+	lists := []*address_list.AddressList{
+		{Name: "office", Addresses: []*address_list.Address{{Address: "10.0.0.1"}}},
+		{Name: "lab", Addresses: []*address_list.Address{{Address: "10.1.0.0/16", Comment: "lab"}}},
+	}
+	// The stale lab entry the router starts with is removed. Arrays are ordered by key, so lab is added first.
+	initial := []entry{{List: "lab", Address: "10.9.9.9"}}
+	want := []entry{
+		{List: "lab", Address: "10.1.0.0/16", Comment: "lab"},
+		{List: "office", Address: "10.0.0.1"},
+	}
+
+	signer := signing.NewHMACSigner([]byte("signing secret"))
+	key := signing.DeviceKey(signer, "gw-office", "secret")
+
+	tests := []struct {
+		name     string
+		signed   bool
+		tampered bool
+		want     []entry
+	}{
+		{name: "unsigned", want: want},
+		{name: "signed", signed: true, want: want},
+		// The scheduled fetch of a device with signing configured verifies the script like the loader.
+		{name: "tampered", signed: true, tampered: true, want: initial},
+	}
+
+	for _, version := range []int{0, 6, 7} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("version %d %s", version, tt.name), func(t *testing.T) {
+				selector := templates.Selector{Version: version}
+				lists := render(t, tmpl, selector, "GetAddressLists", lists)
+				data := map[string]string{
+					"Subject":             "device",
+					"Name":                "gw-office",
+					"ScriptURL":           "https://provisioning.example.com/device/gw-office/script.rsc",
+					"FileName":            "mtprov-fetch.rsc",
+					"AuthorizationHeader": "Authorization: Token secret",
+				}
+				if tt.signed {
+					data["SignatureURL"] = "https://provisioning.example.com/device/gw-office/script.rsc?format=sig"
+					data["KeyScriptName"] = "mtprov-key"
+					data["MACField"] = signing.DeviceMACField
+				}
+				script := render(t, tmpl, selector, "GetDeviceFetchScript", data)
+
+				in := newRouter(t, initial)
+				in.Scripts["mtprov-key"] = key
+				signature := string(signing.SignatureFile([]byte(lists), signer, key))
+				if tt.tampered {
+					lists += "\n/ip firewall address-list add list=office address=192.0.2.1"
+				}
+				in.Fetch = func(url string, headers []string) (string, error) {
+					if want := []string{"Authorization: Token secret"}; !reflect.DeepEqual(headers, want) {
+						return "", fmt.Errorf("headers = %v, want %v", headers, want)
+					}
+					if strings.HasSuffix(url, "format=sig") {
+						return signature, nil
+					}
+					return lists, nil
+				}
+
+				if err := in.Run(script); err != nil {
+					t.Fatalf("Run() error = %v", err)
+				}
+				if logs := errorLogs(in); (len(logs) != 0) != tt.tampered {
+					t.Fatalf("Run() logged errors %v, want errors %t", logs, tt.tampered)
+				}
+				if got := routerEntries(in); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("entries = %+v, want %+v", got, tt.want)
+				}
+				if len(in.Files) != 0 {
+					t.Errorf("files = %v, want the fetched file removed", in.Files)
+				}
+			})
+		}
+	}
+}
+
+func TestGetAddressListLoader(t *testing.T) {
+	tmpl := parseTemplates(t)
+
+	list := &address_list.AddressList{Name: "office", Addresses: []*address_list.Address{{Address: "10.0.0.1", Comment: "gateway"}}}
+	script := render(t, tmpl, templates.Selector{}, "GetAddressList", list)
+	loader := render(t, tmpl, templates.Selector{}, "GetAddressListLoader", map[string]string{
+		"Subject":       "address-list",
+		"Name":          "office",
+		"ScriptURL":     "https://provisioning.example.com/address-list/office?device=gw-office&format=rsc",
+		"SignatureURL":  "https://provisioning.example.com/address-list/office?device=gw-office&format=sig",
+		"KeyScriptName": "mtprov-key",
+		"MACField":      signing.DeviceMACField,
+	})
+
+	signer := signing.NewHMACSigner([]byte("signing secret"))
+	key := signing.DeviceKey(signer, "gw-office", "token")
+
+	tests := []struct {
+		name      string
+		key       string
+		script    string
+		signature string
+		want      []entry
+	}{
+		{
+			name:      "signed script is imported",
+			key:       key,
+			script:    script,
+			signature: string(signing.SignatureFile([]byte(script), signer, key)),
+			want:      []entry{{List: "office", Address: "10.0.0.1", Comment: "gateway"}},
+		},
+		{
+			name:      "tampered script is refused",
+			key:       key,
+			script:    script + "\n/ip firewall address-list add list=office address=192.0.2.1",
+			signature: string(signing.SignatureFile([]byte(script), signer, key)),
+		},
+		{
+			name:      "digest alone is refused",
+			key:       key,
+			script:    script,
+			signature: string(signing.SignatureFile([]byte(script), signer, "")),
+		},
+		{
+			name:      "script signed for another device is refused",
+			key:       key,
+			script:    script,
+			signature: string(signing.SignatureFile([]byte(script), signer, signing.DeviceKey(signer, "gw-lab", "token"))),
+		},
+		{
+			name:      "router without key refuses",
+			script:    script,
+			signature: string(signing.SignatureFile([]byte(script), signer, key)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := newRouter(t, nil)
+			if tt.key != "" {
+				in.Scripts["mtprov-key"] = tt.key
+			}
+			in.Fetch = func(url string, headers []string) (string, error) {
+				if strings.HasSuffix(url, "format=sig") {
+					return tt.signature, nil
+				}
+				return tt.script, nil
+			}
+
+			if err := in.Run(loader); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			if tt.want == nil {
+				tt.want = []entry{}
+				if logs := errorLogs(in); len(logs) == 0 {
+					t.Errorf("Run() logged no error")
+				}
+			}
+			if got := routerEntries(in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/audit"
+	"mikrotik_provisioning/internal/pkg/logging"
+)
+
+const retryDelay = 5 * time.Second
+
+type (
+	// Source calls notify with the name of every changed address list until the context is done or it fails.
+	Source func(ctx context.Context, notify func(name string)) error
+
+	// Broker notifies watchers of an address list whenever it changes. Notifications only carry the
+	// list name: watchers fetch the current state, so missed or duplicate notifications are harmless.
+	Broker struct {
+		mu       sync.Mutex
+		watchers map[string]map[chan struct{}]struct{}
+		done     chan struct{}
+		closed   bool
+
+		sourceErr   error
+		sourceErrAt time.Time
+	}
+)
+
+func NewBroker() *Broker {
+	return &Broker{watchers: make(map[string]map[chan struct{}]struct{}), done: make(chan struct{})}
+}
+
+// Done is closed when the broker is closed. Watchers must return then, so that the server can shut down.
+func (b *Broker) Done() <-chan struct{} {
+	return b.done
+}
+
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+}
+
+// Subscribe returns a channel which receives a value after each change of the list. Changes made while
+// a value is pending are coalesced. The returned function must be called to unsubscribe.
+func (b *Broker) Subscribe(name string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	if b.watchers[name] == nil {
+		b.watchers[name] = make(map[chan struct{}]struct{})
+	}
+	b.watchers[name][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.watchers[name], ch)
+		if len(b.watchers[name]) == 0 {
+			delete(b.watchers, name)
+		}
+	}
+}
+
+// Notify wakes up all watchers of the list without blocking.
+func (b *Broker) Notify(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.watchers[name] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Write notifies the watchers of changed address lists; it implements audit.Sink, so that the broker
+// can subscribe to the service.
+func (b *Broker) Write(ctx context.Context, event *audit.Event) error {
+	if event.Resource == audit.AddressListResource {
+		b.Notify(event.Name)
+	}
+
+	return nil
+}
+
+// Follow notifies watchers of the changes reported by the source, such as changes made by other replicas.
+// It restarts the source after failures until the context is done.
+func (b *Broker) Follow(ctx context.Context, source Source) {
+	for {
+		err := source(ctx, b.Notify)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			err = fmt.Errorf("change source stopped")
+		}
+		logging.Default().Error("failed to follow address list changes", "error", err)
+
+		b.mu.Lock()
+		b.sourceErr, b.sourceErrAt = err, time.Now()
+		b.mu.Unlock()
+
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CheckHealth fails while the followed source keeps failing.
+func (b *Broker) CheckHealth(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.sourceErr != nil && time.Since(b.sourceErrAt) < 2*retryDelay {
+		return b.sourceErr
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/audit"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	office, unsubscribeOffice := b.Subscribe("office")
+	lab, unsubscribeLab := b.Subscribe("lab")
+	defer unsubscribeLab()
+
+	// Changes made while a notification is pending are coalesced.
+	for i := 0; i < 2; i++ {
+		if err := b.Write(context.Background(), audit.NewEvent(context.Background(), audit.PatchAction, audit.AddressListResource, "office")); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	_ = b.Write(context.Background(), audit.NewEvent(context.Background(), audit.DeleteAction, audit.DeviceResource, "lab"))
+
+	if got := pending(office); got != 1 {
+		t.Errorf("office notifications = %d, want 1", got)
+	}
+	if got := pending(lab); got != 0 {
+		t.Errorf("lab notifications = %d, want 0 for a device named like the list", got)
+	}
+
+	unsubscribeOffice()
+	b.Notify("office")
+	if got := pending(office); got != 0 {
+		t.Errorf("office notifications = %d after unsubscribing, want 0", got)
+	}
+	if _, ok := b.watchers["office"]; ok {
+		t.Errorf("watchers of office kept after the last one unsubscribed")
+	}
+}
+
+func TestBrokerFollow(t *testing.T) {
+	b := NewBroker()
+	office, unsubscribe := b.Subscribe("office")
+	defer unsubscribe()
+
+	if err := b.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("CheckHealth() error = %v before following", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Follow(ctx, func(ctx context.Context, notify func(name string)) error {
+			notify("office")
+			return errors.New("change stream closed")
+		})
+	}()
+
+	select {
+	case <-office:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("office was not notified of the change from the source")
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for b.CheckHealth(context.Background()) == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("CheckHealth() error = nil while the source fails")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Follow() did not return when the context was done")
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker()
+	select {
+	case <-b.Done():
+		t.Fatalf("Done() closed before Close()")
+	default:
+	}
+
+	b.Close()
+	b.Close()
+	select {
+	case <-b.Done():
+	default:
+		t.Errorf("Done() not closed after Close()")
+	}
+}
+
+func pending(ch <-chan struct{}) int {
+	n := 0
+	for {
+		select {
+		case <-ch:
+			n++
+		default:
+			return n
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/audit"
+	"mikrotik_provisioning/internal/pkg/logging"
+)
+
+const (
+	DefaultMaxAttempts = 8
+	DefaultBaseDelay   = time.Second
+	DefaultMaxDelay    = 10 * time.Minute
+	DefaultWorkers     = 4
+
+	queueSize      = 1024
+	requestTimeout = 10 * time.Second
+)
+
+type (
+	Store interface {
+		GetWebhooks(ctx context.Context) ([]*Webhook, error)
+		GetWebhook(ctx context.Context, id string) (*Webhook, error)
+		CreateDeadLetter(ctx context.Context, delivery *Delivery) error
+	}
+
+	// Dispatcher delivers change events to webhooks in the background. Deliveries are queued for a fixed
+	// number of workers. Failed deliveries are queued again after an exponential backoff and stored as dead
+	// letters after the last attempt, when the queue is full, or when the dispatcher is stopped before they
+	// succeed.
+	Dispatcher struct {
+		store       Store
+		client      *http.Client
+		maxAttempts int
+		baseDelay   time.Duration
+		maxDelay    time.Duration
+		workers     int
+
+		events     chan *audit.Event
+		deliveries chan *Delivery
+		done       chan struct{}
+		wg         sync.WaitGroup
+		running    int32
+
+		mu      sync.Mutex
+		stopped bool
+		retries map[*Delivery]*time.Timer
+	}
+)
+
+func NewDispatcher(store Store, maxAttempts int, baseDelay, maxDelay time.Duration, workers int) *Dispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	if baseDelay <= 0 {
+		baseDelay = DefaultBaseDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxDelay
+	}
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	return &Dispatcher{
+		store:       store,
+		client:      &http.Client{Timeout: requestTimeout},
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+		maxDelay:    maxDelay,
+		workers:     workers,
+		events:      make(chan *audit.Event, queueSize),
+		deliveries:  make(chan *Delivery, queueSize),
+		done:        make(chan struct{}),
+		retries:     make(map[*Delivery]*time.Timer),
+	}
+}
+
+// Start fans queued events out to the matching webhooks and starts the workers, until Stop is called.
+func (d *Dispatcher) Start() {
+	for i := 0; i < d.workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+
+	d.wg.Add(1)
+	atomic.StoreInt32(&d.running, 1)
+	go func() {
+		defer d.wg.Done()
+		defer atomic.StoreInt32(&d.running, 0)
+		for {
+			select {
+			case event := <-d.events:
+				d.fanOut(event)
+			case <-d.done:
+				// Queued events are fanned out once more, so that their deliveries become dead letters.
+				for {
+					select {
+					case event := <-d.events:
+						d.fanOut(event)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops dispatching and waits for running delivery attempts. Queued events, queued deliveries and
+// pending retries are stored as dead letters, to be redelivered once the service is back.
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	d.stopped = true
+	for delivery, timer := range d.retries {
+		if timer.Stop() {
+			d.wg.Done()
+			d.abandon(delivery)
+		}
+	}
+	d.retries = nil
+	d.mu.Unlock()
+
+	close(d.done)
+	d.wg.Wait()
+
+	for {
+		select {
+		case delivery := <-d.deliveries:
+			d.abandon(delivery)
+		default:
+			return
+		}
+	}
+}
+
+// CheckHealth fails when the dispatcher is not running or its queue is full.
+func (d *Dispatcher) CheckHealth(ctx context.Context) error {
+	if atomic.LoadInt32(&d.running) == 0 {
+		return errors.New("webhook dispatcher is not running")
+	}
+
+	if len(d.events) == cap(d.events) {
+		return errors.New("webhook queue is full")
+	}
+
+	if len(d.deliveries) == cap(d.deliveries) {
+		return errors.New("webhook delivery queue is full")
+	}
+
+	return nil
+}
+
+// Write queues an event for delivery without blocking; it implements audit.Sink. When the queue is full, the event is dropped.
+func (d *Dispatcher) Write(ctx context.Context, event *audit.Event) error {
+	select {
+	case d.events <- event:
+		return nil
+	default:
+		return fmt.Errorf("webhook queue is full, dropped event %s for %s", EventType(event), event.Name)
+	}
+}
+
+// Redeliver retries a dead letter from the first attempt.
+func (d *Dispatcher) Redeliver(delivery *Delivery) {
+	delivery.Attempts = 0
+	delivery.LastError = ""
+	delivery.FailedAt = nil
+	d.enqueue(delivery)
+}
+
+func (d *Dispatcher) fanOut(event *audit.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	webhooks, err := d.store.GetWebhooks(ctx)
+	cancel()
+	if err != nil {
+		logging.Default().Error("failed to get webhooks", "error", err)
+		return
+	}
+
+	eventType := EventType(event)
+	for _, wh := range webhooks {
+		if !wh.Matches(eventType) {
+			continue
+		}
+
+		d.enqueue(&Delivery{
+			ID:        newDeliveryID(),
+			WebhookID: wh.ID,
+			URL:       wh.URL,
+			Type:      eventType,
+			Event:     event,
+			CreatedAt: time.Now().UTC(),
+		})
+	}
+}
+
+// enqueue queues a delivery for the workers. A delivery which cannot be queued, as the dispatcher is
+// stopped or the queue is full, is stored as a dead letter.
+func (d *Dispatcher) enqueue(delivery *Delivery) {
+	select {
+	case <-d.done:
+		d.abandon(delivery)
+		return
+	default:
+	}
+
+	select {
+	case d.deliveries <- delivery:
+	default:
+		delivery.LastError = "webhook delivery queue is full"
+		d.deadLetter(delivery)
+	}
+}
+
+// work attempts queued deliveries until the dispatcher is stopped.
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+
+		select {
+		case delivery := <-d.deliveries:
+			d.deliver(delivery)
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// deliver attempts a delivery once and schedules a retry if it fails.
+func (d *Dispatcher) deliver(delivery *Delivery) {
+	err := d.attempt(delivery)
+	if err == nil {
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.maxAttempts {
+		d.deadLetter(delivery)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		d.abandon(delivery)
+		return
+	}
+
+	d.wg.Add(1)
+	d.retries[delivery] = time.AfterFunc(d.backoff(delivery.Attempts), func() {
+		defer d.wg.Done()
+
+		d.mu.Lock()
+		delete(d.retries, delivery)
+		d.mu.Unlock()
+
+		d.enqueue(delivery)
+	})
+}
+
+// abandon stores a delivery the dispatcher was stopped before completing as a dead letter.
+func (d *Dispatcher) abandon(delivery *Delivery) {
+	if delivery.LastError == "" {
+		delivery.LastError = "dispatcher stopped before the first attempt"
+	} else {
+		delivery.LastError = "dispatcher stopped after: " + delivery.LastError
+	}
+
+	d.deadLetter(delivery)
+}
+
+// attempt sends the delivery once. The secret is looked up on every attempt, so that deleted
+// webhooks stop receiving retries and changed secrets take effect.
+func (d *Dispatcher) attempt(delivery *Delivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	wh, err := d.store.GetWebhook(ctx, delivery.WebhookID)
+	if err != nil {
+		return err
+	}
+	if wh == nil {
+		return nil
+	}
+
+	body, err := json.Marshal(&Payload{ID: delivery.ID, Type: delivery.Type, Event: delivery.Event})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, "sha256="+Sign(wh.Secret, timestamp, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) deadLetter(delivery *Delivery) {
+	failedAt := time.Now().UTC()
+	delivery.FailedAt = &failedAt
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if err := d.store.CreateDeadLetter(ctx, delivery); err != nil {
+		logging.Default().Error("failed to store dead letter", "delivery", delivery.ID, "error", err)
+	}
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.baseDelay
+	for i := 1; i < attempts && delay < d.maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > d.maxDelay {
+		return d.maxDelay
+	}
+
+	return delay
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>". Receivers should recompute it
+// from the X-Webhook-Timestamp header and the raw body, and reject old timestamps.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newDeliveryID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
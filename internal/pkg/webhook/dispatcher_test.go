@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/audit"
+)
+
+type store struct {
+	webhook *Webhook
+
+	mu          sync.Mutex
+	deadLetters []*Delivery
+}
+
+func (s *store) GetWebhooks(ctx context.Context) ([]*Webhook, error) {
+	return []*Webhook{s.webhook}, nil
+}
+
+func (s *store) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+	return s.webhook, nil
+}
+
+func (s *store) CreateDeadLetter(ctx context.Context, delivery *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deadLetters = append(s.deadLetters, delivery)
+	return nil
+}
+
+func TestDispatcherStopStoresPendingDeliveries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	s := &store{webhook: &Webhook{ID: "1", URL: server.URL, Secret: "secret"}}
+	d := NewDispatcher(s, 3, time.Hour, time.Hour, 1)
+
+	// The events are queued before the dispatcher starts, so that some of them may still be queued on Stop.
+	events := 5
+	for i := 0; i < events; i++ {
+		if err := d.Write(context.Background(), audit.NewEvent(context.Background(), audit.CreateAction, audit.AddressListResource, "office")); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	d.Start()
+
+	done := make(chan struct{})
+	go func() {
+		d.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Stop() did not return")
+	}
+
+	if len(s.deadLetters) != events {
+		t.Fatalf("dead letters = %d, want %d", len(s.deadLetters), events)
+	}
+	for _, delivery := range s.deadLetters {
+		if delivery.FailedAt == nil || delivery.Attempts >= 3 || delivery.LastError == "" {
+			t.Errorf("dead letter = %+v, want a failed delivery with a reason", delivery)
+		}
+	}
+}
+
+func TestDispatcherDeliversWithWorkers(t *testing.T) {
+	var mu sync.Mutex
+	var running, maxRunning, delivered int
+	started := make(chan struct{}, 100)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		started <- struct{}{}
+		<-release
+
+		mu.Lock()
+		running--
+		delivered++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	s := &store{webhook: &Webhook{ID: "1", URL: server.URL, Secret: "secret"}}
+	workers := 2
+	d := NewDispatcher(s, 3, time.Hour, time.Hour, workers)
+	d.Start()
+
+	events := 20
+	for i := 0; i < events; i++ {
+		if err := d.Write(context.Background(), audit.NewEvent(context.Background(), audit.CreateAction, audit.AddressListResource, "office")); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	// Every worker takes a delivery before any is released, then each released request lets a worker
+	// take the next one while the others stay queued.
+	for i := 0; i < events; i++ {
+		select {
+		case <-started:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("delivery %d was not attempted", i+1)
+		}
+		if i >= workers-1 {
+			release <- struct{}{}
+		}
+	}
+	for i := 0; i < workers-1; i++ {
+		release <- struct{}{}
+	}
+	d.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if delivered != events || maxRunning != workers {
+		t.Errorf("delivered = %d with %d at once, want %d with %d at once", delivered, maxRunning, events, workers)
+	}
+	if len(s.deadLetters) != 0 {
+		t.Errorf("dead letters = %d, want 0", len(s.deadLetters))
+	}
+}
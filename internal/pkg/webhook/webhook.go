@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"mikrotik_provisioning/internal/pkg/audit"
+	valid "mikrotik_provisioning/pkg/validator"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+type (
+	// Webhook subscribes a URL to change events. Events are "<resource>.<action>" patterns,
+	// such as "address-list.*" or "device.delete"; no patterns subscribe to every event.
+	Webhook struct {
+		ID        string    `json:"id" validator:"omitempty"`
+		URL       string    `json:"url" validator:"required,url"`
+		Secret    string    `json:"secret,omitempty" validator:"omitempty"`
+		Events    []string  `json:"events,omitempty" validator:"omitempty"`
+		CreatedAt time.Time `json:"created_at" validator:"omitempty"`
+	}
+
+	// Delivery is a change event sent to a webhook. Deliveries which failed every attempt are kept as dead letters.
+	Delivery struct {
+		ID        string       `json:"id"`
+		WebhookID string       `json:"webhook_id"`
+		URL       string       `json:"url"`
+		Type      string       `json:"type"`
+		Event     *audit.Event `json:"event"`
+		Attempts  int          `json:"attempts"`
+		LastError string       `json:"last_error,omitempty"`
+		CreatedAt time.Time    `json:"created_at"`
+		FailedAt  *time.Time   `json:"failed_at,omitempty"`
+	}
+
+	// Payload is the JSON body of a delivery.
+	Payload struct {
+		ID    string       `json:"id"`
+		Type  string       `json:"type"`
+		Event *audit.Event `json:"event"`
+	}
+
+	WebhookRequest struct {
+		*Webhook
+	}
+
+	WebhookResponse struct {
+		*Webhook
+	}
+
+	DeliveryResponse struct {
+		*Delivery
+	}
+)
+
+// EventType returns the type of an event as matched by the event patterns of webhooks.
+func EventType(event *audit.Event) string {
+	return event.Resource + "." + event.Action
+}
+
+// Matches reports whether the webhook subscribes to the event type.
+func (wh *Webhook) Matches(eventType string) bool {
+	if len(wh.Events) == 0 {
+		return true
+	}
+
+	for _, pattern := range wh.Events {
+		if ok, _ := path.Match(pattern, eventType); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (wr *WebhookRequest) Bind(r *http.Request) error {
+	if wr.Webhook == nil {
+		return fmt.Errorf("missing webhook")
+	}
+
+	if err := valid.Struct(wr); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(wr.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url: %s", wr.URL)
+	}
+
+	for _, pattern := range wr.Events {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid event pattern: %s", pattern)
+		}
+	}
+
+	return nil
+}
+
+func (wr *WebhookResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (dr *DeliveryResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
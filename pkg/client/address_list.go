@@ -0,0 +1,226 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	addressListPath = "/address-list"
+	changesPath     = "/changes"
+)
+
+// GetAddressLists returns a page of address lists and the cursor of the next page, if there is one.
+func (c *Client) GetAddressLists(ctx context.Context, options *ListOptions) ([]*AddressList, string, error) {
+	query := url.Values{}
+	if options != nil {
+		setString(query, "prefix", options.Prefix)
+		for key, value := range options.Labels {
+			if value != "" {
+				key += "=" + value
+			}
+			query.Add("label", key)
+		}
+		setPage(query, "name", options.Descending, options.Limit, options.Cursor)
+	}
+
+	addressLists := make([]*AddressList, 0)
+	header, err := c.do(ctx, &request{method: http.MethodGet, path: addressListPath + "/", query: query, out: &addressLists})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return addressLists, header.Get(nextCursorHeader), nil
+}
+
+// GetAllAddressLists follows the cursors of GetAddressLists and returns every matching address list.
+func (c *Client) GetAllAddressLists(ctx context.Context, options *ListOptions) ([]*AddressList, error) {
+	page := ListOptions{}
+	if options != nil {
+		page = *options
+	}
+
+	all := make([]*AddressList, 0)
+	for {
+		addressLists, cursor, err := c.GetAddressLists(ctx, &page)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, addressLists...)
+
+		if cursor == "" {
+			return all, nil
+		}
+		page.Cursor = cursor
+	}
+}
+
+func (c *Client) GetAddressList(ctx context.Context, name string) (*AddressList, error) {
+	addressList := new(AddressList)
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: addressListPath + "/" + url.PathEscape(name), out: addressList}); err != nil {
+		return nil, err
+	}
+
+	return addressList, nil
+}
+
+func (c *Client) CreateAddressList(ctx context.Context, addressList *AddressList) (*AddressList, error) {
+	created := new(AddressList)
+	if _, err := c.do(ctx, &request{method: http.MethodPost, path: addressListPath + "/", in: addressList, out: created}); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// UpdateAddressList replaces the entries and labels of the address list with the name of addressList.
+func (c *Client) UpdateAddressList(ctx context.Context, addressList *AddressList) (*AddressList, error) {
+	updated := new(AddressList)
+	if _, err := c.do(ctx, &request{method: http.MethodPut, path: addressListPath + "/" + url.PathEscape(addressList.Name), in: addressList, out: updated}); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// PatchAddressList adds or removes entries of an address list. Adding an existing entry replaces it.
+func (c *Client) PatchAddressList(ctx context.Context, name string, action Action, addresses []*Address) (*AddressList, error) {
+	in := struct {
+		Action    Action     `json:"action"`
+		Addresses []*Address `json:"addresses"`
+	}{Action: action, Addresses: addresses}
+
+	updated := new(AddressList)
+	if _, err := c.do(ctx, &request{method: http.MethodPatch, path: addressListPath + "/" + url.PathEscape(name), in: in, out: updated}); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (c *Client) AddEntries(ctx context.Context, name string, addresses ...*Address) (*AddressList, error) {
+	return c.PatchAddressList(ctx, name, AddAction, addresses)
+}
+
+func (c *Client) RemoveEntries(ctx context.Context, name string, addresses ...*Address) (*AddressList, error) {
+	return c.PatchAddressList(ctx, name, RemoveAction, addresses)
+}
+
+func (c *Client) DeleteAddressList(ctx context.Context, name string) error {
+	_, err := c.do(ctx, &request{method: http.MethodDelete, path: addressListPath + "/" + url.PathEscape(name)})
+	return err
+}
+
+// GetEntries returns a page of the entries of an address list and the cursor of the next page, if there is one.
+func (c *Client) GetEntries(ctx context.Context, name string, options *EntryOptions) ([]*Address, string, error) {
+	query := url.Values{}
+	if options != nil {
+		setString(query, "address", options.Address)
+		setString(query, "comment", options.Comment)
+		if options.Disabled != nil {
+			query.Set("disabled", strconv.FormatBool(*options.Disabled))
+		}
+		setPage(query, "address", options.Descending, options.Limit, options.Cursor)
+	}
+
+	entries := make([]*Address, 0)
+	header, err := c.do(ctx, &request{method: http.MethodGet, path: addressListPath + "/" + url.PathEscape(name) + "/entries", query: query, out: &entries})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return entries, header.Get(nextCursorHeader), nil
+}
+
+func (c *Client) GetEntry(ctx context.Context, name, address string) (*Address, error) {
+	entry := new(Address)
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: entryPath(name, address), out: entry}); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// PutEntry creates or replaces an entry, and reports whether it was created.
+func (c *Client) PutEntry(ctx context.Context, name string, entry *Address) (*Address, bool, error) {
+	stored := new(Address)
+	req := &request{method: http.MethodPut, path: entryPath(name, entry.Address), in: entry, out: stored}
+	if _, err := c.do(ctx, req); err != nil {
+		return nil, false, err
+	}
+
+	return stored, req.status == http.StatusCreated, nil
+}
+
+func (c *Client) DeleteEntry(ctx context.Context, name, address string) error {
+	_, err := c.do(ctx, &request{method: http.MethodDelete, path: entryPath(name, address)})
+	return err
+}
+
+// ApplyChanges applies all operations, or none of them. If the operations are invalid, the result of
+// every operation is returned along with an *Error with status 422 Unprocessable Entity.
+func (c *Client) ApplyChanges(ctx context.Context, operations []*Operation, dryRun bool) (*ChangeResponse, error) {
+	query := url.Values{}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+
+	in := struct {
+		Operations []*Operation `json:"operations"`
+	}{Operations: operations}
+
+	response := new(ChangeResponse)
+	if _, err := c.do(ctx, &request{method: http.MethodPost, path: changesPath, query: query, in: in, out: response}); err != nil {
+		if response.Results != nil {
+			return response, err
+		}
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// GetAddressListScript returns the RouterOS script of an address list, as fetched by routers.
+func (c *Client) GetAddressListScript(ctx context.Context, name string, options *ScriptOptions) ([]byte, error) {
+	query := scriptQuery(options)
+	query.Set("format", "rsc")
+
+	var script []byte
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: addressListPath + "/" + url.PathEscape(name), query: query, accept: "text/plain", out: &script}); err != nil {
+		return nil, err
+	}
+
+	return script, nil
+}
+
+func entryPath(name, address string) string {
+	return addressListPath + "/" + url.PathEscape(name) + "/entries/" + url.PathEscape(address)
+}
+
+func setString(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+func setPage(query url.Values, field string, descending bool, limit int, cursor string) {
+	if descending {
+		query.Set("sort", "-"+field)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	setString(query, "cursor", cursor)
+}
+
+func scriptQuery(options *ScriptOptions) url.Values {
+	query := url.Values{}
+	if options != nil {
+		setString(query, "version", options.Version)
+		setString(query, "model", options.Model)
+	}
+
+	return query
+}
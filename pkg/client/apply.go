@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+const applyPath = "/apply"
+
+// ManagedByLabel is the label which marks the address lists owned by the manifests of an ApplyRequest.
+const ManagedByLabel = "managed-by"
+
+type (
+	// ApplyRequest declares all address lists owned by ManagedBy. Plan is the ID of a reviewed plan, which
+	// is then applied only if it is still the same.
+	ApplyRequest struct {
+		ManagedBy string         `json:"managed_by"`
+		Prune     bool           `json:"prune,omitempty"`
+		Plan      string         `json:"plan,omitempty"`
+		Lists     []*AddressList `json:"lists"`
+	}
+
+	PlanAction string
+
+	// PlanStep is the change of one address list. Labels are the new labels, if they change.
+	PlanStep struct {
+		Action   PlanAction        `json:"action"`
+		List     string            `json:"list"`
+		Revision int64             `json:"revision,omitempty"`
+		Labels   map[string]string `json:"labels,omitempty"`
+		Added    []*Address        `json:"added,omitempty"`
+		Removed  []*Address        `json:"removed,omitempty"`
+		Changed  []*Address        `json:"changed,omitempty"`
+		Reason   string            `json:"reason,omitempty"`
+	}
+
+	Plan struct {
+		ID        string      `json:"id"`
+		DryRun    bool        `json:"dry_run"`
+		Applied   bool        `json:"applied"`
+		Steps     []*PlanStep `json:"steps"`
+		Unchanged int         `json:"unchanged"`
+	}
+)
+
+const (
+	CreatePlanAction PlanAction = "create"
+	UpdatePlanAction PlanAction = "update"
+	DeletePlanAction PlanAction = "delete"
+	SkipPlanAction   PlanAction = "skip"
+)
+
+// Apply plans, and unless dryRun applies, the changes which bring the address lists of the owner in line
+// with the request. If the request names a plan which no longer matches, an *Error with status
+// 409 Conflict is returned and nothing is changed.
+func (c *Client) Apply(ctx context.Context, apply *ApplyRequest, dryRun bool) (*Plan, error) {
+	query := url.Values{}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+
+	plan := new(Plan)
+	if _, err := c.do(ctx, &request{method: http.MethodPost, path: applyPath, query: query, in: apply, out: plan}); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// Changes reports whether applying the plan changes anything.
+func (p *Plan) Changes() bool {
+	for _, step := range p.Steps {
+		if step.Action != SkipPlanAction {
+			return true
+		}
+	}
+
+	return false
+}
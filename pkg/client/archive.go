@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const (
+	exportPath = "/admin/export"
+	importPath = "/admin/import"
+
+	// ArchiveContentType is the media type of archives, JSON lines of records.
+	ArchiveContentType = "application/x-ndjson"
+)
+
+type (
+	// ImportMode selects how an archive is restored. MergeImport creates and updates what the archive holds;
+	// ReplaceImport also deletes the address lists, devices and API keys it does not hold.
+	ImportMode string
+
+	// ImportCounts is what an import did to the records of one kind.
+	ImportCounts struct {
+		Created int `json:"created"`
+		Updated int `json:"updated"`
+		Deleted int `json:"deleted"`
+		Skipped int `json:"skipped"`
+	}
+
+	ImportResult struct {
+		Mode         ImportMode   `json:"mode"`
+		Version      int          `json:"version"`
+		AddressLists ImportCounts `json:"address_lists"`
+		Devices      ImportCounts `json:"devices"`
+		APIKeys      ImportCounts `json:"api_keys"`
+		AuditEvents  ImportCounts `json:"audit_events"`
+	}
+)
+
+const (
+	MergeImport   ImportMode = "merge"
+	ReplaceImport ImportMode = "replace"
+)
+
+// Export writes an archive of all address lists, devices, API keys and audit events to w as it is received.
+// With secrets, it holds the device tokens and API signing keys, which grant access to the service. An
+// error after part of the archive was written leaves it incomplete, which Import detects.
+func (c *Client) Export(ctx context.Context, w io.Writer, secrets bool) error {
+	query := url.Values{}
+	if secrets {
+		query.Set("secrets", "true")
+	}
+
+	_, err := c.do(ctx, &request{method: http.MethodGet, path: exportPath, query: query, accept: ArchiveContentType, out: w})
+	return err
+}
+
+// Import restores an archive written by Export. The archive is passed whole, as requests are signed over
+// their body. Nothing is written unless the whole archive is valid.
+func (c *Client) Import(ctx context.Context, archive []byte, mode ImportMode) (*ImportResult, error) {
+	query := url.Values{}
+	if mode != "" {
+		query.Set("mode", string(mode))
+	}
+
+	result := new(ImportResult)
+	if _, err := c.do(ctx, &request{method: http.MethodPost, path: importPath, query: query, in: archive, contentType: ArchiveContentType, out: result}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,310 @@
+// Package client is a Go client for the MikroTik provisioning API.
+//
+// Requests are signed with an access and secret key (see package hmacauth) or carry an OIDC bearer
+// token. Failed requests are retried with exponential backoff: requests which the server cannot have
+// processed (a refused connection, or a signature rejected as replayed, e.g. an identical request sent
+// within the same second) always, transport errors and server errors only for idempotent methods. A
+// POST answered with 502 or 504 by a proxy, or whose connection broke, may still have been applied.
+//
+//	c, err := client.New("https://provisioning.example.com", client.WithCredentials(accessKey, secretKey))
+//	if err != nil { ... }
+//	list, err := c.AddEntries(ctx, "blocklist", &client.Address{Address: "192.0.2.1", Comment: "scanner"})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"mikrotik_provisioning/pkg/hmacauth"
+)
+
+const (
+	DefaultRetries    = 3
+	DefaultRetryDelay = time.Second
+	DefaultTimeout    = 30 * time.Second
+
+	nextCursorHeader = "X-Next-Cursor"
+	deviceScheme     = "Token"
+)
+
+type (
+	Client struct {
+		baseURL     *url.URL
+		httpClient  *http.Client
+		accessKey   string
+		secretKey   string
+		bearerToken string
+		retries     int
+		retryDelay  time.Duration
+		userAgent   string
+	}
+
+	Option func(*Client)
+
+	// Error is an error response of the API. Responses without JSON body only carry the status code.
+	Error struct {
+		StatusCode int    `json:"-"`
+		Status     string `json:"status"`
+		Code       int64  `json:"code,omitempty"`
+		Message    string `json:"error,omitempty"`
+	}
+)
+
+// WithHTTPClient sets the HTTP client, e.g. to present a client certificate.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithCredentials signs every request with the access and secret key.
+func WithCredentials(accessKey, secretKey string) Option {
+	return func(c *Client) {
+		c.accessKey, c.secretKey = accessKey, secretKey
+	}
+}
+
+// WithBearerToken sends the OIDC access token with every request.
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.bearerToken = token
+	}
+}
+
+// WithRetries sets how often a failed request is retried, and the delay before the first retry, which doubles
+// with every retry. Delays below a second are raised to a second, as the server rejects a repeated signature
+// within the same second as a replay.
+func WithRetries(retries int, delay time.Duration) Option {
+	return func(c *Client) {
+		c.retries, c.retryDelay = retries, delay
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// New returns a client for the API at baseURL, e.g. "https://provisioning.example.com".
+func New(baseURL string, options ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL: %s", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		retries:    DefaultRetries,
+		retryDelay: DefaultRetryDelay,
+		userAgent:  "mtprov-client",
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	if c.retryDelay < time.Second {
+		c.retryDelay = time.Second
+	}
+
+	return c, nil
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Status, e.Message)
+	}
+
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Status)
+}
+
+// IsNotFound reports whether err is a 404 Not Found response.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict reports whether err is a 409 Conflict response, e.g. a batch of changes racing another update.
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// IsForbidden reports whether err is a 401 Unauthorized or 403 Forbidden response.
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized) || hasStatus(err, http.StatusForbidden)
+}
+
+func hasStatus(err error, status int) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == status
+}
+
+// request describes a call: the JSON body is encoded from in and the response decoded into out. A []byte
+// in is sent as it is, with contentType, and the body of a successful response is copied to an io.Writer
+// out as it is received. The status code of the response is set once it is received.
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	in          interface{}
+	out         interface{}
+	accept      string
+	contentType string
+	deviceToken string
+	status      int
+}
+
+// do sends the request, retrying as described in the package documentation, and returns the response
+// headers. Error responses are returned as *Error.
+func (c *Client) do(ctx context.Context, req *request) (http.Header, error) {
+	var body []byte
+	switch in := req.in.(type) {
+	case nil:
+	case []byte:
+		body = in
+	default:
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		header, retry, err := c.send(ctx, req, body)
+		if err == nil || !retry || attempt >= c.retries {
+			return header, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, req *request, body []byte) (http.Header, bool, error) {
+	u := *c.baseURL
+	u.Path += req.path
+	u.RawQuery = req.query.Encode()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, req.method, u.String(), reader)
+	if err != nil {
+		return nil, false, err
+	}
+
+	accept := req.accept
+	if accept == "" {
+		accept = "application/json"
+	}
+	r.Header.Set("Accept", accept)
+	r.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		contentType := req.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	switch {
+	case req.deviceToken != "":
+		r.Header.Set("Authorization", deviceScheme+" "+req.deviceToken)
+	case c.bearerToken != "":
+		r.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	case c.accessKey != "":
+		if err := hmacauth.SignRequest(r, c.accessKey, c.secretKey, time.Now()); err != nil {
+			return nil, false, err
+		}
+	}
+
+	resp, err := c.httpClient.Do(r)
+	if err != nil {
+		// A cancelled context is final. A refused connection never reached the server, while other
+		// transport errors may happen after the request was processed.
+		return nil, ctx.Err() == nil && (idempotent(req.method) || errors.Is(err, syscall.ECONNREFUSED)), err
+	}
+	defer resp.Body.Close()
+	req.status = resp.StatusCode
+
+	// Once part of a streamed response is written, retrying would write it twice.
+	if w, ok := req.out.(io.Writer); ok && resp.StatusCode < http.StatusBadRequest {
+		if _, err := io.Copy(w, resp.Body); err != nil {
+			return nil, false, err
+		}
+		return resp.Header, false, nil
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ctx.Err() == nil && idempotent(req.method), err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(data, e) != nil || e.Status == "" {
+			e.Status = strings.ToLower(http.StatusText(resp.StatusCode))
+		}
+
+		// Changes rejected as invalid still report the result of every operation.
+		if resp.StatusCode == http.StatusUnprocessableEntity && req.out != nil {
+			_ = json.Unmarshal(data, req.out)
+		}
+
+		// A replayed signature was rejected before the request was processed; retrying signs it anew.
+		replayed := resp.StatusCode == http.StatusForbidden && e.Message == hmacauth.ErrReplayedRequest.Error()
+
+		return resp.Header, replayed || retryable(req.method, resp.StatusCode), e
+	}
+
+	switch out := req.out.(type) {
+	case nil:
+	case *[]byte:
+		*out = data
+	default:
+		if len(data) != 0 {
+			if err := json.Unmarshal(data, out); err != nil {
+				return nil, false, fmt.Errorf("failed to decode response: %s", err)
+			}
+		}
+	}
+
+	return resp.Header, false, nil
+}
+
+// retryable reports whether an error response may be retried. Gateways answer 502 and 504 for requests
+// which the server may have processed, so server errors are only retried for idempotent methods.
+func retryable(method string, status int) bool {
+	return status >= http.StatusInternalServerError && idempotent(method)
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,259 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"mikrotik_provisioning/internal/app"
+	"mikrotik_provisioning/internal/config"
+	"mikrotik_provisioning/internal/pkg/address_list"
+	"mikrotik_provisioning/internal/pkg/http/router"
+	"mikrotik_provisioning/internal/pkg/logging"
+)
+
+const (
+	testAccessKey = "AKIAADMIN"
+	testSecretKey = "admin-secret-key"
+)
+
+// storage keeps address lists in memory, named by their ID.
+type storage struct {
+	app.Storage
+
+	mu    sync.Mutex
+	lists map[string]*address_list.AddressList
+}
+
+func (s *storage) get(id string) *address_list.AddressList {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addressList, ok := s.lists[id]
+	if !ok {
+		return nil
+	}
+	c := *addressList
+	c.Addresses = append([]*address_list.Address(nil), addressList.Addresses...)
+
+	return &c
+}
+
+func (s *storage) put(addressList *address_list.AddressList) *address_list.AddressList {
+	s.mu.Lock()
+	c := *addressList
+	c.ID = c.Name
+	c.Revision++
+	s.lists[c.ID] = &c
+	s.mu.Unlock()
+
+	return s.get(c.ID)
+}
+
+func (s *storage) GetAddressList(ctx context.Context, name string) (*address_list.AddressList, error) {
+	return s.get(name), nil
+}
+
+func (s *storage) GetAddressListByID(ctx context.Context, id string) (*address_list.AddressList, error) {
+	return s.get(id), nil
+}
+
+func (s *storage) CreateAddressList(ctx context.Context, addressList *address_list.AddressList) (*address_list.AddressList, error) {
+	return s.put(addressList), nil
+}
+
+func (s *storage) UpdateAddressList(ctx context.Context, id string, addressList *address_list.AddressList) (*address_list.AddressList, error) {
+	return s.put(addressList), nil
+}
+
+func (s *storage) UpdateEntriesInAddressList(ctx context.Context, action address_list.Action, id string, addresses []*address_list.Address) (*address_list.AddressList, error) {
+	addressList := s.get(id)
+	changed := make(map[string]bool)
+	for _, entry := range addresses {
+		changed[entry.Address] = true
+	}
+
+	kept := make([]*address_list.Address, 0, len(addressList.Addresses))
+	for _, entry := range addressList.Addresses {
+		if !changed[entry.Address] {
+			kept = append(kept, entry)
+		}
+	}
+	if action == address_list.AddAction {
+		kept = append(kept, addresses...)
+	}
+	addressList.Addresses = kept
+
+	return s.put(addressList), nil
+}
+
+// faultyTransport fails the first request it sends as fault describes, and sends the others as they are.
+type faultyTransport struct {
+	next  http.RoundTripper
+	fault string
+	sent  int32
+}
+
+func (t *faultyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if atomic.AddInt32(&t.sent, 1) > 1 {
+		return t.next.RoundTrip(r)
+	}
+
+	switch t.fault {
+	case "refused":
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	case "replayed":
+		// An identical request sent just before uses up the signature.
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		first := r.Clone(r.Context())
+		first.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if resp, err := t.next.RoundTrip(first); err == nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		return t.next.RoundTrip(r)
+	}
+
+	// The server processes the request, but the client does not get its response.
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch t.fault {
+	case "reset":
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	case "bad gateway":
+		return gatewayResponse(r, http.StatusBadGateway), nil
+	default:
+		return gatewayResponse(r, http.StatusGatewayTimeout), nil
+	}
+}
+
+func gatewayResponse(r *http.Request, status int) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       ioutil.NopCloser(strings.NewReader(http.StatusText(status))),
+		Request:    r,
+	}
+}
+
+// newTestClient returns a client of the API served on top of s, whose first request fails as fault describes,
+// and a counter of the requests the API received.
+func newTestClient(t *testing.T, s *storage, fault string) (*Client, *int32) {
+	t.Helper()
+
+	handler, err := router.New(&router.Options{
+		Config: &config.Config{
+			Access: &config.Access{Users: []*config.User{{AccessKey: testAccessKey, SecretKey: testSecretKey, Role: "admin"}}},
+		},
+		Service: app.NewMikrotikProvisioningService(s),
+		Logger:  logging.New(ioutil.Discard, logging.InfoLevel, logging.LogfmtFormat),
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	var received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := New(server.URL,
+		WithHTTPClient(&http.Client{Transport: &faultyTransport{next: server.Client().Transport, fault: fault}}),
+		WithCredentials(testAccessKey, testSecretKey),
+		WithRetries(1, time.Second),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	return c, &received
+}
+
+func TestRetries(t *testing.T) {
+	office := &AddressList{Name: "office", Addresses: []*Address{{Address: "10.0.0.1"}}}
+	create := func(c *Client) error {
+		_, err := c.CreateAddressList(context.Background(), office)
+		return err
+	}
+	get := func(c *Client) error {
+		_, err := c.GetAddressList(context.Background(), "lab")
+		return err
+	}
+	update := func(c *Client) error {
+		_, err := c.UpdateAddressList(context.Background(), &AddressList{Name: "lab", Addresses: []*Address{{Address: "10.1.0.2"}}})
+		return err
+	}
+	add := func(c *Client) error {
+		_, err := c.AddEntries(context.Background(), "lab", &Address{Address: "10.1.0.3"})
+		return err
+	}
+
+	tests := []struct {
+		name         string
+		call         func(c *Client) error
+		fault        string
+		wantStatus   int
+		wantReceived int32
+	}{
+		// Requests which did not reach the server, or were rejected before being processed, are retried.
+		{name: "post refused", call: create, fault: "refused", wantReceived: 1},
+		{name: "patch replayed", call: add, fault: "replayed", wantReceived: 3},
+		// Non-idempotent requests which may have been processed are not.
+		{name: "post reset", call: create, fault: "reset", wantStatus: -1, wantReceived: 1},
+		{name: "post bad gateway", call: create, fault: "bad gateway", wantStatus: http.StatusBadGateway, wantReceived: 1},
+		{name: "post gateway timeout", call: create, fault: "gateway timeout", wantStatus: http.StatusGatewayTimeout, wantReceived: 1},
+		{name: "patch bad gateway", call: add, fault: "bad gateway", wantStatus: http.StatusBadGateway, wantReceived: 1},
+		// Idempotent requests are.
+		{name: "get reset", call: get, fault: "reset", wantReceived: 2},
+		{name: "get bad gateway", call: get, fault: "bad gateway", wantReceived: 2},
+		{name: "put gateway timeout", call: update, fault: "gateway timeout", wantReceived: 2},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := &storage{lists: map[string]*address_list.AddressList{
+				"lab": {ID: "lab", Name: "lab", Addresses: []*address_list.Address{{Address: "10.1.0.1"}}, Revision: 1},
+			}}
+			c, received := newTestClient(t, s, tt.fault)
+
+			err := tt.call(c)
+			var e *Error
+			switch {
+			case tt.wantStatus == 0 && err != nil:
+				t.Fatalf("call error = %v, want none", err)
+			case tt.wantStatus == -1 && (err == nil || errors.As(err, &e)):
+				t.Fatalf("call error = %v, want a transport error", err)
+			case tt.wantStatus > 0 && (!errors.As(err, &e) || e.StatusCode != tt.wantStatus):
+				t.Fatalf("call error = %v, want status %d", err, tt.wantStatus)
+			}
+
+			if got := atomic.LoadInt32(received); got != tt.wantReceived {
+				t.Errorf("server received %d requests, want %d", got, tt.wantReceived)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+const devicePath = "/device"
+
+func (c *Client) GetDevices(ctx context.Context) ([]*Device, error) {
+	devices := make([]*Device, 0)
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: devicePath + "/", out: &devices}); err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+func (c *Client) GetDevice(ctx context.Context, name string) (*Device, error) {
+	dev := new(Device)
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: devicePath + "/" + url.PathEscape(name), out: dev}); err != nil {
+		return nil, err
+	}
+
+	return dev, nil
+}
+
+func (c *Client) CreateDevice(ctx context.Context, dev *Device) (*Device, error) {
+	created := new(Device)
+	if _, err := c.do(ctx, &request{method: http.MethodPost, path: devicePath + "/", in: dev, out: created}); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (c *Client) UpdateDevice(ctx context.Context, dev *Device) (*Device, error) {
+	updated := new(Device)
+	if _, err := c.do(ctx, &request{method: http.MethodPut, path: devicePath + "/" + url.PathEscape(dev.Name), in: dev, out: updated}); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (c *Client) DeleteDevice(ctx context.Context, name string) error {
+	_, err := c.do(ctx, &request{method: http.MethodDelete, path: devicePath + "/" + url.PathEscape(name)})
+	return err
+}
+
+// GetDeviceBootstrap returns the script which sets up a router to fetch its address lists.
+func (c *Client) GetDeviceBootstrap(ctx context.Context, name string, options *ScriptOptions) ([]byte, error) {
+	var script []byte
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: devicePath + "/" + url.PathEscape(name) + "/bootstrap.rsc", query: scriptQuery(options), accept: "text/plain", out: &script}); err != nil {
+		return nil, err
+	}
+
+	return script, nil
+}
+
+// GetDeviceScript fetches the address list script of a router as the router does, with its device token.
+func (c *Client) GetDeviceScript(ctx context.Context, name, token string, options *ScriptOptions) ([]byte, error) {
+	var script []byte
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: devicePath + "/" + url.PathEscape(name) + "/script.rsc", query: scriptQuery(options), accept: "text/plain", deviceToken: token, out: &script}); err != nil {
+		return nil, err
+	}
+
+	return script, nil
+}
@@ -0,0 +1,85 @@
+package client
+
+import "time"
+
+type (
+	Address struct {
+		Address   string     `json:"address"`
+		Disabled  bool       `json:"disabled,omitempty"`
+		Comment   string     `json:"comment,omitempty"`
+		CreatedAt *time.Time `json:"created_at,omitempty"`
+		UpdatedAt *time.Time `json:"updated_at,omitempty"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"` // the entry is left out of reads and scripts from then on
+	}
+
+	AddressList struct {
+		Name      string            `json:"name"`
+		Addresses []*Address        `json:"addresses"`
+		Labels    map[string]string `json:"labels,omitempty"`
+		Revision  int64             `json:"revision,omitempty"`
+	}
+
+	Device struct {
+		Name            string   `json:"name"`
+		Model           string   `json:"model,omitempty"`
+		RouterOSVersion string   `json:"routeros_version,omitempty"`
+		AddressLists    []string `json:"address_lists"`
+		FetchInterval   string   `json:"fetch_interval,omitempty"`
+		Token           string   `json:"token,omitempty"`
+	}
+
+	Action string
+
+	// Operation adds or removes entries of one address list, as part of ApplyChanges.
+	Operation struct {
+		List      string     `json:"list"`
+		Action    Action     `json:"action"`
+		Addresses []*Address `json:"addresses"`
+	}
+
+	OperationResult struct {
+		List      string     `json:"list"`
+		Action    Action     `json:"action"`
+		Added     []*Address `json:"added,omitempty"`
+		Removed   []*Address `json:"removed,omitempty"`
+		Changed   []*Address `json:"changed,omitempty"`
+		Unchanged int        `json:"unchanged"`
+		Error     string     `json:"error,omitempty"`
+	}
+
+	ChangeResponse struct {
+		DryRun  bool               `json:"dry_run"`
+		Applied bool               `json:"applied"`
+		Results []*OperationResult `json:"results"`
+	}
+
+	// ListOptions filters and paginates GetAddressLists. Empty fields match everything.
+	ListOptions struct {
+		Prefix     string
+		Labels     map[string]string // an empty value matches any value of the label
+		Descending bool
+		Limit      int
+		Cursor     string
+	}
+
+	// EntryOptions filters and paginates GetEntries. Address may be an IPv4 network in CIDR notation.
+	EntryOptions struct {
+		Address    string
+		Comment    string
+		Disabled   *bool
+		Descending bool
+		Limit      int
+		Cursor     string
+	}
+
+	// ScriptOptions selects the RouterOS variant a script is rendered for. Empty fields use the default templates.
+	ScriptOptions struct {
+		Version string
+		Model   string
+	}
+)
+
+const (
+	AddAction    Action = "add"
+	RemoveAction Action = "remove"
+)
@@ -0,0 +1,219 @@
+package hmacauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanonicalRequest(t *testing.T) {
+	timestamp := time.Unix(1600000000, 0)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   string
+	}{
+		{
+			name:   "empty body",
+			method: http.MethodGet,
+			target: "/address-list",
+			want:   "GET\n/address-list\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n1600000000",
+		},
+		{
+			name:   "body",
+			method: http.MethodPost,
+			target: "/address-list",
+			body:   `{"a":1}`,
+			want:   "POST\n/address-list\n015abd7f5cc57a2dd94b7590f04ad8084273905ee33ec5cebeae62276a97f862\n1600000000",
+		},
+		{
+			name:   "lower case method",
+			method: "get",
+			target: "/address-list",
+			want:   "GET\n/address-list\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n1600000000",
+		},
+		{
+			name:   "query",
+			method: http.MethodGet,
+			target: "/address-list?prefix=office-&limit=2",
+			want:   "GET\n/address-list?prefix=office-&limit=2\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n1600000000",
+		},
+		{
+			name:   "escaped path",
+			method: http.MethodGet,
+			target: "/address-list/office%2Flab",
+			want:   "GET\n/address-list/office%2Flab\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n1600000000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if got := canonicalRequest(tt.method, requestPath(r), []byte(tt.body), timestamp); got != tt.want {
+				t.Errorf("canonicalRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	key := DeriveKey("secret-key")
+
+	tests := []struct {
+		name     string
+		signedAt time.Time
+		secret   string
+		modify   func(r *http.Request)
+		want     error
+	}{
+		{name: "valid", signedAt: now},
+		{name: "clock behind", signedAt: now.Add(-DefaultWindow)},
+		{name: "clock ahead", signedAt: now.Add(DefaultWindow)},
+		{name: "too old", signedAt: now.Add(-DefaultWindow - time.Second), want: ErrInvalidTimestamp},
+		{name: "too far ahead", signedAt: now.Add(DefaultWindow + time.Second), want: ErrInvalidTimestamp},
+		{name: "wrong secret", signedAt: now, secret: "other-secret-key", want: ErrInvalidSignature},
+		{
+			name:     "bad body hash",
+			signedAt: now,
+			modify: func(r *http.Request) {
+				r.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "lab"}`)).Body
+			},
+			want: ErrInvalidSignature,
+		},
+		{
+			name:     "changed query",
+			signedAt: now,
+			modify:   func(r *http.Request) { r.URL.RawQuery = "dry_run=false" },
+			want:     ErrInvalidSignature,
+		},
+		{
+			name:     "changed timestamp",
+			signedAt: now,
+			modify:   func(r *http.Request) { r.Header.Set(TimestampHeader, "1600000001") },
+			want:     ErrInvalidSignature,
+		},
+		{
+			name:     "missing timestamp",
+			signedAt: now,
+			modify:   func(r *http.Request) { r.Header.Del(TimestampHeader) },
+			want:     ErrInvalidTimestamp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := tt.secret
+			if secret == "" {
+				secret = "secret-key"
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/address-list?dry_run=true", strings.NewReader(`{"name": "office"}`))
+			if err := SignRequest(r, "AKIAEXAMPLE", secret, tt.signedAt); err != nil {
+				t.Fatalf("SignRequest() error = %v", err)
+			}
+			if tt.modify != nil {
+				tt.modify(r)
+			}
+
+			accessKey, signature, err := ParseAuthorization(r)
+			if err != nil || accessKey != "AKIAEXAMPLE" {
+				t.Fatalf("ParseAuthorization() = %s, %v, want AKIAEXAMPLE", accessKey, err)
+			}
+			if err := Verify(r, key, signature, now, DefaultWindow); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRestoresBody(t *testing.T) {
+	now := time.Now()
+	r := httptest.NewRequest(http.MethodPost, "/address-list", strings.NewReader(`{"name": "office"}`))
+	if err := SignRequest(r, "AKIAEXAMPLE", "secret-key", now); err != nil {
+		t.Fatalf("SignRequest() error = %v", err)
+	}
+
+	_, signature, _ := ParseAuthorization(r)
+	for i := 0; i < 2; i++ {
+		if err := Verify(r, DeriveKey("secret-key"), signature, now, DefaultWindow); err != nil {
+			t.Fatalf("Verify() #%d error = %v", i+1, err)
+		}
+	}
+}
+
+func TestParseAuthorization(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        string
+		wantAccessKey string
+		wantSignature string
+		wantErr       error
+	}{
+		{name: "valid", header: "MTP-HMAC-SHA256 Credential=AKIAEXAMPLE, Signature=abc", wantAccessKey: "AKIAEXAMPLE", wantSignature: "abc"},
+		{name: "reordered", header: "MTP-HMAC-SHA256 Signature=abc,Credential=AKIAEXAMPLE", wantAccessKey: "AKIAEXAMPLE", wantSignature: "abc"},
+		{name: "missing", wantErr: ErrMissingAuthorization},
+		{name: "other scheme", header: "Bearer token", wantErr: ErrInvalidAuthorization},
+		{name: "missing signature", header: "MTP-HMAC-SHA256 Credential=AKIAEXAMPLE", wantErr: ErrInvalidAuthorization},
+		{name: "malformed parameter", header: "MTP-HMAC-SHA256 Credential=AKIAEXAMPLE, Signature", wantErr: ErrInvalidAuthorization},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+
+			accessKey, signature, err := ParseAuthorization(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseAuthorization() error = %v, want %v", err, tt.wantErr)
+			}
+			if accessKey != tt.wantAccessKey || signature != tt.wantSignature {
+				t.Errorf("ParseAuthorization() = %s, %s, want %s, %s", accessKey, signature, tt.wantAccessKey, tt.wantSignature)
+			}
+		})
+	}
+}
+
+func TestReplayCache(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	c := NewReplayCache(time.Minute)
+
+	if c.Seen("a", now) {
+		t.Errorf("Seen(a) = true on first use")
+	}
+	if !c.Seen("a", now.Add(time.Second)) {
+		t.Errorf("Seen(a) = false when replayed")
+	}
+	if !c.Seen("a", now.Add(2*time.Minute)) {
+		t.Errorf("Seen(a) = false when replayed within twice the window")
+	}
+	if c.Seen("a", now.Add(2*time.Minute+time.Second)) {
+		t.Errorf("Seen(a) = true after twice the window")
+	}
+}
+
+func TestReplayCacheSweepsOncePerWindow(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	c := NewReplayCache(time.Minute)
+
+	c.Seen("a", now)
+	c.Seen("b", now.Add(30*time.Second))
+	c.Seen("c", now.Add(61*time.Second))
+	c.Seen("d", now.Add(2*time.Minute+time.Millisecond))
+	if _, ok := c.seen["a"]; !ok || len(c.seen) != 4 {
+		t.Errorf("signatures = %d before the next sweep, want 4", len(c.seen))
+	}
+
+	c.Seen("e", now.Add(2*time.Minute+2*time.Second))
+	if _, ok := c.seen["a"]; ok || len(c.seen) != 4 {
+		t.Errorf("signatures = %d after the sweep, want the forgotten one swept", len(c.seen))
+	}
+}
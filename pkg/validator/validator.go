@@ -1,7 +1,11 @@
 package validator
 
 import (
+	"net"
 	"regexp"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
 
 	"gopkg.in/go-playground/validator.v9"
 )
@@ -14,11 +18,35 @@ func addressListNameValidator(fl validator.FieldLevel) bool {
 	return true
 }
 
+func deviceNameValidator(fl validator.FieldLevel) bool {
+	if ok, _ := regexp.MatchString(`^[A-Za-z0-9-]+$`, fl.Field().String()); !ok {
+		return false
+	}
+
+	return true
+}
+
+// deviceModelValidator accepts RouterBOARD model names such as "RB4011iGS+RM" or "CCR2004-16G-2S+".
+func deviceModelValidator(fl validator.FieldLevel) bool {
+	if ok, _ := regexp.MatchString(`^[A-Za-z0-9][A-Za-z0-9+_-]*$`, fl.Field().String()); !ok {
+		return false
+	}
+
+	return true
+}
+
 func commentValidator(fl validator.FieldLevel) bool {
-	if ok, _ := regexp.MatchString(`^[A-Za-zА-Яа-я0-9\s,.:-]+$`, fl.Field().String()); !ok {
+	comment := fl.Field().String()
+	if !utf8.ValidString(comment) {
 		return false
 	}
 
+	for _, r := range comment {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -46,11 +74,51 @@ func mongoDSNValidator(fl validator.FieldLevel) bool {
 	return true
 }
 
+func listenAddressValidator(fl validator.FieldLevel) bool {
+	_, port, err := net.SplitHostPort(fl.Field().String())
+	if err != nil {
+		return false
+	}
+
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 && port != "0" {
+		return false
+	}
+
+	return true
+}
+
+// shared is safe for concurrent use and caches the structs it validated.
+var shared = New()
+
+// New returns a validator which enforces the validator tags, with the validators of this package registered.
+func New() *validator.Validate {
+	v := validator.New()
+	v.SetTagName("validator")
+	if err := RegisterValidators(v); err != nil {
+		panic(err)
+	}
+
+	return v
+}
+
+// Struct validates s against its validator tags.
+func Struct(s interface{}) error {
+	return shared.Struct(s)
+}
+
 func RegisterValidators(v *validator.Validate) error {
 	if err := v.RegisterValidation("address_list_name", addressListNameValidator); err != nil {
 		return err
 	}
 
+	if err := v.RegisterValidation("device_name", deviceNameValidator); err != nil {
+		return err
+	}
+
+	if err := v.RegisterValidation("device_model", deviceModelValidator); err != nil {
+		return err
+	}
+
 	if err := v.RegisterValidation("comment", commentValidator); err != nil {
 		return err
 	}
@@ -67,5 +135,9 @@ func RegisterValidators(v *validator.Validate) error {
 		return err
 	}
 
+	if err := v.RegisterValidation("listen_address", listenAddressValidator); err != nil {
+		return err
+	}
+
 	return nil
 }